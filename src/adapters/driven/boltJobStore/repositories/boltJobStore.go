@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+)
+
+// jobsBucket holds the JSON encoded jobs keyed by their ID
+var jobsBucket = []byte("jobs")
+
+// BoltJobStore implements the JobStorePort interface using an embedded bbolt database file
+type BoltJobStore struct {
+	db *bolt.DB
+}
+
+// Verify interface implementation
+var _ repositories.JobStorePort = (*BoltJobStore)(nil)
+
+// NewBoltJobStore opens (or creates) the job database at the given path
+func NewBoltJobStore(databasePath string) (repositories.JobStorePort, error) {
+	// The timeout avoids blocking forever when another instance holds the database lock
+	db, err := bolt.Open(databasePath, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening job store %s: %w", databasePath, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(jobsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error initializing job store: %w", err)
+	}
+
+	return &BoltJobStore{db: db}, nil
+}
+
+func (s *BoltJobStore) SaveJob(job models.EncodeJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("error encoding job %s: %w", job.ID, err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Put([]byte(job.ID), data)
+	})
+}
+
+func (s *BoltJobStore) GetJob(id string) (models.EncodeJob, error) {
+	var job models.EncodeJob
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get([]byte(id))
+		if data == nil {
+			return repositories.ErrJobNotFound
+		}
+		return json.Unmarshal(data, &job)
+	})
+	return job, err
+}
+
+func (s *BoltJobStore) ListJobs() ([]models.EncodeJob, error) {
+	var jobs []models.EncodeJob
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(key, data []byte) error {
+			var job models.EncodeJob
+			if err := json.Unmarshal(data, &job); err != nil {
+				return fmt.Errorf("error decoding job %s: %w", key, err)
+			}
+			jobs = append(jobs, job)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+
+	return jobs, nil
+}
+
+func (s *BoltJobStore) DeleteJob(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Delete([]byte(id))
+	})
+}
+
+func (s *BoltJobStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"errors"
+	"path"
+	"testing"
+	"time"
+
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+)
+
+func TestBoltJobStore(t *testing.T) {
+	databasePath := path.Join(t.TempDir(), "jobs.db")
+
+	store, err := NewBoltJobStore(databasePath)
+	if err != nil {
+		t.Fatalf("NewBoltJobStore() error = %v", err)
+	}
+
+	now := time.Now()
+	jobs := []models.EncodeJob{
+		{ID: "b", InputStoragePath: "/data/raw/second.mp4", State: models.JobStateRunning, CreatedAt: now.Add(time.Second)},
+		{ID: "a", InputStoragePath: "/data/raw/first.mp4", State: models.JobStateQueued, CreatedAt: now},
+	}
+	for _, job := range jobs {
+		if err := store.SaveJob(job); err != nil {
+			t.Fatalf("SaveJob() error = %v", err)
+		}
+	}
+
+	// Jobs must survive a reopening of the database
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	store, err = NewBoltJobStore(databasePath)
+	if err != nil {
+		t.Fatalf("NewBoltJobStore() error = %v", err)
+	}
+	defer store.Close()
+
+	listed, err := store.ListJobs()
+	if err != nil {
+		t.Fatalf("ListJobs() error = %v", err)
+	}
+	if len(listed) != 2 || listed[0].ID != "a" || listed[1].ID != "b" {
+		t.Errorf("ListJobs() = %v, expected jobs a then b", listed)
+	}
+
+	job, err := store.GetJob("b")
+	if err != nil {
+		t.Fatalf("GetJob() error = %v", err)
+	}
+	if job.InputStoragePath != "/data/raw/second.mp4" || job.State != models.JobStateRunning {
+		t.Errorf("GetJob() = %v, expected the running job b", job)
+	}
+
+	if _, err := store.GetJob("missing"); !errors.Is(err, repositories.ErrJobNotFound) {
+		t.Errorf("GetJob() error = %v, expected ErrJobNotFound", err)
+	}
+
+	if err := store.DeleteJob("a"); err != nil {
+		t.Fatalf("DeleteJob() error = %v", err)
+	}
+	if _, err := store.GetJob("a"); !errors.Is(err, repositories.ErrJobNotFound) {
+		t.Errorf("GetJob() error = %v after DeleteJob(), expected ErrJobNotFound", err)
+	}
+	if err := store.DeleteJob("missing"); err != nil {
+		t.Errorf("DeleteJob() error = %v for a missing job", err)
+	}
+}
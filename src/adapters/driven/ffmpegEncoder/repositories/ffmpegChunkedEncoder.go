@@ -0,0 +1,238 @@
+package repositories
+
+import (
+	"Theatrum/constants"
+	"Theatrum/domain/models"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// chunksDirName is the work directory, inside the output directory, where chunks are encoded before being stitched
+const chunksDirName = ".chunks"
+
+// chunk is a part of the source encoded by its own FFmpeg process
+type chunk struct {
+	// Start of the chunk in seconds, always on a keyframe
+	Start float64
+	// Duration of the chunk in seconds, 0 for the last chunk which runs to the end of the source
+	Duration float64
+}
+
+func addInputRange(args []string, part chunk) []string {
+	args = append(args, "-ss", strconv.FormatFloat(part.Start, 'f', 6, 64))
+	if part.Duration > 0 {
+		args = append(args, "-t", strconv.FormatFloat(part.Duration, 'f', 6, 64))
+	}
+	return args
+}
+
+// addOutputOffset shifts the chunk timestamps so the stitched segments play as one continuous stream
+func addOutputOffset(args []string, part chunk) []string {
+	return append(args, "-output_ts_offset", strconv.FormatFloat(part.Start, 'f', 6, 64))
+}
+
+// encodeChunked splits the source at keyframes, encodes the chunks concurrently and stitches
+// the segments of each chunk into one continuous variant playlist per quality
+func (e *FfmpegEncoder) encodeChunked(ctx context.Context, inputPath string, outputPath string, qualities map[string]models.Quality, distribution models.Distribution, options models.EncodeOptions) error {
+	outputDir := path.Dir(outputPath)
+
+	chunks, duration, err := e.planChunks(inputPath, options.Chunks)
+	if err != nil {
+		return err
+	}
+
+	// Too few keyframes to split the source, encode it in one go
+	if len(chunks) < 2 {
+		options.Chunks = 0
+		return e.encode(ctx, inputPath, outputPath, qualities, distribution, options)
+	}
+
+	workDir := path.Join(outputDir, chunksDirName)
+	if err := os.RemoveAll(workDir); err != nil {
+		return fmt.Errorf("failed to clean chunks directory: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	log.Printf("Encoding %s in %d chunks", inputPath, len(chunks))
+
+	// The threads budget of the job is shared by its chunks
+	if options.Threads > 0 {
+		options.Threads = max(1, options.Threads/len(chunks))
+	}
+
+	// The progress of a chunked encode advances as its chunks finish
+	var progress *progressTracker
+	if options.Progress != nil {
+		progress = newProgressTracker(duration, options.Progress)
+	}
+
+	// The first failing chunk cancels the others
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(chunks))
+	for i, part := range chunks {
+		chunkOutputPath := path.Join(chunkDir(workDir, i), constants.MasterPlaylist)
+		if err := os.MkdirAll(path.Dir(chunkOutputPath), 0755); err != nil {
+			return fmt.Errorf("failed to create chunk directory: %v", err)
+		}
+		args := buildEncodeArgs(inputPath, chunkOutputPath, qualities, distribution, options, &part)
+
+		wg.Add(1)
+		// The last chunk runs to the end of the source
+		partDuration := part.Duration
+		if partDuration == 0 {
+			partDuration = duration - part.Start
+		}
+
+		go func(index int, args []string) {
+			defer wg.Done()
+			if err := e.runFfmpeg(ctx, options.JobID, args, nil); err != nil {
+				errs <- fmt.Errorf("chunk %d: %w", index, err)
+				cancel()
+				return
+			}
+			progress.advance(partDuration)
+		}(i, args)
+	}
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		return err
+	}
+
+	for _, name := range sortedQualityNames(qualities) {
+		if err := stitchVariant(workDir, len(chunks), outputDir, name); err != nil {
+			return fmt.Errorf("failed to stitch quality %s: %v", name, err)
+		}
+	}
+
+	// Variants are referenced by relative paths, so the master playlist of the first chunk applies to the stitched output
+	master, err := os.ReadFile(path.Join(chunkDir(workDir, 0), constants.MasterPlaylist))
+	if err != nil {
+		return fmt.Errorf("failed to read chunk master playlist: %v", err)
+	}
+	if err := os.WriteFile(path.Join(outputDir, constants.MasterPlaylist), master, 0644); err != nil {
+		return fmt.Errorf("failed to write master playlist: %v", err)
+	}
+
+	log.Printf("Successfully encoded video to %s", outputPath)
+	return nil
+}
+
+// planChunks probes the source and splits it at keyframes into at most count chunks, the source duration is returned as well
+func (e *FfmpegEncoder) planChunks(inputPath string, count int) ([]chunk, float64, error) {
+	media, err := e.ProbeVideo(inputPath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	keyframes, err := e.probeKeyframes(inputPath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return splitAtKeyframes(keyframes, media.Duration, count), media.Duration, nil
+}
+
+// probeKeyframes lists the timestamps of the video keyframes, reading packets only (no decoding)
+func (e *FfmpegEncoder) probeKeyframes(inputPath string) ([]float64, error) {
+	args := []string{"-v", "error", "-select_streams", "v:0", "-show_entries", "packet=pts_time,flags", "-of", "csv=p=0", inputPath}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(e.ffprobePath, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var keyframes []float64
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		ptsTime, flags, found := strings.Cut(strings.TrimSpace(line), ",")
+		if !found || !strings.Contains(flags, "K") {
+			continue
+		}
+		if pts, err := strconv.ParseFloat(ptsTime, 64); err == nil {
+			keyframes = append(keyframes, pts)
+		}
+	}
+
+	return keyframes, nil
+}
+
+// splitAtKeyframes cuts the source into count chunks of about the same duration, each chunk starting on a keyframe
+// Fewer chunks are returned when keyframes are too sparse
+func splitAtKeyframes(keyframes []float64, duration float64, count int) []chunk {
+	starts := []float64{0}
+	next := 0
+	for k := 1; k < count; k++ {
+		target := duration * float64(k) / float64(count)
+		for next < len(keyframes) && keyframes[next] < target {
+			next++
+		}
+		if next == len(keyframes) {
+			break
+		}
+		if keyframes[next] > starts[len(starts)-1] {
+			starts = append(starts, keyframes[next])
+		}
+	}
+
+	chunks := make([]chunk, len(starts))
+	for i, start := range starts {
+		chunks[i].Start = start
+		if i+1 < len(starts) {
+			chunks[i].Duration = starts[i+1] - start
+		}
+	}
+	return chunks
+}
+
+func chunkDir(workDir string, index int) string {
+	return path.Join(workDir, fmt.Sprintf("chunk_%03d", index))
+}
+
+// stitchVariant moves the segments of every chunk of a quality into the output directory with a continuous numbering,
+// then writes the variant playlist listing them
+func stitchVariant(workDir string, chunkCount int, outputDir string, name string) error {
+	variantDir := path.Join(outputDir, name)
+	if err := os.MkdirAll(variantDir, 0755); err != nil {
+		return err
+	}
+
+	var stitched []hlsSegment
+	for i := 0; i < chunkCount; i++ {
+		chunkVariantDir := path.Join(chunkDir(workDir, i), name)
+		content, err := os.ReadFile(path.Join(chunkVariantDir, constants.SubPlaylist))
+		if err != nil {
+			return err
+		}
+
+		segments, err := parseMediaPlaylist(string(content))
+		if err != nil {
+			return err
+		}
+
+		for _, segment := range segments {
+			segmentName := fmt.Sprintf(constants.SegmentName, len(stitched))
+			if err := os.Rename(path.Join(chunkVariantDir, segment.URI), path.Join(variantDir, segmentName)); err != nil {
+				return err
+			}
+			stitched = append(stitched, hlsSegment{Duration: segment.Duration, URI: segmentName})
+		}
+	}
+
+	return os.WriteFile(path.Join(variantDir, constants.SubPlaylist), []byte(buildMediaPlaylist(stitched)), 0644)
+}
@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"Theatrum/constants"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitAtKeyframes(t *testing.T) {
+	tests := []struct {
+		name      string
+		keyframes []float64
+		duration  float64
+		count     int
+		expected  []chunk
+	}{
+		{
+			name:      "regular keyframes",
+			keyframes: []float64{0, 2, 4, 6, 8, 10, 12, 14, 16, 18},
+			duration:  20,
+			count:     4,
+			expected:  []chunk{{Start: 0, Duration: 6}, {Start: 6, Duration: 4}, {Start: 10, Duration: 6}, {Start: 16}},
+		},
+		{
+			name:      "sparse keyframes give fewer chunks",
+			keyframes: []float64{0, 15},
+			duration:  20,
+			count:     4,
+			expected:  []chunk{{Start: 0, Duration: 15}, {Start: 15}},
+		},
+		{
+			name:      "single keyframe",
+			keyframes: []float64{0},
+			duration:  20,
+			count:     4,
+			expected:  []chunk{{Start: 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitAtKeyframes(tt.keyframes, tt.duration, tt.count)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("splitAtKeyframes() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestStitchVariant(t *testing.T) {
+	workDir := t.TempDir()
+	outputDir := t.TempDir()
+
+	// Two chunks of the "low" quality, each numbered from zero by FFmpeg
+	chunkPlaylists := []string{
+		"#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:6\n#EXT-X-MEDIA-SEQUENCE:0\n#EXTINF:6.000000,\nsegment_000.ts\n#EXTINF:4.500000,\nsegment_001.ts\n#EXT-X-ENDLIST\n",
+		"#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:7\n#EXT-X-MEDIA-SEQUENCE:0\n#EXTINF:6.400000,\nsegment_000.ts\n#EXT-X-ENDLIST\n",
+	}
+	for i, playlist := range chunkPlaylists {
+		variantDir := path.Join(chunkDir(workDir, i), "low")
+		if err := os.MkdirAll(variantDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path.Join(variantDir, constants.SubPlaylist), []byte(playlist), 0644); err != nil {
+			t.Fatal(err)
+		}
+		segments, err := parseMediaPlaylist(playlist)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, segment := range segments {
+			if err := os.WriteFile(path.Join(variantDir, segment.URI), []byte(playlist), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := stitchVariant(workDir, len(chunkPlaylists), outputDir, "low"); err != nil {
+		t.Fatalf("stitchVariant() error = %v", err)
+	}
+
+	content, err := os.ReadFile(path.Join(outputDir, "low", constants.SubPlaylist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments, err := parseMediaPlaylist(string(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []hlsSegment{
+		{Duration: 6, URI: "segment_000.ts"},
+		{Duration: 4.5, URI: "segment_001.ts"},
+		{Duration: 6.4, URI: "segment_002.ts"},
+	}
+	if !reflect.DeepEqual(segments, expected) {
+		t.Errorf("stitched segments = %v, expected %v", segments, expected)
+	}
+	if !strings.Contains(string(content), "#EXT-X-TARGETDURATION:7\n") {
+		t.Errorf("stitched playlist has wrong target duration:\n%s", content)
+	}
+	if !strings.HasSuffix(string(content), "#EXT-X-ENDLIST\n") {
+		t.Errorf("stitched playlist is not terminated:\n%s", content)
+	}
+
+	// The last segment comes from the second chunk
+	segment, err := os.ReadFile(path.Join(outputDir, "low", "segment_002.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(segment) != chunkPlaylists[1] {
+		t.Errorf("segment_002.ts was not moved from the second chunk")
+	}
+}
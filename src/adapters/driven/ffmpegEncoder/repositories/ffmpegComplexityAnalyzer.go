@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"Theatrum/domain/models"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// complexityExcerptCount is the number of excerpts, spread over the source, encoded by the complexity analysis
+const complexityExcerptCount = 3
+
+func (e *FfmpegEncoder) AnalyzeComplexity(inputPath string, qualities map[string]models.Quality, crf int, sampleSeconds int) (map[string]int64, error) {
+	media, err := e.ProbeVideo(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	if media.Duration <= 0 {
+		return nil, fmt.Errorf("cannot analyze a source without duration")
+	}
+
+	excerpts := complexityExcerpts(media.Duration, float64(sampleSeconds))
+
+	bitrates := make(map[string]int64, len(qualities))
+	for _, name := range sortedQualityNames(qualities) {
+		var totalBytes int64
+		var totalSeconds float64
+		for _, excerpt := range excerpts {
+			size, err := e.encodeExcerpt(inputPath, qualities[name], crf, excerpt)
+			if err != nil {
+				return nil, fmt.Errorf("analysis of quality %s failed: %v", name, err)
+			}
+			totalBytes += size
+			totalSeconds += excerpt.Duration
+		}
+		bitrates[name] = int64(float64(totalBytes*8) / totalSeconds)
+	}
+
+	return bitrates, nil
+}
+
+// complexityExcerpts spreads the analyzed excerpts over the source, or analyzes the whole source when it is short
+func complexityExcerpts(duration float64, sampleSeconds float64) []chunk {
+	if duration <= sampleSeconds {
+		return []chunk{{Start: 0, Duration: duration}}
+	}
+
+	excerptDuration := sampleSeconds / complexityExcerptCount
+	excerpts := make([]chunk, complexityExcerptCount)
+	for i := range excerpts {
+		// Excerpts are centered on 1/6, 3/6 and 5/6 of the source
+		center := duration * float64(2*i+1) / float64(2*complexityExcerptCount)
+		excerpts[i] = chunk{Start: center - excerptDuration/2, Duration: excerptDuration}
+	}
+	return excerpts
+}
+
+// encodeExcerpt encodes an excerpt of the source at the quality resolution and returns the encoded size in bytes
+func (e *FfmpegEncoder) encodeExcerpt(inputPath string, quality models.Quality, crf int, excerpt chunk) (int64, error) {
+	output, err := os.CreateTemp("", "theatrum-complexity-*.mkv")
+	if err != nil {
+		return 0, err
+	}
+	output.Close()
+	defer os.Remove(output.Name())
+
+	args := []string{"-v", "error", "-y"}
+	args = addInputRange(args, excerpt)
+	args = addInput(args, inputPath)
+	args = append(args,
+		"-map", "0:v:0",
+		"-an",
+		"-vf", fmt.Sprintf("scale=%d:%d", quality.Width, quality.Height),
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", strconv.Itoa(crf),
+		"-f", "matroska",
+		output.Name(),
+	)
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(e.ffmpegPath, args...)
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("ffmpeg failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	info, err := os.Stat(output.Name())
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,39 @@
+package repositories
+
+import "testing"
+
+func TestComplexityExcerpts(t *testing.T) {
+	tests := []struct {
+		name          string
+		duration      float64
+		sampleSeconds float64
+		expected      []chunk
+	}{
+		{
+			name:          "short source analyzed whole",
+			duration:      20,
+			sampleSeconds: 30,
+			expected:      []chunk{{Start: 0, Duration: 20}},
+		},
+		{
+			name:          "excerpts spread over the source",
+			duration:      600,
+			sampleSeconds: 30,
+			expected:      []chunk{{Start: 95, Duration: 10}, {Start: 295, Duration: 10}, {Start: 495, Duration: 10}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := complexityExcerpts(tt.duration, tt.sampleSeconds)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("complexityExcerpts() = %v, expected %v", got, tt.expected)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("complexityExcerpts() = %v, expected %v", got, tt.expected)
+				}
+			}
+		})
+	}
+}
@@ -4,46 +4,82 @@ import (
 	"Theatrum/constants"
 	"Theatrum/domain/models"
 	"Theatrum/domain/repositories"
+	"Theatrum/domain/utils"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // FfmpegEncoder implements the EncoderPort interface using FFmpeg
 type FfmpegEncoder struct {
-	ffmpegPath string
-	DryRun     bool // If true, only print the command, do not execute
+	ffmpegPath  string
+	ffprobePath string
+	DryRun      bool // If true, only print the command, do not execute
+
+	vmafOnce      sync.Once
+	vmafAvailable bool
+
+	versionOnce sync.Once
+	version     string
+	versionErr  error
+
+	processes processRegistry
 }
 
 // NewFfmpegEncoder creates a new instance of FfmpegEncoder
 func NewFfmpegEncoder() repositories.EncoderPort {
-	return &FfmpegEncoder{ffmpegPath: "ffmpeg"}
+	return &FfmpegEncoder{ffmpegPath: "ffmpeg", ffprobePath: "ffprobe"}
 }
 
 func addInput(args []string, inputPath string) []string {
 	return append(args, "-i", inputPath)
 }
 
-func addFilter(args []string, qualities map[string]models.Quality) []string {
+// sortedQualityNames returns the quality names in a stable order, so every argument builder uses the same stream indexes
+func sortedQualityNames(qualities map[string]models.Quality) []string {
+	names := make([]string, 0, len(qualities))
+	for name := range qualities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func addFilter(args []string, names []string, qualities map[string]models.Quality, passthrough map[string]bool) []string {
+	// Only re-encoded qualities go through the scaler
+	encodedIndexes := make([]int, 0, len(names))
+	for index, name := range names {
+		if !passthrough[name] {
+			encodedIndexes = append(encodedIndexes, index)
+		}
+	}
+	if len(encodedIndexes) == 0 {
+		return args
+	}
+
 	// Start building the filter complex string
-	filterComplex := "[0:v]split=" + fmt.Sprintf("%d", len(qualities))
+	filterComplex := "[0:v]split=" + fmt.Sprintf("%d", len(encodedIndexes))
 	
 	// Add input labels for each split
-	for i := 0; i < len(qualities); i++ {
-		filterComplex += fmt.Sprintf("[v%d]", i)
+	for _, index := range encodedIndexes {
+		filterComplex += fmt.Sprintf("[v%d]", index)
 	}
 	filterComplex += ";"
 	
 	// Add scale filters for each quality
-	index := 0
-	for _, quality := range qualities {
+	for _, index := range encodedIndexes {
+		quality := qualities[names[index]]
 		filterComplex += fmt.Sprintf("[v%d]scale=%d:%d[v%dout];", index, quality.Width, quality.Height, index)
-		index++
 	}
 
 	// Remove the trailing semicolon
@@ -55,13 +91,16 @@ func addFilter(args []string, qualities map[string]models.Quality) []string {
 	return args
 }
 
-func addVideoCodec(args []string, qualities map[string]models.Quality) []string {
-	index := 0
-	for _, quality := range qualities {
-		// Parse bitrate string to float (remove 'k' and convert)
-		bitrateStr := strings.TrimSuffix(quality.Bitrate, "k")
-		bitrate, _ := strconv.ParseFloat(bitrateStr, 64)
-		
+func addVideoCodec(args []string, names []string, qualities map[string]models.Quality, passthrough map[string]bool) []string {
+	for index, name := range names {
+		quality := qualities[name]
+
+		// Remux the source video stream as is
+		if passthrough[name] {
+			args = append(args, "-map", "0:v:0", fmt.Sprintf("-c:v:%d", index), "copy")
+			continue
+		}
+
 		// Add mapping for video stream
 		args = append(args, "-map", fmt.Sprintf("[v%dout]", index))
 		
@@ -69,45 +108,53 @@ func addVideoCodec(args []string, qualities map[string]models.Quality) []string
 		args = append(args,
 			fmt.Sprintf("-c:v:%d", index), "libx264",
 			fmt.Sprintf("-b:v:%d", index), quality.Bitrate,
-			fmt.Sprintf("-maxrate:v:%d", index), fmt.Sprintf("%.0fk", bitrate*0.6666667),
-			fmt.Sprintf("-bufsize:v:%d", index), quality.Bitrate,
 		)
-		index++
+
+		// The bitrates are validated with the configuration, in any notation such as "800k" or "2.5M"
+		if bitrate, err := utils.ParseBitrate(quality.Bitrate); err == nil {
+			args = append(args, fmt.Sprintf("-maxrate:v:%d", index), utils.FormatBitrate(bitrate*2/3))
+		}
+		args = append(args, fmt.Sprintf("-bufsize:v:%d", index), quality.Bitrate)
 	}
 	return args
 }
 
-func addAudioCodec(args []string, qualities map[string]models.Quality) []string {
-	index := 0
-	for _, quality := range qualities {
+func addAudioCodec(args []string, names []string, qualities map[string]models.Quality, passthrough map[string]bool) []string {
+	for index, name := range names {
+		quality := qualities[name]
+
+		// Remux the source audio stream as is
+		if passthrough[name] {
+			args = append(args, "-map", "a:0", fmt.Sprintf("-c:a:%d", index), "copy")
+			continue
+		}
+
 		args = append(args,
 			"-map", "a:0",
 			fmt.Sprintf("-c:a:%d", index), quality.Audio.Codec,
 			fmt.Sprintf("-b:a:%d", index), quality.Audio.Bitrate,
 		)
-		index++
 	}
 	return args
 }
 
-func addMuxing(args []string, outputPath string, distribution models.Distribution, qualities map[string]models.Quality) []string {
+func addMuxing(args []string, outputPath string, distribution models.Distribution, names []string) []string {
 	outputDir := filepath.Dir(outputPath)
 
 	// Generate the stream_map
 	streamMap := ""
-	index := 0
-	for qualityName := range qualities {
+	for index, qualityName := range names {
 		if index > 0 {
 			streamMap += " "
 		}
 		streamMap += fmt.Sprintf("v:%d,a:%d,name:%s", index, index, qualityName)
-		index++
 	}
 
 	// Add HLS parameters
 	args = append(args,
 		"-f", "hls",
 		"-hls_time", fmt.Sprintf("%d", distribution.Hls.SegmentDuration),
+		"-hls_playlist_type", "vod", // Keep every segment in the playlists
 		"-var_stream_map", streamMap,
 		"-hls_segment_filename", path.Join(outputDir, "%v", constants.SegmentName),
 		"-master_pl_name", constants.MasterPlaylist,
@@ -117,19 +164,46 @@ func addMuxing(args []string, outputPath string, distribution models.Distributio
 	return args
 }
 
-func (e *FfmpegEncoder) EncodeVideo(inputPath string, outputPath string, qualities map[string]models.Quality, distribution models.Distribution) error {
+func (e *FfmpegEncoder) EncodeVideo(ctx context.Context, inputPath string, outputPath string, qualities map[string]models.Quality, distribution models.Distribution, options models.EncodeOptions) error {
 	// Ensure output directory exists
 	outputDir := path.Dir(outputPath)
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		return fmt.Errorf("failed to create output directory: %v", err)
 	}
 
-	args := []string{}
-	args = addInput(args, inputPath)
-	args = addFilter(args, qualities)
-	args = addVideoCodec(args, qualities)
-	args = addAudioCodec(args, qualities)
-	args = addMuxing(args, outputPath, distribution, qualities)
+	if options.KeepRenditions == nil || e.DryRun {
+		return e.encode(ctx, inputPath, outputPath, qualities, distribution, options)
+	}
+
+	// FFmpeg only lists the encoded qualities in the master playlist, the kept ones are taken from the previous master playlist
+	masterPath := path.Join(outputDir, constants.MasterPlaylist)
+	encoded := []byte{}
+	if len(qualities) > 0 {
+		if err := e.encode(ctx, inputPath, outputPath, qualities, distribution, options); err != nil {
+			return err
+		}
+		var err error
+		if encoded, err = os.ReadFile(masterPath); err != nil {
+			return fmt.Errorf("failed to read master playlist: %v", err)
+		}
+	}
+
+	master := mergeMasterPlaylists(options.PreviousMaster, string(encoded), options.KeepRenditions)
+	if err := os.WriteFile(masterPath, []byte(master), 0644); err != nil {
+		return fmt.Errorf("failed to write master playlist: %v", err)
+	}
+
+	log.Printf("Updated master playlist %s", masterPath)
+	return nil
+}
+
+// encode encodes the source into the given qualities, in chunks when enabled
+func (e *FfmpegEncoder) encode(ctx context.Context, inputPath string, outputPath string, qualities map[string]models.Quality, distribution models.Distribution, options models.EncodeOptions) error {
+	if options.Chunks > 1 && !e.DryRun {
+		return e.encodeChunked(ctx, inputPath, outputPath, qualities, distribution, options)
+	}
+
+	args := buildEncodeArgs(inputPath, outputPath, qualities, distribution, options, nil)
 
 	if e.DryRun {
 		log.Printf("Prepared FFmpeg command: \n%s %s\n\n", e.ffmpegPath, strings.Join(args, " "))
@@ -138,21 +212,133 @@ func (e *FfmpegEncoder) EncodeVideo(inputPath string, outputPath string, qualiti
 		return nil
 	}
 
+	var onProgress func(seconds float64)
+	if tracker := e.newProgressTracker(inputPath, options); tracker != nil {
+		onProgress = tracker.update
+	}
+
+	if err := e.runFfmpeg(ctx, options.JobID, args, onProgress); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully encoded video to %s", outputPath)
+	return nil
+}
+
+// newProgressTracker probes the source duration to report the progress of an encode, nil when it is not requested or unknown
+func (e *FfmpegEncoder) newProgressTracker(inputPath string, options models.EncodeOptions) *progressTracker {
+	if options.Progress == nil {
+		return nil
+	}
+
+	media, err := e.ProbeVideo(inputPath)
+	if err != nil || media.Duration <= 0 {
+		log.Printf("Error probing duration of %s, progress is not reported: %v", inputPath, err)
+		return nil
+	}
+	return newProgressTracker(media.Duration, options.Progress)
+}
+
+// addThreads limits the threads used by the encoders, so concurrent jobs do not oversubscribe the CPUs
+func addThreads(args []string, threads int) []string {
+	if threads <= 0 {
+		return args
+	}
+	return append(args, "-threads", strconv.Itoa(threads))
+}
+
+// buildEncodeArgs builds the FFmpeg arguments encoding the whole source, or only a chunk of it when one is given
+func buildEncodeArgs(inputPath string, outputPath string, qualities map[string]models.Quality, distribution models.Distribution, options models.EncodeOptions, part *chunk) []string {
+	names := sortedQualityNames(qualities)
+
+	args := []string{}
+	if part != nil {
+		args = addInputRange(args, *part)
+	}
+	args = addInput(args, inputPath)
+	args = addFilter(args, names, qualities, options.Passthrough)
+	args = addVideoCodec(args, names, qualities, options.Passthrough)
+	args = addAudioCodec(args, names, qualities, options.Passthrough)
+	if part != nil {
+		args = addOutputOffset(args, *part)
+	}
+	args = addThreads(args, options.Threads)
+	args = addMuxing(args, outputPath, distribution, names)
+
+	return args
+}
+
+// runFfmpeg executes FFmpeg with the given arguments for a job, the process is killed if the context is canceled
+// onProgress, when set, receives the encoded duration in seconds
+func (e *FfmpegEncoder) runFfmpeg(ctx context.Context, jobID string, args []string, onProgress func(seconds float64)) error {
+	if onProgress != nil {
+		args = append(append([]string{}, progressArgs...), args...)
+	}
+
 	// Prepare the command
-	cmd := exec.Command(e.ffmpegPath, args...)
+	cmd := exec.CommandContext(ctx, e.ffmpegPath, args...)
 
-	// Redirect output to see FFmpeg logs
+	// Redirect output to see FFmpeg logs, and keep its end to report failures
+	stderr := &tailWriter{}
 	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
+	if onProgress != nil {
+		cmd.Stdout = &progressWriter{onUpdate: onProgress}
+	}
 
 	log.Printf("Executing FFmpeg command: %s %v", e.ffmpegPath, args)
 	
-	err := cmd.Run()
+	if err := cmd.Start(); err != nil {
+		return newEncodeError(err, "")
+	}
+	e.processes.add(jobID, cmd)
+	err := cmd.Wait()
+	e.processes.remove(jobID, cmd)
 	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("ffmpeg execution canceled: %w", ctx.Err())
+		}
 		log.Printf("FFmpeg execution failed: %v", err)
-		return fmt.Errorf("ffmpeg execution failed: %v", err)
+		return newEncodeError(err, stderr.String())
+	}
+
+	return nil
+}
+
+// Version reads the FFmpeg version once, from the first line of "ffmpeg -version" (e.g. "ffmpeg version 6.1.1 Copyright...")
+func (e *FfmpegEncoder) Version() (string, error) {
+	e.versionOnce.Do(func() {
+		output, err := exec.Command(e.ffmpegPath, "-version").Output()
+		if err != nil {
+			e.versionErr = fmt.Errorf("failed to read ffmpeg version: %w", err)
+			return
+		}
+
+		firstLine, _, _ := strings.Cut(string(output), "\n")
+		fields := strings.Fields(firstLine)
+		if len(fields) < 3 || fields[1] != "version" {
+			e.versionErr = fmt.Errorf("unexpected ffmpeg version output: %q", firstLine)
+			return
+		}
+		e.version = fields[2]
+	})
+	return e.version, e.versionErr
+}
+
+func (e *FfmpegEncoder) CheckDecode(inputPath string, seconds int) error {
+	// -xerror makes FFmpeg stop with a failure on the first decoding error
+	args := []string{"-v", "error", "-xerror", "-t", strconv.Itoa(seconds), "-i", inputPath, "-f", "null", "-"}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(e.ffmpegPath, args...)
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("decoding failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if stderr.Len() > 0 {
+		return fmt.Errorf("decoding reported errors: %s", strings.TrimSpace(stderr.String()))
 	}
 
-	log.Printf("Successfully encoded video to %s", outputPath)
 	return nil
 }
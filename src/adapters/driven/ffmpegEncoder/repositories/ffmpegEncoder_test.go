@@ -2,6 +2,11 @@ package repositories
 
 import (
 	"Theatrum/domain/models"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"testing"
 )
 
@@ -13,6 +18,7 @@ func TestFfmpegEncoder_EncodeVideo(t *testing.T) {
 		outputPath     string
 		qualities      map[string]models.Quality
 		distribution   models.Distribution
+		options        models.EncodeOptions
 		expectedError  bool
 		setupMock      func()
 		cleanupMock    func()
@@ -57,6 +63,41 @@ func TestFfmpegEncoder_EncodeVideo(t *testing.T) {
 			},
 			expectedError: false,
 		},
+		{
+			name:       "passthrough encoding",
+			inputPath:  "input.mp4",
+			outputPath: "output/test_output.m3u8",
+			qualities: map[string]models.Quality{
+				"low": {
+					Width:    640,
+					Height:   360,
+					Bitrate:  "800k",
+					Audio: models.Audio{
+						Bitrate: "96k",
+						Codec:   "aac",
+					},
+				},
+				"high": {
+					Width:       1920,
+					Height:      1080,
+					Bitrate:     "5000k",
+					Passthrough: true,
+					Audio: models.Audio{
+						Bitrate: "192k",
+						Codec:   "aac",
+					},
+				},
+			},
+			distribution: models.Distribution{
+				Hls: models.Hls{
+					SegmentDuration: 10,
+				},
+			},
+			options: models.EncodeOptions{
+				Passthrough: map[string]bool{"high": true},
+			},
+			expectedError: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -70,7 +111,7 @@ func TestFfmpegEncoder_EncodeVideo(t *testing.T) {
 			encoder.DryRun = true
 
 			// Execute the encoding
-			err := encoder.EncodeVideo(tt.inputPath, tt.outputPath, tt.qualities, tt.distribution)
+			err := encoder.EncodeVideo(context.Background(), tt.inputPath, tt.outputPath, tt.qualities, tt.distribution, tt.options)
 
 			// Check error expectations
 			if (err != nil) != tt.expectedError {
@@ -82,4 +123,109 @@ func TestFfmpegEncoder_EncodeVideo(t *testing.T) {
 			// For example, checking that the command contains expected parameters
 		})
 	}
-}
\ No newline at end of file
+}
+
+// argValue returns the argument following a flag, or "" when the flag is missing
+func argValue(args []string, flag string) string {
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == flag {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func TestBuildEncodeArgs(t *testing.T) {
+	qualities := map[string]models.Quality{
+		"high": {Width: 1920, Height: 1080, Bitrate: "4.5M", Audio: models.Audio{Bitrate: "192k", Codec: "aac"}},
+		"low":  {Width: 640, Height: 360, Bitrate: "800k", Audio: models.Audio{Bitrate: "96k", Codec: "aac"}},
+	}
+	distribution := models.Distribution{Hls: models.Hls{SegmentDuration: 10}}
+
+	tests := []struct {
+		name           string
+		passthrough    map[string]bool
+		expectedArgs   map[string]string
+		expectedFilter string
+	}{
+		{
+			name: "encoded qualities",
+			expectedArgs: map[string]string{
+				"-c:v:0": "libx264", "-b:v:0": "4.5M", "-maxrate:v:0": "3000k", "-bufsize:v:0": "4.5M",
+				"-c:v:1": "libx264", "-b:v:1": "800k", "-maxrate:v:1": "534k",
+			},
+			expectedFilter: "[0:v]split=2[v0][v1];[v0]scale=1920:1080[v0out];[v1]scale=640:360[v1out]",
+		},
+		{
+			name:        "passthrough quality",
+			passthrough: map[string]bool{"high": true},
+			expectedArgs: map[string]string{
+				"-c:v:0": "copy", "-c:a:0": "copy", "-b:v:0": "", "-maxrate:v:0": "",
+				"-c:v:1": "libx264", "-b:v:1": "800k",
+			},
+			expectedFilter: "[0:v]split=1[v1];[v1]scale=640:360[v1out]",
+		},
+		{
+			name:        "only passthrough qualities",
+			passthrough: map[string]bool{"high": true, "low": true},
+			expectedArgs: map[string]string{
+				"-c:v:0": "copy", "-c:v:1": "copy",
+			},
+			expectedFilter: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := buildEncodeArgs("input.mp4", "output/master.m3u8", qualities, distribution, models.EncodeOptions{Passthrough: tt.passthrough}, nil)
+
+			for flag, expected := range tt.expectedArgs {
+				if got := argValue(args, flag); got != expected {
+					t.Errorf("%s = %q, expected %q in %v", flag, got, expected, args)
+				}
+			}
+			if got := argValue(args, "-filter_complex"); got != tt.expectedFilter {
+				t.Errorf("-filter_complex = %q, expected %q", got, tt.expectedFilter)
+			}
+		})
+	}
+}
+
+// fakeFfmpeg writes a shell script standing for FFmpeg, which prints a message on its error output and exits with a code
+func fakeFfmpeg(t *testing.T, stderr string, exitCode int) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake FFmpeg is a shell script")
+	}
+
+	script := filepath.Join(t.TempDir(), "ffmpeg")
+	content := "#!/bin/sh\nprintf '%s' '" + stderr + "' >&2\nexit " + strconv.Itoa(exitCode) + "\n"
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
+
+func TestFfmpegEncoder_CheckDecode(t *testing.T) {
+	tests := []struct {
+		name          string
+		stderr        string
+		exitCode      int
+		expectedError bool
+	}{
+		{name: "clean decode", expectedError: false},
+		{name: "decoder failure", stderr: "Invalid NAL unit size", exitCode: 1, expectedError: true},
+		{name: "errors without failure", stderr: "error while decoding MB 12 7", exitCode: 0, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder := &FfmpegEncoder{ffmpegPath: fakeFfmpeg(t, tt.stderr, tt.exitCode)}
+
+			err := encoder.CheckDecode("input.mp4", 10)
+			if (err != nil) != tt.expectedError {
+				t.Errorf("CheckDecode() error = %v, expectedError %v", err, tt.expectedError)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package repositories
+
+import (
+	"Theatrum/domain/models"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+const (
+	// stderrTailBytes bounds the FFmpeg output kept in memory while it runs
+	stderrTailBytes = 16 * 1024
+	// stderrTailLines is the number of FFmpeg output lines kept with an encode failure
+	stderrTailLines = 30
+)
+
+// permanentFfmpegErrors are FFmpeg messages of sources that cannot be demuxed or decoded, retrying the encode would fail the
+// same way. Generic system errors such as "No such file or directory" or "Invalid argument" are also printed for missing
+// outputs or temporary storage failures, so they are retried
+var permanentFfmpegErrors = []string{
+	"Invalid data found when processing input",
+	"does not contain any stream",
+	"Invalid frame dimensions",
+	"Unsupported codec",
+	"Decoder not found",
+	"Could not find codec parameters",
+	"moov atom not found",
+}
+
+// tailWriter keeps the end of what is written to it, so the output of a failed FFmpeg run can be reported
+type tailWriter struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > stderrTailBytes {
+		w.buf = append([]byte(nil), w.buf[len(w.buf)-stderrTailBytes:]...)
+	}
+	return len(p), nil
+}
+
+// String returns the last lines written, progress lines rewritten with carriage returns are split as well
+func (w *tailWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return lastLines(strings.ReplaceAll(string(w.buf), "\r", "\n"), stderrTailLines)
+}
+
+// newEncodeError classifies a failed FFmpeg run as transient or permanent from its exit status and output
+func newEncodeError(err error, stderrTail string) *models.EncodeError {
+	encodeErr := &models.EncodeError{
+		ExitCode:   -1,
+		StderrTail: stderrTail,
+		Err:        fmt.Errorf("ffmpeg execution failed: %w", err),
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		// FFmpeg could not be started at all
+		return encodeErr
+	}
+	encodeErr.ExitCode = exitErr.ExitCode()
+
+	// Killed by a signal (out of memory, shutdown...), the source is not to blame
+	if encodeErr.ExitCode < 0 {
+		return encodeErr
+	}
+
+	for _, message := range permanentFfmpegErrors {
+		if strings.Contains(stderrTail, message) {
+			encodeErr.Permanent = true
+			break
+		}
+	}
+
+	return encodeErr
+}
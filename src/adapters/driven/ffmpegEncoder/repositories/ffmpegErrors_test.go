@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestNewEncodeError(t *testing.T) {
+	tests := []struct {
+		name              string
+		command           string
+		stderrTail        string
+		expectedPermanent bool
+		expectedExitCode  int
+	}{
+		{
+			name:              "corrupted source",
+			command:           "exit 1",
+			stderrTail:        "input.mp4: Invalid data found when processing input",
+			expectedPermanent: true,
+			expectedExitCode:  1,
+		},
+		{
+			name:              "undecodable source",
+			command:           "exit 1",
+			stderrTail:        "[mov,mp4,m4a,3gp,3g2,mj2 @ 0x1] moov atom not found",
+			expectedPermanent: true,
+			expectedExitCode:  1,
+		},
+		{
+			name:              "missing output directory",
+			command:           "exit 1",
+			stderrTail:        "output/720p/segment_000.ts: No such file or directory",
+			expectedPermanent: false,
+			expectedExitCode:  1,
+		},
+		{
+			name:              "storage failure",
+			command:           "exit 1",
+			stderrTail:        "Error writing trailer of output/720p/index.m3u8: Invalid argument",
+			expectedPermanent: false,
+			expectedExitCode:  1,
+		},
+		{
+			name:              "unknown failure",
+			command:           "exit 1",
+			stderrTail:        "av_interleaved_write_frame(): No space left on device",
+			expectedPermanent: false,
+			expectedExitCode:  1,
+		},
+		{
+			name:              "killed by a signal",
+			command:           "kill -9 $$",
+			stderrTail:        "Invalid data found when processing input",
+			expectedPermanent: false,
+			expectedExitCode:  -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runErr := exec.Command("sh", "-c", tt.command).Run()
+			if runErr == nil {
+				t.Fatal("expected the command to fail")
+			}
+
+			got := newEncodeError(runErr, tt.stderrTail)
+			if got.Permanent != tt.expectedPermanent {
+				t.Errorf("Permanent = %v, expected %v", got.Permanent, tt.expectedPermanent)
+			}
+			if got.ExitCode != tt.expectedExitCode {
+				t.Errorf("ExitCode = %d, expected %d", got.ExitCode, tt.expectedExitCode)
+			}
+			if !errors.Is(got, runErr) {
+				t.Errorf("error does not wrap the FFmpeg failure")
+			}
+		})
+	}
+}
+
+func TestTailWriter(t *testing.T) {
+	writer := &tailWriter{}
+	for i := 0; i < stderrTailLines; i++ {
+		writer.Write([]byte("frame= 1 fps=0.0\r"))
+	}
+	writer.Write([]byte("Error while decoding stream #0:0\nConversion failed!\n"))
+
+	lines := strings.Split(writer.String(), "\n")
+	if len(lines) != stderrTailLines {
+		t.Errorf("tail has %d lines, expected %d", len(lines), stderrTailLines)
+	}
+	if lines[len(lines)-1] != "Conversion failed!" {
+		t.Errorf("tail ends with %q, expected the last FFmpeg line", lines[len(lines)-1])
+	}
+}
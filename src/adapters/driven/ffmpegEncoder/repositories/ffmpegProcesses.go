@@ -0,0 +1,98 @@
+package repositories
+
+import (
+	"log"
+	"os/exec"
+	"sync"
+)
+
+// processRegistry tracks the running FFmpeg processes of each job, so a job can be suspended and resumed
+// A job runs several processes in sequence (analysis, encode or chunks, quality measurement): it stays suspended
+// between them until it is resumed
+type processRegistry struct {
+	mu        sync.Mutex
+	processes map[string]map[*exec.Cmd]bool
+	suspended map[string]bool
+}
+
+// init creates the maps of the registry on its first use, the registry must be locked
+func (r *processRegistry) init() {
+	if r.processes == nil {
+		r.processes = make(map[string]map[*exec.Cmd]bool)
+		r.suspended = make(map[string]bool)
+	}
+}
+
+// add registers a started process, it is suspended at once if its job is suspended
+func (r *processRegistry) add(jobID string, cmd *exec.Cmd) {
+	if jobID == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.init()
+	if r.processes[jobID] == nil {
+		r.processes[jobID] = make(map[*exec.Cmd]bool)
+	}
+	r.processes[jobID][cmd] = true
+
+	if r.suspended[jobID] {
+		if err := suspendProcess(cmd.Process); err != nil {
+			log.Printf("Error suspending FFmpeg process of job %s: %v", jobID, err)
+		}
+	}
+}
+
+// remove unregisters an exited process, its job stays suspended for its next processes
+func (r *processRegistry) remove(jobID string, cmd *exec.Cmd) {
+	if jobID == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.processes[jobID], cmd)
+	if len(r.processes[jobID]) == 0 {
+		delete(r.processes, jobID)
+	}
+}
+
+// signal suspends or resumes every process of a job, and the processes it starts afterwards
+// The job is only recorded as suspended once all its processes were, resuming it forgets it
+func (r *processRegistry) signal(jobID string, suspend bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.init()
+	for cmd := range r.processes[jobID] {
+		var err error
+		if suspend {
+			err = suspendProcess(cmd.Process)
+		} else {
+			err = resumeProcess(cmd.Process)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if suspend {
+		r.suspended[jobID] = true
+	} else {
+		delete(r.suspended, jobID)
+	}
+	return nil
+}
+
+// Suspend pauses the running FFmpeg processes of a job
+func (e *FfmpegEncoder) Suspend(jobID string) error {
+	return e.processes.signal(jobID, true)
+}
+
+// Resume continues the suspended FFmpeg processes of a job, a finished job is forgotten
+func (e *FfmpegEncoder) Resume(jobID string) error {
+	return e.processes.signal(jobID, false)
+}
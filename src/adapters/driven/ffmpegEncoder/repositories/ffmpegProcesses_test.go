@@ -0,0 +1,78 @@
+//go:build !windows
+
+package repositories
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessRegistrySuspendedJob(t *testing.T) {
+	registry := &processRegistry{}
+	start := func() *exec.Cmd {
+		t.Helper()
+		cmd := exec.Command("sleep", "30")
+		if err := cmd.Start(); err != nil {
+			t.Skipf("sleep cannot be started: %v", err)
+		}
+		registry.add("job", cmd)
+		t.Cleanup(func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+		})
+		return cmd
+	}
+	stop := func(cmd *exec.Cmd) {
+		cmd.Process.Kill()
+		cmd.Wait()
+		registry.remove("job", cmd)
+	}
+
+	analysis := start()
+	if err := registry.signal("job", true); err != nil {
+		t.Fatalf("signal(suspend) error: %v", err)
+	}
+
+	// The next process of the job starts suspended
+	stop(analysis)
+	if !registry.suspended["job"] {
+		t.Fatal("job is no longer suspended once its process exited")
+	}
+	encode := start()
+	// The signal is delivered asynchronously
+	state := processState(encode)
+	for i := 0; i < 100 && state != "" && state != "T"; i++ {
+		time.Sleep(10 * time.Millisecond)
+		state = processState(encode)
+	}
+	if state != "" && state != "T" {
+		t.Errorf("next process state = %s, expected T (stopped)", state)
+	}
+	stop(encode)
+
+	// The job is resumed without any running process, once it finished
+	if err := registry.signal("job", false); err != nil {
+		t.Errorf("signal(resume) error: %v", err)
+	}
+	if registry.suspended["job"] {
+		t.Error("job is still suspended once resumed")
+	}
+}
+
+// processState returns the state letter of a process read from /proc, empty where /proc is not available
+func processState(cmd *exec.Cmd) string {
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(cmd.Process.Pid) + "/stat")
+	if err != nil {
+		return ""
+	}
+	// The state follows the command name, which is in parentheses
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
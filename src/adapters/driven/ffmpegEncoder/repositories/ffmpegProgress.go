@@ -0,0 +1,96 @@
+package repositories
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// progressArgs make FFmpeg write its progress as "key=value" lines on stdout instead of the stats line on stderr
+var progressArgs = []string{"-progress", "pipe:1", "-nostats"}
+
+// progressWriter parses the "-progress" output of FFmpeg and reports the encoded duration in seconds
+type progressWriter struct {
+	mu       sync.Mutex
+	buf      []byte
+	onUpdate func(seconds float64)
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		end := bytes.IndexByte(w.buf, '\n')
+		if end < 0 {
+			break
+		}
+		line := strings.TrimSpace(string(w.buf[:end]))
+		w.buf = w.buf[end+1:]
+
+		// out_time_ms is in microseconds as well, it is kept for older FFmpeg versions
+		key, value, found := strings.Cut(line, "=")
+		if !found || (key != "out_time_us" && key != "out_time_ms") {
+			continue
+		}
+		microseconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || microseconds < 0 {
+			continue
+		}
+		w.onUpdate(float64(microseconds) / 1e6)
+	}
+	return len(p), nil
+}
+
+// progressTracker turns the encoded durations into the fraction of the source encoded, never going backwards
+type progressTracker struct {
+	mu       sync.Mutex
+	duration float64
+	encoded  float64 // Seconds of the finished parts, for the chunked encodes
+	done     float64
+	report   func(fraction float64)
+}
+
+func newProgressTracker(duration float64, report func(fraction float64)) *progressTracker {
+	return &progressTracker{duration: duration, report: report}
+}
+
+// update reports that the given number of seconds of the source were encoded
+func (t *progressTracker) update(seconds float64) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.set(seconds)
+}
+
+// advance reports that a part of the source lasting the given number of seconds was encoded
+func (t *progressTracker) advance(seconds float64) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.encoded += seconds
+	t.set(t.encoded)
+}
+
+func (t *progressTracker) set(seconds float64) {
+	if t.duration <= 0 {
+		return
+	}
+
+	fraction := min(1, seconds/t.duration)
+	if fraction <= t.done {
+		return
+	}
+	t.done = fraction
+	t.report(fraction)
+}
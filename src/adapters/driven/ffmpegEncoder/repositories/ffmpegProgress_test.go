@@ -0,0 +1,34 @@
+package repositories
+
+import "testing"
+
+func TestProgressWriter(t *testing.T) {
+	var fractions []float64
+	tracker := newProgressTracker(10, func(fraction float64) {
+		fractions = append(fractions, fraction)
+	})
+	writer := &progressWriter{onUpdate: tracker.update}
+
+	// Lines may be split across writes, and the encoded time may go backwards between streams
+	for _, chunk := range []string{
+		"frame=10\nout_time_us=2500",
+		"000\nprogress=continue\n",
+		"out_time_us=N/A\nout_time_us=2000000\n",
+		"out_time_ms=5000000\nprogress=continue\n",
+		"out_time_us=12000000\nprogress=end\n",
+	} {
+		if _, err := writer.Write([]byte(chunk)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	expected := []float64{0.25, 0.5, 1}
+	if len(fractions) != len(expected) {
+		t.Fatalf("reported fractions = %v, expected %v", fractions, expected)
+	}
+	for i := range expected {
+		if fractions[i] != expected[i] {
+			t.Fatalf("reported fractions = %v, expected %v", fractions, expected)
+		}
+	}
+}
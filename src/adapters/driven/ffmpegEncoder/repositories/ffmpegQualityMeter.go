@@ -0,0 +1,127 @@
+package repositories
+
+import (
+	"Theatrum/domain/models"
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxPsnr replaces the infinite PSNR reported for identical frames, which JSON cannot represent
+const maxPsnr = 100
+
+var (
+	psnrRegex = regexp.MustCompile(`PSNR .*average:([0-9.]+|inf)`)
+	ssimRegex = regexp.MustCompile(`SSIM .*All:([0-9.]+)`)
+	vmafRegex = regexp.MustCompile(`VMAF score: ([0-9.]+)`)
+)
+
+func (e *FfmpegEncoder) MeasureQuality(sourcePath string, variantPath string, quality models.Quality, vmaf bool) (models.RenditionQuality, error) {
+	// The variant may not have the quality resolution, a passthrough rendition keeps the one of the source
+	variant, err := e.ProbeVideo(variantPath)
+	if err != nil {
+		return models.RenditionQuality{}, fmt.Errorf("failed to probe variant: %v", err)
+	}
+	if variant.Video == nil || variant.Video.Width <= 0 || variant.Video.Height <= 0 {
+		return models.RenditionQuality{}, fmt.Errorf("variant has no video stream")
+	}
+
+	result := models.RenditionQuality{
+		Width:   variant.Video.Width,
+		Height:  variant.Video.Height,
+		Bitrate: quality.Bitrate,
+	}
+
+	vmaf = vmaf && e.hasVmaf()
+
+	metrics := []string{"psnr", "ssim"}
+	if vmaf {
+		metrics = append(metrics, "libvmaf")
+	}
+	filter := buildQualityFilter(result.Width, result.Height, metrics)
+
+	args := []string{"-hide_banner", "-nostats", "-i", variantPath, "-i", sourcePath, "-filter_complex", filter, "-an", "-f", "null", "-"}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(e.ffmpegPath, args...)
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return result, fmt.Errorf("quality measurement failed: %v: %s", err, lastLines(stderr.String(), 5))
+	}
+
+	output := stderr.String()
+
+	psnr, err := parseMetric(psnrRegex, output)
+	if err != nil {
+		return result, fmt.Errorf("PSNR not found in FFmpeg output")
+	}
+	result.Psnr = math.Min(psnr, maxPsnr)
+
+	if result.Ssim, err = parseMetric(ssimRegex, output); err != nil {
+		return result, fmt.Errorf("SSIM not found in FFmpeg output")
+	}
+
+	if vmaf {
+		score, err := parseMetric(vmafRegex, output)
+		if err != nil {
+			return result, fmt.Errorf("VMAF not found in FFmpeg output")
+		}
+		result.Vmaf = &score
+	}
+
+	return result, nil
+}
+
+// buildQualityFilter builds the filter graph comparing the variant, first input, with the source, second input, scaled to the
+// variant resolution, with every metric
+func buildQualityFilter(width int, height int, metrics []string) string {
+	// Both inputs start at zero, as the HLS segments have shifted timestamps
+	filter := fmt.Sprintf("[0:v]setpts=PTS-STARTPTS,split=%d", len(metrics))
+	for i := range metrics {
+		filter += fmt.Sprintf("[d%d]", i)
+	}
+	filter += fmt.Sprintf(";[1:v]scale=%d:%d:flags=bicubic,setpts=PTS-STARTPTS,split=%d", width, height, len(metrics))
+	for i := range metrics {
+		filter += fmt.Sprintf("[r%d]", i)
+	}
+	for i, metric := range metrics {
+		filter += fmt.Sprintf(";[d%d][r%d]%s", i, i, metric)
+	}
+	return filter
+}
+
+// hasVmaf checks once whether FFmpeg was built with libvmaf
+func (e *FfmpegEncoder) hasVmaf() bool {
+	e.vmafOnce.Do(func() {
+		output, err := exec.Command(e.ffmpegPath, "-hide_banner", "-filters").Output()
+		e.vmafAvailable = err == nil && strings.Contains(string(output), " libvmaf ")
+		if !e.vmafAvailable {
+			log.Printf("FFmpeg has no libvmaf filter, VMAF will not be measured")
+		}
+	})
+	return e.vmafAvailable
+}
+
+func parseMetric(re *regexp.Regexp, output string) (float64, error) {
+	matches := re.FindAllStringSubmatch(output, -1)
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("metric not found")
+	}
+	// The summary is printed last
+	return strconv.ParseFloat(matches[len(matches)-1][1], 64)
+}
+
+// lastLines keeps the end of a command output for error messages
+func lastLines(output string, count int) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) > count {
+		lines = lines[len(lines)-count:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"math"
+	"regexp"
+	"testing"
+)
+
+func TestParseMetric(t *testing.T) {
+	output := `[Parsed_psnr_2 @ 0x1] PSNR y:38.12 u:43.50 v:44.01 average:39.07 min:35.20 max:41.30
+[Parsed_ssim_3 @ 0x2] SSIM Y:0.971 (15.4) U:0.982 (17.4) V:0.984 (17.9) All:0.975 (16.0)
+[Parsed_libvmaf_4 @ 0x4] VMAF score: 93.417`
+
+	tests := []struct {
+		name     string
+		re       *regexp.Regexp
+		output   string
+		expected float64
+		wantErr  bool
+	}{
+		{name: "PSNR", re: psnrRegex, output: output, expected: 39.07},
+		{name: "PSNR of identical frames", re: psnrRegex, output: "PSNR y:inf u:inf v:inf average:inf min:inf max:inf", expected: math.Inf(1)},
+		{name: "last summary", re: psnrRegex, output: "PSNR average:20.5\nPSNR average:41.25", expected: 41.25},
+		{name: "SSIM", re: ssimRegex, output: output, expected: 0.975},
+		{name: "VMAF", re: vmafRegex, output: output, expected: 93.417},
+		{name: "missing metric", re: vmafRegex, output: "Conversion failed!", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMetric(tt.re, tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMetric() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("parseMetric() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBuildQualityFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		width    int
+		height   int
+		metrics  []string
+		expected string
+	}{
+		{
+			name:    "scaled variant",
+			width:   1280,
+			height:  720,
+			metrics: []string{"psnr", "ssim"},
+			expected: "[0:v]setpts=PTS-STARTPTS,split=2[d0][d1];[1:v]scale=1280:720:flags=bicubic,setpts=PTS-STARTPTS,split=2[r0][r1]" +
+				";[d0][r0]psnr;[d1][r1]ssim",
+		},
+		{
+			name:    "passthrough variant at the source resolution, with VMAF",
+			width:   1440,
+			height:  1080,
+			metrics: []string{"psnr", "ssim", "libvmaf"},
+			expected: "[0:v]setpts=PTS-STARTPTS,split=3[d0][d1][d2];[1:v]scale=1440:1080:flags=bicubic,setpts=PTS-STARTPTS,split=3[r0][r1][r2]" +
+				";[d0][r0]psnr;[d1][r1]ssim;[d2][r2]libvmaf",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildQualityFilter(tt.width, tt.height, tt.metrics); got != tt.expected {
+				t.Errorf("buildQualityFilter() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package repositories
+
+import (
+	"os"
+	"syscall"
+)
+
+func suspendProcess(process *os.Process) error {
+	return process.Signal(syscall.SIGSTOP)
+}
+
+func resumeProcess(process *os.Process) error {
+	return process.Signal(syscall.SIGCONT)
+}
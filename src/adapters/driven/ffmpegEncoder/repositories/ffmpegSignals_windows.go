@@ -0,0 +1,18 @@
+//go:build windows
+
+package repositories
+
+import (
+	"errors"
+	"os"
+)
+
+var errSuspendUnsupported = errors.New("suspending FFmpeg is not supported on Windows")
+
+func suspendProcess(process *os.Process) error {
+	return errSuspendUnsupported
+}
+
+func resumeProcess(process *os.Process) error {
+	return errSuspendUnsupported
+}
@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"Theatrum/domain/models"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ffprobeOutput mirrors the subset of the ffprobe JSON output used by the encoder
+type ffprobeOutput struct {
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType    string `json:"codec_type"`
+		CodecName    string `json:"codec_name"`
+		Width        int    `json:"width"`
+		Height       int    `json:"height"`
+		AvgFrameRate string `json:"avg_frame_rate"`
+		BitRate      string `json:"bit_rate"`
+	} `json:"streams"`
+}
+
+func (e *FfmpegEncoder) ProbeVideo(inputPath string) (models.MediaInfo, error) {
+	args := []string{"-v", "error", "-print_format", "json", "-show_format", "-show_streams", inputPath}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(e.ffprobePath, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return models.MediaInfo{}, fmt.Errorf("ffprobe failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var output ffprobeOutput
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return models.MediaInfo{}, fmt.Errorf("failed to parse ffprobe output: %v", err)
+	}
+
+	info := models.MediaInfo{
+		FormatName: output.Format.FormatName,
+		Duration:   parseFloat(output.Format.Duration),
+		Bitrate:    parseInt(output.Format.BitRate),
+	}
+
+	// Only keep the first stream of each type, as the encoder only maps those
+	for _, stream := range output.Streams {
+		switch stream.CodecType {
+		case "video":
+			if info.Video == nil {
+				info.Video = &models.VideoStreamInfo{
+					Codec:     stream.CodecName,
+					Width:     stream.Width,
+					Height:    stream.Height,
+					Framerate: parseFrameRate(stream.AvgFrameRate),
+					Bitrate:   parseInt(stream.BitRate),
+				}
+			}
+		case "audio":
+			if info.Audio == nil {
+				info.Audio = &models.AudioStreamInfo{
+					Codec:   stream.CodecName,
+					Bitrate: parseInt(stream.BitRate),
+				}
+			}
+		}
+	}
+
+	return info, nil
+}
+
+func parseFloat(value string) float64 {
+	result, _ := strconv.ParseFloat(value, 64)
+	return result
+}
+
+func parseInt(value string) int64 {
+	result, _ := strconv.ParseInt(value, 10, 64)
+	return result
+}
+
+// parseFrameRate converts a rational frame rate such as "30000/1001" to frames per second
+func parseFrameRate(value string) float64 {
+	numerator, denominator, found := strings.Cut(value, "/")
+	if !found {
+		return parseFloat(value)
+	}
+	den := parseFloat(denominator)
+	if den == 0 {
+		return 0
+	}
+	return parseFloat(numerator) / den
+}
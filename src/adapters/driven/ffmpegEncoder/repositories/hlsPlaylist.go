@@ -0,0 +1,144 @@
+package repositories
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hlsSegment is a media segment listed in a variant playlist
+type hlsSegment struct {
+	Duration float64
+	URI      string
+}
+
+// parseMediaPlaylist extracts the segments listed in a variant playlist
+func parseMediaPlaylist(content string) ([]hlsSegment, error) {
+	var (
+		segments []hlsSegment
+		duration float64
+		pending  bool
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid segment duration %q: %v", value, err)
+			}
+			duration = parsed
+			pending = true
+		case strings.HasPrefix(line, "#"):
+			continue // Other tags are rebuilt when the playlist is written
+		default:
+			if !pending {
+				return nil, fmt.Errorf("segment %q has no duration", line)
+			}
+			segments = append(segments, hlsSegment{Duration: duration, URI: line})
+			pending = false
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return segments, nil
+}
+
+// buildMediaPlaylist writes a complete VOD variant playlist listing the given segments
+func buildMediaPlaylist(segments []hlsSegment) string {
+	// Every segment duration rounded up must fit in the target duration
+	targetDuration := 0
+	for _, segment := range segments {
+		targetDuration = max(targetDuration, int(math.Ceil(segment.Duration)))
+	}
+
+	var playlist strings.Builder
+	playlist.WriteString("#EXTM3U\n")
+	playlist.WriteString("#EXT-X-VERSION:3\n")
+	playlist.WriteString(fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", targetDuration))
+	playlist.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
+	playlist.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	for _, segment := range segments {
+		playlist.WriteString(fmt.Sprintf("#EXTINF:%.6f,\n%s\n", segment.Duration, segment.URI))
+	}
+	playlist.WriteString("#EXT-X-ENDLIST\n")
+
+	return playlist.String()
+}
+
+// hlsVariant is a variant stream listed in a master playlist
+type hlsVariant struct {
+	// Info is the #EXT-X-STREAM-INF tag describing the variant
+	Info string
+	URI  string
+}
+
+// name returns the quality of the variant, the directory of its playlist
+func (v hlsVariant) name() string {
+	name, _, _ := strings.Cut(v.URI, "/")
+	return name
+}
+
+// parseMasterPlaylist extracts the header tags and the variants of a master playlist
+func parseMasterPlaylist(content string) (header []string, variants []hlsVariant) {
+	info := ""
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			info = line
+		case strings.HasPrefix(line, "#"):
+			header = append(header, line)
+		case info != "":
+			variants = append(variants, hlsVariant{Info: info, URI: line})
+			info = ""
+		}
+	}
+	return header, variants
+}
+
+// mergeMasterPlaylists writes a master playlist listing the variants of the encoded master playlist,
+// plus the kept variants of the previous one, sorted by quality name
+// The header of the encoded master playlist is used, or the previous one when nothing was encoded
+func mergeMasterPlaylists(previous string, encoded string, keep []string) string {
+	previousHeader, previousVariants := parseMasterPlaylist(previous)
+	header, variants := parseMasterPlaylist(encoded)
+	if len(header) == 0 {
+		header = previousHeader
+	}
+
+	for _, variant := range previousVariants {
+		if slices.Contains(keep, variant.name()) && !slices.ContainsFunc(variants, func(encoded hlsVariant) bool {
+			return encoded.name() == variant.name()
+		}) {
+			variants = append(variants, variant)
+		}
+	}
+	sort.SliceStable(variants, func(i, j int) bool {
+		return variants[i].name() < variants[j].name()
+	})
+
+	var playlist strings.Builder
+	for _, line := range header {
+		playlist.WriteString(line + "\n")
+	}
+	for _, variant := range variants {
+		playlist.WriteString(variant.Info + "\n" + variant.URI + "\n")
+	}
+	return playlist.String()
+}
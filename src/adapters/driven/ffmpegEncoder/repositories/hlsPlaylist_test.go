@@ -0,0 +1,52 @@
+package repositories
+
+import "testing"
+
+func TestMergeMasterPlaylists(t *testing.T) {
+	previous := "#EXTM3U\n#EXT-X-VERSION:3\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=1000000,RESOLUTION=640x360\nlow/stream.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720\nmedium/stream.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=6000000,RESOLUTION=1920x1080\nhigh/stream.m3u8\n"
+
+	tests := []struct {
+		name     string
+		encoded  string
+		keep     []string
+		expected string
+	}{
+		{
+			name:    "added quality next to the kept ones",
+			encoded: "#EXTM3U\n#EXT-X-VERSION:6\n#EXT-X-STREAM-INF:BANDWIDTH=12000000,RESOLUTION=3840x2160\nuhd/stream.m3u8\n",
+			keep:    []string{"low", "medium", "high"},
+			expected: "#EXTM3U\n#EXT-X-VERSION:6\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=6000000,RESOLUTION=1920x1080\nhigh/stream.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=1000000,RESOLUTION=640x360\nlow/stream.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720\nmedium/stream.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=12000000,RESOLUTION=3840x2160\nuhd/stream.m3u8\n",
+		},
+		{
+			name:    "changed quality replaces the previous one",
+			encoded: "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-STREAM-INF:BANDWIDTH=2000000,RESOLUTION=640x360\nlow/stream.m3u8\n",
+			keep:    []string{"medium"},
+			expected: "#EXTM3U\n#EXT-X-VERSION:3\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=2000000,RESOLUTION=640x360\nlow/stream.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720\nmedium/stream.m3u8\n",
+		},
+		{
+			name:    "removed quality without encode",
+			encoded: "",
+			keep:    []string{"low", "high"},
+			expected: "#EXTM3U\n#EXT-X-VERSION:3\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=6000000,RESOLUTION=1920x1080\nhigh/stream.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=1000000,RESOLUTION=640x360\nlow/stream.m3u8\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeMasterPlaylists(previous, tt.encoded, tt.keep); got != tt.expected {
+				t.Errorf("mergeMasterPlaylists() =\n%s\nexpected\n%s", got, tt.expected)
+			}
+		})
+	}
+}
@@ -2,49 +2,444 @@ package fileAccess
 
 import (
 	"Theatrum/constants"
+	"Theatrum/domain/models"
 	"Theatrum/domain/repositories"
+	"Theatrum/domain/utils"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
+	"slices"
 	"strings"
 )
 
 // FileAccess implements the StoragePort interface for file system operations
-type FileAccess struct{}
+// Every operation goes through an os.Root of the data directory, so neither the paths nor the symbolic links can lead outside of it
+type FileAccess struct {
+	dir  string // Data directory, with forward slashes
+	root *os.Root
+	// errEscapes is the error of the root for the names leading outside of it, which os does not export
+	errEscapes error
+}
 
 // Verify interface implementation
 var _ repositories.StoragePort = (*FileAccess)(nil)
 
-// NewFileAccess creates a new instance of FileAccess
-func NewFileAccess() repositories.StoragePort {
-	return &FileAccess{}
+// NewFileAccess creates a new instance of FileAccess rooted in the data directory
+func NewFileAccess() (repositories.StoragePort, error) {
+	return newFileAccess(constants.VideoDir)
+}
+
+func newFileAccess(dir string) (*FileAccess, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating data directory: %w", err)
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error opening data directory: %w", err)
+	}
+
+	// The error of the names leading outside of the root is taken from the parent directory, which always does
+	var pathErr *fs.PathError
+	if _, err := root.Stat(".."); !errors.As(err, &pathErr) {
+		root.Close()
+		return nil, fmt.Errorf("error opening data directory: its parent is not refused (%v)", err)
+	}
+	return &FileAccess{dir: filepath.ToSlash(filepath.Clean(dir)), root: root, errEscapes: pathErr.Err}, nil
+}
+
+// rel returns the name in the root of a path of the data directory, an error wrapping utils.ErrUnsafePath for the other paths
+func (f *FileAccess) rel(storagePath string) (string, error) {
+	name, err := utils.RelativeToRoot(f.dir, storagePath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.FromSlash(name), nil
+}
+
+// storagePath returns the path in the data directory of a name in the root
+func (f *FileAccess) storagePath(name string) string {
+	return path.Join(f.dir, filepath.ToSlash(name))
+}
+
+func (f *FileAccess) open(path string) (*os.File, error) {
+	name, err := f.rel(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := f.root.Open(name)
+	return file, f.escapeError(err)
+}
+
+// escapeError wraps utils.ErrUnsafePath around the errors of the root for the names leading outside of it through a symbolic link
+func (f *FileAccess) escapeError(err error) error {
+	if err != nil && errors.Is(err, f.errEscapes) {
+		return fmt.Errorf("%w: %w", utils.ErrUnsafePath, err)
+	}
+	return err
 }
 
 func (f *FileAccess) ReadFile(path string) ([]byte, error) {
-	return os.ReadFile(path)
+	file, err := f.open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+func (f *FileAccess) OpenFile(path string) (io.ReadSeekCloser, models.FileInfo, error) {
+	file, err := f.open(path)
+	if err != nil {
+		return nil, models.FileInfo{}, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, models.FileInfo{}, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, models.FileInfo{}, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+
+	return file, models.FileInfo{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (f *FileAccess) ReadFileHeader(path string, size int) ([]byte, error) {
+	file, err := f.open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	header := make([]byte, size)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return header[:n], nil
 }
 
 func (f *FileAccess) WriteFile(path string, data []byte) error {
-	return os.WriteFile(path, data, 0644)
+	name, err := f.rel(path)
+	if err != nil {
+		return err
+	}
+	file, err := f.root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
 
 func (f *FileAccess) DeleteFile(path string) error {
-	return os.Remove(path)
+	name, err := f.rel(path)
+	if err != nil {
+		return err
+	}
+	return f.root.Remove(name)
 }
 
-func (f *FileAccess) ListFiles(path string) ([]string, error) {
-	return filepath.Glob(path)
+func (f *FileAccess) MoveFile(sourcePath string, destinationPath string) error {
+	if err := f.mkdirAll(filepath.Dir(destinationPath)); err != nil {
+		return err
+	}
+	return f.rename(sourcePath, destinationPath)
+}
+
+// ImportFile renames the local file, or copies it when the destination is on another file system
+func (f *FileAccess) ImportFile(localPath string, destinationPath string) error {
+	if err := f.mkdirAll(filepath.Dir(destinationPath)); err != nil {
+		return err
+	}
+	name, err := f.rel(destinationPath)
+	if err != nil {
+		return err
+	}
+	// The local file is renamed outside of the root, so the destination directory is first resolved in it
+	if _, err := f.root.Stat(filepath.Dir(name)); err != nil {
+		return f.escapeError(err)
+	}
+	if err := os.Rename(localPath, filepath.Join(f.root.Name(), name)); err == nil {
+		return nil
+	}
+
+	source, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	// The copy is renamed once complete, so the detection never sees a partial file
+	tempPath := path.Join(path.Dir(destinationPath), "."+path.Base(destinationPath)+"."+utils.NewID())
+	tempName, err := f.rel(tempPath)
+	if err != nil {
+		return err
+	}
+	temp, err := f.root.OpenFile(tempName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(temp, source)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = f.rename(tempPath, destinationPath)
+	}
+	if err != nil {
+		f.root.Remove(tempName)
+		return err
+	}
+
+	source.Close()
+	return os.Remove(localPath)
+}
+
+// mkdirAll creates a directory of the data directory with its parents, os.Root has no MkdirAll before Go 1.25
+func (f *FileAccess) mkdirAll(dir string) error {
+	name, err := f.rel(dir)
+	if err != nil {
+		return err
+	}
+
+	current := ""
+	for _, segment := range strings.Split(filepath.ToSlash(name), "/") {
+		if segment == "." {
+			continue
+		}
+		current = filepath.Join(current, segment)
+		if err := f.root.Mkdir(current, 0755); err != nil && !errors.Is(err, fs.ErrExist) {
+			return f.escapeError(err)
+		}
+	}
+	return nil
+}
+
+// rename moves a file of the data directory. os.Root has no Rename before Go 1.25, so both paths are first resolved
+// in the root: a parent directory leading outside of it is refused.
+func (f *FileAccess) rename(sourcePath string, destinationPath string) error {
+	sourceName, err := f.rel(sourcePath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.root.Lstat(sourceName); err != nil {
+		return f.escapeError(err)
+	}
+
+	destinationName, err := f.rel(destinationPath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.root.Stat(filepath.Dir(destinationName)); err != nil {
+		return f.escapeError(err)
+	}
+
+	return os.Rename(filepath.Join(f.root.Name(), sourceName), filepath.Join(f.root.Name(), destinationName))
+}
+
+func (f *FileAccess) ListFiles(pattern string) ([]string, error) {
+	name, err := f.rel(pattern)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := fs.Glob(f.root.FS(), filepath.ToSlash(name))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, len(matches))
+	for i, match := range matches {
+		files[i] = f.storagePath(match)
+	}
+	return files, nil
 }
 
 func (f *FileAccess) GetFileSize(path string) (int64, error) {
-	info, err := os.Stat(path)
+	info, err := f.StatFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+func (f *FileAccess) StatFile(path string) (models.FileInfo, error) {
+	name, err := f.rel(path)
+	if err != nil {
+		return models.FileInfo{}, err
+	}
+	info, err := f.root.Stat(name)
+	if err != nil {
+		return models.FileInfo{}, f.escapeError(err)
+	}
+	return models.FileInfo{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// DeleteDirectory deletes a directory with its contents. os.Root has no RemoveAll before Go 1.25, so the tree is walked
+// without following the symbolic links, and removed from its deepest entries.
+func (f *FileAccess) DeleteDirectory(path string) error {
+	name, err := f.rel(path)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		return fmt.Errorf("%w: cannot delete the data directory", utils.ErrUnsafePath)
+	}
+
+	info, err := f.root.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return f.root.Remove(name)
+	}
+
+	var entries []string
+	err = fs.WalkDir(f.root.FS(), filepath.ToSlash(name), func(entry string, _ fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range slices.Backward(entries) {
+		if err := f.root.Remove(filepath.FromSlash(entry)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FileAccess) DirectorySize(path string) (int64, error) {
+	name, err := f.rel(path)
 	if err != nil {
 		return 0, err
 	}
-	return info.Size(), nil
+
+	var size int64
+	err = fs.WalkDir(f.root.FS(), filepath.ToSlash(name), func(_ string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	return size, err
+}
+
+// FetchFile only checks the file exists, it already is on the local file system
+func (f *FileAccess) FetchFile(path string) (func(), error) {
+	if _, err := f.StatFile(path); err != nil {
+		return nil, err
+	}
+	return func() {}, nil
+}
+
+// StageDirectory creates a directory in the encodes directory, which is usually on the file system of the data directory
+// so the staged files are published by renaming them
+func (f *FileAccess) StageDirectory() (string, func(), error) {
+	return stageDirectory()
+}
+
+// PublishDirectory imports every file beneath the local directory into the storage directory
+func (f *FileAccess) PublishDirectory(localDir string, storagePath string) error {
+	files, err := stagedFiles(localDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := f.ImportFile(filepath.Join(localDir, filepath.FromSlash(file)), path.Join(storagePath, file)); err != nil {
+			return fmt.Errorf("error publishing %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// stageDirectory creates a directory of its own in the encodes directory, and returns it with the function removing it
+func stageDirectory() (string, func(), error) {
+	if err := os.MkdirAll(constants.EncodesDir, 0755); err != nil {
+		return "", nil, fmt.Errorf("error creating encodes directory: %w", err)
+	}
+	localDir, err := os.MkdirTemp(constants.EncodesDir, "encode-")
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating staging directory: %w", err)
+	}
+
+	release := func() {
+		if err := os.RemoveAll(localDir); err != nil {
+			log.Printf("Error removing staging directory %s: %v", localDir, err)
+		}
+	}
+	return filepath.ToSlash(localDir), release, nil
+}
+
+// stagedFiles lists the files beneath a local directory with slashed paths relative to it, the ones of the deepest
+// subdirectories first
+func stagedFiles(localDir string) ([]string, error) {
+	files := []string{}
+	err := filepath.WalkDir(filepath.FromSlash(localDir), func(localPath string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		relativePath, err := filepath.Rel(filepath.FromSlash(localDir), localPath)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(relativePath))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortStableFunc(files, func(a, b string) int {
+		return cmp.Compare(strings.Count(b, "/"), strings.Count(a, "/"))
+	})
+	return files, nil
+}
+
+func (f *FileAccess) HashFile(path string) (string, error) {
+	file, err := f.open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
 // SearchFiles walks the filesystem, finds every file that sits beneath
@@ -104,7 +499,10 @@ import (
 )
 
 func main() {
-	fa := &fileAccess.FileAccess{}
+	fa, err := fileAccess.NewFileAccess()
+	if err != nil {
+		log.Fatalf("opening storage failed: %v", err)
+	}
 
 	pattern := "data/{username}/{qualities}"
 	//pattern := "data/{username}/default"
@@ -121,87 +519,26 @@ func main() {
 */
 // TODO : make it able to manage filename directly in the pattern
 func (fa *FileAccess) SearchFiles(pattern string, extensions []string) ([]string, []map[string]string, error) {
-	// Validate pattern to prevent path traversal
-	if err := validatePattern(pattern); err != nil {
-		return nil, nil, err
-	}
-
-	// Compute the max depth of the pattern (number of segments)
-	maxDepth := strings.Count(pattern, "/")
-
-	// 1. Build a regular expression from the pattern
-	varNames := make([]string, 0) // Dynamic allocation for variable names
-	var reBuilder strings.Builder
-	reBuilder.WriteString("^") // anchor at the start
-
-	// We'll also work out the longest literal prefix so we know where to
-	// start the directory walk (huge speed-up on big trees).
-	var walkRoot strings.Builder
-
-	varAlreadyFound := false // This makes us able to manage a static dir name like "default" after a placeholder.
-	hasFilename := false     // Track if pattern ends with a filename
-
-	for i := 0; i < len(pattern); i++ {
-		ch := pattern[i]
-		switch {
-		case ch == constants.PlaceholderBegin[0]:
-			varAlreadyFound = true
-			// finish any literal run *before* this brace
-			reBuilder.WriteString("([^/]+)")
-			// collect the var name
-			j := strings.IndexByte(pattern[i+1:], constants.PlaceholderEnd[0])
-			if j == -1 {
-				return nil, nil, fmt.Errorf("unclosed placeholder in pattern %q", pattern)
-			}
-			name := pattern[i+1 : i+1+j]
-			if name == "" {
-				return nil, nil, fmt.Errorf("empty placeholder in pattern %q", pattern)
-			}
-			varNames = append(varNames, name)
-			i += j // skip over the variable text; the loop's i++ will land on the closing brace
-		case ch == constants.PlaceholderEnd[0]:
-			// Nothing extra; the regex group has already been written, we just need to skip over the closing brace
-		default:
-			// ordinary byte
-			reBuilder.WriteString(regexp.QuoteMeta(string(ch)))
-			
-			if !varAlreadyFound {
-				walkRoot.WriteByte(ch) // only literals belong in the root
-			}
-
-			// Check if this is the last character and it's not a slash
-			if i == len(pattern)-1 && ch != '/' {
-				hasFilename = true
-			}
-		}
-	}
-
-	// Only append "/.+" if the pattern doesn't end with a filename
-	if !hasFilename {
-		reBuilder.WriteString("/.+$") // we expect *files* to sit beneath the dir
-	} else {
-		reBuilder.WriteString("$") // just anchor at the end for exact filename match
-	}
-
-	re, err := regexp.Compile(reBuilder.String())
+	searchPattern, err := utils.CompilePathPattern(pattern)
 	if err != nil {
-		return nil, nil, fmt.Errorf("building regexp from pattern: %w", err)
-	}
-
-	// 2. Work out where to start walking
-	root := filepath.Clean(walkRoot.String())
-	if root == "" || root == string(filepath.Separator) {
-		root = string(filepath.Separator)
+		return nil, nil, err
 	}
+	maxDepth := searchPattern.MaxDepth()
 
-	// 3. Walk and match
+	// Walk from the longest literal prefix of the pattern and match
 	var (
 		paths []string
 		vars  []map[string]string
 	)
 
-	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, walkErr error) error {
-		path = strings.ReplaceAll(path, "\\", "/")
+	rootName, err := fa.rel(searchPattern.Root())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The walk stays in the root, and does not follow the symbolic links to directories
+	err = fs.WalkDir(fa.root.FS(), filepath.ToSlash(rootName), func(name string, d fs.DirEntry, walkErr error) error {
+		path := fa.storagePath(name)
 
 		// Calculate current depth by counting path separators
 		currentDepth := strings.Count(path, "/")
@@ -218,56 +555,16 @@ func (fa *FileAccess) SearchFiles(pattern string, extensions []string) ([]string
 			return nil // Continue walking
 		}
 
-		log.Printf("Walking %s (depth: %d)", path, currentDepth)
-
 		// For files, check if they match our pattern
-		// Use forward slashes for regex matching on every platform
-		slashPath := filepath.ToSlash(path)
-		if !re.MatchString(slashPath) {
+		m, matched := searchPattern.Match(path, extensions)
+		if !matched {
 			return nil // not of interest
 		}
 
-		// Check filename if specified in pattern
-		if hasFilename {
-			pathFilename := filepath.Base(slashPath)
-			patternFilename := filepath.Base(pattern)
-			if pathFilename != patternFilename {
-				return nil // filename doesn't match
-			}
-		}
-
-		// Check extensions if specified
-		if len(extensions) > 0 {
-			// Convert both the path extension and valid extensions to lowercase for case-insensitive comparison
-			pathExt := strings.ToLower(filepath.Ext(path))
-			validExt := false
-			for _, ext := range extensions {
-				if strings.ToLower(ext) == pathExt {
-					validExt = true
-					break
-				}
-			}
-			if !validExt {
-				return nil // extension doesn't match
-			}
-		}
-
-		matches := re.FindStringSubmatch(slashPath)
-		if len(matches) != len(varNames)+1 {
-			// Should never happen, but be defensive
-			return nil
-		}
-
-		m := make(map[string]string, len(varNames))
-		for i, name := range varNames {
-			m[name] = matches[i+1]
-		}
-
-		// Extract filename from the path if it exists
-		if strings.Contains(path, "/") {
-			filename := filepath.Base(path)
-			if filename != "" && filename != "." && filename != "/" {
-				m["FILENAME"] = filename
+		// A symbolic link is only a file of the storage if its target is in the root
+		if d.Type()&fs.ModeSymlink != 0 {
+			if info, err := fa.root.Stat(name); err != nil || info.IsDir() {
+				return nil
 			}
 		}
 
@@ -283,52 +580,3 @@ func (fa *FileAccess) SearchFiles(pattern string, extensions []string) ([]string
 
 	return paths, vars, nil
 }
-
-// TODO : centralize security checks
-// validatePattern performs security checks on the pattern to prevent path traversal attacks
-func validatePattern(pattern string) error {
-	// Check for path traversal attempts
-	if strings.Contains(pattern, "..") {
-		return fmt.Errorf("pattern cannot contain '..' (path traversal attempt)")
-	}
-
-	// Check for backslash path traversal (Windows-style)
-	if strings.Contains(pattern, "\\") {
-		return fmt.Errorf("pattern cannot contain backslashes (use forward slashes)")
-	}
-
-	// Check for empty segments
-	segments := strings.Split(pattern, "/")
-	for _, seg := range segments {
-		if seg == "" && seg != segments[0] { // Allow empty first segment for leading slash
-			return fmt.Errorf("pattern cannot contain empty segments")
-		}
-	}
-
-	// TODO : centralize security checks
-	// Check for any other potentially dangerous characters
-	dangerousChars := []string{"%00", "%2e", "%2f", "%5c", "~", "|", ">", "<", "*", "?"}
-	for _, char := range dangerousChars {
-		if strings.Contains(pattern, char) {
-			return fmt.Errorf("pattern contains potentially dangerous character: %s", char)
-		}
-	}
-
-	// Validate placeholder syntax
-	placeholderRegex := regexp.MustCompile(constants.PlaceholderRegex)
-	allPlaceholders := placeholderRegex.FindAllString(pattern, -1)
-	
-	// Check that all placeholders are properly formed
-	for _, ph := range allPlaceholders {
-		if !strings.HasPrefix(ph, constants.PlaceholderBegin) || !strings.HasSuffix(ph, constants.PlaceholderEnd) {
-			return fmt.Errorf("invalid placeholder syntax: %s", ph)
-		}
-	}
-
-	// Check for nested placeholders
-	if strings.Contains(pattern, constants.PlaceholderBegin+constants.PlaceholderBegin) || strings.Contains(pattern, constants.PlaceholderEnd+constants.PlaceholderEnd) {
-		return fmt.Errorf("nested placeholders are not allowed")
-	}
-
-	return nil
-}
@@ -0,0 +1,201 @@
+package fileAccess
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"Theatrum/domain/utils"
+)
+
+// newTestFileAccess returns a storage rooted in a temporary data directory, next to a secret file outside of it
+// which is linked from the data directory
+func newTestFileAccess(t testing.TB) (*FileAccess, string) {
+	t.Helper()
+
+	dir := filepath.ToSlash(t.TempDir())
+	dataDir := path.Join(dir, "data")
+	storage, err := newFileAccess(dataDir)
+	if err != nil {
+		t.Fatalf("newFileAccess error: %v", err)
+	}
+	t.Cleanup(func() { storage.root.Close() })
+
+	files := map[string]string{
+		"secret.mp4":                    "secret",
+		"data/raw/john/movie.mp4":       "movie",
+		"data/raw/alice/show.mkv":       "show",
+		"data/raw/alice/notes.txt":      "notes",
+		"data/encoded/john/master.m3u8": "#EXTM3U",
+	}
+	for file, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	links := map[string]string{
+		"data/raw/john/escape.mp4":   filepath.Join(dir, "secret.mp4"),
+		"data/raw/john/relative.mp4": "../../../secret.mp4",
+		"data/raw/john/inside.mp4":   "movie.mp4",
+		"data/raw/outside":           dir,
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Skipf("symbolic links are not supported: %v", err)
+		}
+	}
+
+	return storage, dataDir
+}
+
+func TestFileAccessStaysInRoot(t *testing.T) {
+	storage, dataDir := newTestFileAccess(t)
+
+	if data, err := storage.ReadFile(path.Join(dataDir, "raw/john/movie.mp4")); err != nil || string(data) != "movie" {
+		t.Errorf("ReadFile = %q, %v", data, err)
+	}
+	if data, err := storage.ReadFile(path.Join(dataDir, "raw/john/inside.mp4")); err != nil || string(data) != "movie" {
+		t.Errorf("ReadFile through a link inside the root = %q, %v", data, err)
+	}
+
+	for _, escape := range []string{"raw/john/escape.mp4", "raw/john/relative.mp4", "raw/outside/secret.mp4"} {
+		if data, err := storage.ReadFile(path.Join(dataDir, escape)); !errors.Is(err, utils.ErrUnsafePath) {
+			t.Errorf("ReadFile(%s) = %q, %v, want ErrUnsafePath", escape, data, err)
+		}
+		if _, _, err := storage.OpenFile(path.Join(dataDir, escape)); err == nil {
+			t.Errorf("OpenFile(%s) expected an error", escape)
+		}
+	}
+
+	outside := path.Join(dataDir, "..", "secret.mp4")
+	if _, err := storage.StatFile(outside); !errors.Is(err, utils.ErrUnsafePath) {
+		t.Errorf("StatFile(%s) error = %v, want ErrUnsafePath", outside, err)
+	}
+	if err := storage.WriteFile(path.Join(dataDir, "raw/outside/written.mp4"), []byte("x")); err == nil {
+		t.Errorf("WriteFile through a link outside the root expected an error")
+	}
+	if err := storage.MoveFile(path.Join(dataDir, "raw/john/movie.mp4"), path.Join(dataDir, "raw/outside/moved.mp4")); !errors.Is(err, utils.ErrUnsafePath) {
+		t.Errorf("MoveFile through a link outside the root error = %v, want ErrUnsafePath", err)
+	}
+
+	// The imported file is renamed from outside of the root, the destination directory must not lead out of it
+	localPath := filepath.Join(t.TempDir(), "upload.mp4")
+	if err := os.WriteFile(localPath, []byte("upload"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.ImportFile(localPath, path.Join(dataDir, "raw/outside/imported.mp4")); !errors.Is(err, utils.ErrUnsafePath) {
+		t.Errorf("ImportFile through a link outside the root error = %v, want ErrUnsafePath", err)
+	}
+	if _, err := os.Stat(path.Join(dataDir, "..", "imported.mp4")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ImportFile wrote a file outside the root: %v", err)
+	}
+	if err := storage.ImportFile(localPath, path.Join(dataDir, "raw/john/imported.mp4")); err != nil {
+		t.Errorf("ImportFile error = %v", err)
+	}
+	if data, err := storage.ReadFile(path.Join(dataDir, "raw/john/imported.mp4")); err != nil || string(data) != "upload" {
+		t.Errorf("imported file = %q, %v", data, err)
+	}
+
+	// Deleting a directory removes the links, not their targets
+	if err := storage.DeleteDirectory(path.Join(dataDir, "raw")); err != nil {
+		t.Fatalf("DeleteDirectory error: %v", err)
+	}
+	if _, err := os.Stat(path.Join(dataDir, "raw")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("raw still exists after DeleteDirectory: %v", err)
+	}
+	if _, err := os.Stat(path.Join(dataDir, "..", "secret.mp4")); err != nil {
+		t.Errorf("DeleteDirectory removed a file outside the root: %v", err)
+	}
+	if err := storage.DeleteDirectory(dataDir); !errors.Is(err, utils.ErrUnsafePath) {
+		t.Errorf("DeleteDirectory of the data directory error = %v, want ErrUnsafePath", err)
+	}
+}
+
+func TestFileAccessMoveFile(t *testing.T) {
+	storage, dataDir := newTestFileAccess(t)
+
+	source := path.Join(dataDir, "raw/alice/show.mkv")
+	archived := path.Join(dataDir, "archive/alice/2024-03-09/show.mkv")
+	if err := storage.MoveFile(source, archived); err != nil {
+		t.Fatalf("MoveFile error: %v", err)
+	}
+	if data, err := storage.ReadFile(archived); err != nil || string(data) != "show" {
+		t.Errorf("ReadFile of moved file = %q, %v", data, err)
+	}
+	if _, err := storage.StatFile(source); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("StatFile of moved file error = %v, want fs.ErrNotExist", err)
+	}
+
+	files, err := storage.ListFiles(path.Join(dataDir, "archive/*/*/*.mkv"))
+	if err != nil || len(files) != 1 || files[0] != archived {
+		t.Errorf("ListFiles = %v, %v, want %v", files, err, []string{archived})
+	}
+}
+
+func TestFileAccessSearchFiles(t *testing.T) {
+	storage, dataDir := newTestFileAccess(t)
+
+	files, vars, err := storage.SearchFiles(path.Join(dataDir, "raw/{username}"), []string{".mp4", ".mkv"})
+	if err != nil {
+		t.Fatalf("SearchFiles error: %v", err)
+	}
+
+	expected := map[string]string{
+		path.Join(dataDir, "raw/alice/show.mkv"):  "alice",
+		path.Join(dataDir, "raw/john/movie.mp4"):  "john",
+		path.Join(dataDir, "raw/john/inside.mp4"): "john",
+	}
+	if len(files) != len(expected) {
+		t.Fatalf("SearchFiles = %v, want %d files", files, len(expected))
+	}
+	for i, file := range files {
+		if username, found := expected[file]; !found || vars[i]["username"] != username {
+			t.Errorf("SearchFiles found %s with %v", file, vars[i])
+		}
+	}
+}
+
+// FuzzSearchFiles checks that no search pattern finds a file outside of the data directory, or one not matching the pattern
+func FuzzSearchFiles(f *testing.F) {
+	for _, seed := range []string{"raw/{username}", "raw/john", "{kind}/{username}/master.m3u8", "raw/{username:int}", "..", "raw/../..", "raw/outside", "raw/{x:.+}", "/{a}", "raw/{username:j.*}/escape.mp4"} {
+		f.Add(seed)
+	}
+
+	storage, dataDir := newTestFileAccess(f)
+	f.Fuzz(func(t *testing.T, pattern string) {
+		search := dataDir + "/" + pattern
+		files, vars, err := storage.SearchFiles(search, nil)
+		if err != nil {
+			return
+		}
+
+		compiled, err := utils.CompilePathPattern(search)
+		if err != nil {
+			t.Fatalf("SearchFiles accepted the invalid pattern %q: %v", search, err)
+		}
+		for i, file := range files {
+			if !strings.HasPrefix(file, dataDir+"/") {
+				t.Errorf("SearchFiles(%q) found %s outside of the data directory", search, file)
+			}
+			if _, err := storage.ReadFile(file); err != nil {
+				t.Errorf("SearchFiles(%q) found %s which cannot be read: %v", search, file, err)
+			}
+			if _, matched := compiled.Match(file, nil); !matched {
+				t.Errorf("SearchFiles(%q) found %s not matching the pattern", search, file)
+			}
+			for name, value := range vars[i] {
+				if strings.Contains(value, "/") {
+					t.Errorf("SearchFiles(%q) extracted %s=%q across segments", search, name, value)
+				}
+			}
+		}
+	})
+}
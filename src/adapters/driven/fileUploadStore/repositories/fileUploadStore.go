@@ -0,0 +1,157 @@
+package repositories
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+)
+
+// infoSuffix is appended to the ID of an upload to name the JSON file describing it, its data file is named after the ID
+const infoSuffix = ".info"
+
+// FileUploadStore implements the UploadStorePort interface with a data file and a JSON info file per upload in a directory
+type FileUploadStore struct {
+	dir string
+}
+
+// Verify interface implementation
+var _ repositories.UploadStorePort = (*FileUploadStore)(nil)
+
+// NewFileUploadStore keeps the uploads in the given directory, created with the first upload
+func NewFileUploadStore(dir string) repositories.UploadStorePort {
+	return &FileUploadStore{dir: dir}
+}
+
+func (s *FileUploadStore) CreateUpload(upload models.Upload) error {
+	if err := s.checkID(upload.ID); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return fmt.Errorf("error encoding upload %s: %w", upload.ID, err)
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("error creating upload directory %s: %w", s.dir, err)
+	}
+	if err := os.WriteFile(s.UploadPath(upload.ID), nil, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(s.UploadPath(upload.ID)+infoSuffix, data, 0644)
+}
+
+// GetUpload reads the info file of an upload, its offset and last update come from its data file
+func (s *FileUploadStore) GetUpload(id string) (models.Upload, error) {
+	if err := s.checkID(id); err != nil {
+		return models.Upload{}, err
+	}
+
+	data, err := os.ReadFile(s.UploadPath(id) + infoSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return models.Upload{}, fmt.Errorf("%w: %s", repositories.ErrUploadNotFound, id)
+	}
+	if err != nil {
+		return models.Upload{}, err
+	}
+
+	var upload models.Upload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return models.Upload{}, fmt.Errorf("error decoding upload %s: %w", id, err)
+	}
+
+	info, err := os.Stat(s.UploadPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return models.Upload{}, fmt.Errorf("%w: %s", repositories.ErrUploadNotFound, id)
+	}
+	if err != nil {
+		return models.Upload{}, err
+	}
+	upload.Offset = info.Size()
+	upload.UpdatedAt = info.ModTime()
+
+	return upload, nil
+}
+
+func (s *FileUploadStore) ListUploads() ([]models.Upload, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []models.Upload{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	uploads := []models.Upload{}
+	for _, entry := range entries {
+		id, isInfo := strings.CutSuffix(entry.Name(), infoSuffix)
+		if !isInfo {
+			continue
+		}
+		upload, err := s.GetUpload(id)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, nil
+}
+
+func (s *FileUploadStore) WriteUpload(id string, data io.Reader, limit int64) (int64, error) {
+	if err := s.checkID(id); err != nil {
+		return 0, err
+	}
+
+	file, err := os.OpenFile(s.UploadPath(id), os.O_WRONLY|os.O_APPEND, 0644)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, fmt.Errorf("%w: %s", repositories.ErrUploadNotFound, id)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := io.Copy(file, io.LimitReader(data, limit))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return written, err
+}
+
+func (s *FileUploadStore) UploadPath(id string) string {
+	return filepath.Join(s.dir, id)
+}
+
+func (s *FileUploadStore) DeleteUpload(id string) error {
+	if err := s.checkID(id); err != nil {
+		return err
+	}
+
+	err := os.Remove(s.UploadPath(id) + infoSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", repositories.ErrUploadNotFound, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The data of a complete upload was already moved to the storage
+	if err := os.Remove(s.UploadPath(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// checkID rejects the IDs which are not a plain file name, they come from the request URLs
+func (s *FileUploadStore) checkID(id string) error {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return fmt.Errorf("%w: %s", repositories.ErrUploadNotFound, id)
+	}
+	return nil
+}
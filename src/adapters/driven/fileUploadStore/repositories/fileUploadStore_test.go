@@ -0,0 +1,55 @@
+package repositories
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+)
+
+func TestFileUploadStore(t *testing.T) {
+	store := NewFileUploadStore(path.Join(t.TempDir(), "uploads"))
+
+	upload := models.Upload{ID: "0123456789abcdef", Token: "john", Channel: "/video/{username}", Vars: map[string]string{"username": "john"}, FileName: "movie.mp4", Size: 10, CreatedAt: time.Now()}
+	if err := store.CreateUpload(upload); err != nil {
+		t.Fatalf("CreateUpload() error = %v", err)
+	}
+
+	// Chunks are appended, the offset is the number of bytes stored
+	for _, chunk := range []string{"movie", "data-and-more"} {
+		if _, err := store.WriteUpload(upload.ID, strings.NewReader(chunk), 5); err != nil {
+			t.Fatalf("WriteUpload() error = %v", err)
+		}
+	}
+	stored, err := store.GetUpload(upload.ID)
+	if err != nil {
+		t.Fatalf("GetUpload() error = %v", err)
+	}
+	if stored.Offset != 10 || stored.FileName != upload.FileName || stored.Vars["username"] != "john" || !stored.Complete() {
+		t.Errorf("GetUpload() = %+v", stored)
+	}
+	if data, err := os.ReadFile(store.UploadPath(upload.ID)); err != nil || string(data) != "moviedata-" {
+		t.Errorf("upload data = %q, %v", data, err)
+	}
+
+	if uploads, err := store.ListUploads(); err != nil || len(uploads) != 1 {
+		t.Errorf("ListUploads() = %v, %v, want 1 upload", uploads, err)
+	}
+
+	if err := store.DeleteUpload(upload.ID); err != nil {
+		t.Fatalf("DeleteUpload() error = %v", err)
+	}
+	if _, err := store.GetUpload(upload.ID); !errors.Is(err, repositories.ErrUploadNotFound) {
+		t.Errorf("GetUpload() of deleted upload error = %v, want ErrUploadNotFound", err)
+	}
+
+	// The IDs come from the request URLs
+	if _, err := store.GetUpload("../jobs.db"); !errors.Is(err, repositories.ErrUploadNotFound) {
+		t.Errorf("GetUpload() of a path error = %v, want ErrUploadNotFound", err)
+	}
+}
@@ -0,0 +1,153 @@
+package repositories
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+
+	"Theatrum/constants"
+	"Theatrum/domain/repositories"
+)
+
+// eventsBufferSize is the number of events kept while the consumer is busy, newer events are dropped
+const eventsBufferSize = 256
+
+// FsnotifyWatcher implements the WatcherPort interface using the OS file notifications (inotify on Linux)
+type FsnotifyWatcher struct {
+	watcher *fsnotify.Watcher
+	events  chan string
+	mu      sync.Mutex
+	roots   map[string]int // Maximum depth watched below each root
+	done    chan struct{}
+}
+
+// Verify interface implementation
+var _ repositories.WatcherPort = (*FsnotifyWatcher)(nil)
+
+// NewFsnotifyWatcher creates a watcher and starts forwarding its events
+func NewFsnotifyWatcher() (repositories.WatcherPort, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("error creating file watcher: %w", err)
+	}
+
+	w := &FsnotifyWatcher{
+		watcher: watcher,
+		events:  make(chan string, eventsBufferSize),
+		roots:   make(map[string]int),
+		done:    make(chan struct{}),
+	}
+	go w.forward()
+
+	return w, nil
+}
+
+// Watch watches the literal root of the pattern and its subdirectories, down to the depth of the pattern
+// Notifications are not recursive, so the directories created afterwards are added as they appear
+func (w *FsnotifyWatcher) Watch(pattern string) error {
+	root := patternRoot(pattern)
+	depth := strings.Count(pattern, "/") - strings.Count(root, "/")
+
+	w.mu.Lock()
+	w.roots[root] = max(w.roots[root], depth)
+	w.mu.Unlock()
+
+	return w.addTree(root)
+}
+
+func (w *FsnotifyWatcher) Events() <-chan string {
+	return w.events
+}
+
+func (w *FsnotifyWatcher) Close() error {
+	close(w.done)
+	return w.watcher.Close()
+}
+
+// patternRoot returns the directory made of the literal segments of a pattern, before its first placeholder
+func patternRoot(pattern string) string {
+	root := pattern
+	if index := strings.Index(pattern, constants.PlaceholderBegin); index >= 0 {
+		root = pattern[:index]
+	}
+	return filepath.ToSlash(filepath.Clean(root))
+}
+
+// maxDepth returns how deep below its root a directory may be watched, or -1 if it is outside every root
+func (w *FsnotifyWatcher) maxDepth(dir string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	depth := -1
+	for root, rootDepth := range w.roots {
+		if dir != root && !strings.HasPrefix(dir, root+"/") {
+			continue
+		}
+		depth = max(depth, rootDepth-(strings.Count(dir, "/")-strings.Count(root, "/")))
+	}
+	return depth
+}
+
+// addTree watches a directory and its subdirectories within the depth of their pattern
+func (w *FsnotifyWatcher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		path = filepath.ToSlash(path)
+		if w.maxDepth(path) < 0 {
+			return filepath.SkipDir
+		}
+		if err := w.watcher.Add(path); err != nil {
+			return fmt.Errorf("error watching %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// forward translates the notifications into file paths, and watches the new directories
+func (w *FsnotifyWatcher) forward() {
+	for {
+		select {
+		case <-w.done:
+			return
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("File watcher error: %v", err)
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) && !event.Has(fsnotify.Rename) {
+				continue
+			}
+
+			path := filepath.ToSlash(event.Name)
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(path); err == nil && info.IsDir() {
+					if err := w.addTree(path); err != nil {
+						log.Printf("Error watching new directory: %v", err)
+					}
+				}
+			}
+
+			// Never block the notifications, the periodic rescan catches the dropped events
+			select {
+			case w.events <- path:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPatternRoot(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		expected string
+	}{
+		{name: "placeholder", pattern: "/data/raw_videos/{username}", expected: "/data/raw_videos"},
+		{name: "nested placeholders", pattern: "/data/{username}/{stream}/raw", expected: "/data"},
+		{name: "no placeholder", pattern: "/data/raw_videos", expected: "/data/raw_videos"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := patternRoot(tt.pattern); got != tt.expected {
+				t.Errorf("patternRoot() = %s, expected %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFsnotifyWatcherNewDirectory(t *testing.T) {
+	root := filepath.ToSlash(t.TempDir())
+
+	watcher, err := NewFsnotifyWatcher()
+	if err != nil {
+		t.Fatalf("NewFsnotifyWatcher() error = %v", err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Watch(root + "/{username}"); err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+
+	// The directory of a new user is watched as soon as it is created
+	userDir := root + "/john"
+	if err := os.Mkdir(userDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvent(t, watcher.Events(), userDir)
+
+	video := userDir + "/video.mp4"
+	if err := os.WriteFile(video, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvent(t, watcher.Events(), video)
+}
+
+func waitForEvent(t *testing.T, events <-chan string, expected string) {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event == expected {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("no event received for %s", expected)
+		}
+	}
+}
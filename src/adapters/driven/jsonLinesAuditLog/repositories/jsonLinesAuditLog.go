@@ -0,0 +1,45 @@
+package repositories
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+)
+
+// JsonLinesAuditLog implements the RetentionAuditPort interface by appending one JSON object per line to a local file
+type JsonLinesAuditLog struct {
+	logPath string
+	mu      sync.Mutex
+}
+
+// Verify interface implementation
+var _ repositories.RetentionAuditPort = (*JsonLinesAuditLog)(nil)
+
+// NewJsonLinesAuditLog returns an audit log appending to the file at the given path, created on the first entry
+func NewJsonLinesAuditLog(logPath string) repositories.RetentionAuditPort {
+	return &JsonLinesAuditLog{logPath: logPath}
+}
+
+func (l *JsonLinesAuditLog) Record(entry models.RetentionAuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding audit entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.OpenFile(l.logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening audit log %s: %w", l.logPath, err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing audit log %s: %w", l.logPath, err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,54 @@
+package repositories
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"Theatrum/domain/models"
+)
+
+func TestJsonLinesAuditLog(t *testing.T) {
+	logPath := path.Join(t.TempDir(), "retention_audit.log")
+	auditLog := NewJsonLinesAuditLog(logPath)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	entries := []models.RetentionAuditEntry{
+		{Time: now, Channel: "/video/{username}", Owner: "john", Directory: "/data/records/john/old", Reason: "max_age", Size: 1024},
+		{Time: now, Channel: "/video/{username}", Owner: "alice", Directory: "/data/records/alice/old", Reason: "max_count", DryRun: true},
+	}
+	for _, entry := range entries {
+		if err := auditLog.Record(entry); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	file, err := os.Open(logPath)
+	if err != nil {
+		t.Fatalf("opening audit log: %v", err)
+	}
+	defer file.Close()
+
+	// Every entry is appended on its own line
+	var recorded []models.RetentionAuditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry models.RetentionAuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("line %q is not an audit entry: %v", scanner.Text(), err)
+		}
+		recorded = append(recorded, entry)
+	}
+
+	if len(recorded) != len(entries) {
+		t.Fatalf("recorded %d entries, want %d", len(recorded), len(entries))
+	}
+	for i := range entries {
+		if recorded[i] != entries[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, recorded[i], entries[i])
+		}
+	}
+}
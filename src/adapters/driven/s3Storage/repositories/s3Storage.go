@@ -0,0 +1,459 @@
+package repositories
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"Theatrum/constants"
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+	"Theatrum/domain/utils"
+)
+
+// contentTypes completes the MIME types known by the system for the HLS files
+var contentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+}
+
+// S3Storage implements the StoragePort interface over an S3 compatible bucket, such as MinIO.
+// The bucket mirrors the data directory: the key of a file is its path relative to the data directory, after the prefix.
+// The data directory only holds the files fetched for, or written by, FFmpeg.
+type S3Storage struct {
+	client *minio.Client
+	bucket string
+	prefix string
+	root   string // Local directory mirrored by the bucket
+}
+
+// Verify interface implementation
+var _ repositories.StoragePort = (*S3Storage)(nil)
+
+// NewS3Storage connects to the bucket mirroring the data directory
+func NewS3Storage(settings models.S3Storage) (repositories.StoragePort, error) {
+	return newS3Storage(settings, constants.VideoDir)
+}
+
+func newS3Storage(settings models.S3Storage, root string) (*S3Storage, error) {
+	// Without configured keys, the credentials are read from the AWS_ or MINIO_ environment variables
+	creds := credentials.NewChainCredentials([]credentials.Provider{&credentials.EnvAWS{}, &credentials.EnvMinio{}})
+	if settings.AccessKey != "" {
+		creds = credentials.NewStaticV4(settings.AccessKey, settings.SecretKey, "")
+	}
+
+	client, err := minio.New(settings.Endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: settings.UseSSL,
+		Region: settings.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating s3 client for %s: %w", settings.Endpoint, err)
+	}
+
+	// Fail at startup rather than at the first encode
+	exists, err := client.BucketExists(context.Background(), settings.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("error reaching s3 bucket %s: %w", settings.Bucket, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("s3 bucket %s does not exist", settings.Bucket)
+	}
+
+	return &S3Storage{
+		client: client,
+		bucket: settings.Bucket,
+		prefix: strings.Trim(settings.Prefix, "/"),
+		root:   path.Clean(root),
+	}, nil
+}
+
+func (s *S3Storage) ReadFile(storagePath string) ([]byte, error) {
+	object, err := s.getObject(storagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return nil, s.wrapError(storagePath, err)
+	}
+	return data, nil
+}
+
+// OpenFile returns the object, which fetches the requested ranges from the server as it is read
+func (s *S3Storage) OpenFile(storagePath string) (io.ReadSeekCloser, models.FileInfo, error) {
+	object, err := s.getObject(storagePath)
+	if err != nil {
+		return nil, models.FileInfo{}, err
+	}
+
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, models.FileInfo{}, s.wrapError(storagePath, err)
+	}
+	return object, models.FileInfo{Size: info.Size, ModTime: info.LastModified}, nil
+}
+
+func (s *S3Storage) ReadFileHeader(storagePath string, size int) ([]byte, error) {
+	object, err := s.getObject(storagePath)
+	if err != nil {
+		return nil, err
+	}
+	// Closing the object stops the download of the rest of the file
+	defer object.Close()
+
+	header := make([]byte, size)
+	n, err := io.ReadFull(object, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, s.wrapError(storagePath, err)
+	}
+	return header[:n], nil
+}
+
+func (s *S3Storage) WriteFile(storagePath string, data []byte) error {
+	key, err := s.key(storagePath)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutObject(context.Background(), s.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: contentType(key),
+	})
+	return s.wrapError(storagePath, err)
+}
+
+func (s *S3Storage) DeleteFile(storagePath string) error {
+	key, err := s.key(storagePath)
+	if err != nil {
+		return err
+	}
+
+	// Removing a missing object succeeds on S3, it is reported like a missing file
+	if _, err := s.client.StatObject(context.Background(), s.bucket, key, minio.StatObjectOptions{}); err != nil {
+		return s.wrapError(storagePath, err)
+	}
+	return s.wrapError(storagePath, s.client.RemoveObject(context.Background(), s.bucket, key, minio.RemoveObjectOptions{}))
+}
+
+// MoveFile copies the object on the server then removes the source, the destination object only appears once fully copied
+func (s *S3Storage) MoveFile(sourcePath string, destinationPath string) error {
+	sourceKey, err := s.key(sourcePath)
+	if err != nil {
+		return err
+	}
+	destinationKey, err := s.key(destinationPath)
+	if err != nil {
+		return err
+	}
+
+	// Compose copies objects of any size, a plain copy is limited to 5 GiB
+	_, err = s.client.ComposeObject(context.Background(),
+		minio.CopyDestOptions{Bucket: s.bucket, Object: destinationKey},
+		minio.CopySrcOptions{Bucket: s.bucket, Object: sourceKey},
+	)
+	if err != nil {
+		return s.wrapError(sourcePath, err)
+	}
+	return s.wrapError(sourcePath, s.client.RemoveObject(context.Background(), s.bucket, sourceKey, minio.RemoveObjectOptions{}))
+}
+
+// ListFiles returns the files matching a glob pattern, with the syntax of path.Match
+func (s *S3Storage) ListFiles(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	// Only the objects under the literal part of the pattern are listed
+	literal := pattern
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		literal = pattern[:i]
+	}
+
+	var files []string
+	err := s.listFiles(literal, func(storagePath string) {
+		if matched, _ := path.Match(pattern, storagePath); matched {
+			files = append(files, storagePath)
+		}
+	})
+	return files, err
+}
+
+func (s *S3Storage) GetFileSize(storagePath string) (int64, error) {
+	info, err := s.StatFile(storagePath)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+func (s *S3Storage) StatFile(storagePath string) (models.FileInfo, error) {
+	key, err := s.key(storagePath)
+	if err != nil {
+		return models.FileInfo{}, err
+	}
+
+	info, err := s.client.StatObject(context.Background(), s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return models.FileInfo{}, s.wrapError(storagePath, err)
+	}
+	return models.FileInfo{Size: info.Size, ModTime: info.LastModified}, nil
+}
+
+func (s *S3Storage) HashFile(storagePath string) (string, error) {
+	object, err := s.getObject(storagePath)
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, object); err != nil {
+		return "", s.wrapError(storagePath, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (s *S3Storage) DirectorySize(storagePath string) (int64, error) {
+	var size int64
+	err := s.listObjects(strings.TrimSuffix(storagePath, "/")+"/", func(object minio.ObjectInfo) {
+		size += object.Size
+	})
+	return size, err
+}
+
+// DeleteDirectory removes the objects whose key starts with the directory
+func (s *S3Storage) DeleteDirectory(storagePath string) error {
+	var keys []string
+	err := s.listObjects(strings.TrimSuffix(storagePath, "/")+"/", func(object minio.ObjectInfo) {
+		keys = append(keys, object.Key)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := s.client.RemoveObject(context.Background(), s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+			return s.wrapError(s.storagePath(key), err)
+		}
+	}
+	return nil
+}
+
+// SearchFiles matches the object keys, as paths of the data directory, against the pattern,
+// see FileAccess.SearchFiles for the pattern rules
+func (s *S3Storage) SearchFiles(pattern string, extensions []string) ([]string, []map[string]string, error) {
+	searchPattern, err := utils.CompilePathPattern(pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		paths []string
+		vars  []map[string]string
+	)
+	err = s.listFiles(searchPattern.Root(), func(storagePath string) {
+		if m, matched := searchPattern.Match(storagePath, extensions); matched {
+			paths = append(paths, storagePath)
+			vars = append(vars, m)
+		}
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error searching files: %w", err)
+	}
+
+	return paths, vars, nil
+}
+
+// FetchFile downloads the object to its path in the data directory
+func (s *S3Storage) FetchFile(storagePath string) (func(), error) {
+	key, err := s.key(storagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.client.FGetObject(context.Background(), s.bucket, key, filepath.FromSlash(storagePath), minio.GetObjectOptions{}); err != nil {
+		return nil, s.wrapError(storagePath, err)
+	}
+
+	release := func() {
+		if err := os.Remove(filepath.FromSlash(storagePath)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing local copy of %s: %v", storagePath, err)
+		}
+	}
+	return release, nil
+}
+
+// ImportFile uploads the local file then removes it
+func (s *S3Storage) ImportFile(localPath string, storagePath string) error {
+	key, err := s.key(storagePath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.client.FPutObject(context.Background(), s.bucket, key, localPath, minio.PutObjectOptions{
+		ContentType: contentType(key),
+	}); err != nil {
+		return fmt.Errorf("error uploading %s: %w", localPath, err)
+	}
+	return os.Remove(localPath)
+}
+
+// StageDirectory creates a directory of its own in the encodes directory, from where its files are uploaded
+func (s *S3Storage) StageDirectory() (string, func(), error) {
+	if err := os.MkdirAll(constants.EncodesDir, 0755); err != nil {
+		return "", nil, fmt.Errorf("error creating encodes directory: %w", err)
+	}
+	localDir, err := os.MkdirTemp(constants.EncodesDir, "encode-")
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating staging directory: %w", err)
+	}
+
+	release := func() {
+		if err := os.RemoveAll(localDir); err != nil {
+			log.Printf("Error removing staging directory %s: %v", localDir, err)
+		}
+	}
+	return filepath.ToSlash(localDir), release, nil
+}
+
+// PublishDirectory uploads every file beneath the local directory to the storage directory, the ones of the deepest
+// subdirectories first
+func (s *S3Storage) PublishDirectory(localDir string, storagePath string) error {
+	files := []string{}
+	err := filepath.WalkDir(filepath.FromSlash(localDir), func(localPath string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		relativePath, err := filepath.Rel(filepath.FromSlash(localDir), localPath)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(relativePath))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	slices.SortStableFunc(files, func(a, b string) int {
+		return cmp.Compare(strings.Count(b, "/"), strings.Count(a, "/"))
+	})
+
+	for _, file := range files {
+		if err := s.ImportFile(filepath.Join(filepath.FromSlash(localDir), filepath.FromSlash(file)), path.Join(storagePath, file)); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Uploaded %d files of %s to bucket %s", len(files), storagePath, s.bucket)
+	return nil
+}
+
+// key returns the object key of a path of the data directory
+func (s *S3Storage) key(storagePath string) (string, error) {
+	relativePath, err := utils.RelativeToRoot(s.root, storagePath)
+	if err != nil {
+		return "", err
+	}
+	if relativePath == "." {
+		relativePath = ""
+	}
+	return path.Join(s.prefix, relativePath), nil
+}
+
+// storagePath returns the path in the data directory of an object key
+func (s *S3Storage) storagePath(key string) string {
+	return path.Join(s.root, strings.TrimPrefix(key, s.prefix))
+}
+
+// listFiles calls found with the path of every object whose path starts with the given path prefix
+func (s *S3Storage) listFiles(pathPrefix string, found func(storagePath string)) error {
+	return s.listObjects(pathPrefix, func(object minio.ObjectInfo) {
+		found(s.storagePath(object.Key))
+	})
+}
+
+// listObjects calls found with every object whose path starts with the given path prefix
+func (s *S3Storage) listObjects(pathPrefix string, found func(object minio.ObjectInfo)) error {
+	keyPrefix, err := s.key(pathPrefix)
+	if err != nil {
+		return err
+	}
+	// The keys of the data directory itself are beneath the prefix, not next to it
+	if keyPrefix == s.prefix && s.prefix != "" {
+		keyPrefix += "/"
+	}
+	// The path prefix may end with a partial file name, kept by key
+	if strings.HasSuffix(pathPrefix, "/") && !strings.HasSuffix(keyPrefix, "/") {
+		keyPrefix += "/"
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: keyPrefix, Recursive: true}) {
+		if object.Err != nil {
+			return object.Err
+		}
+		found(object)
+	}
+	return nil
+}
+
+func (s *S3Storage) getObject(storagePath string) (*minio.Object, error) {
+	key, err := s.key(storagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := s.client.GetObject(context.Background(), s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s.wrapError(storagePath, err)
+	}
+	return object, nil
+}
+
+// wrapError reports the missing objects as missing files
+func (s *S3Storage) wrapError(storagePath string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NotFound":
+		return &fs.PathError{Op: "open", Path: storagePath, Err: fs.ErrNotExist}
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return fmt.Errorf("s3 storage %s: %w", storagePath, err)
+}
+
+func contentType(key string) string {
+	ext := strings.ToLower(path.Ext(key))
+	if contentType, found := contentTypes[ext]; found {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,206 @@
+package repositories
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"Theatrum/constants"
+	"Theatrum/domain/models"
+)
+
+// newTestS3Storage connects to the MinIO server given by THEATRUM_S3_TEST_ENDPOINT, the test is skipped without it.
+// The bucket defaults to theatrum-test, the credentials are read from the AWS_ or MINIO_ environment variables.
+func newTestS3Storage(t *testing.T) *S3Storage {
+	t.Helper()
+
+	endpoint := os.Getenv("THEATRUM_S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("THEATRUM_S3_TEST_ENDPOINT is not set")
+	}
+	bucket := os.Getenv("THEATRUM_S3_TEST_BUCKET")
+	if bucket == "" {
+		bucket = "theatrum-test"
+	}
+
+	// Every test works under its own prefix
+	prefix := path.Join("theatrum-tests", t.Name(), time.Now().Format("20060102150405.000000000"))
+	storage, err := newS3Storage(models.S3Storage{Endpoint: endpoint, Bucket: bucket, Prefix: prefix}, t.TempDir())
+	if err != nil {
+		t.Fatalf("newS3Storage error: %v", err)
+	}
+
+	t.Cleanup(func() {
+		var files []string
+		storage.listFiles(storage.root, func(storagePath string) { files = append(files, storagePath) })
+		for _, file := range files {
+			storage.DeleteFile(file)
+		}
+	})
+	return storage
+}
+
+func TestS3StorageKey(t *testing.T) {
+	storage := &S3Storage{prefix: "theatrum", root: "/srv/data"}
+
+	tests := []struct {
+		path     string
+		expected string
+		invalid  bool
+	}{
+		{path: "/srv/data/raw/john/movie.mp4", expected: "theatrum/raw/john/movie.mp4"},
+		{path: "/srv/data", expected: "theatrum"},
+		{path: "/srv/data/../etc/passwd", invalid: true},
+		{path: "/srv/database/file", invalid: true},
+	}
+
+	for _, tt := range tests {
+		key, err := storage.key(tt.path)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("key(%q) expected an error, got %q", tt.path, key)
+			}
+			continue
+		}
+		if err != nil || key != tt.expected {
+			t.Errorf("key(%q) = %q, %v, want %q", tt.path, key, err, tt.expected)
+		}
+		if back := storage.storagePath(key); back != path.Clean(tt.path) {
+			t.Errorf("storagePath(%q) = %q, want %q", key, back, tt.path)
+		}
+	}
+}
+
+func TestS3StorageFiles(t *testing.T) {
+	storage := newTestS3Storage(t)
+	source := path.Join(storage.root, "raw", "john", "movie.mp4")
+
+	if err := storage.WriteFile(source, []byte("movie")); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+	if data, err := storage.ReadFile(source); err != nil || string(data) != "movie" {
+		t.Fatalf("ReadFile = %q, %v", data, err)
+	}
+	if header, err := storage.ReadFileHeader(source, 2); err != nil || string(header) != "mo" {
+		t.Errorf("ReadFileHeader = %q, %v", header, err)
+	}
+	if info, err := storage.StatFile(source); err != nil || info.Size != 5 {
+		t.Errorf("StatFile = %+v, %v", info, err)
+	}
+
+	// Range requests seek into the object
+	file, info, err := storage.OpenFile(source)
+	if err != nil || info.Size != 5 || info.ModTime.IsZero() {
+		t.Fatalf("OpenFile = %+v, %v", info, err)
+	}
+	if _, err := file.Seek(2, io.SeekStart); err != nil {
+		t.Fatalf("Seek error: %v", err)
+	}
+	if data, err := io.ReadAll(file); err != nil || string(data) != "vie" {
+		t.Errorf("read after Seek = %q, %v", data, err)
+	}
+	file.Close()
+
+	archived := path.Join(storage.root, "archive", "john", "movie.mp4")
+	if err := storage.MoveFile(source, archived); err != nil {
+		t.Fatalf("MoveFile error: %v", err)
+	}
+	if _, err := storage.ReadFile(source); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadFile of moved file error = %v, want fs.ErrNotExist", err)
+	}
+
+	files, err := storage.ListFiles(path.Join(storage.root, "archive", "*", "*.mp4"))
+	if err != nil || !slices.Equal(files, []string{archived}) {
+		t.Errorf("ListFiles = %v, %v, want %v", files, err, []string{archived})
+	}
+
+	if err := storage.DeleteFile(archived); err != nil {
+		t.Fatalf("DeleteFile error: %v", err)
+	}
+	if err := storage.DeleteFile(archived); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("DeleteFile of deleted file error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestS3StorageSearchFiles(t *testing.T) {
+	storage := newTestS3Storage(t)
+
+	for _, file := range []string{"raw/john/movie.mp4", "raw/alice/show.mkv", "raw/alice/notes.txt", "encoded/john/master.m3u8"} {
+		if err := storage.WriteFile(path.Join(storage.root, file), []byte(file)); err != nil {
+			t.Fatalf("WriteFile error: %v", err)
+		}
+	}
+
+	files, vars, err := storage.SearchFiles(path.Join(storage.root, "raw", "{username}"), []string{".mp4", ".mkv"})
+	if err != nil {
+		t.Fatalf("SearchFiles error: %v", err)
+	}
+
+	expected := map[string]map[string]string{
+		path.Join(storage.root, "raw/alice/show.mkv"): {"username": "alice", "FILENAME": "show.mkv"},
+		path.Join(storage.root, "raw/john/movie.mp4"): {"username": "john", "FILENAME": "movie.mp4"},
+	}
+	if len(files) != len(expected) {
+		t.Fatalf("SearchFiles = %v, want %d files", files, len(expected))
+	}
+	for i, file := range files {
+		if !maps.Equal(vars[i], expected[file]) {
+			t.Errorf("SearchFiles vars of %s = %v, want %v", file, vars[i], expected[file])
+		}
+	}
+}
+
+func TestS3StoragePublishDirectory(t *testing.T) {
+	storage := newTestS3Storage(t)
+	outputDir := path.Join(storage.root, "encoded", "john", "movie")
+
+	encodesDir := constants.EncodesDir
+	constants.EncodesDir = filepath.ToSlash(t.TempDir())
+	t.Cleanup(func() { constants.EncodesDir = encodesDir })
+
+	localDir, release, err := storage.StageDirectory()
+	if err != nil {
+		t.Fatalf("StageDirectory error: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(localDir, "720p"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(localDir, "720p", "segment_000.ts"), []byte("segment"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.PublishDirectory(localDir, outputDir); err != nil {
+		t.Fatalf("PublishDirectory error: %v", err)
+	}
+	release()
+	if _, err := os.Stat(localDir); !os.IsNotExist(err) {
+		t.Errorf("staging directory still exists after its release: %v", err)
+	}
+
+	segment := path.Join(outputDir, "720p", "segment_000.ts")
+	releaseSegment, err := storage.FetchFile(segment)
+	if err != nil {
+		t.Fatalf("FetchFile error: %v", err)
+	}
+	if data, err := os.ReadFile(segment); err != nil || string(data) != "segment" {
+		t.Errorf("fetched file = %q, %v", data, err)
+	}
+	releaseSegment()
+	if _, err := os.Stat(segment); !os.IsNotExist(err) {
+		t.Errorf("fetched file still exists after release: %v", err)
+	}
+
+	if err := storage.DeleteDirectory(outputDir); err != nil {
+		t.Fatalf("DeleteDirectory error: %v", err)
+	}
+	if size, err := storage.DirectorySize(outputDir); err != nil || size != 0 {
+		t.Errorf("DirectorySize after DeleteDirectory = %d, %v, want 0", size, err)
+	}
+}
@@ -10,6 +10,94 @@ type Config struct {
 type Application struct {
 	PublicPath         string             `yaml:"public_path"`
 	AllStreamsPlaylist AllStreamsPlaylist `yaml:"all_streams_playlist"`
+	Encoding           Encoding           `yaml:"encoding,omitempty"`
+	Watch              Watch              `yaml:"watch,omitempty"`
+	Storage            Storage            `yaml:"storage,omitempty"`
+	Inventory          Inventory          `yaml:"inventory,omitempty"`
+	Janitor            Janitor            `yaml:"janitor,omitempty"`
+	Uploads            Uploads            `yaml:"uploads,omitempty"`
+	Api                Api                `yaml:"api,omitempty"`
+}
+
+type Api struct {
+	Tokens []ApiToken `yaml:"tokens,omitempty"` // Tokens of the jobs and usage API (default: none, the API refuses every request)
+}
+
+type ApiToken struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"` // Sent as "Authorization: Bearer <token>"
+}
+
+type Uploads struct {
+	Enabled     bool          `yaml:"enabled,omitempty"`      // Serve the resumable upload API under /api/uploads (default: false)
+	MaxSize     string        `yaml:"max_size,omitempty"`     // Largest source accepted, e.g. "50G" (default: no limit)
+	ExpireAfter string        `yaml:"expire_after,omitempty"` // How long an unfinished upload is kept after its last chunk (default: 24h)
+	Tokens      []UploadToken `yaml:"tokens,omitempty"`
+}
+
+type UploadToken struct {
+	Name     string            `yaml:"name"`
+	Token    string            `yaml:"token"`
+	Channels []string          `yaml:"channels,omitempty"` // Channels the token can upload to (default: every video_unencoded channel)
+	Vars     map[string]string `yaml:"vars,omitempty"`     // Placeholder values of video_input_path fixed by the token, e.g. username: john
+}
+
+type Janitor struct {
+	Interval string `yaml:"interval,omitempty"` // Delay between two enforcements of the stream retention policies (default: 1h)
+	DryRun   bool   `yaml:"dry_run,omitempty"`  // Only record the expired outputs in the audit log, without deleting them (default: false)
+}
+
+type Inventory struct {
+	ReconcileInterval string `yaml:"reconcile_interval,omitempty"` // Delay between two searches of the storage for the files added by hand (default: 5m)
+}
+
+type Storage struct {
+	Type string    `yaml:"type,omitempty"` // Where the sources and the outputs are stored: local or s3 (default: local)
+	S3   S3Storage `yaml:"s3,omitempty"`   // S3 compatible bucket, for the s3 type
+}
+
+type S3Storage struct {
+	Endpoint  string `yaml:"endpoint"`             // Host and optional port of the S3 API, e.g. minio:9000
+	Bucket    string `yaml:"bucket"`               // Bucket mirroring the data directory
+	Prefix    string `yaml:"prefix,omitempty"`     // Prepended to the object keys (default: none)
+	Region    string `yaml:"region,omitempty"`     // Region of the bucket (default: detected)
+	AccessKey string `yaml:"access_key,omitempty"` // (default: AWS_ACCESS_KEY_ID or MINIO_ROOT_USER environment variable)
+	SecretKey string `yaml:"secret_key,omitempty"` // (default: AWS_SECRET_ACCESS_KEY or MINIO_ROOT_PASSWORD environment variable)
+	UseSSL    bool   `yaml:"use_ssl,omitempty"`    // Use HTTPS to reach the endpoint (default: false)
+}
+
+type Watch struct {
+	Enabled         bool   `yaml:"enabled"`                    // Keep detecting new sources after startup (default: false, sources are detected at startup only)
+	RescanInterval  string `yaml:"rescan_interval,omitempty"`  // Delay between two full scans (default: 5m)
+	StabilityPeriod string `yaml:"stability_period,omitempty"` // How long a source must stay unchanged before being queued (default: 30s)
+}
+
+type Encoding struct {
+	Workers       int      `yaml:"workers,omitempty"`         // Number of jobs encoded at the same time (default: 1)
+	ThreadsPerJob int      `yaml:"threads_per_job,omitempty"` // FFmpeg threads budget of each job (default: 0, FFmpeg decides)
+	Retry         Retry    `yaml:"retry,omitempty"`           // Retry of the failed encodes
+	Schedule      Schedule `yaml:"schedule,omitempty"`        // Time windows of the encodes (default: always)
+	// Re-encode at startup the outputs whose channel ladder changed since their encode (default: false)
+	ReencodeChangedLadders bool `yaml:"reencode_changed_ladders,omitempty"`
+	// How long the done, failed and canceled jobs are kept in the job store (default: 168h, 0 keeps them forever)
+	FinishedJobRetention string `yaml:"finished_job_retention,omitempty"`
+}
+
+type Schedule struct {
+	Windows        []ScheduleWindow `yaml:"windows"`                   // Windows in which encodes may run (default: none, encodes always run)
+	SuspendRunning bool             `yaml:"suspend_running,omitempty"` // Suspend the running encodes outside the windows (default: false, they finish)
+}
+
+type ScheduleWindow struct {
+	Days  string `yaml:"days,omitempty"` // Days of the week, e.g. "mon-fri" or "sat,sun" (default: every day)
+	Start string `yaml:"start"`          // Start time of day, e.g. "22:00"
+	End   string `yaml:"end"`            // End time of day, e.g. "06:00" (a window ending before it starts runs past midnight)
+}
+
+type Retry struct {
+	MaxAttempts int    `yaml:"max_attempts,omitempty"` // Number of encodes tried before the job fails (default: 3)
+	Backoff     string `yaml:"backoff,omitempty"`      // Delay before the first retry, doubled at every retry (default: 1m)
+	MaxBackoff  string `yaml:"max_backoff,omitempty"`  // Maximum delay between two attempts (default: 0, no cap)
 }
 
 type AllStreamsPlaylist struct {
@@ -27,12 +115,15 @@ type Audio struct {
 }
 
 type Quality struct {
-	Width     int    `yaml:"width"`
-	Height    int    `yaml:"height"`
-	Framerate int    `yaml:"framerate"`
-	Bitrate   string `yaml:"bitrate"`
-	Codec     string `yaml:"codec"`
-	Audio     Audio  `yaml:"audio"`
+	Width       int    `yaml:"width"`
+	Height      int    `yaml:"height"`
+	Framerate   int    `yaml:"framerate"`
+	Bitrate     string `yaml:"bitrate"`
+	Codec       string `yaml:"codec"`
+	Audio       Audio  `yaml:"audio"`
+	Passthrough bool   `yaml:"passthrough,omitempty"` // If enabled, compliant sources are remuxed instead of re-encoded (default: false)
+	MinBitrate  string `yaml:"min_bitrate,omitempty"` // Lowest bitrate chosen by the auto ladder (default: no lower bound)
+	MaxBitrate  string `yaml:"max_bitrate,omitempty"` // Highest bitrate chosen by the auto ladder (default: bitrate)
 }
 
 type Distribution struct {
@@ -50,8 +141,51 @@ type Stream struct {
 	Distribution Distribution       `yaml:"distribution"`
 
 	// Specific fields for video unencoded streams
-	VideoInputPath      string `yaml:"video_input_path"`
-	DeleteAfterEncoding bool   `yaml:"delete_after_encoding,omitempty"` // If enabled, delete the source file after video encoding (default: false)
+	VideoInputPath       string          `yaml:"video_input_path"`
+	VideoExtensions      []string        `yaml:"video_extensions,omitempty"`       // Accepted source file extensions (default: .mp4, .mov, .mkv, .webm, .avi, .ts)
+	DeleteAfterEncoding  bool            `yaml:"delete_after_encoding,omitempty"`  // Deprecated, same as after_encoding: delete
+	AfterEncoding        string          `yaml:"after_encoding,omitempty"`         // keep, delete or move the source file after video encoding (default: keep)
+	ArchivePath          string          `yaml:"archive_path,omitempty"`           // Where sources are moved after their encode with after_encoding: move, supports {date}, {yyyy}, {mm}, {uuid} and {hash8}
+	QuarantinePath       string          `yaml:"quarantine_path,omitempty"`        // Where sources failing the pre-flight checks are moved (default: left in place)
+	DecodeCheckSeconds   int             `yaml:"decode_check_seconds,omitempty"`   // Seconds decoded by the pre-flight check (default: 10)
+	ChunkedEncoding      ChunkedEncoding `yaml:"chunked_encoding,omitempty"`       // Split long sources into concurrently encoded chunks (default: disabled)
+	AutoLadder           AutoLadder      `yaml:"auto_ladder,omitempty"`            // Pick the quality bitrates from a complexity analysis of the source (default: disabled)
+	QualityReport        QualityReport   `yaml:"quality_report,omitempty"`         // Measure the objective quality of each encode (default: disabled)
+	MaxConcurrentEncodes int             `yaml:"max_concurrent_encodes,omitempty"` // Maximum number of jobs of the channel encoded at the same time (default: 0, no limit)
+	DeadLetterPath       string          `yaml:"dead_letter_path,omitempty"`       // Where sources are moved once their encode failed for good (default: left in place)
+	Priority             int             `yaml:"priority,omitempty"`               // Encode priority of the channel jobs, the highest first (default: 0)
+	EncodingSchedule     *Schedule       `yaml:"encoding_schedule,omitempty"`      // Time windows of the channel encodes (default: the application encoding schedule)
+	Quota                *Quota          `yaml:"quota,omitempty"`                  // Storage limit of the sources and outputs (default: none)
+	Retention            *Retention      `yaml:"retention,omitempty"`              // When the encoded outputs are deleted (default: never)
+}
+
+type Retention struct {
+	MaxAge      string `yaml:"max_age,omitempty"`     // Outputs encoded longer ago are deleted, e.g. "720h" (default: no limit)
+	MaxCount    int    `yaml:"max_count,omitempty"`   // Only the newest outputs of each owner are kept (default: no limit)
+	KeepLast    int    `yaml:"keep_last,omitempty"`   // The newest outputs of each owner are kept even when older than max_age (default: 0)
+	Placeholder string `yaml:"placeholder,omitempty"` // Placeholder of path whose values are the owners (default: none, the channel is the only owner)
+}
+
+type Quota struct {
+	MaxSize     string `yaml:"max_size"`              // e.g. "50G", binary units
+	Placeholder string `yaml:"placeholder,omitempty"` // Placeholder of video_input_path whose values each get the quota (default: none, the channel shares it)
+	OnExceed    string `yaml:"on_exceed,omitempty"`   // hold or reject the sources whose encode would exceed the quota (default: hold)
+}
+
+type ChunkedEncoding struct {
+	Chunks      int `yaml:"chunks"`       // Number of chunks encoded concurrently (default: 0, disabled)
+	MinDuration int `yaml:"min_duration"` // Minimum source duration in seconds to split it (default: 0)
+}
+
+type AutoLadder struct {
+	Enabled       bool `yaml:"enabled"`
+	Crf           int  `yaml:"crf,omitempty"`            // Constant rate factor of the analysis encodes (default: 23)
+	SampleSeconds int  `yaml:"sample_seconds,omitempty"` // Total duration of the analyzed excerpts (default: 30)
+}
+
+type QualityReport struct {
+	Enabled bool `yaml:"enabled"`
+	Vmaf    bool `yaml:"vmaf,omitempty"` // Also measure VMAF when FFmpeg has libvmaf (default: false)
 }
 
 type StreamTemplate struct {
@@ -60,4 +194,4 @@ type StreamTemplate struct {
 
 type Channel struct {
 	Stream Stream `yaml:"stream,omitempty"`
-}
\ No newline at end of file
+}
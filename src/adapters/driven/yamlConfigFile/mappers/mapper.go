@@ -2,7 +2,11 @@ package mappers
 
 import (
 	"Theatrum/adapters/driven/yamlConfigFile/entities"
+	"Theatrum/constants"
 	"Theatrum/domain/models"
+	"Theatrum/domain/utils"
+	"strings"
+	"time"
 )
 
 // ToDomainServer converts a YAML server configuration to a domain server model
@@ -24,6 +28,9 @@ func ToDomainQuality(quality entities.Quality) models.Quality {
 			Bitrate: quality.Audio.Bitrate,
 			Codec:   quality.Audio.Codec,
 		},
+		Passthrough: quality.Passthrough,
+		MinBitrate:  quality.MinBitrate,
+		MaxBitrate:  quality.MaxBitrate,
 	}
 }
 
@@ -46,7 +53,90 @@ func ToDomainStream(stream entities.Stream) models.Stream {
 
 		// Specific fields for video unencoded streams
 		VideoInputPath:      stream.VideoInputPath,
-		DeleteAfterEncoding: stream.DeleteAfterEncoding,
+		VideoExtensions:     stream.VideoExtensions,
+		AfterEncoding:       ToDomainAfterEncoding(stream),
+		ArchivePath:         stream.ArchivePath,
+		QuarantinePath:      stream.QuarantinePath,
+		DecodeCheckSeconds:  stream.DecodeCheckSeconds,
+		ChunkedEncoding: models.ChunkedEncoding{
+			Chunks:      stream.ChunkedEncoding.Chunks,
+			MinDuration: stream.ChunkedEncoding.MinDuration,
+		},
+		AutoLadder: ToDomainAutoLadder(stream.AutoLadder),
+		QualityReport: models.QualityReportSettings{
+			Enabled: stream.QualityReport.Enabled,
+			Vmaf:    stream.QualityReport.Vmaf,
+		},
+		MaxConcurrentEncodes: stream.MaxConcurrentEncodes,
+		DeadLetterPath:       stream.DeadLetterPath,
+		Priority:             stream.Priority,
+		Schedule:             ToDomainStreamSchedule(stream.EncodingSchedule),
+		Quota:                ToDomainQuota(stream.Quota),
+		Retention:            ToDomainRetention(stream.Retention),
+	}
+}
+
+// ToDomainRetention converts a YAML retention policy to a domain retention model, the age is validated beforehand
+func ToDomainRetention(retention *entities.Retention) models.Retention {
+	if retention == nil {
+		return models.Retention{}
+	}
+
+	maxAge, _ := time.ParseDuration(retention.MaxAge)
+
+	return models.Retention{
+		MaxAge:      maxAge,
+		MaxCount:    retention.MaxCount,
+		KeepLast:    retention.KeepLast,
+		Placeholder: retention.Placeholder,
+	}
+}
+
+// ToDomainQuota converts a YAML quota to a domain quota model, the size is validated beforehand
+func ToDomainQuota(quota *entities.Quota) models.Quota {
+	if quota == nil {
+		return models.Quota{}
+	}
+
+	onExceed := models.QuotaAction(quota.OnExceed)
+	if onExceed == "" {
+		onExceed = models.QuotaActionHold
+	}
+	maxSize, _ := utils.ParseSize(quota.MaxSize)
+
+	return models.Quota{
+		MaxSize:     maxSize,
+		Placeholder: quota.Placeholder,
+		OnExceed:    onExceed,
+	}
+}
+
+// ToDomainAfterEncoding returns what happens to the sources of a stream after their encode, delete_after_encoding is kept for older configurations
+func ToDomainAfterEncoding(stream entities.Stream) models.AfterEncoding {
+	if stream.AfterEncoding != "" {
+		return models.AfterEncoding(stream.AfterEncoding)
+	}
+	if stream.DeleteAfterEncoding {
+		return models.AfterEncodingDelete
+	}
+	return models.AfterEncodingKeep
+}
+
+// ToDomainAutoLadder converts a YAML auto ladder configuration to a domain auto ladder model
+func ToDomainAutoLadder(autoLadder entities.AutoLadder) models.AutoLadder {
+	crf := autoLadder.Crf
+	if crf == 0 {
+		crf = constants.DefaultAutoLadderCrf
+	}
+	sampleSeconds := autoLadder.SampleSeconds
+	if sampleSeconds == 0 {
+		sampleSeconds = constants.DefaultAutoLadderSampleSecs
+	}
+
+	return models.AutoLadder{
+		Enabled:       autoLadder.Enabled,
+		Crf:           crf,
+		SampleSeconds: sampleSeconds,
 	}
 }
 
@@ -73,5 +163,195 @@ func ToDomainApplication(app entities.Application) models.Application {
 			Enabled: enabled,
 			Path:    app.AllStreamsPlaylist.Path,
 		},
+		Encoding:  ToDomainEncoding(app.Encoding),
+		Watch:     ToDomainWatch(app.Watch),
+		Storage:   ToDomainStorage(app.Storage),
+		Inventory: ToDomainInventory(app.Inventory),
+		Janitor:   ToDomainJanitor(app.Janitor),
+		Uploads:   ToDomainUploads(app.Uploads),
+		Api:       ToDomainApi(app.Api),
+	}
+}
+
+// ToDomainApi converts a YAML API configuration to a domain API model
+func ToDomainApi(api entities.Api) models.Api {
+	tokens := make([]models.ApiToken, 0, len(api.Tokens))
+	for _, token := range api.Tokens {
+		tokens = append(tokens, models.ApiToken{
+			Name:  token.Name,
+			Token: token.Token,
+		})
+	}
+	return models.Api{Tokens: tokens}
+}
+
+// ToDomainUploads converts a YAML uploads configuration to a domain uploads model, the size and duration are validated beforehand
+func ToDomainUploads(uploads entities.Uploads) models.Uploads {
+	maxSize := int64(0)
+	if uploads.MaxSize != "" {
+		maxSize, _ = utils.ParseSize(uploads.MaxSize)
+	}
+	expireAfter := uploads.ExpireAfter
+	if expireAfter == "" {
+		expireAfter = constants.DefaultUploadExpireAfter
+	}
+	expireAfterDuration, _ := time.ParseDuration(expireAfter)
+
+	tokens := make([]models.UploadToken, 0, len(uploads.Tokens))
+	for _, token := range uploads.Tokens {
+		tokens = append(tokens, models.UploadToken{
+			Name:     token.Name,
+			Token:    token.Token,
+			Channels: token.Channels,
+			Vars:     token.Vars,
+		})
+	}
+
+	return models.Uploads{
+		Enabled:     uploads.Enabled,
+		MaxSize:     maxSize,
+		ExpireAfter: expireAfterDuration,
+		Tokens:      tokens,
+	}
+}
+
+// ToDomainJanitor converts a YAML janitor configuration to a domain janitor model, the interval is validated beforehand
+func ToDomainJanitor(janitor entities.Janitor) models.Janitor {
+	interval := janitor.Interval
+	if interval == "" {
+		interval = constants.DefaultRetentionInterval
+	}
+	intervalDuration, _ := time.ParseDuration(interval)
+
+	return models.Janitor{
+		Interval: intervalDuration,
+		DryRun:   janitor.DryRun,
+	}
+}
+
+// ToDomainInventory converts a YAML inventory configuration to a domain inventory model, the interval is validated beforehand
+func ToDomainInventory(inventory entities.Inventory) models.Inventory {
+	reconcileInterval := inventory.ReconcileInterval
+	if reconcileInterval == "" {
+		reconcileInterval = constants.DefaultInventoryReconcile
+	}
+	reconcileIntervalDuration, _ := time.ParseDuration(reconcileInterval)
+
+	return models.Inventory{
+		ReconcileInterval: reconcileIntervalDuration,
+	}
+}
+
+// ToDomainStorage converts a YAML storage configuration to a domain storage model, the local storage being the default
+func ToDomainStorage(storage entities.Storage) models.Storage {
+	storageType := models.StorageType(storage.Type)
+	if storageType == "" {
+		storageType = models.StorageTypeLocal
+	}
+
+	return models.Storage{
+		Type: storageType,
+		S3: models.S3Storage{
+			Endpoint:  storage.S3.Endpoint,
+			Bucket:    storage.S3.Bucket,
+			Prefix:    strings.Trim(storage.S3.Prefix, "/"),
+			Region:    storage.S3.Region,
+			AccessKey: storage.S3.AccessKey,
+			SecretKey: storage.S3.SecretKey,
+			UseSSL:    storage.S3.UseSSL,
+		},
+	}
+}
+
+// ToDomainWatch converts a YAML watch configuration to a domain watch model, durations are validated beforehand
+func ToDomainWatch(watch entities.Watch) models.Watch {
+	rescanInterval := watch.RescanInterval
+	if rescanInterval == "" {
+		rescanInterval = constants.DefaultWatchRescanInterval
+	}
+	stabilityPeriod := watch.StabilityPeriod
+	if stabilityPeriod == "" {
+		stabilityPeriod = constants.DefaultWatchStabilityPeriod
+	}
+
+	rescanIntervalDuration, _ := time.ParseDuration(rescanInterval)
+	stabilityPeriodDuration, _ := time.ParseDuration(stabilityPeriod)
+
+	return models.Watch{
+		Enabled:         watch.Enabled,
+		RescanInterval:  rescanIntervalDuration,
+		StabilityPeriod: stabilityPeriodDuration,
+	}
+}
+
+// ToDomainEncoding converts a YAML encoding configuration to a domain encoding model, durations are validated beforehand
+func ToDomainEncoding(encoding entities.Encoding) models.Encoding {
+	workers := encoding.Workers
+	if workers == 0 {
+		workers = constants.DefaultEncodeWorkers
+	}
+	finishedJobRetention := encoding.FinishedJobRetention
+	if finishedJobRetention == "" {
+		finishedJobRetention = constants.DefaultFinishedJobRetention
+	}
+	finishedJobRetentionDuration, _ := time.ParseDuration(finishedJobRetention)
+
+	return models.Encoding{
+		Workers:       workers,
+		ThreadsPerJob: encoding.ThreadsPerJob,
+		Retry:         ToDomainRetryPolicy(encoding.Retry),
+		Schedule:      ToDomainSchedule(encoding.Schedule),
+
+		ReencodeChangedLadders: encoding.ReencodeChangedLadders,
+		FinishedJobRetention:   finishedJobRetentionDuration,
+	}
+}
+
+// ToDomainSchedule converts a YAML schedule configuration to a domain schedule, windows are validated beforehand
+func ToDomainSchedule(schedule entities.Schedule) models.Schedule {
+	windows := make([]models.ScheduleWindow, 0, len(schedule.Windows))
+	for _, window := range schedule.Windows {
+		if parsed, err := models.ParseScheduleWindow(window.Days, window.Start, window.End); err == nil {
+			windows = append(windows, parsed)
+		}
+	}
+
+	return models.Schedule{
+		Windows:        windows,
+		SuspendRunning: schedule.SuspendRunning,
+	}
+}
+
+// ToDomainStreamSchedule converts the optional schedule override of a stream
+func ToDomainStreamSchedule(schedule *entities.Schedule) *models.Schedule {
+	if schedule == nil {
+		return nil
+	}
+	result := ToDomainSchedule(*schedule)
+	return &result
+}
+
+// ToDomainRetryPolicy converts a YAML retry configuration to a domain retry policy, durations are validated beforehand
+func ToDomainRetryPolicy(retry entities.Retry) models.RetryPolicy {
+	maxAttempts := retry.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = constants.DefaultRetryMaxAttempts
+	}
+	backoff := retry.Backoff
+	if backoff == "" {
+		backoff = constants.DefaultRetryBackoff
+	}
+	maxBackoff := retry.MaxBackoff
+	if maxBackoff == "" {
+		maxBackoff = constants.DefaultRetryMaxBackoff
+	}
+
+	backoffDuration, _ := time.ParseDuration(backoff)
+	maxBackoffDuration, _ := time.ParseDuration(maxBackoff)
+
+	return models.RetryPolicy{
+		MaxAttempts: maxAttempts,
+		Backoff:     backoffDuration,
+		MaxBackoff:  maxBackoffDuration,
 	}
 }
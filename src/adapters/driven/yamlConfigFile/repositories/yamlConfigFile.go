@@ -3,14 +3,18 @@ package repositories
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 
 	yamlConfigFileEntities "Theatrum/adapters/driven/yamlConfigFile/entities"
 	yamlConfigFileMappers "Theatrum/adapters/driven/yamlConfigFile/mappers"
+	"Theatrum/constants"
 	"Theatrum/domain/models"
 	"Theatrum/domain/repositories"
+	"Theatrum/domain/utils"
 )
 
 // YamlConfigFile implements the ConfigurationPort interface using YAML files
@@ -59,6 +63,42 @@ func (y *YamlConfigFile) validateConfig(config *yamlConfigFileEntities.Config) e
 	if config.Application.AllStreamsPlaylist.Enabled && config.Application.AllStreamsPlaylist.Path == "" {
 		return fmt.Errorf("all_streams_playlist is enabled but path is empty")
 	}
+	if config.Application.Encoding.Workers < 0 {
+		return fmt.Errorf("invalid encoding workers: must not be negative")
+	}
+	if config.Application.Encoding.ThreadsPerJob < 0 {
+		return fmt.Errorf("invalid encoding threads_per_job: must not be negative")
+	}
+	if err := y.validateRetry(config.Application.Encoding.Retry); err != nil {
+		return err
+	}
+	if retention := config.Application.Encoding.FinishedJobRetention; retention != "" {
+		duration, err := time.ParseDuration(retention)
+		if err != nil || duration < 0 {
+			return fmt.Errorf("invalid encoding finished_job_retention '%s': must be a duration such as 168h, or 0 to keep the jobs", retention)
+		}
+	}
+	if err := y.validateWatch(config.Application.Watch); err != nil {
+		return err
+	}
+	if err := y.validateStorage(config.Application.Storage); err != nil {
+		return err
+	}
+	if interval := config.Application.Inventory.ReconcileInterval; interval != "" {
+		duration, err := time.ParseDuration(interval)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("invalid inventory reconcile_interval '%s': must be a positive duration such as 5m", interval)
+		}
+	}
+	if interval := config.Application.Janitor.Interval; interval != "" {
+		duration, err := time.ParseDuration(interval)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("invalid janitor interval '%s': must be a positive duration such as 1h", interval)
+		}
+	}
+	if err := y.validateSchedule(config.Application.Encoding.Schedule, "encoding schedule"); err != nil {
+		return err
+	}
 
 	// Validate server configuration
 	if config.Server.HTTPPort <= 0 {
@@ -78,6 +118,14 @@ func (y *YamlConfigFile) validateConfig(config *yamlConfigFileEntities.Config) e
 		}
 	}
 
+	if err := y.validateApi(config.Application.Api); err != nil {
+		return err
+	}
+
+	if err := y.validateUploads(config.Application.Uploads, config.Channels); err != nil {
+		return err
+	}
+
 	// Validate channels
 	for name, channel := range config.Channels {
 		// Check that name never = "/"
@@ -85,6 +133,16 @@ func (y *YamlConfigFile) validateConfig(config *yamlConfigFileEntities.Config) e
 			return fmt.Errorf("invalid channel name: must not be '/'")
 		}
 
+		// The API routes are served before the channels
+		if name == constants.ApiPathPrefix || strings.HasPrefix(name, constants.ApiPathPrefix+"/") {
+			return fmt.Errorf("invalid channel name '%s': %s is reserved for the API", name, constants.ApiPathPrefix)
+		}
+
+		// The placeholders of the channel name become the variables of its routes
+		if _, err := utils.ParsePlaceholders(name); err != nil {
+			return fmt.Errorf("invalid channel name '%s': %w", name, err)
+		}
+
 		// Validate stream
 		if err := y.validateStream(channel.Stream, fmt.Sprintf("channel '%s'", name)); err != nil {
 			return err
@@ -126,15 +184,121 @@ func (y *YamlConfigFile) validateStream(stream yamlConfigFileEntities.Stream, co
 			return err
 		}
 		
-		// delete_after_encoding is valid for video_unencoded streams (no validation needed, bool defaults to false)
+		// Validate accepted source file extensions
+		for _, extension := range stream.VideoExtensions {
+			if len(extension) < 2 || !strings.HasPrefix(extension, ".") || strings.ContainsAny(extension, "/\\") {
+				return fmt.Errorf("%s has invalid video extension '%s': must start with a dot (e.g. .mp4)", context, extension)
+			}
+		}
+
+		// Validate pre-flight settings
+		if stream.QuarantinePath != "" {
+			if err := y.validatePath(stream.QuarantinePath, fmt.Sprintf("%s quarantine_path", context)); err != nil {
+				return err
+			}
+			// Quarantined sources would otherwise be detected again
+			if stream.QuarantinePath == stream.VideoInputPath || strings.HasPrefix(stream.QuarantinePath, stream.VideoInputPath+"/") {
+				return fmt.Errorf("%s quarantine_path must not be inside video_input_path", context)
+			}
+		}
+		if stream.DecodeCheckSeconds < 0 {
+			return fmt.Errorf("%s has invalid decode_check_seconds: must not be negative", context)
+		}
+
+		// Validate chunked encoding settings
+		if stream.ChunkedEncoding.Chunks < 0 || stream.ChunkedEncoding.MinDuration < 0 {
+			return fmt.Errorf("%s has invalid chunked_encoding: chunks and min_duration must not be negative", context)
+		}
+
+		// Validate auto ladder settings
+		if stream.AutoLadder.Crf < 0 || stream.AutoLadder.Crf > 51 {
+			return fmt.Errorf("%s has invalid auto_ladder crf: must be between 0 and 51", context)
+		}
+		if stream.AutoLadder.SampleSeconds < 0 {
+			return fmt.Errorf("%s has invalid auto_ladder sample_seconds: must not be negative", context)
+		}
+
+		if stream.MaxConcurrentEncodes < 0 {
+			return fmt.Errorf("%s has invalid max_concurrent_encodes: must not be negative", context)
+		}
+
+		if stream.EncodingSchedule != nil {
+			if err := y.validateSchedule(*stream.EncodingSchedule, fmt.Sprintf("%s encoding_schedule", context)); err != nil {
+				return err
+			}
+		}
+
+		// Validate dead letter settings
+		if stream.DeadLetterPath != "" {
+			if err := y.validatePath(stream.DeadLetterPath, fmt.Sprintf("%s dead_letter_path", context)); err != nil {
+				return err
+			}
+			// Failed sources would otherwise be detected again
+			if stream.DeadLetterPath == stream.VideoInputPath || strings.HasPrefix(stream.DeadLetterPath, stream.VideoInputPath+"/") {
+				return fmt.Errorf("%s dead_letter_path must not be inside video_input_path", context)
+			}
+		}
+
+		// Validate after encoding settings
+		if err := y.validateAfterEncoding(stream, context); err != nil {
+			return err
+		}
+
+		if stream.Quota != nil {
+			if err := y.validateQuota(stream, context); err != nil {
+				return err
+			}
+		}
+
+		if stream.Retention != nil {
+			if err := y.validateRetention(stream, context); err != nil {
+				return err
+			}
+		}
 	} else {
 		// For video_encoded streams, these fields should not be set
 		if stream.VideoInputPath != "" {
 			return fmt.Errorf("%s of type video_encoded should not have video_input_path", context)
 		}
+		if len(stream.VideoExtensions) != 0 {
+			return fmt.Errorf("%s of type video_encoded should not have video_extensions", context)
+		}
+		if stream.QuarantinePath != "" || stream.DecodeCheckSeconds != 0 {
+			return fmt.Errorf("%s of type video_encoded should not have pre-flight settings", context)
+		}
+		if stream.ChunkedEncoding.Chunks != 0 {
+			return fmt.Errorf("%s of type video_encoded should not have chunked_encoding", context)
+		}
+		if stream.AutoLadder.Enabled {
+			return fmt.Errorf("%s of type video_encoded should not have auto_ladder enabled", context)
+		}
+		if stream.QualityReport.Enabled {
+			return fmt.Errorf("%s of type video_encoded should not have quality_report enabled", context)
+		}
+		if stream.MaxConcurrentEncodes != 0 {
+			return fmt.Errorf("%s of type video_encoded should not have max_concurrent_encodes", context)
+		}
+		if stream.DeadLetterPath != "" {
+			return fmt.Errorf("%s of type video_encoded should not have dead_letter_path", context)
+		}
+		if stream.Priority != 0 {
+			return fmt.Errorf("%s of type video_encoded should not have priority", context)
+		}
+		if stream.EncodingSchedule != nil {
+			return fmt.Errorf("%s of type video_encoded should not have encoding_schedule", context)
+		}
 		if stream.DeleteAfterEncoding {
 			return fmt.Errorf("%s of type video_encoded should not have delete_after_encoding enabled", context)
 		}
+		if stream.AfterEncoding != "" || stream.ArchivePath != "" {
+			return fmt.Errorf("%s of type video_encoded should not have after encoding settings", context)
+		}
+		if stream.Quota != nil {
+			return fmt.Errorf("%s of type video_encoded should not have quota", context)
+		}
+		if stream.Retention != nil {
+			return fmt.Errorf("%s of type video_encoded should not have retention", context)
+		}
 	}
 
 	// Validate qualities
@@ -156,6 +320,214 @@ func (y *YamlConfigFile) validateStream(stream yamlConfigFileEntities.Stream, co
 	return nil
 }
 
+func (y *YamlConfigFile) validateRetry(retry yamlConfigFileEntities.Retry) error {
+	if retry.MaxAttempts < 0 {
+		return fmt.Errorf("invalid encoding retry max_attempts: must not be negative")
+	}
+
+	durations := map[string]string{"backoff": retry.Backoff, "max_backoff": retry.MaxBackoff}
+	for name, value := range durations {
+		if value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration < 0 {
+			return fmt.Errorf("invalid encoding retry %s '%s': must be a duration such as 30s or 5m", name, value)
+		}
+	}
+
+	return nil
+}
+
+func (y *YamlConfigFile) validateSchedule(schedule yamlConfigFileEntities.Schedule, context string) error {
+	for i, window := range schedule.Windows {
+		if _, err := models.ParseScheduleWindow(window.Days, window.Start, window.End); err != nil {
+			return fmt.Errorf("%s has invalid window %d: %v", context, i+1, err)
+		}
+	}
+
+	return nil
+}
+
+func (y *YamlConfigFile) validateWatch(watch yamlConfigFileEntities.Watch) error {
+	if watch.RescanInterval != "" {
+		duration, err := time.ParseDuration(watch.RescanInterval)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("invalid watch rescan_interval '%s': must be a positive duration such as 5m", watch.RescanInterval)
+		}
+	}
+	if watch.StabilityPeriod != "" {
+		duration, err := time.ParseDuration(watch.StabilityPeriod)
+		if err != nil || duration < 0 {
+			return fmt.Errorf("invalid watch stability_period '%s': must be a duration such as 30s", watch.StabilityPeriod)
+		}
+	}
+
+	return nil
+}
+
+// validateQuota checks the quota of a stream, whose placeholder must tell the owner of its sources, outputs and archived sources
+func (y *YamlConfigFile) validateQuota(stream yamlConfigFileEntities.Stream, context string) error {
+	quota := *stream.Quota
+	if _, err := utils.ParseSize(quota.MaxSize); err != nil {
+		return fmt.Errorf("%s has invalid quota max_size '%s': must be a positive size such as 50G", context, quota.MaxSize)
+	}
+
+	// The values of the placeholder are read from the paths of the files
+	if quota.Placeholder != "" {
+		templates := [][2]string{{"video_input_path", stream.VideoInputPath}, {"path", stream.Path}}
+		if models.AfterEncoding(stream.AfterEncoding) == models.AfterEncodingMove {
+			templates = append(templates, [2]string{"archive_path", stream.ArchivePath})
+		}
+		for _, template := range templates {
+			if !hasSegmentPlaceholder(template[1], quota.Placeholder) {
+				return fmt.Errorf("%s quota placeholder '%s' must be a segment of %s", context, quota.Placeholder, template[0])
+			}
+		}
+	}
+
+	switch models.QuotaAction(quota.OnExceed) {
+	case "", models.QuotaActionHold, models.QuotaActionReject:
+	default:
+		return fmt.Errorf("%s has invalid quota on_exceed '%s': must be hold or reject", context, quota.OnExceed)
+	}
+
+	return nil
+}
+
+// validateRetention checks the retention policy of a stream, whose sources must not be kept in the input path
+func (y *YamlConfigFile) validateRetention(stream yamlConfigFileEntities.Stream, context string) error {
+	retention := *stream.Retention
+
+	if retention.MaxAge != "" {
+		duration, err := time.ParseDuration(retention.MaxAge)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("%s has invalid retention max_age '%s': must be a positive duration such as 720h", context, retention.MaxAge)
+		}
+	}
+	if retention.MaxCount < 0 || retention.KeepLast < 0 {
+		return fmt.Errorf("%s has invalid retention: max_count and keep_last must not be negative", context)
+	}
+	if retention.MaxAge == "" && retention.MaxCount == 0 {
+		return fmt.Errorf("%s retention must have max_age or max_count", context)
+	}
+	if retention.MaxCount > 0 && retention.KeepLast > retention.MaxCount {
+		return fmt.Errorf("%s retention keep_last must not be greater than max_count", context)
+	}
+
+	// The owners are read from the outputs paths
+	if retention.Placeholder != "" && !hasSegmentPlaceholder(stream.Path, retention.Placeholder) {
+		return fmt.Errorf("%s retention placeholder '%s' must be a segment of path", context, retention.Placeholder)
+	}
+
+	// A source kept in the input path would be encoded again once its output expired
+	afterEncoding := models.AfterEncoding(stream.AfterEncoding)
+	if afterEncoding != models.AfterEncodingDelete && afterEncoding != models.AfterEncodingMove && !stream.DeleteAfterEncoding {
+		return fmt.Errorf("%s with retention must have after_encoding: delete or move", context)
+	}
+
+	return nil
+}
+
+// hasSegmentPlaceholder reports whether a placeholder, whatever its constraint, is a whole segment of a path template
+func hasSegmentPlaceholder(template string, name string) bool {
+	return slices.ContainsFunc(strings.Split(template, "/"), func(segment string) bool {
+		placeholder, ok := utils.SegmentPlaceholder(segment)
+		return ok && placeholder.Name == name
+	})
+}
+
+// validateApi checks the tokens of the jobs and usage API
+func (y *YamlConfigFile) validateApi(api yamlConfigFileEntities.Api) error {
+	names := make(map[string]bool)
+	tokens := make(map[string]bool)
+	for i, token := range api.Tokens {
+		if token.Name == "" || names[token.Name] {
+			return fmt.Errorf("api token %d must have a unique name", i+1)
+		}
+		// Short tokens could be guessed
+		if len(token.Token) < 16 || tokens[token.Token] {
+			return fmt.Errorf("api token '%s' must be unique and at least 16 characters long", token.Name)
+		}
+		names[token.Name] = true
+		tokens[token.Token] = true
+	}
+	return nil
+}
+
+// validateUploads checks the upload tokens, which can only upload to the video_unencoded channels
+func (y *YamlConfigFile) validateUploads(uploads yamlConfigFileEntities.Uploads, channels map[string]yamlConfigFileEntities.Channel) error {
+	if uploads.MaxSize != "" {
+		if _, err := utils.ParseSize(uploads.MaxSize); err != nil {
+			return fmt.Errorf("invalid uploads max_size '%s': must be a positive size such as 50G", uploads.MaxSize)
+		}
+	}
+	if uploads.ExpireAfter != "" {
+		duration, err := time.ParseDuration(uploads.ExpireAfter)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("invalid uploads expire_after '%s': must be a positive duration such as 24h", uploads.ExpireAfter)
+		}
+	}
+	if uploads.Enabled && len(uploads.Tokens) == 0 {
+		return fmt.Errorf("uploads are enabled but no token is defined")
+	}
+
+	names := make(map[string]bool)
+	tokens := make(map[string]bool)
+	for i, token := range uploads.Tokens {
+		if token.Name == "" || names[token.Name] {
+			return fmt.Errorf("uploads token %d must have a unique name", i+1)
+		}
+		// Short tokens could be guessed
+		if len(token.Token) < 16 || tokens[token.Token] {
+			return fmt.Errorf("uploads token '%s' must be unique and at least 16 characters long", token.Name)
+		}
+		names[token.Name] = true
+		tokens[token.Token] = true
+
+		for _, channelName := range token.Channels {
+			if channel, found := channels[channelName]; !found || channel.Stream.Type != string(models.StreamTypeVideoUnEncoded) {
+				return fmt.Errorf("uploads token '%s' channel '%s' is not a video_unencoded channel", token.Name, channelName)
+			}
+		}
+		for name, value := range token.Vars {
+			if name == "" || utils.CheckPathValue(value) != nil {
+				return fmt.Errorf("uploads token '%s' has invalid value '%s' for placeholder '%s'", token.Name, value, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (y *YamlConfigFile) validateStorage(storage yamlConfigFileEntities.Storage) error {
+	switch models.StorageType(storage.Type) {
+	case "", models.StorageTypeLocal:
+		if storage.S3 != (yamlConfigFileEntities.S3Storage{}) {
+			return fmt.Errorf("storage s3 settings require the s3 storage type")
+		}
+		return nil
+	case models.StorageTypeS3:
+	default:
+		return fmt.Errorf("invalid storage type '%s': must be local or s3", storage.Type)
+	}
+
+	if storage.S3.Endpoint == "" || storage.S3.Bucket == "" {
+		return fmt.Errorf("s3 storage requires an endpoint and a bucket")
+	}
+	if strings.Contains(storage.S3.Endpoint, "://") {
+		return fmt.Errorf("invalid s3 endpoint '%s': must be a host and optional port, use use_ssl for HTTPS", storage.S3.Endpoint)
+	}
+	if strings.Contains(storage.S3.Prefix, "..") {
+		return fmt.Errorf("invalid s3 prefix '%s': cannot contain '..'", storage.S3.Prefix)
+	}
+	if (storage.S3.AccessKey == "") != (storage.S3.SecretKey == "") {
+		return fmt.Errorf("s3 access_key and secret_key must be set together")
+	}
+
+	return nil
+}
+
 func (y *YamlConfigFile) validateQuality(quality yamlConfigFileEntities.Quality, context string) error {
 	if quality.Width <= 0 {
 		return fmt.Errorf("%s has invalid width: must be greater than 0", context)
@@ -172,6 +544,30 @@ func (y *YamlConfigFile) validateQuality(quality yamlConfigFileEntities.Quality,
 	if quality.Bitrate == "" {
 		return fmt.Errorf("%s has empty bitrate", context)
 	}
+
+	if _, err := utils.ParseBitrate(quality.Bitrate); err != nil {
+		return fmt.Errorf("%s has %v", context, err)
+	}
+
+	// Validate the auto ladder bounds
+	var minBitrate, maxBitrate int64
+	if quality.MinBitrate != "" {
+		parsed, err := utils.ParseBitrate(quality.MinBitrate)
+		if err != nil {
+			return fmt.Errorf("%s has invalid min_bitrate: %v", context, err)
+		}
+		minBitrate = parsed
+	}
+	if quality.MaxBitrate != "" {
+		parsed, err := utils.ParseBitrate(quality.MaxBitrate)
+		if err != nil {
+			return fmt.Errorf("%s has invalid max_bitrate: %v", context, err)
+		}
+		maxBitrate = parsed
+	}
+	if minBitrate > 0 && maxBitrate > 0 && minBitrate > maxBitrate {
+		return fmt.Errorf("%s has min_bitrate greater than max_bitrate", context)
+	}
 	
 	if quality.Codec == "" {
 		return fmt.Errorf("%s has empty codec", context)
@@ -181,6 +577,10 @@ func (y *YamlConfigFile) validateQuality(quality yamlConfigFileEntities.Quality,
 	if quality.Audio.Bitrate == "" {
 		return fmt.Errorf("%s has empty audio bitrate", context)
 	}
+
+	if _, err := utils.ParseBitrate(quality.Audio.Bitrate); err != nil {
+		return fmt.Errorf("%s has invalid audio bitrate: %v", context, err)
+	}
 	
 	if quality.Audio.Codec == "" {
 		return fmt.Errorf("%s has empty audio codec", context)
@@ -198,37 +598,41 @@ func (y *YamlConfigFile) validateDistribution(distribution yamlConfigFileEntitie
 	return nil
 }
 
-func (y *YamlConfigFile) validatePath(path string, context string) error {
-	// Check for path traversal attempts
-	if strings.Contains(path, "..") {
-		return fmt.Errorf("%s cannot contain '..' (path traversal attempt)", context)
-	}
-
-	// Check for absolute paths (should be relative)
-	if strings.HasPrefix(path, "/") || strings.HasPrefix(path, "\\") {
-		return fmt.Errorf("%s should be a relative path, not absolute", context)
+// validateAfterEncoding checks what happens to the sources after their encode, an archive path is required to move them
+func (y *YamlConfigFile) validateAfterEncoding(stream yamlConfigFileEntities.Stream, context string) error {
+	switch models.AfterEncoding(stream.AfterEncoding) {
+	case "", models.AfterEncodingKeep, models.AfterEncodingDelete, models.AfterEncodingMove:
+	default:
+		return fmt.Errorf("%s has invalid after_encoding '%s': must be keep, delete or move", context, stream.AfterEncoding)
 	}
 
-	// Check for Windows drive paths
-	if len(path) >= 2 && path[1] == ':' {
-		return fmt.Errorf("%s should not contain Windows drive letters", context)
+	if stream.DeleteAfterEncoding && stream.AfterEncoding != "" {
+		return fmt.Errorf("%s cannot set both delete_after_encoding and after_encoding", context)
 	}
 
-	// Check for empty segments
-	segments := strings.Split(path, "/")
-	for _, seg := range segments {
-		if seg == "" {
-			return fmt.Errorf("%s cannot contain empty segments", context)
+	if models.AfterEncoding(stream.AfterEncoding) != models.AfterEncodingMove {
+		if stream.ArchivePath != "" {
+			return fmt.Errorf("%s has archive_path without after_encoding: move", context)
 		}
+		return nil
 	}
 
-	// Check for potentially dangerous characters
-	dangerousChars := []string{"%00", "%2e", "%2f", "%5c", "|", ">", "<", "*", "?"}
-	for _, char := range dangerousChars {
-		if strings.Contains(path, char) {
-			return fmt.Errorf("%s contains potentially dangerous character: %s", context, char)
-		}
+	if stream.ArchivePath == "" {
+		return fmt.Errorf("%s with after_encoding: move must have archive_path", context)
+	}
+	if err := y.validatePath(stream.ArchivePath, fmt.Sprintf("%s archive_path", context)); err != nil {
+		return err
 	}
+	// Archived sources would otherwise be detected again
+	if stream.ArchivePath == stream.VideoInputPath || strings.HasPrefix(stream.ArchivePath, stream.VideoInputPath+"/") {
+		return fmt.Errorf("%s archive_path must not be inside video_input_path", context)
+	}
+	return nil
+}
 
+func (y *YamlConfigFile) validatePath(path string, context string) error {
+	if err := utils.CheckRelativePathTemplate(path); err != nil {
+		return fmt.Errorf("%s: %w", context, err)
+	}
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"Theatrum/domain/services"
+)
+
+// NewApiAuthMiddleware refuses the requests without a valid API token, sent as "Authorization: Bearer <token>"
+func NewApiAuthMiddleware(appService *services.ApplicationService) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			secret, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			token, err := appService.AuthenticateApi(secret)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			// Every change made through the API is traced to its token
+			if r.Method != http.MethodGet {
+				log.Printf("API %s %s by token %s", r.Method, r.URL.Path, token.Name)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"Theatrum/domain/jobs"
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+	"Theatrum/domain/services"
+)
+
+// jobResponse describes an encode job, the stderr tail is only given in the job detail and the failed jobs listing
+type jobResponse struct {
+	ID             string          `json:"id"`
+	Channel        string          `json:"channel"`
+	Owner          string          `json:"owner,omitempty"`
+	Input          string          `json:"input"`
+	Output         string          `json:"output"`
+	State          models.JobState `json:"state"`
+	Suspended      bool            `json:"suspended,omitempty"`
+	Priority       int             `json:"priority"`
+	Progress       float64         `json:"progress"`
+	Attempts       int             `json:"attempts"`
+	Error          string          `json:"error,omitempty"`
+	StderrTail     string          `json:"stderr_tail,omitempty"`
+	DeadLetterPath string          `json:"dead_letter_path,omitempty"`
+	Reencode       bool            `json:"reencode,omitempty"`
+	Renditions     []string        `json:"renditions,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	StartedAt      *time.Time      `json:"started_at,omitempty"`
+	FinishedAt     *time.Time      `json:"finished_at,omitempty"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	// DurationSeconds is how long the last attempt ran, or has been running
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+}
+
+// createJobRequest queues the encode of a source, given by its path in the data directory
+type createJobRequest struct {
+	Channel  string `json:"channel"`
+	File     string `json:"file"`
+	Priority *int   `json:"priority,omitempty"`
+}
+
+type priorityRequest struct {
+	Priority *int `json:"priority"`
+}
+
+// JobsHandler serves the encode jobs API
+type JobsHandler struct {
+	encodeQueue    *jobs.EncodeJobQueue
+	videoDetector  *jobs.VideoUnencodedDetector
+	ladderDetector *jobs.LadderChangeDetector
+}
+
+func NewJobsHandler(encodeQueue *jobs.EncodeJobQueue, videoDetector *jobs.VideoUnencodedDetector, ladderDetector *jobs.LadderChangeDetector) *JobsHandler {
+	return &JobsHandler{
+		encodeQueue:    encodeQueue,
+		videoDetector:  videoDetector,
+		ladderDetector: ladderDetector,
+	}
+}
+
+// List returns every job, oldest first, optionally filtered by the "state" query parameter
+func (h *JobsHandler) List(w http.ResponseWriter, r *http.Request) {
+	h.list(w, models.JobState(r.URL.Query().Get("state")), false)
+}
+
+// ListFailed returns the jobs which failed for good, with their stderr tail
+func (h *JobsHandler) ListFailed(w http.ResponseWriter, r *http.Request) {
+	h.list(w, models.JobStateFailed, true)
+}
+
+func (h *JobsHandler) list(w http.ResponseWriter, state models.JobState, withStderr bool) {
+	allJobs, err := h.encodeQueue.Jobs()
+	if err != nil {
+		log.Printf("Error listing jobs: %v", err)
+		http.Error(w, "Error listing jobs", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]jobResponse, 0, len(allJobs))
+	for _, job := range allJobs {
+		if state != "" && job.State != state {
+			continue
+		}
+		response = append(response, newJobResponse(job, withStderr))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Get returns the detail of a job, with the end of the FFmpeg output of its last failed attempt
+func (h *JobsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	job, err := h.encodeQueue.Job(mux.Vars(r)["id"])
+	h.respond(w, job, err, http.StatusOK)
+}
+
+// Create queues the encode of a source of a video unencoded channel
+func (h *JobsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var request createJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Channel == "" || request.File == "" {
+		http.Error(w, "Expected a JSON body with a channel and a file", http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.videoDetector.QueueFile(request.Channel, request.File)
+	if err == nil && request.Priority != nil {
+		job, err = h.encodeQueue.SetPriority(job.ID, *request.Priority)
+	}
+	h.respond(w, job, err, http.StatusCreated)
+}
+
+// Reencode queues the re-encode of the outputs whose channel ladder changed, and returns the queued jobs
+func (h *JobsHandler) Reencode(w http.ResponseWriter, r *http.Request) {
+	queuedJobs := h.ladderDetector.DetectAndQueueReencodes()
+
+	response := make([]jobResponse, 0, len(queuedJobs))
+	for _, job := range queuedJobs {
+		response = append(response, newJobResponse(job, false))
+	}
+	writeJSON(w, http.StatusAccepted, response)
+}
+
+// Cancel removes a queued job from the queue, or stops a running one
+func (h *JobsHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	job, err := h.encodeQueue.Cancel(mux.Vars(r)["id"])
+	h.respond(w, job, err, http.StatusAccepted)
+}
+
+// Retry queues again a failed or canceled job
+func (h *JobsHandler) Retry(w http.ResponseWriter, r *http.Request) {
+	job, err := h.encodeQueue.Retry(mux.Vars(r)["id"])
+	h.respond(w, job, err, http.StatusAccepted)
+}
+
+// SetPriority changes the priority of a queued or running job
+func (h *JobsHandler) SetPriority(w http.ResponseWriter, r *http.Request) {
+	var request priorityRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Priority == nil {
+		http.Error(w, "Expected a JSON body with a priority", http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.encodeQueue.SetPriority(mux.Vars(r)["id"], *request.Priority)
+	h.respond(w, job, err, http.StatusOK)
+}
+
+// respond writes the job, or the HTTP status matching the error
+func (h *JobsHandler) respond(w http.ResponseWriter, job models.EncodeJob, err error, status int) {
+	switch {
+	case err == nil:
+		writeJSON(w, status, newJobResponse(job, true))
+	case errors.Is(err, repositories.ErrJobNotFound), errors.Is(err, jobs.ErrUnknownChannel), errors.Is(err, jobs.ErrSourceNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, jobs.ErrJobNotActive), errors.Is(err, jobs.ErrJobNotRetryable), errors.Is(err, jobs.ErrJobAlreadyQueued), errors.Is(err, jobs.ErrNameCollision):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, services.ErrInvalidSource):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, services.ErrQuotaExceeded):
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+	default:
+		log.Printf("Error handling job request: %v", err)
+		http.Error(w, "Error handling job request", http.StatusInternalServerError)
+	}
+}
+
+func newJobResponse(job models.EncodeJob, withStderr bool) jobResponse {
+	response := jobResponse{
+		ID:             job.ID,
+		Channel:        job.ChannelName,
+		Owner:          job.Owner(),
+		Input:          job.InputStoragePath,
+		Output:         job.OutputStoragePath,
+		State:          job.State,
+		Suspended:      job.Suspended,
+		Priority:       job.Priority,
+		Progress:       job.Progress,
+		Attempts:       job.Attempts,
+		Error:          job.Error,
+		DeadLetterPath: job.DeadLetterPath,
+		Reencode:       job.Reencode,
+		Renditions:     job.Renditions,
+		CreatedAt:      job.CreatedAt,
+		StartedAt:      optionalTime(job.StartedAt),
+		FinishedAt:     optionalTime(job.FinishedAt),
+		NextAttemptAt:  optionalTime(job.NextAttemptAt),
+	}
+	if withStderr {
+		response.StderrTail = job.StderrTail
+	}
+
+	if !job.StartedAt.IsZero() {
+		end := time.Now()
+		if job.State != models.JobStateRunning && job.FinishedAt.After(job.StartedAt) {
+			end = job.FinishedAt
+		}
+		response.DurationSeconds = end.Sub(job.StartedAt).Round(time.Second).Seconds()
+	}
+
+	return response
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
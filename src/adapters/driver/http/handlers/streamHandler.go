@@ -1,9 +1,10 @@
 package handlers
 
 import (
+	"errors"
+	"io/fs"
 	"log"
 	"net/http"
-	"os"
 	"path"
 	"path/filepath"
 
@@ -11,6 +12,7 @@ import (
 
 	"Theatrum/domain/models"
 	"Theatrum/domain/services"
+	"Theatrum/domain/utils"
 )
 
 type StreamHandler struct {
@@ -79,13 +81,20 @@ func (h *StreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	resourceStoragePath := path.Join(storagePath, resource)
 
-	// Check if file exists
-	if _, err := os.Stat(resourceStoragePath); os.IsNotExist(err) {
+	// The paths leading outside of the data directory are refused by the path policy of the storage
+	file, info, err := h.streamService.OpenResource(resourceStoragePath)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, utils.ErrUnsafePath) {
 		log.Printf("File not found: %s", resourceStoragePath)
 		http.Error(w, "File not found", http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		log.Printf("Error opening %s: %v", resourceStoragePath, err)
+		http.Error(w, "Error reading file", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
 
-	// Serve the file
-	http.ServeFile(w, r, resourceStoragePath)
+	// Serve the file, with the conditional and range requests handled from its modification time and size
+	http.ServeContent(w, r, path.Base(resource), info.ModTime, file)
 }
\ No newline at end of file
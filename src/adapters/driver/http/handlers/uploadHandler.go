@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"Theatrum/constants"
+	"Theatrum/domain/jobs"
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+	"Theatrum/domain/services"
+)
+
+const (
+	// tusVersion is the version of the tus resumable upload protocol served
+	tusVersion = "1.0.0"
+	// tusExtensions are the extensions of the protocol served
+	tusExtensions = "creation,termination,expiration"
+	// tusContentType is the content type of the chunks
+	tusContentType = "application/offset+octet-stream"
+)
+
+// UploadHandler serves the resumable uploads of the sources, following the tus protocol (https://tus.io/protocols/resumable-upload)
+// The requests are authenticated by an upload token sent as "Authorization: Bearer <token>"
+type UploadHandler struct {
+	uploadService *services.UploadService
+	videoDetector *jobs.VideoUnencodedDetector
+}
+
+func NewUploadHandler(uploadService *services.UploadService, videoDetector *jobs.VideoUnencodedDetector) *UploadHandler {
+	return &UploadHandler{
+		uploadService: uploadService,
+		videoDetector: videoDetector,
+	}
+}
+
+// Options describes the protocol versions and extensions served, it is not authenticated
+func (h *UploadHandler) Options(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	if maxSize := h.uploadService.MaxSize(); maxSize > 0 {
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(maxSize, 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Create starts an upload of the size given by Upload-Length, its channel, file name and placeholder values are given by Upload-Metadata
+func (h *UploadHandler) Create(w http.ResponseWriter, r *http.Request) {
+	token, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		http.Error(w, "Expected an Upload-Length header", http.StatusBadRequest)
+		return
+	}
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	upload, err := h.uploadService.Create(token, size, metadata)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", constants.ApiPathPrefix+"/uploads/"+upload.ID)
+	h.writeUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Head returns the offset of an upload, where the client resumes it
+func (h *UploadHandler) Head(w http.ResponseWriter, r *http.Request) {
+	token, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	upload, err := h.uploadService.Get(token, mux.Vars(r)["id"])
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.writeUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Patch appends a chunk at the offset given by Upload-Offset, the complete upload is queued for encoding
+func (h *UploadHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	token, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != tusContentType {
+		http.Error(w, "Expected the "+tusContentType+" content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Expected an Upload-Offset header", http.StatusBadRequest)
+		return
+	}
+
+	upload, source, err := h.uploadService.Write(token, mux.Vars(r)["id"], offset, r.Body)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	// The encode is queued right away instead of waiting for the detection
+	if source != "" {
+		job, err := h.videoDetector.QueueFile(upload.Channel, strings.TrimPrefix(source, constants.VideoDir+"/"))
+		if err != nil {
+			log.Printf("Error queueing uploaded video %s, left to the detection: %v", source, err)
+		} else {
+			w.Header().Set("Theatrum-Job-Id", job.ID)
+		}
+	}
+
+	h.writeUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Delete terminates an upload and removes its data
+func (h *UploadHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	token, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.uploadService.Terminate(token, mux.Vars(r)["id"]); err != nil {
+		h.respondError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticate checks the protocol version and the upload token of a request, and writes the error response if needed
+func (h *UploadHandler) authenticate(w http.ResponseWriter, r *http.Request) (models.UploadToken, bool) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported tus version", http.StatusPreconditionFailed)
+		return models.UploadToken{}, false
+	}
+
+	secret, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	token, err := h.uploadService.Authenticate(secret)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return models.UploadToken{}, false
+	}
+	return token, true
+}
+
+func (h *UploadHandler) writeUploadHeaders(w http.ResponseWriter, upload models.Upload) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	if !upload.Complete() {
+		w.Header().Set("Upload-Expires", h.uploadService.ExpiresAt(upload).UTC().Format(http.TimeFormat))
+	}
+}
+
+// respondError writes the HTTP status matching the error
+func (h *UploadHandler) respondError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repositories.ErrUploadNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrUploadForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, services.ErrInvalidUpload):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrUploadOffsetMismatch):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, services.ErrUploadLocked):
+		http.Error(w, err.Error(), http.StatusLocked)
+	case errors.Is(err, services.ErrUploadTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, services.ErrQuotaExceeded):
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+	default:
+		log.Printf("Error handling upload request: %v", err)
+		http.Error(w, "Error handling upload request", http.StatusInternalServerError)
+	}
+}
+
+// parseUploadMetadata decodes the Upload-Metadata header: comma separated keys, each followed by a space and its base64 encoded value
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for pair := range strings.SplitSeq(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("invalid Upload-Metadata header: empty key")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.New("invalid Upload-Metadata header: value of " + key + " is not base64 encoded")
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"Theatrum/domain/jobs"
+	"Theatrum/domain/services"
+)
+
+// usageResponse describes the storage used by a channel with a quota, or by a placeholder value of the channel
+type usageResponse struct {
+	Channel      string `json:"channel"`
+	Placeholder  string `json:"placeholder,omitempty"`
+	Value        string `json:"value,omitempty"`
+	UsedBytes    int64  `json:"used_bytes"`
+	PendingBytes int64  `json:"pending_bytes"`
+	MaxBytes     int64  `json:"max_bytes"`
+	Exceeded     bool   `json:"exceeded"`
+}
+
+// UsageHandler serves the storage usage of the channels with a quota
+type UsageHandler struct {
+	quotaService *services.QuotaService
+	encodeQueue  *jobs.EncodeJobQueue
+}
+
+func NewUsageHandler(quotaService *services.QuotaService, encodeQueue *jobs.EncodeJobQueue) *UsageHandler {
+	return &UsageHandler{
+		quotaService: quotaService,
+		encodeQueue:  encodeQueue,
+	}
+}
+
+// ServeHTTP returns the usage of every channel with a quota, optionally filtered by the "channel" query parameter
+// Pending bytes are the estimated output size of the queued and running encodes
+func (h *UsageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report, err := h.quotaService.Report(h.encodeQueue.PendingSize)
+	if err != nil {
+		log.Printf("Error measuring storage usage: %v", err)
+		http.Error(w, "Error measuring storage usage", http.StatusInternalServerError)
+		return
+	}
+
+	channel := r.URL.Query().Get("channel")
+	response := make([]usageResponse, 0, len(report))
+	for _, usage := range report {
+		if channel != "" && usage.Channel != channel {
+			continue
+		}
+		response = append(response, usageResponse{
+			Channel:      usage.Channel,
+			Placeholder:  usage.Placeholder,
+			Value:        usage.Value,
+			UsedBytes:    usage.Used,
+			PendingBytes: usage.Pending,
+			MaxBytes:     usage.MaxSize,
+			Exceeded:     usage.Exceeded(),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
@@ -8,10 +8,17 @@ import (
 	"syscall"
 	"time"
 
+	boltJobStoreRepository "Theatrum/adapters/driven/boltJobStore/repositories"
 	ffmpegEncoderRepository "Theatrum/adapters/driven/ffmpegEncoder/repositories"
 	fileAccessRepository "Theatrum/adapters/driven/fileAccess/repositories"
+	fileUploadStoreRepository "Theatrum/adapters/driven/fileUploadStore/repositories"
+	fsnotifyWatcherRepository "Theatrum/adapters/driven/fsnotifyWatcher/repositories"
+	jsonLinesAuditLogRepository "Theatrum/adapters/driven/jsonLinesAuditLog/repositories"
+	s3StorageRepository "Theatrum/adapters/driven/s3Storage/repositories"
 	yamlConfigFileRepository "Theatrum/adapters/driven/yamlConfigFile/repositories"
+	"Theatrum/constants"
 	"Theatrum/domain/jobs"
+	"Theatrum/domain/models"
 	"Theatrum/domain/repositories"
 	"Theatrum/domain/services"
 	"Theatrum/servers"
@@ -19,6 +26,13 @@ import (
 	"go.uber.org/dig"
 )
 
+// configuration is the loaded configuration file, the storage adapter is chosen from it
+type configuration struct {
+	application *models.Application
+	server      *models.Server
+	channels    *map[string]models.Stream
+}
+
 func main() {
 	// Configure logging
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
@@ -37,26 +51,53 @@ func main() {
 	container.Provide(func() repositories.EncoderPort {
 		return ffmpegEncoderRepository.NewFfmpegEncoder()
 	})
-	container.Provide(func() repositories.StoragePort {
+	container.Provide(func(config *configuration) (repositories.StoragePort, error) {
+		if config.application.Storage.Type == models.StorageTypeS3 {
+			return s3StorageRepository.NewS3Storage(config.application.Storage.S3)
+		}
 		return fileAccessRepository.NewFileAccess()
 	})
+	container.Provide(func() (repositories.JobStorePort, error) {
+		return boltJobStoreRepository.NewBoltJobStore(constants.JobStorePath)
+	})
+	container.Provide(func() repositories.RetentionAuditPort {
+		return jsonLinesAuditLogRepository.NewJsonLinesAuditLog(constants.RetentionAuditPath)
+	})
+	container.Provide(func() repositories.UploadStorePort {
+		return fileUploadStoreRepository.NewFileUploadStore(constants.UploadsDir)
+	})
+	container.Provide(func() (repositories.WatcherPort, error) {
+		return fsnotifyWatcherRepository.NewFsnotifyWatcher()
+	})
 
-	// Provide services
-	container.Provide(func(configPort repositories.ConfigurationPort, storage repositories.StoragePort, templateService *services.PathTemplateService) (*services.ApplicationService, error) {
+	// Provide configuration
+	container.Provide(func(configPort repositories.ConfigurationPort) (*configuration, error) {
 		application, server, channels, err := configPort.Load("config.yml")
 		if err != nil {
 			log.Printf("error loading configuration: %v", err)
 			return nil, err
 		}
-		return services.NewApplicationService(application, server, channels, storage, templateService), nil
+		return &configuration{application: application, server: server, channels: channels}, nil
+	})
+
+	// Provide services
+	container.Provide(func(config *configuration, storage repositories.StoragePort) *services.InventoryService {
+		return services.NewInventoryService(config.channels, storage)
+	})
+	container.Provide(func(config *configuration, inventory *services.InventoryService, templateService *services.PathTemplateService) *services.ApplicationService {
+		return services.NewApplicationService(config.application, config.server, config.channels, inventory, templateService)
 	})
 	container.Provide(services.NewPathTemplateService)
 	container.Provide(services.NewStreamService)
 	container.Provide(services.NewEncodeService)
+	container.Provide(services.NewSourceValidationService)
+	container.Provide(services.NewManifestService)
+	container.Provide(services.NewQuotaService)
+	container.Provide(services.NewUploadService)
 
 	// Provide job queue
-	container.Provide(func(encodeService *services.EncodeService, storage repositories.StoragePort) *jobs.EncodeJobQueue {
-		return jobs.NewEncodeJobQueue(encodeService, storage)
+	container.Provide(func(appService *services.ApplicationService, encodeService *services.EncodeService, manifestService *services.ManifestService, inventory *services.InventoryService, storage repositories.StoragePort, jobStore repositories.JobStorePort) *jobs.EncodeJobQueue {
+		return jobs.NewEncodeJobQueue(appService, encodeService, manifestService, inventory, storage, jobStore, appService.GetApplication().Encoding)
 	})
 
 	// Provide video detector
@@ -64,34 +105,69 @@ func main() {
 		appService *services.ApplicationService,
 		encodeQueue *jobs.EncodeJobQueue,
 		storage repositories.StoragePort,
+		watcher repositories.WatcherPort,
 		templateService *services.PathTemplateService,
+		validationService *services.SourceValidationService,
+		manifestService *services.ManifestService,
+		inventory *services.InventoryService,
+		quotaService *services.QuotaService,
 	) *jobs.VideoUnencodedDetector {
-		return jobs.NewVideoUnencodedDetector(appService, encodeQueue, storage, templateService)
+		return jobs.NewVideoUnencodedDetector(appService, encodeQueue, storage, watcher, templateService, validationService, manifestService, inventory, quotaService)
 	})
 
+	// Provide ladder change detector
+	container.Provide(jobs.NewLadderChangeDetector)
+
+	// Provide retention janitor
+	container.Provide(jobs.NewRetentionJanitor)
+
 	// Start the application and jobs
 	err := container.Invoke(func(
 		appService *services.ApplicationService,
 		streamService *services.StreamService,
 		encodeQueue *jobs.EncodeJobQueue,
 		videoDetector *jobs.VideoUnencodedDetector,
+		ladderDetector *jobs.LadderChangeDetector,
+		inventory *services.InventoryService,
+		quotaService *services.QuotaService,
+		janitor *jobs.RetentionJanitor,
+		uploadService *services.UploadService,
 	) {
+		// Keep the inventory in line with the files added or removed by hand
+		go inventory.Reconcile(ctx, appService.GetApplication().Inventory.ReconcileInterval)
+
 		// Start the encode queue
 		encodeQueue.Start()
 
-		// Run video detection synchronously
-		if err := videoDetector.DetectAndQueueVideos(); err != nil {
+		// Queue the re-encodes of the outputs whose ladder changed, before the detection which would encode their kept sources in full
+		if appService.GetApplication().Encoding.ReencodeChangedLadders {
+			ladderDetector.DetectAndQueueReencodes()
+		}
+
+		// Delete the outputs expired by the retention policies
+		go janitor.Run(ctx)
+
+		// Remove the uploads abandoned by their client
+		if appService.GetApplication().Uploads.Enabled {
+			go uploadService.Expire(ctx)
+		}
+
+		// Watch the sources continuously, or run video detection synchronously once
+		if appService.GetApplication().Watch.Enabled {
+			go videoDetector.Watch(ctx)
+		} else if err := videoDetector.DetectAndQueueVideos(); err != nil {
 			log.Printf("Error during video detection: %v", err)
 		}
 
 		// Setup cleanup for graceful shutdown
 		defer func() {
+			cancel()
 			appService.Cleanup()
 			encodeQueue.Stop()
 		}()
 
 		// Start HTTP server
-		httpServer := servers.NewHttpServer(appService, streamService)
+		httpServer := servers.NewHttpServer(appService, streamService, encodeQueue, videoDetector, ladderDetector, quotaService, uploadService)
 		
 		// Create a channel to listen for errors coming from the server
 		serverErrors := make(chan error, 1)
@@ -5,6 +5,18 @@ import (
 )
 
 var (
-	FrontendDir = path.Join(workDirNormalized, "frontend")
-	VideoDir    = path.Join(workDirNormalized, "data")
+	FrontendDir  = path.Join(workDirNormalized, "frontend")
+	VideoDir     = path.Join(workDirNormalized, "data")
+	JobStorePath = path.Join(workDirNormalized, "jobs.db")
+	// UploadsDir holds the uploads in progress, until they are moved to the input path of their channel
+	UploadsDir = path.Join(workDirNormalized, "uploads")
+	// EncodesDir holds the encodes in progress, each in a directory of its own, until they are published to the storage
+	EncodesDir = path.Join(workDirNormalized, "encodes")
+	// RetentionAuditPath records every output directory expired by the retention policies, one JSON object per line
+	RetentionAuditPath = path.Join(workDirNormalized, "retention_audit.log")
+)
+
+const (
+	// ApiPathPrefix is reserved for the API routes, channels cannot be served under it
+	ApiPathPrefix = "/api"
 )
\ No newline at end of file
@@ -8,4 +8,36 @@ var (
 	PlaceholderBegin = "{"
 	PlaceholderEnd   = "}"
 	PlaceholderRegex = regexp.QuoteMeta(PlaceholderBegin) + `[^` + regexp.QuoteMeta(PlaceholderBegin) + regexp.QuoteMeta(PlaceholderEnd) + `]+` + regexp.QuoteMeta(PlaceholderEnd)
+
+	// SourcePlaceholders tell the sources apart in an output path, without any of them the outputs of a video unencoded
+	// stream are put in a directory named after their source
+	SourcePlaceholders = []string{PlaceholderFilename, PlaceholderFilenameStem, PlaceholderUUID, PlaceholderHash8}
+
+	// ComputedPlaceholders are given a value when a source is first queued, which its later encodes keep
+	ComputedPlaceholders = []string{PlaceholderDate, PlaceholderYear, PlaceholderMonth, PlaceholderUUID, PlaceholderHash8}
+)
+
+const (
+	// PlaceholderFilename is the file name of a source, slugified when it has characters not accepted in the paths
+	PlaceholderFilename = "FILENAME"
+	// PlaceholderFilenameStem is the file name of a source without its extension, slugified like PlaceholderFilename
+	PlaceholderFilenameStem = "FILENAME_STEM"
+	// PlaceholderExt is the lower case extension of a source, without its dot
+	PlaceholderExt = "EXT"
+	// PlaceholderDate is replaced by the day a source was queued in the output and archive paths
+	PlaceholderDate = "date"
+	// DateLayout is the format of the {date} placeholder
+	DateLayout = "2006-01-02"
+	// PlaceholderYear and PlaceholderMonth are replaced by the year (2024) and month (01 to 12) a source was queued
+	PlaceholderYear  = "yyyy"
+	PlaceholderMonth = "mm"
+	// PlaceholderUUID is replaced by a random UUID, drawn once per source
+	PlaceholderUUID = "uuid"
+	// PlaceholderHash8 is replaced by the first 8 hex characters of the SHA-256 of a source
+	PlaceholderHash8 = "hash8"
+
+	// PlaceholderConstraintSeparator separates the name of a placeholder from its constraint, as in {id:int}
+	PlaceholderConstraintSeparator = ":"
+	// PlaceholderConstraintInt restricts a placeholder to digits
+	PlaceholderConstraintInt = "int"
 )
\ No newline at end of file
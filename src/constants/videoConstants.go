@@ -5,6 +5,24 @@ var (
 	MasterPlaylist                = "master.m3u8"
 	SubPlaylist                   = "playlist.m3u8"
 	SegmentName                   = "segment_%03d.ts"
-	ValidVideoExtensions          = []string{".mp4"}
+	ValidVideoExtensions          = []string{".mp4", ".mov", ".mkv", ".webm", ".avi", ".ts"}
 	ValidMasterPlaylistExtensions = []string{".m3u8"}
+	DefaultDecodeCheckSeconds     = 10
+	QuarantineReportSuffix        = ".error.json"
+	LadderFile                    = "ladder.json"
+	QualityReportFile             = "quality_report.json"
+	ManifestFile                  = "manifest.json"
+	DefaultAutoLadderCrf          = 23
+	DefaultAutoLadderSampleSecs   = 30
+	DefaultEncodeWorkers          = 1
+	DefaultRetryMaxAttempts       = 3
+	DefaultRetryBackoff           = "1m"
+	DefaultRetryMaxBackoff        = "0"
+	DefaultFinishedJobRetention   = "168h"
+	DeadLetterStderrSuffix        = ".stderr.log"
+	DefaultWatchRescanInterval    = "5m"
+	DefaultWatchStabilityPeriod   = "30s"
+	DefaultInventoryReconcile     = "5m"
+	DefaultRetentionInterval      = "1h"
+	DefaultUploadExpireAfter      = "24h"
 )
\ No newline at end of file
@@ -2,117 +2,594 @@ package jobs
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"path"
+	"strings"
 	"sync"
 	"time"
 
+	"Theatrum/constants"
 	"Theatrum/domain/models"
 	"Theatrum/domain/repositories"
 	"Theatrum/domain/services"
+	"Theatrum/domain/utils"
 )
 
-// EncodeJob represents a video encoding job
-type EncodeJob struct {
-	InputStoragePath  string
-	OutputStoragePath string
-	Channel          models.Stream
-}
+// ErrJobAlreadyQueued is returned when an equivalent job is already queued or running
+var ErrJobAlreadyQueued = errors.New("job already queued")
+
+// errChannelRemoved fails the stored jobs whose channel is no longer configured
+var errChannelRemoved = errors.New("channel is no longer configured")
 
-// EncodeJobQueue manages the queue of encoding jobs
+// EncodeJobQueue manages the queue of encoding jobs, persisted in the job store so a restart does not lose them
 type EncodeJobQueue struct {
-	jobs            chan EncodeJob
+	appService      *services.ApplicationService
 	encodeService   *services.EncodeService
+	manifestService *services.ManifestService
+	inventory       *services.InventoryService
 	storage         repositories.StoragePort
+	jobStore        repositories.JobStorePort
+	settings        models.Encoding
+	mu              sync.Mutex
+	activeJobs      map[string]*models.EncodeJob // Queued and running jobs by ID
+	queued          *scheduler                   // Queued jobs, in the order they start
+	running         map[string]int               // Number of running jobs by channel
+	encodes         map[string]*runningEncode    // Running encodes by job ID
+	notify          chan struct{}
+	runningChange   chan struct{} // Notifies the schedule supervisor that a job started or finished
 	wg              sync.WaitGroup
 	ctx             context.Context
 	cancel          context.CancelFunc
 }
 
 // NewEncodeJobQueue creates a new encode job queue
-func NewEncodeJobQueue(encodeService *services.EncodeService, storage repositories.StoragePort) *EncodeJobQueue {
+func NewEncodeJobQueue(appService *services.ApplicationService, encodeService *services.EncodeService, manifestService *services.ManifestService, inventory *services.InventoryService, storage repositories.StoragePort, jobStore repositories.JobStorePort, settings models.Encoding) *EncodeJobQueue {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &EncodeJobQueue{
-		jobs:            make(chan EncodeJob, 100), // Buffer size of 100 jobs
+		appService:      appService,
 		encodeService:   encodeService,
+		manifestService: manifestService,
+		inventory:       inventory,
 		storage:         storage,
+		jobStore:        jobStore,
+		settings:        settings,
+		activeJobs:      make(map[string]*models.EncodeJob),
+		queued:          newScheduler(),
+		running:         make(map[string]int),
+		encodes:         make(map[string]*runningEncode),
+		notify:          make(chan struct{}, 1),
+		runningChange:   make(chan struct{}, 1),
 		ctx:             ctx,
 		cancel:          cancel,
 	}
 }
 
-// Start begins processing the job queue
+// Start restores the unfinished jobs from the job store and begins processing the job queue with the configured number of workers
 func (q *EncodeJobQueue) Start() {
+	if err := q.restore(); err != nil {
+		log.Printf("Error restoring encode jobs: %v", err)
+	}
+
+	workers := max(1, q.settings.Workers)
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.worker(i)
+	}
+
 	q.wg.Add(1)
-	go q.worker()
+	go q.superviseSchedule()
 }
 
-// Stop gracefully stops the worker
+// Stop gracefully stops the workers and closes the job store
 func (q *EncodeJobQueue) Stop() {
 	q.cancel()
-	close(q.jobs)
 	q.wg.Wait()
+	if err := q.jobStore.Close(); err != nil {
+		log.Printf("Error closing job store: %v", err)
+	}
+}
+
+// restore queues again the jobs that were queued, or interrupted while running, when the application stopped,
+// with the current configuration of their channel, and removes the finished jobs past their retention
+func (q *EncodeJobQueue) restore() error {
+	q.pruneFinishedJobs()
+
+	storedJobs, err := q.jobStore.ListJobs()
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, job := range storedJobs {
+		if !job.IsActive() {
+			continue
+		}
+
+		// The configuration may have changed while the application was stopped
+		if err := q.resolveChannel(&job); err != nil {
+			log.Printf("Failing encode job %s: %v", job.ID, err)
+			job.State = models.JobStateFailed
+			job.Error = err.Error()
+			job.FinishedAt = time.Now()
+			if err := q.jobStore.SaveJob(job); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if job.State == models.JobStateRunning {
+			log.Printf("Requeuing interrupted encode job %s: %s", job.ID, job.InputStoragePath)
+			job.State = models.JobStateQueued
+			job.StartedAt = time.Time{}
+			job.Suspended = false
+		}
+		if err := q.jobStore.SaveJob(job); err != nil {
+			return err
+		}
+
+		q.activeJobs[job.ID] = &job
+		q.queued.Push(&job)
+	}
+
+	if q.queued.Len() > 0 {
+		log.Printf("Restored %d encode jobs", q.queued.Len())
+	}
+
+	return nil
+}
+
+// resolveChannel replaces the channel recorded with a stored job by its current configuration
+func (q *EncodeJobQueue) resolveChannel(job *models.EncodeJob) error {
+	channel, found := (*q.appService.GetChannels())[job.ChannelName]
+	if !found || channel.Type != job.Channel.Type {
+		return fmt.Errorf("%w: %s", errChannelRemoved, job.ChannelName)
+	}
+	job.Channel = channel
+	return nil
+}
+
+// pruneFinishedJobs removes from the job store the done, failed and canceled jobs finished for longer than the retention
+func (q *EncodeJobQueue) pruneFinishedJobs() {
+	if q.settings.FinishedJobRetention <= 0 {
+		return
+	}
+
+	storedJobs, err := q.jobStore.ListJobs()
+	if err != nil {
+		log.Printf("Error listing jobs to prune: %v", err)
+		return
+	}
+
+	pruned := 0
+	expiredBefore := time.Now().Add(-q.settings.FinishedJobRetention)
+	for _, job := range storedJobs {
+		if job.IsActive() || job.FinishedAt.IsZero() || !job.FinishedAt.Before(expiredBefore) {
+			continue
+		}
+		if err := q.jobStore.DeleteJob(job.ID); err != nil {
+			log.Printf("Error pruning job %s: %v", job.ID, err)
+			continue
+		}
+		pruned++
+	}
+
+	if pruned > 0 {
+		log.Printf("Pruned %d finished encode jobs", pruned)
+	}
 }
 
-// Enqueue adds a new encoding job to the queue
-func (q *EncodeJobQueue) Enqueue(job EncodeJob) error {
+// Enqueue persists a new encoding job and adds it to the queue, its source is hashed once the job starts
+// ErrJobAlreadyQueued is returned if a job for the same source, or for the same output, is queued or running
+func (q *EncodeJobQueue) Enqueue(job models.EncodeJob) (models.EncodeJob, error) {
+	if q.ctx.Err() != nil {
+		return job, context.Canceled
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if active, found := q.findEquivalentJob(job); found {
+		return *active, fmt.Errorf("%w as %s", ErrJobAlreadyQueued, active.ID)
+	}
+
+	job.ID = utils.NewID()
+	job.State = models.JobStateQueued
+	job.CreatedAt = time.Now()
+
+	if err := q.jobStore.SaveJob(job); err != nil {
+		return job, fmt.Errorf("error saving job: %w", err)
+	}
+
+	q.activeJobs[job.ID] = &job
+	q.queued.Push(&job)
+	q.wakeUp()
+
+	return job, nil
+}
+
+// findEquivalentJob returns the queued or running job encoding the same source or into the same output as a job
+// The queue must be locked
+func (q *EncodeJobQueue) findEquivalentJob(job models.EncodeJob) (*models.EncodeJob, bool) {
+	for _, active := range q.activeJobs {
+		if active.ID == job.ID {
+			continue
+		}
+		if active.InputStoragePath == job.InputStoragePath || active.OutputStoragePath == job.OutputStoragePath {
+			return active, true
+		}
+	}
+	return nil, false
+}
+
+// findActiveJob returns the first queued or running job matching the predicate
+func (q *EncodeJobQueue) findActiveJob(match func(active *models.EncodeJob) bool) (models.EncodeJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, active := range q.activeJobs {
+		if match(active) {
+			return *active, true
+		}
+	}
+	return models.EncodeJob{}, false
+}
+
+// wakeUp notifies an idle worker that a job may be available, without blocking if a worker was already notified
+func (q *EncodeJobQueue) wakeUp() {
+	notify(q.notify)
+}
+
+// notify sends a notification on a channel of capacity 1, without blocking if one is already pending
+func notify(channel chan struct{}) {
 	select {
-	case <-q.ctx.Done():
-		return context.Canceled
-	case q.jobs <- job:
-		return nil
+	case channel <- struct{}{}:
+	default:
+	}
+}
+
+// next pops the queued job to start according to the scheduler and marks it as running
+// Jobs of a capped channel or waiting for a retry are skipped, so they do not hold back the others
+// The returned context is canceled when the job is canceled
+func (q *EncodeJobQueue) next() (models.EncodeJob, context.Context, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	job := q.queued.Next(func(job *models.EncodeJob) bool {
+		return !job.IsDelayed(now) && q.canStart(job, now)
+	})
+	if job == nil {
+		return models.EncodeJob{}, nil, false
+	}
+	q.running[job.ChannelName]++
+
+	// Stopping the queue waits for the running encodes, so they do not inherit its context
+	ctx, cancel := context.WithCancel(context.Background())
+	q.encodes[job.ID] = &runningEncode{cancel: cancel}
+
+	// Let another idle worker pick the remaining jobs
+	if q.queued.Len() > 0 {
+		q.wakeUp()
+	}
+
+	job.State = models.JobStateRunning
+	job.Progress = 0
+	job.Attempts++
+	job.StartedAt = now
+	if err := q.jobStore.SaveJob(*job); err != nil {
+		log.Printf("Error saving job %s: %v", job.ID, err)
+	}
+	notify(q.runningChange)
+
+	return *job, ctx, true
+}
+
+// canStart checks whether the schedule of a job is open and its channel below its concurrency cap
+func (q *EncodeJobQueue) canStart(job *models.EncodeJob, now time.Time) bool {
+	if !q.schedule(job).IsOpen(now) {
+		return false
 	}
+	limit := job.Channel.MaxConcurrentEncodes
+	return limit <= 0 || q.running[job.ChannelName] < limit
+}
+
+// wakeUpDelay returns how long until a queued job may become startable, at the end of its retry backoff
+// or when its schedule opens (0 when no job waits for either)
+func (q *EncodeJobQueue) wakeUpDelay() time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var delay time.Duration
+	now := time.Now()
+	for _, job := range q.queued.Jobs() {
+		wakeUpAt := job.NextAttemptAt
+		if !job.IsDelayed(now) {
+			wakeUpAt = q.schedule(job).NextChange(now)
+			if wakeUpAt.IsZero() {
+				continue
+			}
+		}
+		if wait := wakeUpAt.Sub(now); delay == 0 || wait < delay {
+			delay = wait
+		}
+	}
+	return delay
+}
+
+// finish records the outcome of a job and returns it updated
+// A failed job is queued again after a backoff, unless the failure is permanent, it ran out of attempts or it was canceled
+func (q *EncodeJobQueue) finish(job models.EncodeJob, result models.EncodeResult, encodeErr error) models.EncodeJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	canceled := false
+	if encode, found := q.encodes[job.ID]; found {
+		delete(q.encodes, job.ID)
+		encode.cancel()
+		canceled = encode.canceled
+	}
+
+	// The priority may have been changed while the job was running
+	job.Priority = q.activeJobs[job.ID].Priority
+
+	// The encoder keeps the job suspended until it is resumed, a retry must not start suspended
+	if q.activeJobs[job.ID].Suspended {
+		if err := q.encodeService.ResumeJob(job.ID); err != nil {
+			log.Printf("Error resuming finished encode job %s: %v", job.ID, err)
+		}
+	}
+
+	retry := false
+	job.FinishedAt = time.Now()
+	job.Suspended = false
+	if canceled && encodeErr != nil {
+		job.State = models.JobStateCanceled
+		job.Error = ""
+		job.StderrTail = ""
+	} else if encodeErr != nil {
+		job.Error = encodeErr.Error()
+		job.StderrTail = models.EncodeStderrTail(encodeErr)
+		retry = !models.IsPermanentEncodeError(encodeErr) && job.Attempts < q.settings.Retry.MaxAttempts
+		if retry {
+			job.State = models.JobStateQueued
+			job.NextAttemptAt = job.FinishedAt.Add(q.settings.Retry.Delay(job.Attempts))
+		} else {
+			job.State = models.JobStateFailed
+		}
+	} else {
+		job.State = models.JobStateDone
+		job.Progress = 1
+		job.Error = ""
+		job.StderrTail = ""
+		job.Result = &result
+	}
+
+	if err := q.jobStore.SaveJob(job); err != nil {
+		log.Printf("Error saving job %s: %v", job.ID, err)
+	}
+	if retry {
+		*q.activeJobs[job.ID] = job
+		q.queued.Push(q.activeJobs[job.ID])
+	} else {
+		delete(q.activeJobs, job.ID)
+	}
+
+	q.running[job.ChannelName]--
+	if q.running[job.ChannelName] <= 0 {
+		delete(q.running, job.ChannelName)
+	}
+
+	// A job of the channel may have been waiting for this slot
+	if q.queued.Len() > 0 {
+		q.wakeUp()
+	}
+	notify(q.runningChange)
+
+	return job
 }
 
 // worker processes jobs from the queue
-func (q *EncodeJobQueue) worker() {
+func (q *EncodeJobQueue) worker(id int) {
 	defer q.wg.Done()
-	log.Printf("Encode worker started")
+	log.Printf("Encode worker %d started", id)
 
 	for {
 		select {
 		case <-q.ctx.Done():
-			log.Printf("Encode worker stopping")
+			log.Printf("Encode worker %d stopping", id)
 			return
-		case job, ok := <-q.jobs:
-			if !ok {
+		default:
+		}
+
+		job, ctx, ok := q.next()
+		if !ok {
+			// Wait for a new job, a free channel slot, the end of a retry backoff or the opening of a schedule
+			var later <-chan time.Time
+			if delay := q.wakeUpDelay(); delay > 0 {
+				later = time.After(delay)
+			}
+			select {
+			case <-q.ctx.Done():
+				log.Printf("Encode worker %d stopping", id)
 				return
+			case <-q.notify:
+			case <-later:
 			}
-			q.processJob(job)
+			continue
 		}
+
+		q.processJob(ctx, job)
+		q.pruneFinishedJobs()
 	}
 }
 
-// processJob handles a single encoding job because encoder already manage multi-threading
-func (q *EncodeJobQueue) processJob(job EncodeJob) {
-	startTime := time.Now()
-	log.Printf("Starting encode job: %s -> %s", job.InputStoragePath, job.OutputStoragePath)
+// FailedJobs returns the jobs whose encode failed for good, oldest first
+func (q *EncodeJobQueue) FailedJobs() ([]models.EncodeJob, error) {
+	storedJobs, err := q.jobStore.ListJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	failedJobs := []models.EncodeJob{}
+	for _, job := range storedJobs {
+		if job.State == models.JobStateFailed {
+			failedJobs = append(failedJobs, job)
+		}
+	}
+	return failedJobs, nil
+}
 
-	err := q.encodeService.EncodeStream(
+// deadLetter moves the source of a failed job to its dead letter directory, next to a log of the failure
+func (q *EncodeJobQueue) deadLetter(job models.EncodeJob) {
+	if job.DeadLetterPath == "" {
+		return
+	}
+
+	// A failed source of the same name, or its report, is kept: the job ID tells the two apart
+	deadLetterPath := path.Join(job.DeadLetterPath, path.Base(job.InputStoragePath))
+	if q.storageHas(deadLetterPath) || q.storageHas(deadLetterPath+constants.DeadLetterStderrSuffix) {
+		extension := path.Ext(deadLetterPath)
+		deadLetterPath = strings.TrimSuffix(deadLetterPath, extension) + "." + job.ID + extension
+	}
+	if err := q.storage.MoveFile(job.InputStoragePath, deadLetterPath); err != nil {
+		log.Printf("Error moving %s to dead letter: %v", job.InputStoragePath, err)
+		return
+	}
+	q.inventory.Update(job.InputStoragePath)
+
+	report := fmt.Sprintf("Job: %s\nSource: %s\nAttempts: %d\nFailed at: %s\nError: %s\n\n%s\n",
+		job.ID,
 		job.InputStoragePath,
-		job.OutputStoragePath,
-		job.Channel,
-	)
+		job.Attempts,
+		job.FinishedAt.Format(time.RFC3339),
+		job.Error,
+		job.StderrTail)
+	if err := q.storage.WriteFile(deadLetterPath+constants.DeadLetterStderrSuffix, []byte(report)); err != nil {
+		log.Printf("Error writing dead letter report of %s: %v", deadLetterPath, err)
+	}
+
+	log.Printf("Moved failed video to dead letter: %s -> %s", job.InputStoragePath, deadLetterPath)
+}
+
+// storageHas reports whether a file exists in the storage
+func (q *EncodeJobQueue) storageHas(file string) bool {
+	_, err := q.storage.StatFile(file)
+	return err == nil
+}
+
+// processJob encodes a single job within the threads budget of a worker
+func (q *EncodeJobQueue) processJob(ctx context.Context, job models.EncodeJob) {
+	startTime := time.Now()
+	log.Printf("Starting encode job %s (attempt %d): %s -> %s", job.ID, job.Attempts, job.InputStoragePath, job.OutputStoragePath)
+
+	// The content is hashed by the worker rather than when queueing, so large sources do not slow the scans down
+	var result models.EncodeResult
+	var err error
+	if job.ContentHash == "" {
+		job.ContentHash, err = q.storage.HashFile(job.InputStoragePath)
+		if err != nil {
+			err = fmt.Errorf("error hashing source: %w", err)
+		}
+	}
+	if err == nil {
+		result, err = q.encodeService.EncodeStream(ctx, job, q.settings.ThreadsPerJob, func(fraction float64) {
+			q.setProgress(job.ID, fraction)
+		})
+	}
+	job = q.finish(job, result, err)
 
 	duration := time.Since(startTime)
+	if job.State == models.JobStateCanceled {
+		log.Printf("Encode job %s canceled after %v", job.ID, duration.Round(time.Second))
+		return
+	}
 	if err != nil {
-		log.Printf("Error processing encode job %s after %v: %v", 
-			job.InputStoragePath, 
-			duration.Round(time.Second), 
+		log.Printf("Error processing encode job %s after %v: %v",
+			job.InputStoragePath,
+			duration.Round(time.Second),
 			err)
+
+		if job.State == models.JobStateQueued {
+			log.Printf("Retrying encode job %s at %s (attempt %d of %d)", job.ID, job.NextAttemptAt.Format(time.RFC3339), job.Attempts+1, q.settings.Retry.MaxAttempts)
+			return
+		}
+
+		log.Printf("Encode job %s failed after %d attempts", job.ID, job.Attempts)
+		// A re-encoded source is kept for the next re-encodes
+		if !job.Reencode {
+			q.deadLetter(job)
+		}
 		return
 	}
 
-	log.Printf("Successfully encoded video: %s (took %v)", 
-		job.InputStoragePath, 
+	log.Printf("Successfully encoded video: %s (took %v)",
+		job.InputStoragePath,
 		duration.Round(time.Second))
 
-	// Delete source file if enabled for video_unencoded streams
-	if job.Channel.Type == models.StreamTypeVideoUnEncoded && job.Channel.DeleteAfterEncoding {
+	if result.QualityReport != nil {
+		for _, rendition := range result.QualityReport.Renditions {
+			log.Printf("Quality %s of %s: PSNR %.2f dB, SSIM %.4f", rendition.Quality, job.InputStoragePath, rendition.Psnr, rendition.Ssim)
+		}
+	}
+
+	// Record the encode so the source is not queued again while it and its channel ladder are unchanged,
+	// the source is read before it is deleted or archived
+	manifest, manifestErr := q.manifestService.NewManifest(job)
+
+	// Delete or archive the source file if enabled for video_unencoded streams, a re-encoded source stays where it is kept
+	sourcePath := job.InputStoragePath
+	if job.Channel.Type == models.StreamTypeVideoUnEncoded && !job.Reencode {
+		sourcePath = q.afterEncoding(job)
+	}
+
+	if manifestErr == nil {
+		manifestErr = q.manifestService.SaveManifest(job, manifest, sourcePath)
+	}
+	if manifestErr != nil {
+		log.Printf("Error writing manifest of %s: %v", job.InputStoragePath, manifestErr)
+	}
+
+	// The published output and the moved source change the playlists and the detected sources
+	outputDir := path.Dir(job.OutputStoragePath)
+	q.inventory.Update(job.InputStoragePath, sourcePath, path.Join(outputDir, constants.MasterPlaylist), path.Join(outputDir, constants.ManifestFile))
+}
+
+// afterEncoding deletes the source of an encoded job, or moves it to its archive directory, according to its channel
+// It returns where the source is kept, empty if it was deleted
+func (q *EncodeJobQueue) afterEncoding(job models.EncodeJob) string {
+	switch job.Channel.AfterEncoding {
+	case models.AfterEncodingDelete:
 		log.Printf("Deleting source file after successful encoding: %s", job.InputStoragePath)
 		if err := q.storage.DeleteFile(job.InputStoragePath); err != nil {
 			log.Printf("Error deleting source file %s: %v", job.InputStoragePath, err)
-		} else {
-			log.Printf("Successfully deleted source file: %s", job.InputStoragePath)
+			return job.InputStoragePath
+		}
+		log.Printf("Successfully deleted source file: %s", job.InputStoragePath)
+		return ""
+
+	case models.AfterEncodingMove:
+		if job.ArchivePath == "" {
+			return job.InputStoragePath
 		}
+
+		// An archived source of the same name is kept, the job ID tells the two apart
+		archivedPath := path.Join(job.ArchivePath, path.Base(job.InputStoragePath))
+		if _, err := q.storage.StatFile(archivedPath); err == nil {
+			extension := path.Ext(archivedPath)
+			archivedPath = strings.TrimSuffix(archivedPath, extension) + "." + job.ID + extension
+		}
+
+		if err := q.storage.MoveFile(job.InputStoragePath, archivedPath); err != nil {
+			log.Printf("Error archiving source file %s: %v", job.InputStoragePath, err)
+			return job.InputStoragePath
+		}
+		log.Printf("Archived source file after successful encoding: %s -> %s", job.InputStoragePath, archivedPath)
+		return archivedPath
 	}
+
+	return job.InputStoragePath
 }
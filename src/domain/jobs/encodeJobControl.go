@@ -0,0 +1,194 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"Theatrum/domain/models"
+)
+
+var (
+	// ErrJobNotActive is returned when a job must be queued or running to be changed
+	ErrJobNotActive = errors.New("job is not queued or running")
+	// ErrJobNotRetryable is returned when retrying a job which did not fail and was not canceled
+	ErrJobNotRetryable = errors.New("only failed or canceled jobs can be retried")
+)
+
+// runningEncode tracks a running job, so it can be canceled
+type runningEncode struct {
+	cancel   context.CancelFunc
+	canceled bool
+}
+
+// Jobs returns every job, oldest first, with the live state of the queued and running ones
+func (q *EncodeJobQueue) Jobs() ([]models.EncodeJob, error) {
+	storedJobs, err := q.jobStore.ListJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, job := range storedJobs {
+		if active, found := q.activeJobs[job.ID]; found {
+			storedJobs[i] = *active
+		}
+	}
+	return storedJobs, nil
+}
+
+// Job returns a job with its live state, or repositories.ErrJobNotFound
+func (q *EncodeJobQueue) Job(id string) (models.EncodeJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if active, found := q.activeJobs[id]; found {
+		return *active, nil
+	}
+	return q.jobStore.GetJob(id)
+}
+
+// Cancel removes a queued job from the queue, or stops the encode of a running job
+// A running job is marked as canceled once its encode stopped, its source is left in place
+func (q *EncodeJobQueue) Cancel(id string) (models.EncodeJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.activeJob(id)
+	if err != nil {
+		return models.EncodeJob{}, err
+	}
+
+	if encode, running := q.encodes[id]; running {
+		log.Printf("Canceling running encode job %s", id)
+		encode.canceled = true
+		encode.cancel()
+		return *job, nil
+	}
+
+	q.queued.Remove(id)
+	delete(q.activeJobs, id)
+
+	job.State = models.JobStateCanceled
+	job.NextAttemptAt = time.Time{}
+	job.FinishedAt = time.Now()
+	if err := q.jobStore.SaveJob(*job); err != nil {
+		return *job, fmt.Errorf("error saving job: %w", err)
+	}
+
+	log.Printf("Canceled queued encode job %s", id)
+	return *job, nil
+}
+
+// Retry queues again a failed or canceled job, with its attempts reset and the current configuration of its channel
+// ErrJobAlreadyQueued is returned if another job for the same source, or for the same output, is queued or running
+func (q *EncodeJobQueue) Retry(id string) (models.EncodeJob, error) {
+	if q.ctx.Err() != nil {
+		return models.EncodeJob{}, context.Canceled
+	}
+
+	job, err := q.jobStore.GetJob(id)
+	if err != nil {
+		return job, err
+	}
+	if !job.IsRetryable() {
+		return job, ErrJobNotRetryable
+	}
+
+	// The source may have been moved to the dead letter directory, or changed and hashed again when the job starts
+	if _, err := q.storage.StatFile(job.InputStoragePath); err != nil {
+		return job, fmt.Errorf("error reading source: %w", err)
+	}
+	if err := q.resolveChannel(&job); err != nil {
+		return job, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, found := q.activeJobs[id]; found {
+		return job, ErrJobNotRetryable
+	}
+	if active, found := q.findEquivalentJob(job); found {
+		return *active, fmt.Errorf("%w as %s", ErrJobAlreadyQueued, active.ID)
+	}
+
+	job.ContentHash = ""
+	job.State = models.JobStateQueued
+	job.Progress = 0
+	job.Attempts = 0
+	job.NextAttemptAt = time.Time{}
+	job.Error = ""
+	job.StderrTail = ""
+	job.StartedAt = time.Time{}
+	job.FinishedAt = time.Time{}
+
+	if err := q.jobStore.SaveJob(job); err != nil {
+		return job, fmt.Errorf("error saving job: %w", err)
+	}
+
+	q.activeJobs[job.ID] = &job
+	q.queued.Push(&job)
+	q.wakeUp()
+
+	log.Printf("Retrying encode job %s: %s", job.ID, job.InputStoragePath)
+	return job, nil
+}
+
+// SetPriority changes the priority of a queued or running job, a running job keeps it if it is retried
+func (q *EncodeJobQueue) SetPriority(id string, priority int) (models.EncodeJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.activeJob(id)
+	if err != nil {
+		return models.EncodeJob{}, err
+	}
+
+	job.Priority = priority
+	if err := q.jobStore.SaveJob(*job); err != nil {
+		return *job, fmt.Errorf("error saving job: %w", err)
+	}
+	return *job, nil
+}
+
+// PendingSize returns the estimated output size of the queued and running jobs of a channel, of a placeholder value
+// when the placeholder is not empty
+func (q *EncodeJobQueue) PendingSize(channelName string, placeholder string, value string) int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var size int64
+	for _, job := range q.activeJobs {
+		if job.ChannelName == channelName && (placeholder == "" || job.Vars[placeholder] == value) {
+			size += job.EstimatedSize
+		}
+	}
+	return size
+}
+
+// activeJob returns a queued or running job, ErrJobNotActive if it finished or repositories.ErrJobNotFound
+// The queue must be locked
+func (q *EncodeJobQueue) activeJob(id string) (*models.EncodeJob, error) {
+	if job, found := q.activeJobs[id]; found {
+		return job, nil
+	}
+	if _, err := q.jobStore.GetJob(id); err != nil {
+		return nil, err
+	}
+	return nil, ErrJobNotActive
+}
+
+// setProgress records the progress of a running job, it is only kept in memory
+func (q *EncodeJobQueue) setProgress(id string, fraction float64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if job, found := q.activeJobs[id]; found {
+		job.Progress = fraction
+	}
+}
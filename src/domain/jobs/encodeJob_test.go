@@ -0,0 +1,305 @@
+package jobs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"Theatrum/constants"
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+	"Theatrum/domain/services"
+)
+
+// memoryJobStore keeps jobs in memory for the queue tests
+type memoryJobStore struct {
+	jobs map[string]models.EncodeJob
+}
+
+func (s *memoryJobStore) SaveJob(job models.EncodeJob) error {
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *memoryJobStore) GetJob(id string) (models.EncodeJob, error) {
+	job, ok := s.jobs[id]
+	if !ok {
+		return job, repositories.ErrJobNotFound
+	}
+	return job, nil
+}
+
+func (s *memoryJobStore) ListJobs() ([]models.EncodeJob, error) {
+	jobs := make([]models.EncodeJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (s *memoryJobStore) DeleteJob(id string) error {
+	if _, ok := s.jobs[id]; !ok {
+		return repositories.ErrJobNotFound
+	}
+	delete(s.jobs, id)
+	return nil
+}
+
+func (s *memoryJobStore) Close() error {
+	return nil
+}
+
+func TestEncodeJobQueueChannelCap(t *testing.T) {
+	queue := NewEncodeJobQueue(nil, nil, nil, nil, nil, &memoryJobStore{jobs: map[string]models.EncodeJob{}}, models.Encoding{Workers: 4})
+
+	capped := models.Stream{MaxConcurrentEncodes: 1}
+	for _, job := range []models.EncodeJob{
+		{ID: "movies-1", ChannelName: "movies", Channel: capped},
+		{ID: "movies-2", ChannelName: "movies", Channel: capped},
+		{ID: "shows-1", ChannelName: "shows"},
+		{ID: "shows-2", ChannelName: "shows"},
+	} {
+		queue.activeJobs[job.ID] = &job
+		queue.queued.Push(&job)
+	}
+
+	// The second movie waits for the first one while the shows are not limited
+	var started []string
+	for {
+		job, _, ok := queue.next()
+		if !ok {
+			break
+		}
+		started = append(started, job.ID)
+	}
+	expected := []string{"movies-1", "shows-1", "shows-2"}
+	if len(started) != len(expected) {
+		t.Fatalf("started jobs = %v, expected %v", started, expected)
+	}
+	for i := range expected {
+		if started[i] != expected[i] {
+			t.Fatalf("started jobs = %v, expected %v", started, expected)
+		}
+	}
+
+	// Finishing the first movie frees the slot of its channel
+	queue.finish(*queue.activeJobs["movies-1"], models.EncodeResult{}, nil)
+	job, _, ok := queue.next()
+	if !ok || job.ID != "movies-2" {
+		t.Errorf("next() = %v, %v, expected movies-2", job.ID, ok)
+	}
+}
+
+func TestEncodeJobQueueRetry(t *testing.T) {
+	retry := models.RetryPolicy{MaxAttempts: 2, Backoff: time.Minute, MaxBackoff: time.Hour}
+	tests := []struct {
+		name          string
+		attempts      int
+		err           error
+		expectedState models.JobState
+	}{
+		{
+			name:          "transient failure is retried",
+			attempts:      1,
+			err:           &models.EncodeError{Err: errors.New("killed")},
+			expectedState: models.JobStateQueued,
+		},
+		{
+			name:          "permanent failure is not retried",
+			attempts:      1,
+			err:           &models.EncodeError{Permanent: true, Err: errors.New("invalid data")},
+			expectedState: models.JobStateFailed,
+		},
+		{
+			name:          "last attempt fails the job",
+			attempts:      2,
+			err:           errors.New("disk full"),
+			expectedState: models.JobStateFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := NewEncodeJobQueue(nil, nil, nil, nil, nil, &memoryJobStore{jobs: map[string]models.EncodeJob{}}, models.Encoding{Retry: retry})
+			job := models.EncodeJob{ID: "job", State: models.JobStateRunning, Attempts: tt.attempts}
+			queue.activeJobs[job.ID] = &job
+
+			got := queue.finish(job, models.EncodeResult{}, tt.err)
+			if got.State != tt.expectedState {
+				t.Fatalf("finish() state = %s, expected %s", got.State, tt.expectedState)
+			}
+
+			if tt.expectedState == models.JobStateQueued {
+				// The job waits for its backoff before being started again
+				if !got.IsDelayed(time.Now()) {
+					t.Errorf("retried job is not delayed")
+				}
+				if _, _, ok := queue.next(); ok {
+					t.Errorf("next() returned a job still in its backoff")
+				}
+			} else if _, active := queue.activeJobs[job.ID]; active {
+				t.Errorf("failed job is still active")
+			}
+		})
+	}
+}
+
+func TestEncodeJobQueueDeadLetter(t *testing.T) {
+	tests := []struct {
+		name         string
+		existing     map[string]string
+		expectedPath string
+	}{
+		{name: "first failed source", expectedPath: "dead/movie.mp4"},
+		{name: "failed source of the same name", existing: map[string]string{"dead/movie.mp4": "earlier"}, expectedPath: "dead/movie.job.mp4"},
+		{name: "report of the same name", existing: map[string]string{"dead/movie.mp4.stderr.log": "earlier"}, expectedPath: "dead/movie.job.mp4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newMemoryStorage(map[string]string{"raw/movie.mp4": "movie"})
+			for file, content := range tt.existing {
+				storage.put(file, []byte(content), time.Now())
+			}
+			queue := NewEncodeJobQueue(nil, nil, nil, nil, storage, &memoryJobStore{jobs: map[string]models.EncodeJob{}}, models.Encoding{})
+
+			queue.deadLetter(models.EncodeJob{ID: "job", InputStoragePath: "raw/movie.mp4", DeadLetterPath: "dead", Error: "invalid data"})
+
+			if data, err := storage.get(tt.expectedPath); err != nil || string(data) != "movie" {
+				t.Errorf("%s = %q, %v, expected the failed source", tt.expectedPath, data, err)
+			}
+			if data, err := storage.get(tt.expectedPath + constants.DeadLetterStderrSuffix); err != nil || !strings.Contains(string(data), "invalid data") {
+				t.Errorf("%s report = %q, %v, expected the error", tt.expectedPath, data, err)
+			}
+			for file, content := range tt.existing {
+				if data, _ := storage.get(file); string(data) != content {
+					t.Errorf("%s = %q, expected it to be kept", file, data)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeJobQueueSchedule(t *testing.T) {
+	// A window on no day of the week never opens
+	closed := models.Schedule{Windows: []models.ScheduleWindow{{Start: time.Hour, End: 2 * time.Hour}}}
+	queue := NewEncodeJobQueue(nil, nil, nil, nil, nil, &memoryJobStore{jobs: map[string]models.EncodeJob{}}, models.Encoding{Workers: 1, Schedule: closed})
+
+	open := models.Schedule{}
+	for _, job := range []models.EncodeJob{
+		{ID: "night", ChannelName: "night"},
+		{ID: "always", ChannelName: "always", Channel: models.Stream{Schedule: &open}},
+	} {
+		queue.activeJobs[job.ID] = &job
+		queue.queued.Push(&job)
+	}
+
+	// Only the channel overriding the closed application schedule can start
+	job, _, ok := queue.next()
+	if !ok || job.ID != "always" {
+		t.Fatalf("next() = %v, %v, expected always", job.ID, ok)
+	}
+	if job, _, ok := queue.next(); ok {
+		t.Errorf("next() = %v, expected the job outside its schedule to wait", job.ID)
+	}
+}
+
+func TestEncodeJobQueueCancel(t *testing.T) {
+	store := &memoryJobStore{jobs: map[string]models.EncodeJob{}}
+	queue := NewEncodeJobQueue(nil, nil, nil, nil, nil, store, models.Encoding{Workers: 1})
+
+	for _, job := range []models.EncodeJob{
+		{ID: "first", ChannelName: "movies", State: models.JobStateQueued},
+		{ID: "second", ChannelName: "movies", State: models.JobStateQueued},
+	} {
+		store.jobs[job.ID] = job
+		queue.activeJobs[job.ID] = &job
+		queue.queued.Push(&job)
+	}
+
+	job, ctx, ok := queue.next()
+	if !ok || job.ID != "first" {
+		t.Fatalf("next() = %v, %v, expected first", job.ID, ok)
+	}
+
+	// A queued job is canceled at once
+	canceled, err := queue.Cancel("second")
+	if err != nil || canceled.State != models.JobStateCanceled {
+		t.Fatalf("Cancel(second) = %s, %v, expected canceled", canceled.State, err)
+	}
+	if queue.queued.Len() != 0 {
+		t.Errorf("canceled job is still queued")
+	}
+
+	// A running job is canceled once its encode stopped
+	if _, err := queue.Cancel("first"); err != nil {
+		t.Fatalf("Cancel(first) error = %v", err)
+	}
+	if ctx.Err() == nil {
+		t.Fatalf("encode of the canceled job was not stopped")
+	}
+	got := queue.finish(job, models.EncodeResult{}, ctx.Err())
+	if got.State != models.JobStateCanceled {
+		t.Errorf("finish() state = %s, expected canceled", got.State)
+	}
+
+	// Finished jobs cannot be canceled, and unknown ones are not found
+	if _, err := queue.Cancel("first"); !errors.Is(err, ErrJobNotActive) {
+		t.Errorf("Cancel(finished) error = %v, expected %v", err, ErrJobNotActive)
+	}
+	if _, err := queue.Cancel("unknown"); !errors.Is(err, repositories.ErrJobNotFound) {
+		t.Errorf("Cancel(unknown) error = %v, expected %v", err, repositories.ErrJobNotFound)
+	}
+}
+
+func TestEncodeJobQueueRestore(t *testing.T) {
+	now := time.Now()
+	store := &memoryJobStore{jobs: map[string]models.EncodeJob{}}
+	for _, job := range []models.EncodeJob{
+		{ID: "interrupted", ChannelName: "movies", Channel: models.Stream{MaxConcurrentEncodes: 1}, State: models.JobStateRunning, StartedAt: now},
+		{ID: "orphan", ChannelName: "removed", State: models.JobStateQueued},
+		{ID: "expired", ChannelName: "movies", State: models.JobStateDone, FinishedAt: now.Add(-48 * time.Hour)},
+		{ID: "recent", ChannelName: "movies", State: models.JobStateFailed, FinishedAt: now.Add(-time.Hour)},
+	} {
+		store.jobs[job.ID] = job
+	}
+
+	// The channel configuration changed while the application was stopped
+	channels := map[string]models.Stream{"movies": {MaxConcurrentEncodes: 3}}
+	appService := services.NewApplicationService(&models.Application{}, &models.Server{}, &channels, nil, nil)
+	queue := NewEncodeJobQueue(appService, nil, nil, nil, nil, store, models.Encoding{Workers: 1, FinishedJobRetention: 24 * time.Hour})
+	if err := queue.restore(); err != nil {
+		t.Fatalf("restore() error = %v", err)
+	}
+
+	interrupted, found := queue.activeJobs["interrupted"]
+	if !found {
+		t.Fatalf("interrupted job was not restored")
+	}
+	if interrupted.State != models.JobStateQueued || !interrupted.StartedAt.IsZero() {
+		t.Errorf("interrupted job state = %s, expected queued", interrupted.State)
+	}
+	if interrupted.Channel.MaxConcurrentEncodes != 3 {
+		t.Errorf("interrupted job MaxConcurrentEncodes = %d, expected the current 3", interrupted.Channel.MaxConcurrentEncodes)
+	}
+	if stored := store.jobs["interrupted"]; stored.Channel.MaxConcurrentEncodes != 3 {
+		t.Errorf("stored job MaxConcurrentEncodes = %d, expected the current 3", stored.Channel.MaxConcurrentEncodes)
+	}
+
+	// The job of a removed channel cannot be encoded anymore
+	if _, found := queue.activeJobs["orphan"]; found {
+		t.Errorf("job of a removed channel was restored")
+	}
+	if orphan := store.jobs["orphan"]; orphan.State != models.JobStateFailed || orphan.Error == "" {
+		t.Errorf("job of a removed channel state = %s, error = %q, expected failed", orphan.State, orphan.Error)
+	}
+
+	// Only the jobs finished for longer than the retention are pruned
+	if _, found := store.jobs["expired"]; found {
+		t.Errorf("expired job was not pruned")
+	}
+	if _, found := store.jobs["recent"]; !found {
+		t.Errorf("recent job was pruned")
+	}
+}
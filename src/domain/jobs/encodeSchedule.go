@@ -0,0 +1,115 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"Theatrum/domain/models"
+)
+
+// suspendRetryDelay is the delay before trying again to suspend or resume a job which could not be
+// (e.g. while it analyzes its source, before its encode process started)
+const suspendRetryDelay = time.Minute
+
+// schedule returns the schedule of a job: the one of its channel, or the application one
+func (q *EncodeJobQueue) schedule(job *models.EncodeJob) models.Schedule {
+	if job.Channel.Schedule != nil {
+		return *job.Channel.Schedule
+	}
+	return q.settings.Schedule
+}
+
+// superviseSchedule suspends the running jobs when their schedule closes and resumes them when it opens again,
+// for the schedules allowing it
+func (q *EncodeJobQueue) superviseSchedule() {
+	defer q.wg.Done()
+
+	for {
+		var later <-chan time.Time
+		if delay := q.applySchedule(); delay > 0 {
+			later = time.After(delay)
+		}
+
+		select {
+		case <-q.ctx.Done():
+			// Stopping waits for the running encodes, they must not stay suspended
+			q.resumeSuspended()
+			return
+		case <-q.runningChange:
+		case <-later:
+		}
+	}
+}
+
+// resumeSuspended resumes every suspended job regardless of its schedule
+func (q *EncodeJobQueue) resumeSuspended() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, job := range q.activeJobs {
+		if !job.Suspended {
+			continue
+		}
+		if err := q.encodeService.ResumeJob(job.ID); err != nil {
+			log.Printf("Error resuming encode job %s: %v", job.ID, err)
+			continue
+		}
+		job.Suspended = false
+		log.Printf("Resumed encode job %s", job.ID)
+	}
+}
+
+// applySchedule suspends or resumes the running jobs according to their schedule
+// It returns how long until a schedule of a running job changes (0 when there is none)
+func (q *EncodeJobQueue) applySchedule() time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var delay time.Duration
+	wakeUpIn := func(wait time.Duration) {
+		if wait > 0 && (delay == 0 || wait < delay) {
+			delay = wait
+		}
+	}
+
+	now := time.Now()
+	for _, job := range q.activeJobs {
+		schedule := q.schedule(job)
+		if job.State != models.JobStateRunning || !schedule.SuspendRunning {
+			continue
+		}
+
+		if change := schedule.NextChange(now); !change.IsZero() {
+			wakeUpIn(change.Sub(now))
+		}
+
+		open := schedule.IsOpen(now)
+		if open == !job.Suspended {
+			continue
+		}
+
+		var err error
+		if open {
+			err = q.encodeService.ResumeJob(job.ID)
+		} else {
+			err = q.encodeService.SuspendJob(job.ID)
+		}
+		if err != nil {
+			log.Printf("Error changing suspension of encode job %s: %v", job.ID, err)
+			wakeUpIn(suspendRetryDelay)
+			continue
+		}
+
+		job.Suspended = !open
+		if err := q.jobStore.SaveJob(*job); err != nil {
+			log.Printf("Error saving job %s: %v", job.ID, err)
+		}
+		if job.Suspended {
+			log.Printf("Suspended encode job %s outside its schedule", job.ID)
+		} else {
+			log.Printf("Resumed encode job %s", job.ID)
+		}
+	}
+
+	return delay
+}
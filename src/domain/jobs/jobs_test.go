@@ -0,0 +1,279 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+	"Theatrum/domain/utils"
+)
+
+// memoryStorage keeps the files of the jobs tests in memory, by storage path
+type memoryStorage struct {
+	mu      sync.Mutex
+	files   map[string][]byte
+	modTime map[string]time.Time
+	deleted []string // Directories deleted, in order
+	// fetchErr fails the fetches of the sources when set, as a storage outage would
+	fetchErr error
+}
+
+var _ repositories.StoragePort = (*memoryStorage)(nil)
+
+func newMemoryStorage(files map[string]string) *memoryStorage {
+	s := &memoryStorage{files: make(map[string][]byte), modTime: make(map[string]time.Time)}
+	for file, content := range files {
+		s.put(file, []byte(content), time.Now())
+	}
+	return s
+}
+
+// put stores a file with the given modification time
+func (s *memoryStorage) put(file string, data []byte, modTime time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[file] = data
+	s.modTime[file] = modTime
+}
+
+func (s *memoryStorage) get(file string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, found := s.files[file]
+	if !found {
+		return nil, &fs.PathError{Op: "open", Path: file, Err: fs.ErrNotExist}
+	}
+	return data, nil
+}
+
+func (s *memoryStorage) ReadFile(file string) ([]byte, error) {
+	return s.get(file)
+}
+
+func (s *memoryStorage) OpenFile(file string) (io.ReadSeekCloser, models.FileInfo, error) {
+	data, err := s.get(file)
+	if err != nil {
+		return nil, models.FileInfo{}, err
+	}
+	info, _ := s.StatFile(file)
+	return struct {
+		io.ReadSeeker
+		io.Closer
+	}{bytes.NewReader(data), io.NopCloser(nil)}, info, nil
+}
+
+func (s *memoryStorage) ReadFileHeader(file string, size int) ([]byte, error) {
+	data, err := s.get(file)
+	if err != nil {
+		return nil, err
+	}
+	return data[:min(size, len(data))], nil
+}
+
+func (s *memoryStorage) WriteFile(file string, data []byte) error {
+	s.put(file, data, time.Now())
+	return nil
+}
+
+func (s *memoryStorage) DeleteFile(file string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, found := s.files[file]; !found {
+		return &fs.PathError{Op: "remove", Path: file, Err: fs.ErrNotExist}
+	}
+	delete(s.files, file)
+	delete(s.modTime, file)
+	return nil
+}
+
+func (s *memoryStorage) MoveFile(sourcePath string, destinationPath string) error {
+	data, err := s.get(sourcePath)
+	if err != nil {
+		return err
+	}
+	if _, err := s.get(destinationPath); err == nil {
+		return fs.ErrExist
+	}
+	s.put(destinationPath, data, time.Now())
+	return s.DeleteFile(sourcePath)
+}
+
+func (s *memoryStorage) ListFiles(pattern string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := []string{}
+	for file := range s.files {
+		if matched, _ := path.Match(pattern, file); matched {
+			files = append(files, file)
+		}
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+func (s *memoryStorage) GetFileSize(file string) (int64, error) {
+	data, err := s.get(file)
+	return int64(len(data)), err
+}
+
+func (s *memoryStorage) StatFile(file string) (models.FileInfo, error) {
+	data, err := s.get(file)
+	if err != nil {
+		return models.FileInfo{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return models.FileInfo{Size: int64(len(data)), ModTime: s.modTime[file]}, nil
+}
+
+func (s *memoryStorage) DeleteDirectory(directory string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for file := range s.files {
+		if strings.HasPrefix(file, directory+"/") {
+			delete(s.files, file)
+			delete(s.modTime, file)
+		}
+	}
+	s.deleted = append(s.deleted, directory)
+	return nil
+}
+
+func (s *memoryStorage) DirectorySize(directory string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var size int64
+	for file, data := range s.files {
+		if strings.HasPrefix(file, directory+"/") {
+			size += int64(len(data))
+		}
+	}
+	return size, nil
+}
+
+func (s *memoryStorage) HashFile(file string) (string, error) {
+	data, err := s.get(file)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func (s *memoryStorage) SearchFiles(pattern string, extensions []string) ([]string, []map[string]string, error) {
+	compiled, err := utils.CompilePathPattern(pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := []string{}
+	vars := []map[string]string{}
+	for _, file := range slices.Sorted(func(yield func(string) bool) {
+		for file := range s.files {
+			if !yield(file) {
+				return
+			}
+		}
+	}) {
+		if fileVars, matched := compiled.Match(file, extensions); matched {
+			files = append(files, file)
+			vars = append(vars, fileVars)
+		}
+	}
+	return files, vars, nil
+}
+
+func (s *memoryStorage) FetchFile(file string) (func(), error) {
+	s.mu.Lock()
+	fetchErr := s.fetchErr
+	s.mu.Unlock()
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+	if _, err := s.get(file); err != nil {
+		return nil, err
+	}
+	return func() {}, nil
+}
+
+func (s *memoryStorage) ImportFile(localPath string, file string) error {
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+	s.put(file, data, time.Now())
+	return os.Remove(localPath)
+}
+
+func (s *memoryStorage) StageDirectory() (string, func(), error) {
+	localDir, err := os.MkdirTemp("", "encode-")
+	if err != nil {
+		return "", nil, err
+	}
+	return filepath.ToSlash(localDir), func() { os.RemoveAll(localDir) }, nil
+}
+
+func (s *memoryStorage) PublishDirectory(localDir string, directory string) error {
+	return filepath.WalkDir(localDir, func(localPath string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		relativePath, err := filepath.Rel(localDir, localPath)
+		if err != nil {
+			return err
+		}
+		return s.ImportFile(localPath, path.Join(directory, filepath.ToSlash(relativePath)))
+	})
+}
+
+// probeEncoder finds a video in every source, it only serves the validation of the sources
+type probeEncoder struct{}
+
+var _ repositories.EncoderPort = probeEncoder{}
+
+func (probeEncoder) EncodeVideo(ctx context.Context, inputPath string, outputPath string, qualities map[string]models.Quality, distribution models.Distribution, options models.EncodeOptions) error {
+	return errors.New("not an encoder")
+}
+
+func (probeEncoder) ProbeVideo(inputPath string) (models.MediaInfo, error) {
+	return models.MediaInfo{Duration: 60, Video: &models.VideoStreamInfo{}}, nil
+}
+
+func (probeEncoder) CheckDecode(inputPath string, seconds int) error {
+	return nil
+}
+
+func (probeEncoder) AnalyzeComplexity(inputPath string, qualities map[string]models.Quality, crf int, sampleSeconds int) (map[string]int64, error) {
+	return nil, errors.New("not an encoder")
+}
+
+func (probeEncoder) MeasureQuality(sourcePath string, variantPath string, quality models.Quality, vmaf bool) (models.RenditionQuality, error) {
+	return models.RenditionQuality{}, errors.New("not an encoder")
+}
+
+func (probeEncoder) Version() (string, error) {
+	return "probe", nil
+}
+
+func (probeEncoder) Suspend(jobID string) error {
+	return nil
+}
+
+func (probeEncoder) Resume(jobID string) error {
+	return nil
+}
@@ -0,0 +1,145 @@
+package jobs
+
+import (
+	"errors"
+	"log"
+
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+	"Theatrum/domain/services"
+)
+
+// LadderChangeDetector finds the outputs encoded with a previous ladder of their channel and queues their re-encode
+// from the kept source
+type LadderChangeDetector struct {
+	appService      *services.ApplicationService
+	encodeQueue     *EncodeJobQueue
+	storage         repositories.StoragePort
+	templateService *services.PathTemplateService
+	manifestService *services.ManifestService
+	inventory       *services.InventoryService
+}
+
+func NewLadderChangeDetector(
+	appService *services.ApplicationService,
+	encodeQueue *EncodeJobQueue,
+	storage repositories.StoragePort,
+	templateService *services.PathTemplateService,
+	manifestService *services.ManifestService,
+	inventory *services.InventoryService,
+) *LadderChangeDetector {
+	return &LadderChangeDetector{
+		appService:      appService,
+		encodeQueue:     encodeQueue,
+		storage:         storage,
+		templateService: templateService,
+		manifestService: manifestService,
+		inventory:       inventory,
+	}
+}
+
+// DetectAndQueueReencodes compares the ladder recorded in the manifest of every output with the current ladder of its channel,
+// and queues the re-encode of the changed ones. Only the added and changed qualities are encoded when possible.
+// The queued jobs are returned.
+func (d *LadderChangeDetector) DetectAndQueueReencodes() []models.EncodeJob {
+	log.Printf("Starting ladder change detection")
+	defer log.Printf("Ladder change detection completed")
+
+	queuedJobs := []models.EncodeJob{}
+	for channelName, stream := range *d.appService.GetChannels() {
+		if stream.Type != models.StreamTypeVideoUnEncoded {
+			continue
+		}
+
+		currentHash, err := stream.LadderHash()
+		if err != nil {
+			log.Printf("Error hashing ladder of %s: %v", channelName, err)
+			continue
+		}
+
+		// The manifests are next to the master playlists of the channel outputs
+		manifestFiles, vars, err := d.inventory.Files(channelName, services.InventoryManifests)
+		if err != nil {
+			log.Printf("Error searching manifests in %s: %v", stream.Path, err)
+			continue
+		}
+
+		for i, manifestFile := range manifestFiles {
+			// Any path of the output directory locates its manifest
+			manifest, err := d.manifestService.ReadManifest(manifestFile)
+			if err != nil {
+				log.Printf("Error reading manifest %s: %v", manifestFile, err)
+				continue
+			}
+			if manifest.LadderHash == currentHash {
+				continue
+			}
+
+			job, err := d.newReencodeJob(channelName, stream, manifest, vars[i])
+			if err != nil {
+				log.Printf("Cannot re-encode output of %s: %v", manifestFile, err)
+				continue
+			}
+
+			queuedJob, err := d.encodeQueue.Enqueue(job)
+			if errors.Is(err, ErrJobAlreadyQueued) {
+				log.Printf("Video already queued for encoding: %s (job %s)", job.InputStoragePath, queuedJob.ID)
+				continue
+			}
+			if err != nil {
+				log.Printf("Error queueing re-encode of %s: %v", job.InputStoragePath, err)
+				continue
+			}
+
+			log.Printf("Queued re-encode of %s after a ladder change (job %s)", job.InputStoragePath, queuedJob.ID)
+			queuedJobs = append(queuedJobs, queuedJob)
+		}
+	}
+
+	return queuedJobs
+}
+
+// newReencodeJob builds the job encoding again the kept source of an output, limited to the added and changed
+// qualities unless the whole ladder must be encoded again
+func (d *LadderChangeDetector) newReencodeJob(channelName string, stream models.Stream, manifest models.EncodeManifest, vars map[string]string) (models.EncodeJob, error) {
+	sourcePath := d.manifestService.SourcePath(manifest)
+	if sourcePath == "" {
+		return models.EncodeJob{}, errors.New("its source was not kept")
+	}
+	if _, err := d.storage.StatFile(sourcePath); err != nil {
+		return models.EncodeJob{}, err
+	}
+
+	change, err := manifest.LadderChange(stream)
+	if err != nil {
+		return models.EncodeJob{}, err
+	}
+
+	// The output path is templated like the one of the first encode, from the output directory and the source name
+	vars, err = d.templateService.SourceVars(vars, manifest.Source.Name)
+	if err != nil {
+		return models.EncodeJob{}, err
+	}
+	outputPath, err := d.templateService.OutputStoragePath(stream, vars)
+	if err != nil {
+		return models.EncodeJob{}, err
+	}
+
+	job := models.EncodeJob{
+		InputStoragePath:  sourcePath,
+		OutputStoragePath: outputPath,
+		ChannelName:       channelName,
+		Channel:           stream,
+		Vars:              vars,
+		Priority:          stream.Priority,
+		Reencode:          true,
+		RemovedRenditions: change.Removed,
+	}
+	if !change.Full {
+		job.Renditions = change.Renditions()
+	}
+
+	log.Printf("Ladder of %s changed: added %v, changed %v, removed %v, full re-encode: %v",
+		outputPath, change.Added, change.Changed, change.Removed, change.Full)
+	return job, nil
+}
@@ -0,0 +1,196 @@
+package jobs
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"Theatrum/constants"
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+	"Theatrum/domain/services"
+)
+
+// RetentionJanitor deletes the encoded outputs expired by the retention policy of their channel, and records them in the audit log
+// An output is the directory of a master playlist, with its variant playlists and segments
+type RetentionJanitor struct {
+	appService  *services.ApplicationService
+	encodeQueue *EncodeJobQueue
+	storage     repositories.StoragePort
+	inventory   *services.InventoryService
+	auditLog    repositories.RetentionAuditPort
+}
+
+// retainedOutput is an encoded output of a channel, with its owner placeholder value
+type retainedOutput struct {
+	master    string
+	owner     string
+	encodedAt time.Time
+}
+
+func NewRetentionJanitor(
+	appService *services.ApplicationService,
+	encodeQueue *EncodeJobQueue,
+	storage repositories.StoragePort,
+	inventory *services.InventoryService,
+	auditLog repositories.RetentionAuditPort,
+) *RetentionJanitor {
+	return &RetentionJanitor{
+		appService:  appService,
+		encodeQueue: encodeQueue,
+		storage:     storage,
+		inventory:   inventory,
+		auditLog:    auditLog,
+	}
+}
+
+// Run enforces the retention policies at startup then at every interval, until the context is canceled
+func (j *RetentionJanitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.appService.GetApplication().Janitor.Interval)
+	defer ticker.Stop()
+
+	for {
+		j.Sweep()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep deletes the expired outputs of every channel with a retention policy, and returns their audit entries
+// In dry run, the expired outputs are only recorded
+func (j *RetentionJanitor) Sweep() []models.RetentionAuditEntry {
+	channels := *j.appService.GetChannels()
+	dryRun := j.appService.GetApplication().Janitor.DryRun
+	now := time.Now()
+
+	entries := []models.RetentionAuditEntry{}
+	for _, channelName := range slices.Sorted(maps.Keys(channels)) {
+		stream := channels[channelName]
+		if stream.Type != models.StreamTypeVideoUnEncoded || !stream.Retention.Enabled() {
+			continue
+		}
+
+		outputs, err := j.outputs(channelName, stream)
+		if err != nil {
+			log.Printf("Error listing outputs of %s for retention: %v", channelName, err)
+			continue
+		}
+
+		// Outputs are ranked from the newest within each owner
+		rank := make(map[string]int)
+		for _, output := range outputs {
+			reason := stream.Retention.Expiry(rank[output.owner], output.encodedAt, now)
+			rank[output.owner]++
+			if reason == "" {
+				continue
+			}
+
+			entry, expired := j.expire(channelName, output, reason, dryRun)
+			if expired {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	if len(entries) > 0 {
+		log.Printf("Retention expired %d outputs (dry run: %t)", len(entries), dryRun)
+	}
+	return entries
+}
+
+// outputs returns the outputs of a channel, the newest first, from the master playlists of the inventory
+func (j *RetentionJanitor) outputs(channelName string, stream models.Stream) ([]retainedOutput, error) {
+	masters, vars, err := j.inventory.Files(channelName, services.InventoryMasterPlaylists)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([]retainedOutput, 0, len(masters))
+	for i, master := range masters {
+		// The master playlist is written once the encode of its output succeeded
+		info, err := j.storage.StatFile(master)
+		if err != nil {
+			log.Printf("Error reading %s for retention: %v", master, err)
+			continue
+		}
+		outputs = append(outputs, retainedOutput{
+			master:    master,
+			owner:     vars[i][stream.Retention.Placeholder],
+			encodedAt: info.ModTime,
+		})
+	}
+
+	slices.SortStableFunc(outputs, func(a, b retainedOutput) int {
+		return cmp.Or(b.encodedAt.Compare(a.encodedAt), strings.Compare(a.master, b.master))
+	})
+	return outputs, nil
+}
+
+// expire deletes the directory of an expired output and records it in the audit log
+// The outputs being encoded, and the directories holding sources, are skipped and not recorded
+func (j *RetentionJanitor) expire(channelName string, output retainedOutput, reason string, dryRun bool) (models.RetentionAuditEntry, bool) {
+	outputDir := path.Dir(output.master)
+
+	if _, active := j.encodeQueue.findActiveJob(func(active *models.EncodeJob) bool {
+		return path.Dir(active.OutputStoragePath) == outputDir
+	}); active {
+		log.Printf("Keeping expired output %s until its encode finished", outputDir)
+		return models.RetentionAuditEntry{}, false
+	}
+	if j.holdsSources(channelName, outputDir) {
+		log.Printf("Keeping expired output %s, it holds sources of %s", outputDir, channelName)
+		return models.RetentionAuditEntry{}, false
+	}
+
+	entry := models.RetentionAuditEntry{
+		Time:      time.Now(),
+		Channel:   channelName,
+		Owner:     output.owner,
+		Directory: strings.TrimPrefix(outputDir, constants.VideoDir+"/"),
+		Reason:    reason,
+		EncodedAt: output.encodedAt,
+		DryRun:    dryRun,
+	}
+
+	size, err := j.storage.DirectorySize(outputDir)
+	if err != nil {
+		log.Printf("Error measuring %s: %v", outputDir, err)
+	}
+	entry.Size = size
+
+	if dryRun {
+		log.Printf("Output %s expired by %s (dry run, kept)", outputDir, reason)
+	} else if err := j.storage.DeleteDirectory(outputDir); err != nil {
+		log.Printf("Error deleting expired output %s: %v", outputDir, err)
+		entry.Error = err.Error()
+	} else {
+		log.Printf("Deleted output %s expired by %s", outputDir, reason)
+		j.inventory.Update(output.master, path.Join(outputDir, constants.ManifestFile))
+	}
+
+	if err := j.auditLog.Record(entry); err != nil {
+		log.Printf("Error recording the retention of %s: %v", outputDir, err)
+	}
+	return entry, true
+}
+
+// holdsSources reports whether sources of the channel are beneath the output directory, they must not be deleted with it
+func (j *RetentionJanitor) holdsSources(channelName string, outputDir string) bool {
+	sources, _, err := j.inventory.Files(channelName, services.InventorySources)
+	if err != nil {
+		// Without the sources list, the output is kept
+		return true
+	}
+	return slices.ContainsFunc(sources, func(source string) bool {
+		return strings.HasPrefix(source, outputDir+"/")
+	})
+}
@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"Theatrum/constants"
+	"Theatrum/domain/models"
+	"Theatrum/domain/services"
+)
+
+// memoryAuditLog records the retention audit entries in memory
+type memoryAuditLog struct {
+	entries []models.RetentionAuditEntry
+}
+
+func (l *memoryAuditLog) Record(entry models.RetentionAuditEntry) error {
+	l.entries = append(l.entries, entry)
+	return nil
+}
+
+func TestRetentionJanitorSweep(t *testing.T) {
+	tests := []struct {
+		name   string
+		dryRun bool
+	}{
+		{name: "delete", dryRun: false},
+		{name: "dry run", dryRun: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			channels := map[string]models.Stream{
+				"/records/{username}": {
+					Type:           models.StreamTypeVideoUnEncoded,
+					Path:           "records/{username}",
+					VideoInputPath: "raw/{username}",
+					Retention:      models.Retention{MaxAge: 24 * time.Hour, MaxCount: 2, KeepLast: 1, Placeholder: "username"},
+				},
+			}
+
+			// Every source has its own output directory beneath the one of its owner
+			storage := newMemoryStorage(nil)
+			for output, age := range map[string]time.Duration{
+				"records/john/new":      0,
+				"records/john/old":      48 * time.Hour,
+				"records/john/encoding": 72 * time.Hour,
+				"records/john/oldest":   96 * time.Hour,
+				"records/jane/talk":     48 * time.Hour,
+			} {
+				for _, file := range []string{"master.m3u8", "720p/index.m3u8", "720p/segment_000.ts"} {
+					storage.put(path.Join(constants.VideoDir, output, file), []byte("data"), now.Add(-age))
+				}
+			}
+
+			inventory := services.NewInventoryService(&channels, storage)
+			appService := services.NewApplicationService(&models.Application{Janitor: models.Janitor{DryRun: tt.dryRun}}, &models.Server{}, &channels, inventory, nil)
+			queue := NewEncodeJobQueue(appService, nil, nil, nil, nil, &memoryJobStore{jobs: map[string]models.EncodeJob{}}, models.Encoding{Workers: 1})
+			queue.activeJobs["encoding"] = &models.EncodeJob{
+				ID:                "encoding",
+				OutputStoragePath: path.Join(constants.VideoDir, "records/john/encoding/master.m3u8"),
+				State:             models.JobStateRunning,
+			}
+			auditLog := &memoryAuditLog{}
+
+			entries := NewRetentionJanitor(appService, queue, storage, inventory, auditLog).Sweep()
+
+			// The newest output of an owner is kept whatever its age, the one being encoded until its encode finished
+			expected := map[string]string{"records/john/old": "max_age", "records/john/oldest": "max_count"}
+			if len(entries) != len(expected) || len(auditLog.entries) != len(expected) {
+				t.Fatalf("Sweep() expired %v, recorded %v, expected %v", entries, auditLog.entries, expected)
+			}
+			for _, entry := range entries {
+				if entry.Reason != expected[entry.Directory] {
+					t.Errorf("%s reason = %q, expected %q", entry.Directory, entry.Reason, expected[entry.Directory])
+				}
+				if entry.Owner != "john" || entry.DryRun != tt.dryRun || entry.Size != 3*int64(len("data")) {
+					t.Errorf("%s entry = %+v, expected owner john, dry run %t and size %d", entry.Directory, entry, tt.dryRun, 3*len("data"))
+				}
+			}
+
+			for _, output := range []string{"records/john/new", "records/john/old", "records/john/encoding", "records/john/oldest", "records/jane/talk"} {
+				_, err := storage.StatFile(path.Join(constants.VideoDir, output, "master.m3u8"))
+				deleted := expected[output] != "" && !tt.dryRun
+				if (err != nil) != deleted {
+					t.Errorf("%s deleted = %t, expected %t", output, err != nil, deleted)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package jobs
+
+import "Theatrum/domain/models"
+
+// scheduler orders the queued jobs: the highest priority first, then round-robin across the owners of a channel
+// (the placeholder values of the source path), and for an owner the oldest job first
+// A user queueing hundreds of files only delays the other users of the same priority by one job each turn
+type scheduler struct {
+	queued []*models.EncodeJob
+	// served is the turn at which each owner last had a job started, owners never served come first
+	served map[string]uint64
+	turn   uint64
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{served: make(map[string]uint64)}
+}
+
+// ownerKey identifies an owner within its channel, the same placeholder values in two channels are distinct owners
+func ownerKey(job *models.EncodeJob) string {
+	return job.ChannelName + "|" + job.Owner()
+}
+
+// Push adds a job to the queued jobs
+func (s *scheduler) Push(job *models.EncodeJob) {
+	s.queued = append(s.queued, job)
+}
+
+// Len returns the number of queued jobs
+func (s *scheduler) Len() int {
+	return len(s.queued)
+}
+
+// Remove removes a queued job, it returns false if the job is not queued
+func (s *scheduler) Remove(id string) bool {
+	for i, job := range s.queued {
+		if job.ID == id {
+			s.queued = append(s.queued[:i], s.queued[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Jobs returns the queued jobs, in no particular order
+func (s *scheduler) Jobs() []*models.EncodeJob {
+	return s.queued
+}
+
+// Next removes and returns the job to start among the queued jobs accepted by the eligible filter, nil if there is none
+func (s *scheduler) Next(eligible func(job *models.EncodeJob) bool) *models.EncodeJob {
+	best := -1
+	for i, job := range s.queued {
+		if !eligible(job) {
+			continue
+		}
+		if best < 0 || s.before(job, s.queued[best]) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+
+	job := s.queued[best]
+	s.queued = append(s.queued[:best], s.queued[best+1:]...)
+
+	s.turn++
+	s.served[ownerKey(job)] = s.turn
+
+	return job
+}
+
+// before checks whether a job must start before another one
+func (s *scheduler) before(job *models.EncodeJob, other *models.EncodeJob) bool {
+	if job.Priority != other.Priority {
+		return job.Priority > other.Priority
+	}
+
+	// The owner who waited the longest since its last started job goes first
+	jobServed, otherServed := s.served[ownerKey(job)], s.served[ownerKey(other)]
+	if jobServed != otherServed {
+		return jobServed < otherServed
+	}
+
+	if !job.CreatedAt.Equal(other.CreatedAt) {
+		return job.CreatedAt.Before(other.CreatedAt)
+	}
+	return job.ID < other.ID
+}
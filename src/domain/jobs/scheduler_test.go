@@ -0,0 +1,136 @@
+package jobs
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"Theatrum/domain/models"
+)
+
+// newTestJob creates a job of a channel owner, created at the given second
+func newTestJob(id string, channel string, username string, priority int, createdAt int) *models.EncodeJob {
+	return &models.EncodeJob{
+		ID:          id,
+		ChannelName: channel,
+		Vars:        map[string]string{"username": username, "FILENAME": id + ".mp4"},
+		Priority:    priority,
+		CreatedAt:   time.Unix(int64(createdAt), 0),
+	}
+}
+
+func drain(s *scheduler, eligible func(job *models.EncodeJob) bool) []string {
+	var order []string
+	for job := s.Next(eligible); job != nil; job = s.Next(eligible) {
+		order = append(order, job.ID)
+	}
+	return order
+}
+
+func anyJob(job *models.EncodeJob) bool {
+	return true
+}
+
+func TestSchedulerOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		jobs     []*models.EncodeJob
+		expected []string
+	}{
+		{
+			name: "oldest first for a single owner",
+			jobs: []*models.EncodeJob{
+				newTestJob("b", "/video", "john", 0, 2),
+				newTestJob("a", "/video", "john", 0, 1),
+				newTestJob("c", "/video", "john", 0, 3),
+			},
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			name: "round-robin across owners",
+			jobs: []*models.EncodeJob{
+				newTestJob("john-1", "/video", "john", 0, 1),
+				newTestJob("john-2", "/video", "john", 0, 2),
+				newTestJob("john-3", "/video", "john", 0, 3),
+				newTestJob("alice-1", "/video", "alice", 0, 4),
+				newTestJob("bob-1", "/video", "bob", 0, 5),
+				newTestJob("alice-2", "/video", "alice", 0, 6),
+			},
+			expected: []string{"john-1", "alice-1", "bob-1", "john-2", "alice-2", "john-3"},
+		},
+		{
+			name: "highest priority first",
+			jobs: []*models.EncodeJob{
+				newTestJob("low", "/video", "john", 0, 1),
+				newTestJob("high", "/premium", "alice", 10, 2),
+				newTestJob("negative", "/archive", "bob", -5, 0),
+			},
+			expected: []string{"high", "low", "negative"},
+		},
+		{
+			name: "same owner name in two channels is two owners",
+			jobs: []*models.EncodeJob{
+				newTestJob("video-1", "/video", "john", 0, 1),
+				newTestJob("video-2", "/video", "john", 0, 2),
+				newTestJob("premium-1", "/premium", "john", 0, 3),
+			},
+			expected: []string{"video-1", "premium-1", "video-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newScheduler()
+			for _, job := range tt.jobs {
+				s.Push(job)
+			}
+
+			got := drain(s, anyJob)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("order = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSchedulerBulkOwner(t *testing.T) {
+	s := newScheduler()
+
+	// A user dumps 500 files before another user queues one
+	for i := 0; i < 500; i++ {
+		s.Push(newTestJob(fmt.Sprintf("john-%d", i), "/video", "john", 0, i))
+	}
+	first := s.Next(anyJob)
+	s.Push(newTestJob("alice-1", "/video", "alice", 0, 1000))
+
+	if first.ID != "john-0" {
+		t.Fatalf("first job = %s, expected john-0", first.ID)
+	}
+	if next := s.Next(anyJob); next.ID != "alice-1" {
+		t.Errorf("next job = %s, expected alice-1 to wait for a single job of john", next.ID)
+	}
+}
+
+func TestSchedulerSkipsIneligibleJobs(t *testing.T) {
+	s := newScheduler()
+	s.Push(newTestJob("high", "/premium", "john", 10, 1))
+	s.Push(newTestJob("low", "/video", "alice", 0, 2))
+
+	// A job that cannot start does not block the others, and keeps its place
+	got := s.Next(func(job *models.EncodeJob) bool {
+		return job.ChannelName != "/premium"
+	})
+	if got == nil || got.ID != "low" {
+		t.Fatalf("Next() = %v, expected low", got)
+	}
+	if s.Len() != 1 {
+		t.Errorf("Len() = %d, expected the skipped job to stay queued", s.Len())
+	}
+	if got := s.Next(anyJob); got == nil || got.ID != "high" {
+		t.Errorf("Next() = %v, expected high", got)
+	}
+	if got := s.Next(anyJob); got != nil {
+		t.Errorf("Next() = %v, expected no job", got.ID)
+	}
+}
@@ -1,47 +1,165 @@
 package jobs
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"path"
+	"slices"
+	"sync"
+	"time"
 
 	"Theatrum/constants"
 	"Theatrum/domain/models"
 	"Theatrum/domain/repositories"
 	"Theatrum/domain/services"
+	"Theatrum/domain/utils"
 )
 
+var (
+	// ErrUnknownChannel is returned when queueing a source for a channel which does not exist or does not encode its sources
+	ErrUnknownChannel = errors.New("no video unencoded channel")
+	// ErrSourceNotFound is returned when queueing a source which is not in the input path of its channel
+	ErrSourceNotFound = errors.New("source not found in the channel input path")
+	// ErrNameCollision is returned when queueing a source whose output directory is the one of another source, as when their
+	// slugified names or their names without extension are the same
+	ErrNameCollision = errors.New("another source has the same output directory")
+)
+
+// settleDelay groups the burst of notifications sent while a file is written into a single scan
+const settleDelay = time.Second
+
 // VideoUnencodedDetector detects unencoded videos and sends them to the encode queue
 type VideoUnencodedDetector struct {
-	appService      *services.ApplicationService
-	encodeQueue     *EncodeJobQueue
-	storage         repositories.StoragePort
-	templateService *services.PathTemplateService
+	appService        *services.ApplicationService
+	encodeQueue       *EncodeJobQueue
+	storage           repositories.StoragePort
+	watcher           repositories.WatcherPort
+	templateService   *services.PathTemplateService
+	validationService *services.SourceValidationService
+	manifestService   *services.ManifestService
+	inventory         *services.InventoryService
+	quotaService      *services.QuotaService
+	mu                sync.Mutex
+	observed          map[string]*sourceObservation // Sources seen by the last scan by path
+}
+
+// sourceObservation tracks a source between scans, so it is only queued once it stopped changing
+type sourceObservation struct {
+	info models.FileInfo
+	// since is when the source was first seen with its current size and modification time
+	since time.Time
+	// handled is set once the source was queued, found encoded or rejected, it is not processed again until it changes
+	// A source held over quota, or which failed for another reason (probe, storage...), is tried again at the next scan
+	handled bool
+}
+
+// recordedSources are the placeholder values recorded by the manifests of a channel, by source (see sourceKey)
+type recordedSources map[string]map[string]string
+
+// sourceKey identifies a source by its owner and name, whatever the values computed for its output
+func sourceKey(vars map[string]string, name string) string {
+	return models.OwnerOf(vars) + "/" + name
 }
 
 func NewVideoUnencodedDetector(
 	appService *services.ApplicationService,
 	encodeQueue *EncodeJobQueue,
 	storage repositories.StoragePort,
+	watcher repositories.WatcherPort,
 	templateService *services.PathTemplateService,
+	validationService *services.SourceValidationService,
+	manifestService *services.ManifestService,
+	inventory *services.InventoryService,
+	quotaService *services.QuotaService,
 ) *VideoUnencodedDetector {
 	return &VideoUnencodedDetector{
-		appService:      appService,
-		encodeQueue:     encodeQueue,
-		storage:         storage,
-		templateService: templateService,
+		appService:        appService,
+		encodeQueue:       encodeQueue,
+		storage:           storage,
+		watcher:           watcher,
+		templateService:   templateService,
+		validationService: validationService,
+		manifestService:   manifestService,
+		inventory:         inventory,
+		quotaService:      quotaService,
+		observed:          make(map[string]*sourceObservation),
+	}
+}
+
+// Watch detects the sources continuously until the context is canceled, then closes the watcher
+// A scan runs at startup, when the watcher reports a change, at every rescan interval and when a source may have become stable
+func (d *VideoUnencodedDetector) Watch(ctx context.Context) {
+	defer d.watcher.Close()
+
+	settings := d.appService.GetApplication().Watch
+	for _, stream := range *d.appService.GetChannels() {
+		if stream.Type != models.StreamTypeVideoUnEncoded {
+			continue
+		}
+		inputPattern := path.Join(constants.VideoDir, stream.VideoInputPath)
+		if err := d.watcher.Watch(inputPattern); err != nil {
+			log.Printf("Error watching %s, relying on periodic rescans: %v", inputPattern, err)
+		}
+	}
+
+	rescan := time.NewTicker(settings.RescanInterval)
+	defer rescan.Stop()
+
+	for {
+		var stable, settle <-chan time.Time
+		if wait := d.scan(); wait > 0 {
+			stable = time.After(wait)
+		}
+
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case file := <-d.watcher.Events():
+				d.inventory.Update(file)
+				if settle == nil {
+					settle = time.After(settleDelay)
+				}
+			case <-settle:
+				break wait
+			case <-stable:
+				break wait
+			case <-rescan.C:
+				// The rescan catches the sources whose notification was missed
+				d.inventory.Refresh(services.InventorySources)
+				break wait
+			}
+		}
 	}
 }
 
 // DetectAndQueueVideos scans for unencoded videos and queues them for encoding
 func (d *VideoUnencodedDetector) DetectAndQueueVideos() error {
+	d.scan()
+	return nil
+}
+
+// scan queues the new sources of every video unencoded stream
+// When watching, it returns how long until the next source waiting for its stability period may be queued (0 if none)
+func (d *VideoUnencodedDetector) scan() time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	log.Printf("Starting video detection")
 	defer log.Printf("Video detection completed")
 
+	watch := d.appService.GetApplication().Watch
+	now := time.Now()
+	seen := make(map[string]bool)
+
 	// Get streams from application service
 	channels := d.appService.GetChannels()
 
 	// Process each video unencoded stream
-	for _, stream := range *channels {
+	for channelName, stream := range *channels {
 		
 		if stream.Type != models.StreamTypeVideoUnEncoded && stream.VideoInputPath == "" {
 			continue
@@ -49,11 +167,17 @@ func (d *VideoUnencodedDetector) DetectAndQueueVideos() error {
 
 		nbVideosToEncode := 0
 
-		log.Printf("Searching videos for stream %s", stream.Path)
+		// The manifests of the channel are only read when a source needs the values computed for its previous encode
+		var recorded recordedSources
+		sourcesRecorded := func() recordedSources {
+			if recorded == nil {
+				recorded = d.recordedSources(channelName)
+			}
+			return recorded
+		}
 
-		// Search for video files in the stream's path
-		patternVideoToEncode := path.Join(constants.VideoDir, stream.VideoInputPath)
-		filesToEncode, vars, err := d.storage.SearchFiles(patternVideoToEncode, constants.ValidVideoExtensions)
+		// List the video files of the stream's input path
+		filesToEncode, vars, err := d.inventory.Files(channelName, services.InventorySources)
 		if err != nil {
 			log.Printf("Error searching for videos in %s: %v", stream.Path, err)
 			continue
@@ -61,32 +185,329 @@ func (d *VideoUnencodedDetector) DetectAndQueueVideos() error {
 
 		// Process each found video file
 		for i, file := range filesToEncode {
-			// Template the output path with path variables for the encoded video
-			outputPath, err := d.templateService.ReplacePlaceholders(path.Join(constants.VideoDir, stream.Path, constants.PlaceholderBegin+"FILENAME"+constants.PlaceholderEnd), vars[i])
+			seen[file] = true
+
+			// Skip the sources already handled, and when watching, the ones still being uploaded
+			observation := d.observe(file, now)
+			if observation == nil || observation.handled {
+				continue
+			}
+			if watch.Enabled && now.Sub(observation.since) < watch.StabilityPeriod {
+				log.Printf("Waiting for video to be stable before queueing: %s", file)
+				continue
+			}
+
+			// Skip the sources rejected in a previous run and left in place, until they change
+			if d.validationService.IsRejected(file, observation.info) {
+				observation.handled = true
+				continue
+			}
+
+			job, err := d.newJob(channelName, stream, file, vars[i], sourcesRecorded)
 			if err != nil {
-				log.Printf("Error replacing placeholders: %v", err)
+				log.Printf("Error preparing the encode of video %s, trying again at the next scan: %v", file, err)
 				continue
 			}
 
-			nbVideosToEncode++
+			// Skip the sources already encoded with the current ladder
+			if d.manifestService.IsUpToDate(file, job.OutputStoragePath, stream) {
+				observation.handled = true
+				log.Printf("Video already encoded: %s", file)
+				continue
+			}
 
-			// Create and queue the encoding job
-			job := EncodeJob{
-				InputStoragePath:  file,
-				OutputStoragePath: outputPath,
-				Channel:          stream,
+			// Reject the sources which would replace the output of another one
+			if err := d.checkNameCollision(job); err != nil {
+				observation.handled = true
+				log.Printf("Rejecting video %s: %v", file, err)
+				d.quarantine(stream, file, vars[i], err)
+				continue
 			}
 
-			if err := d.encodeQueue.Enqueue(job); err != nil {
-				log.Printf("Error queueing video %s: %v", file, err)
+			// Reject files that are not really videos before handing them to the encoder
+			media, err := d.validationService.Validate(file, stream.GetDecodeCheckSeconds())
+			if err != nil {
+				if !errors.Is(err, services.ErrInvalidSource) {
+					log.Printf("Error validating video %s, trying again at the next scan: %v", file, err)
+					continue
+				}
+				observation.handled = true
+				log.Printf("Rejecting video %s: %v", file, err)
+				d.quarantine(stream, file, vars[i], err)
+				continue
+			}
+
+			// Hold the sources over quota until space is freed, or reject them
+			if err := d.checkQuota(&job, media); err != nil {
+				switch {
+				case !errors.Is(err, services.ErrQuotaExceeded):
+					log.Printf("Error checking the quota of video %s, trying again at the next scan: %v", file, err)
+				case stream.Quota.OnExceed == models.QuotaActionHold:
+					log.Printf("Holding video %s: %v", file, err)
+				default:
+					observation.handled = true
+					log.Printf("Rejecting video %s: %v", file, err)
+					d.quarantine(stream, file, vars[i], err)
+				}
 				continue
 			}
 
-			log.Printf("Queued video for encoding: %s", file)
+			nbVideosToEncode++
+
+			queuedJob, err := d.encodeQueue.Enqueue(job)
+			if errors.Is(err, ErrJobAlreadyQueued) {
+				observation.handled = true
+				log.Printf("Video already queued for encoding: %s (job %s)", file, queuedJob.ID)
+				continue
+			}
+			if err != nil {
+				log.Printf("Error queueing video %s, trying again at the next scan: %v", file, err)
+				continue
+			}
+
+			observation.handled = true
+			log.Printf("Queued video for encoding: %s (job %s)", file, queuedJob.ID)
 		}
 
 		log.Printf("Found %d videos to encode for stream %s", nbVideosToEncode, stream.Path)
 	}
 
+	// Forget the sources that are gone, and find the next one to become stable
+	var wait time.Duration
+	for file, observation := range d.observed {
+		if !seen[file] {
+			delete(d.observed, file)
+			continue
+		}
+		if watch.Enabled && !observation.handled {
+			if remaining := watch.StabilityPeriod - now.Sub(observation.since); remaining > 0 && (wait == 0 || remaining < wait) {
+				wait = remaining
+			}
+		}
+	}
+
+	return wait
+}
+
+// QueueFile queues the encode of a source of a video unencoded channel, given by its path in the data directory
+// The source is validated, but queued even if it was already encoded
+func (d *VideoUnencodedDetector) QueueFile(channelName string, file string) (models.EncodeJob, error) {
+	stream, found := (*d.appService.GetChannels())[channelName]
+	if !found || stream.Type != models.StreamTypeVideoUnEncoded {
+		return models.EncodeJob{}, fmt.Errorf("%w: %s", ErrUnknownChannel, channelName)
+	}
+
+	// The placeholder values come from the channel input pattern, which the source must match
+	sourcePath := path.Join(constants.VideoDir, path.Clean("/"+file))
+	d.inventory.Update(sourcePath)
+	vars, found, err := d.inventory.Lookup(channelName, services.InventorySources, sourcePath)
+	if err != nil {
+		return models.EncodeJob{}, fmt.Errorf("error searching sources: %w", err)
+	}
+	if !found {
+		return models.EncodeJob{}, fmt.Errorf("%w: %s", ErrSourceNotFound, file)
+	}
+
+	media, err := d.validationService.Validate(sourcePath, stream.GetDecodeCheckSeconds())
+	if err != nil {
+		return models.EncodeJob{}, err
+	}
+
+	job, err := d.newJob(channelName, stream, sourcePath, vars, func() recordedSources {
+		return d.recordedSources(channelName)
+	})
+	if err != nil {
+		return job, err
+	}
+	if err := d.checkNameCollision(job); err != nil {
+		return models.EncodeJob{}, err
+	}
+
+	if err := d.checkQuota(&job, media); err != nil {
+		return models.EncodeJob{}, err
+	}
+
+	queuedJob, err := d.encodeQueue.Enqueue(job)
+	if err != nil {
+		return queuedJob, err
+	}
+
+	log.Printf("Queued video for encoding on request: %s (job %s)", sourcePath, queuedJob.ID)
+	return queuedJob, nil
+}
+
+// newJob builds the encode job of a source, templating its output and dead letter paths with the placeholder values of the source
+func (d *VideoUnencodedDetector) newJob(channelName string, stream models.Stream, file string, vars map[string]string, recorded func() recordedSources) (models.EncodeJob, error) {
+	// The outputs are named after the slugified file name
+	vars, err := d.templateService.SourceVars(vars, path.Base(file))
+	if err != nil {
+		return models.EncodeJob{}, err
+	}
+
+	// The output and archive paths can use computed values: {date}, {yyyy}, {mm}, {uuid} and {hash8}
+	// They are computed when the source is first queued, and kept afterwards so its output does not move
+	templates := stream.OutputPath()
+	if stream.AfterEncoding == models.AfterEncodingMove {
+		templates += "/" + stream.ArchivePath
+	}
+	if slices.ContainsFunc(constants.ComputedPlaceholders, func(name string) bool { return utils.HasPlaceholder(templates, name) }) {
+		for name, value := range d.previousValues(file, vars, recorded) {
+			if slices.Contains(constants.ComputedPlaceholders, name) {
+				vars[name] = value
+			}
+		}
+	}
+
+	// The hash of a source hashed for {hash8} is kept, so it is not hashed again by the worker
+	contentHash := ""
+	vars, err = utils.ComputePlaceholders(templates, vars, time.Now(), func() (string, error) {
+		hash, err := d.storage.HashFile(file)
+		contentHash = hash
+		return hash, err
+	})
+	if err != nil {
+		return models.EncodeJob{}, err
+	}
+
+	outputPath, err := d.templateService.OutputStoragePath(stream, vars)
+	if err != nil {
+		return models.EncodeJob{}, err
+	}
+
+	// The dead letter directory is where the source goes if its encode fails for good
+	deadLetterPath := ""
+	if stream.DeadLetterPath != "" {
+		deadLetterPath, err = d.templateService.ReplacePlaceholders(path.Join(constants.VideoDir, stream.DeadLetterPath), vars)
+		if err != nil {
+			return models.EncodeJob{}, err
+		}
+	}
+
+	// The archive directory is where the source goes once encoded
+	archivePath := ""
+	if stream.AfterEncoding == models.AfterEncodingMove {
+		archivePath, err = d.templateService.ReplacePlaceholders(path.Join(constants.VideoDir, stream.ArchivePath), vars)
+		if err != nil {
+			return models.EncodeJob{}, err
+		}
+	}
+
+	return models.EncodeJob{
+		InputStoragePath:  file,
+		OutputStoragePath: outputPath,
+		ChannelName:       channelName,
+		Channel:           stream,
+		Vars:              vars,
+		Priority:          stream.Priority,
+		DeadLetterPath:    deadLetterPath,
+		ArchivePath:       archivePath,
+		ContentHash:       contentHash,
+	}, nil
+}
+
+// previousValues returns the placeholder values given to a source when it was queued before: by its queued or running job,
+// or else by the manifest of its last encode. nil is returned for a new source.
+func (d *VideoUnencodedDetector) previousValues(file string, vars map[string]string, recorded func() recordedSources) map[string]string {
+	if active, found := d.encodeQueue.findActiveJob(func(active *models.EncodeJob) bool {
+		return active.InputStoragePath == file
+	}); found {
+		return active.Vars
+	}
+	return recorded()[sourceKey(vars, path.Base(file))]
+}
+
+// recordedSources reads the placeholder values recorded by the manifests of a channel
+func (d *VideoUnencodedDetector) recordedSources(channelName string) recordedSources {
+	recorded := recordedSources{}
+
+	manifestFiles, vars, err := d.inventory.Files(channelName, services.InventoryManifests)
+	if err != nil {
+		log.Printf("Error searching manifests of %s: %v", channelName, err)
+		return recorded
+	}
+	for i, manifestFile := range manifestFiles {
+		// Any path of the output directory locates its manifest
+		manifest, err := d.manifestService.ReadManifest(manifestFile)
+		if err != nil {
+			log.Printf("Error reading manifest %s: %v", manifestFile, err)
+			continue
+		}
+		// The manifests written before the values were recorded give the ones of their path
+		values := manifest.Vars
+		if values == nil {
+			values = vars[i]
+		}
+		recorded[sourceKey(values, manifest.Source.Name)] = values
+	}
+	return recorded
+}
+
+// checkNameCollision rejects a source whose output would replace the output of another source, recorded in the manifest
+// of its output directory or being encoded to it
+func (d *VideoUnencodedDetector) checkNameCollision(job models.EncodeJob) error {
+	name := path.Base(job.InputStoragePath)
+	outputDir := path.Dir(job.OutputStoragePath)
+
+	if manifest, err := d.manifestService.ReadManifest(job.OutputStoragePath); err == nil && manifest.Source.Name != name {
+		return fmt.Errorf("%w: %s was encoded from %s", ErrNameCollision, outputDir, manifest.Source.Name)
+	}
+
+	if active, found := d.encodeQueue.findActiveJob(func(active *models.EncodeJob) bool {
+		return path.Dir(active.OutputStoragePath) == outputDir && active.InputStoragePath != job.InputStoragePath
+	}); found {
+		return fmt.Errorf("%w: %s is being encoded from %s", ErrNameCollision, outputDir, active.InputStoragePath)
+	}
 	return nil
 }
+
+// checkQuota estimates the output size of a job, and checks it fits in the quota of its channel with the jobs already queued
+func (d *VideoUnencodedDetector) checkQuota(job *models.EncodeJob, media models.MediaInfo) error {
+	quota := job.Channel.Quota
+	job.EstimatedSize = d.quotaService.EstimateSize(job.Channel, media.Duration)
+	pending := d.encodeQueue.PendingSize(job.ChannelName, quota.Placeholder, job.Vars[quota.Placeholder])
+	return d.quotaService.Check(job.ChannelName, job.Channel, job.Vars, job.EstimatedSize+pending)
+}
+
+// observe records the current size and modification time of a source, restarting its stability period when they changed
+// nil is returned when the source cannot be read
+func (d *VideoUnencodedDetector) observe(file string, now time.Time) *sourceObservation {
+	info, err := d.storage.StatFile(file)
+	if err != nil {
+		log.Printf("Error reading video %s: %v", file, err)
+		return nil
+	}
+
+	observation, found := d.observed[file]
+	if !found || !info.Unchanged(observation.info) {
+		observation = &sourceObservation{info: info, since: now}
+		d.observed[file] = observation
+	}
+	return observation
+}
+
+// quarantine moves a rejected source out of the input directory so it is not detected again at every scan,
+// or leaves it in place with its rejection report when the stream has no quarantine path
+func (d *VideoUnencodedDetector) quarantine(stream models.Stream, file string, vars map[string]string, reason error) {
+	quarantineDir := ""
+	if stream.QuarantinePath != "" {
+		var err error
+		quarantineDir, err = d.templateService.ReplacePlaceholders(path.Join(constants.VideoDir, stream.QuarantinePath), vars)
+		if err != nil {
+			log.Printf("Error replacing placeholders: %v", err)
+			return
+		}
+	}
+
+	quarantinedPath, err := d.validationService.Quarantine(file, quarantineDir, reason)
+	if err != nil {
+		log.Printf("Error quarantining video %s: %v", file, err)
+		return
+	}
+	if quarantineDir == "" {
+		log.Printf("Left rejected video in place until it changes: %s", file)
+		return
+	}
+	d.inventory.Update(file)
+
+	log.Printf("Moved video to quarantine: %s -> %s", file, quarantinedPath)
+}
@@ -0,0 +1,169 @@
+package jobs
+
+import (
+	"errors"
+	"path"
+	"testing"
+
+	"Theatrum/constants"
+	"Theatrum/domain/models"
+	"Theatrum/domain/services"
+)
+
+func TestVideoUnencodedDetectorNameCollision(t *testing.T) {
+	stream := models.Stream{Type: models.StreamTypeVideoUnEncoded, Path: "records/{username}", VideoInputPath: "raw/{username}"}
+	outputDir := path.Join(constants.VideoDir, "records/john/movie")
+	storage := newMemoryStorage(map[string]string{
+		path.Join(outputDir, constants.ManifestFile): `{"source": {"name": "movie.mp4"}}`,
+	})
+
+	queue := NewEncodeJobQueue(nil, nil, nil, nil, nil, &memoryJobStore{jobs: map[string]models.EncodeJob{}}, models.Encoding{Workers: 1})
+	queue.activeJobs["talk"] = &models.EncodeJob{
+		ID:                "talk",
+		InputStoragePath:  path.Join(constants.VideoDir, "raw/john/My-Talk.mp4"),
+		OutputStoragePath: path.Join(constants.VideoDir, "records/john/My-Talk/master.m3u8"),
+		State:             models.JobStateQueued,
+	}
+
+	detector := NewVideoUnencodedDetector(nil, queue, storage, nil, services.NewPathTemplateService(), nil, services.NewManifestService(storage, nil), nil, nil)
+
+	tests := []struct {
+		name              string
+		file              string
+		expectedCollision bool
+	}{
+		{name: "source of the manifest", file: "movie.mp4", expectedCollision: false},
+		{name: "other extension of the source of the manifest", file: "movie.mkv", expectedCollision: true},
+		{name: "same slug as a queued source", file: "My Talk.mp4", expectedCollision: true},
+		{name: "queued source", file: "My-Talk.mp4", expectedCollision: false},
+		{name: "other source", file: "other.mp4", expectedCollision: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := path.Join(constants.VideoDir, "raw/john", tt.file)
+			job, err := detector.newJob("/video/{username}", stream, file, map[string]string{"username": "john"}, func() recordedSources { return nil })
+			if err != nil {
+				t.Fatalf("newJob() error = %v", err)
+			}
+
+			err = detector.checkNameCollision(job)
+			if errors.Is(err, ErrNameCollision) != tt.expectedCollision {
+				t.Errorf("checkNameCollision(%s) = %v, expected collision %v", job.OutputStoragePath, err, tt.expectedCollision)
+			}
+		})
+	}
+}
+
+func TestVideoUnencodedDetectorComputedValues(t *testing.T) {
+	channels := map[string]models.Stream{
+		"/video/{username}":  {Type: models.StreamTypeVideoUnEncoded, Path: "records/{username}/{uuid}", VideoInputPath: "raw/{username}"},
+		"/hashed/{username}": {Type: models.StreamTypeVideoUnEncoded, Path: "hashed/{username}/{hash8}", VideoInputPath: "raw/{username}"},
+	}
+	storage := newMemoryStorage(map[string]string{
+		path.Join(constants.VideoDir, "raw/john/movie.mp4"):                              "movie",
+		path.Join(constants.VideoDir, "raw/john/old.mp4"):                                "old",
+		path.Join(constants.VideoDir, "raw/john/new.mp4"):                                "new",
+		path.Join(constants.VideoDir, "records/john/first-uuid", constants.ManifestFile): `{"source": {"name": "movie.mp4"}, "vars": {"username": "john", "uuid": "first-uuid"}}`,
+		// A manifest written before the values were recorded
+		path.Join(constants.VideoDir, "records/john/old-uuid", constants.ManifestFile): `{"source": {"name": "old.mp4"}}`,
+		// The manifest of a source of another owner
+		path.Join(constants.VideoDir, "records/jane/jane-uuid", constants.ManifestFile): `{"source": {"name": "new.mp4"}, "vars": {"username": "jane", "uuid": "jane-uuid"}}`,
+	})
+
+	queue := NewEncodeJobQueue(nil, nil, nil, nil, nil, &memoryJobStore{jobs: map[string]models.EncodeJob{}}, models.Encoding{Workers: 1})
+	detector := NewVideoUnencodedDetector(nil, queue, storage, nil, services.NewPathTemplateService(), nil,
+		services.NewManifestService(storage, nil), services.NewInventoryService(&channels, storage), nil)
+
+	tests := []struct {
+		name            string
+		channel         string
+		file            string
+		expectedPath    string
+		expectedHashed  bool
+		unexpectedValue string
+	}{
+		{name: "source encoded before", channel: "/video/{username}", file: "movie.mp4", expectedPath: "records/john/first-uuid/master.m3u8"},
+		{name: "source encoded before the values were recorded", channel: "/video/{username}", file: "old.mp4", expectedPath: "records/john/old-uuid/master.m3u8"},
+		{name: "new source", channel: "/video/{username}", file: "new.mp4", unexpectedValue: "jane-uuid"},
+		{name: "hashed source", channel: "/hashed/{username}", file: "new.mp4", expectedHashed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := path.Join(constants.VideoDir, "raw/john", tt.file)
+			job, err := detector.newJob(tt.channel, channels[tt.channel], file, map[string]string{"username": "john"}, func() recordedSources {
+				return detector.recordedSources(tt.channel)
+			})
+			if err != nil {
+				t.Fatalf("newJob() error = %v", err)
+			}
+
+			if tt.expectedPath != "" && job.OutputStoragePath != path.Join(constants.VideoDir, tt.expectedPath) {
+				t.Errorf("OutputStoragePath = %s, expected %s", job.OutputStoragePath, tt.expectedPath)
+			}
+			if tt.unexpectedValue != "" && job.Vars[constants.PlaceholderUUID] == tt.unexpectedValue {
+				t.Errorf("uuid = %s, expected a new value", job.Vars[constants.PlaceholderUUID])
+			}
+
+			// The source hashed for its output path is not hashed again by the worker
+			if tt.expectedHashed {
+				hash, _ := storage.HashFile(file)
+				if job.ContentHash != hash || job.Vars[constants.PlaceholderHash8] != hash[:8] {
+					t.Errorf("ContentHash = %q, hash8 = %q, expected %q", job.ContentHash, job.Vars[constants.PlaceholderHash8], hash)
+				}
+			} else if job.ContentHash != "" {
+				t.Errorf("ContentHash = %q, expected the source not to be hashed", job.ContentHash)
+			}
+		})
+	}
+
+	// A queued source keeps the values of its job
+	first, err := detector.newJob("/video/{username}", channels["/video/{username}"], path.Join(constants.VideoDir, "raw/john/new.mp4"), map[string]string{"username": "john"}, func() recordedSources { return nil })
+	if err != nil {
+		t.Fatalf("newJob() error = %v", err)
+	}
+	first.ID = "new"
+	queue.activeJobs[first.ID] = &first
+	again, err := detector.newJob("/video/{username}", channels["/video/{username}"], first.InputStoragePath, map[string]string{"username": "john"}, func() recordedSources { return nil })
+	if err != nil {
+		t.Fatalf("newJob() error = %v", err)
+	}
+	if again.OutputStoragePath != first.OutputStoragePath {
+		t.Errorf("OutputStoragePath = %s, expected the one of the queued job %s", again.OutputStoragePath, first.OutputStoragePath)
+	}
+}
+
+func TestVideoUnencodedDetectorTransientError(t *testing.T) {
+	channels := map[string]models.Stream{
+		"/video/{username}": {Type: models.StreamTypeVideoUnEncoded, Path: "records/{username}", VideoInputPath: "raw/{username}"},
+	}
+	source := path.Join(constants.VideoDir, "raw/john/movie.mp4")
+	storage := newMemoryStorage(map[string]string{source: "\x00\x00\x00\x18ftypisom-movie"})
+
+	templateService := services.NewPathTemplateService()
+	appService := services.NewApplicationService(&models.Application{}, &models.Server{}, &channels, nil, templateService)
+	inventory := services.NewInventoryService(&channels, storage)
+	jobStore := &memoryJobStore{jobs: map[string]models.EncodeJob{}}
+	queue := NewEncodeJobQueue(appService, nil, nil, nil, storage, jobStore, models.Encoding{Workers: 1})
+	detector := NewVideoUnencodedDetector(appService, queue, storage, nil, templateService,
+		services.NewSourceValidationService(storage, probeEncoder{}), services.NewManifestService(storage, nil), inventory,
+		services.NewQuotaService(appService, storage, inventory))
+
+	// A source which cannot be fetched is neither rejected nor forgotten
+	storage.fetchErr = errors.New("connection reset by peer")
+	detector.scan()
+	if len(jobStore.jobs) != 0 {
+		t.Fatalf("jobs = %v, expected none while the source cannot be fetched", jobStore.jobs)
+	}
+	if _, err := storage.get(source + constants.QuarantineReportSuffix); err == nil {
+		t.Error("source was rejected for a storage error")
+	}
+
+	storage.fetchErr = nil
+	detector.scan()
+	detector.scan()
+	if len(jobStore.jobs) != 1 {
+		t.Errorf("jobs = %v, expected the source queued once the storage is back", jobStore.jobs)
+	}
+}
@@ -1,9 +1,157 @@
 package models
 
+import (
+	"math"
+	"slices"
+	"time"
+)
+
 // Application represents the application-wide configuration
 type Application struct {
 	PublicPath        string
 	AllStreamsPlaylist AllStreamsPlaylist
+	Encoding          Encoding
+	Watch             Watch
+	Storage           Storage
+	Inventory         Inventory
+	Janitor           Janitor
+	Uploads           Uploads
+	Api               Api
+}
+
+// Api represents the authentication of the jobs and usage API
+type Api struct {
+	// Tokens are the secrets accepted by the API, it refuses every request without them
+	Tokens []ApiToken
+}
+
+// ApiToken authenticates the requests of an administrator of the API
+type ApiToken struct {
+	// Name identifies the token in the logs
+	Name  string
+	Token string
+}
+
+// Uploads represents the resumable upload API of the sources, following the tus protocol
+type Uploads struct {
+	Enabled bool
+	// MaxSize is the largest source accepted, in bytes (0 for no limit)
+	MaxSize int64
+	// ExpireAfter is how long an unfinished upload is kept after its last chunk
+	ExpireAfter time.Duration
+	Tokens      []UploadToken
+}
+
+// UploadToken authenticates the uploads of an owner
+type UploadToken struct {
+	// Name identifies the token in the logs, and binds the uploads to it
+	Name  string
+	Token string
+	// Channels the token can upload to (every video unencoded channel when empty)
+	Channels []string
+	// Vars are placeholder values of video_input_path fixed by the token, such as the owner
+	Vars map[string]string
+}
+
+// AllowsChannel reports whether the token can upload to a channel
+func (t UploadToken) AllowsChannel(channelName string) bool {
+	return len(t.Channels) == 0 || slices.Contains(t.Channels, channelName)
+}
+
+// Janitor represents the background enforcement of the retention policies of the streams
+type Janitor struct {
+	// Interval is the delay between two enforcements
+	Interval time.Duration
+	// DryRun only records the expired outputs in the audit log, without deleting them
+	DryRun bool
+}
+
+// Inventory represents the in-memory inventory of the master playlists, manifests and sources of the channels
+type Inventory struct {
+	// ReconcileInterval is the delay between two searches of the storage, catching the changes the inventory was not told about
+	ReconcileInterval time.Duration
+}
+
+// StorageType selects where the sources and the encoded outputs are stored
+type StorageType string
+
+const (
+	// StorageTypeLocal stores the files in the data directory
+	StorageTypeLocal StorageType = "local"
+	// StorageTypeS3 stores the files in an S3 compatible bucket, the data directory only holds the files being encoded
+	StorageTypeS3 StorageType = "s3"
+)
+
+// Storage represents the storage of the sources and the encoded outputs
+type Storage struct {
+	Type StorageType
+	S3   S3Storage
+}
+
+// S3Storage represents an S3 compatible bucket, such as MinIO, mirroring the data directory
+type S3Storage struct {
+	// Endpoint is the host, and optional port, of the S3 API
+	Endpoint string
+	Bucket   string
+	// Prefix is prepended to the object keys, the paths relative to the data directory
+	Prefix string
+	Region string
+	// AccessKey and SecretKey are read from the AWS_ or MINIO_ environment variables when empty
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+// Watch represents the continuous detection of the sources of the video_unencoded streams
+type Watch struct {
+	// Enabled keeps detecting new sources after startup, otherwise sources are only detected at startup
+	Enabled bool
+	// RescanInterval is the delay between two full scans, catching the changes missed by the file notifications
+	RescanInterval time.Duration
+	// StabilityPeriod is how long the size and modification time of a source must stay unchanged before it is queued
+	StabilityPeriod time.Duration
+}
+
+// Encoding represents the configuration of the encode worker pool
+type Encoding struct {
+	// Workers is the number of jobs encoded at the same time
+	Workers int
+	// ThreadsPerJob limits the threads used by FFmpeg for each job (0 lets FFmpeg decide)
+	ThreadsPerJob int
+	// Retry of the failed encodes
+	Retry RetryPolicy
+	// Schedule of the encodes, channels may override it
+	Schedule Schedule
+	// ReencodeChangedLadders queues at startup the re-encode of the outputs whose channel ladder changed
+	ReencodeChangedLadders bool
+	// FinishedJobRetention is how long the done, failed and canceled jobs are kept in the job store (0 keeps them forever)
+	FinishedJobRetention time.Duration
+}
+
+// RetryPolicy represents how failed encodes are retried, with an exponential backoff between attempts
+type RetryPolicy struct {
+	// MaxAttempts is the number of encodes tried before the job fails (1 disables retries)
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled at every retry
+	Backoff time.Duration
+	// MaxBackoff caps the delay between two attempts (0 for no cap)
+	MaxBackoff time.Duration
+}
+
+// Delay returns how long to wait before retrying a job that failed the given number of attempts
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempts; i++ {
+		// Without a cap the delay keeps doubling, up to the longest duration
+		if (p.MaxBackoff > 0 && delay >= p.MaxBackoff) || delay > math.MaxInt64/2 {
+			break
+		}
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
 }
 
 // AllStreamsPlaylist represents the configuration for the all streams playlist feature
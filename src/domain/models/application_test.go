@@ -0,0 +1,54 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		attempts int
+		expected time.Duration
+	}{
+		{
+			name:     "first retry waits the backoff",
+			policy:   RetryPolicy{Backoff: time.Minute, MaxBackoff: time.Hour},
+			attempts: 1,
+			expected: time.Minute,
+		},
+		{
+			name:     "backoff doubles at every retry",
+			policy:   RetryPolicy{Backoff: time.Minute, MaxBackoff: time.Hour},
+			attempts: 3,
+			expected: 4 * time.Minute,
+		},
+		{
+			name:     "backoff is capped",
+			policy:   RetryPolicy{Backoff: time.Minute, MaxBackoff: time.Hour},
+			attempts: 10,
+			expected: time.Hour,
+		},
+		{
+			name:     "backoff doubles without a cap",
+			policy:   RetryPolicy{Backoff: time.Minute},
+			attempts: 4,
+			expected: 8 * time.Minute,
+		},
+		{
+			name:     "backoff without a cap does not overflow",
+			policy:   RetryPolicy{Backoff: time.Minute},
+			attempts: 100,
+			expected: time.Minute << 27,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Delay(tt.attempts); got != tt.expected {
+				t.Errorf("Delay(%d) = %v, expected %v", tt.attempts, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+// EncodeResult describes what was produced by an encode, in addition to the playlists and segments
+type EncodeResult struct {
+	// Ladder chosen by the complexity analysis (nil when the configured bitrates are used)
+	Ladder *Ladder
+	// QualityReport measured after the encode (nil when disabled)
+	QualityReport *QualityReport
+}
+
+// EncodeOptions carries the per encode decisions taken by the domain before calling the encoder
+type EncodeOptions struct {
+	// Passthrough lists the qualities remuxed from the source instead of being re-encoded
+	Passthrough map[string]bool
+	// Chunks is the number of parts encoded concurrently (0 or 1 encodes the source in one go)
+	Chunks int
+	// Threads is the FFmpeg threads budget of the encode, shared by its chunks (0 lets FFmpeg decide)
+	Threads int
+	// JobID identifies the encoder processes of the job, so they can be suspended and resumed
+	JobID string
+	// Progress, when set, receives the fraction of the source encoded, from 0 to 1
+	Progress func(fraction float64)
+	// KeepRenditions, when not nil, lists the qualities already encoded in the output which are not encoded again
+	// They stay listed in the master playlist next to the encoded qualities, the other previous qualities are removed from it
+	KeepRenditions []string
+	// PreviousMaster is the master playlist of the output being replaced, which lists the kept qualities
+	PreviousMaster string
+}
@@ -0,0 +1,37 @@
+package models
+
+import "errors"
+
+// EncodeError is returned by the encoder when the encode fails, it tells whether retrying it can succeed
+type EncodeError struct {
+	// Permanent is true when the source or the settings make the encode fail, so a retry would fail the same way
+	Permanent bool
+	// ExitCode of the encoder process (-1 when it was killed by a signal)
+	ExitCode int
+	// StderrTail holds the last lines written by the encoder
+	StderrTail string
+	Err        error
+}
+
+func (e *EncodeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// IsPermanentEncodeError checks whether an error is an encode failure that a retry cannot fix
+func IsPermanentEncodeError(err error) bool {
+	var encodeErr *EncodeError
+	return errors.As(err, &encodeErr) && encodeErr.Permanent
+}
+
+// EncodeStderrTail returns the encoder output captured with an encode failure, if any
+func EncodeStderrTail(err error) string {
+	var encodeErr *EncodeError
+	if errors.As(err, &encodeErr) {
+		return encodeErr.StderrTail
+	}
+	return ""
+}
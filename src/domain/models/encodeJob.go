@@ -0,0 +1,110 @@
+package models
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"Theatrum/constants"
+)
+
+type JobState string
+
+const (
+	JobStateQueued  JobState = "queued"
+	JobStateRunning JobState = "running"
+	JobStateDone    JobState = "done"
+	JobStateFailed  JobState = "failed"
+	// JobStateCanceled is set when a queued or running job is canceled through the API
+	JobStateCanceled JobState = "canceled"
+)
+
+// EncodeJob represents a video encoding job
+type EncodeJob struct {
+	ID               string
+	InputStoragePath string
+	// OutputStoragePath is the master playlist of the output, in the output directory of the source
+	OutputStoragePath string
+	ChannelName       string
+	Channel           Stream
+	// Vars are the placeholder values extracted from the source path
+	Vars map[string]string
+	// Priority orders the jobs, the highest first
+	Priority int
+	// ContentHash of the source file when the job was queued
+	ContentHash string
+
+	State JobState
+	// Suspended is set while the running encode is paused outside its schedule
+	Suspended bool
+	// Progress is the fraction of the source encoded by the running attempt, from 0 to 1
+	Progress float64
+	// Attempts is the number of encodes started for the job
+	Attempts int
+	// NextAttemptAt delays a retried job until the end of its backoff
+	NextAttemptAt time.Time
+	// Error of the last failed encode
+	Error string
+	// StderrTail holds the last lines written by the encoder during the last failed encode
+	StderrTail string
+	// DeadLetterPath is the directory where the source is moved once the job failed for good (empty to leave it in place)
+	DeadLetterPath string
+	// ArchivePath is the directory where the source is moved once encoded, when its channel archives the sources
+	ArchivePath string
+	// Reencode is set for the jobs encoding a kept source again after a change of the channel ladder,
+	// the source is left where it is whatever the outcome
+	Reencode bool
+	// Renditions limits the encode to these qualities of the channel, the others are kept from the previous encode
+	// (nil encodes every quality)
+	Renditions []string
+	// RemovedRenditions are the qualities taken out of the channel since the previous encode, their variants are
+	// deleted from the output once the encode is published
+	RemovedRenditions []string
+	// EstimatedSize is the expected size of the encode output in bytes, counted against the quota of the channel until the job ends
+	EstimatedSize int64
+	// Result of the encode once done
+	Result *EncodeResult
+
+	CreatedAt  time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Owner identifies who the source belongs to, from its placeholder values except the file name ones (e.g. "username=john")
+func (j *EncodeJob) Owner() string {
+	return OwnerOf(j.Vars)
+}
+
+// OwnerOf identifies who a source belongs to from its placeholder values, leaving out the file name and computed ones
+func OwnerOf(vars map[string]string) string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		if name != constants.PlaceholderFilename && name != constants.PlaceholderFilenameStem && name != constants.PlaceholderExt &&
+			!slices.Contains(constants.ComputedPlaceholders, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = name + "=" + vars[name]
+	}
+	return strings.Join(values, ",")
+}
+
+// IsDelayed checks whether the job waits for the end of its retry backoff
+func (j *EncodeJob) IsDelayed(now time.Time) bool {
+	return j.NextAttemptAt.After(now)
+}
+
+// IsRetryable checks whether the job ended without being encoded, so it can be queued again
+func (j *EncodeJob) IsRetryable() bool {
+	return j.State == JobStateFailed || j.State == JobStateCanceled
+}
+
+// IsActive checks whether the job is still waiting or being encoded
+func (j *EncodeJob) IsActive() bool {
+	return j.State == JobStateQueued || j.State == JobStateRunning
+}
@@ -0,0 +1,40 @@
+package models
+
+import "testing"
+
+func TestOwnerOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		vars     map[string]string
+		expected string
+	}{
+		{
+			name:     "input placeholders",
+			vars:     map[string]string{"username": "john", "lang": "en"},
+			expected: "lang=en,username=john",
+		},
+		{
+			name:     "file name placeholders",
+			vars:     map[string]string{"username": "john", "FILENAME": "movie.mp4", "FILENAME_STEM": "movie", "EXT": "mp4"},
+			expected: "username=john",
+		},
+		{
+			name:     "computed placeholders",
+			vars:     map[string]string{"username": "john", "date": "2024-03-09", "yyyy": "2024", "mm": "03", "uuid": "0b7c", "hash8": "9f86d081"},
+			expected: "username=john",
+		},
+		{
+			name:     "no placeholder",
+			vars:     nil,
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OwnerOf(tt.vars); got != tt.expected {
+				t.Errorf("OwnerOf() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// FileInfo describes a stored file
+type FileInfo struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// Unchanged checks whether a file has the same size and modification time as when it was observed
+func (f FileInfo) Unchanged(observed FileInfo) bool {
+	return f.Size == observed.Size && f.ModTime.Equal(observed.ModTime)
+}
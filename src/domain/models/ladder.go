@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// AutoLadder represents the settings of the per-title ladder generation
+type AutoLadder struct {
+	// Enabled picks the quality bitrates from a complexity analysis of the source
+	Enabled bool
+	// Crf is the constant rate factor of the analysis encodes
+	Crf int
+	// SampleSeconds is the total duration of the source excerpts analyzed
+	SampleSeconds int
+}
+
+// Ladder is the set of bitrates chosen for a source by the complexity analysis
+type Ladder struct {
+	Crf        int               `json:"crf"`
+	AnalyzedAt time.Time         `json:"analyzed_at"`
+	Renditions []LadderRendition `json:"renditions"`
+}
+
+// LadderRendition is the bitrate chosen for a quality of the ladder
+type LadderRendition struct {
+	Quality string `json:"quality"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	// MeasuredBitrate is the bitrate in bits per second needed by the source at the analysis CRF
+	MeasuredBitrate int64 `json:"measured_bitrate"`
+	// Bitrate is the measured bitrate clamped to the quality bounds
+	Bitrate string `json:"bitrate"`
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"Theatrum/domain/utils"
+)
+
+// EncodeManifest records what an encode output was produced from, so an unchanged source is not encoded again
+type EncodeManifest struct {
+	Source ManifestSource `json:"source"`
+	// LadderHash identifies the qualities and distribution settings of the channel at encode time
+	LadderHash string              `json:"ladder_hash"`
+	Renditions []ManifestRendition `json:"renditions"`
+	// EncoderVersion is the version of the encoder which produced the output
+	EncoderVersion string    `json:"encoder_version"`
+	EncodedAt      time.Time `json:"encoded_at"`
+	// Vars are the placeholder values of the encode, so the source keeps its computed values when queued again
+	Vars map[string]string `json:"vars,omitempty"`
+}
+
+// ManifestSource identifies the source of an encode
+type ManifestSource struct {
+	// Name is the original file name of the source
+	Name string `json:"name"`
+	// Slug is the file name given to the outputs, Name slugified when it has characters not accepted in the paths
+	Slug string `json:"slug,omitempty"`
+	// Path is where the source is kept after its encode, relative to the data directory (empty when it was deleted)
+	Path    string    `json:"path,omitempty"`
+	Hash    string    `json:"hash"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// ManifestRendition is a quality of the channel as configured at encode time
+type ManifestRendition struct {
+	Quality      string `json:"quality"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	Framerate    int    `json:"framerate"`
+	Bitrate      string `json:"bitrate"`
+	Codec        string `json:"codec"`
+	AudioBitrate string `json:"audio_bitrate"`
+	AudioCodec   string `json:"audio_codec"`
+	Passthrough  bool   `json:"passthrough,omitempty"`
+	MinBitrate   string `json:"min_bitrate,omitempty"`
+	MaxBitrate   string `json:"max_bitrate,omitempty"`
+}
+
+// NewManifestRenditions lists the qualities of a stream sorted by name
+func NewManifestRenditions(qualities map[string]Quality) []ManifestRendition {
+	renditions := make([]ManifestRendition, 0, len(qualities))
+	for name, quality := range qualities {
+		renditions = append(renditions, ManifestRendition{
+			Quality:      name,
+			Width:        quality.Width,
+			Height:       quality.Height,
+			Framerate:    quality.Framerate,
+			Bitrate:      quality.Bitrate,
+			Codec:        quality.Codec,
+			AudioBitrate: quality.Audio.Bitrate,
+			AudioCodec:   quality.Audio.Codec,
+			Passthrough:  quality.Passthrough,
+			MinBitrate:   quality.MinBitrate,
+			MaxBitrate:   quality.MaxBitrate,
+		})
+	}
+	sort.Slice(renditions, func(i, j int) bool {
+		return renditions[i].Quality < renditions[j].Quality
+	})
+	return renditions
+}
+
+// LadderHash identifies the settings of a stream which change its encode output: qualities, distribution and auto ladder
+func (s Stream) LadderHash() (string, error) {
+	return s.ladderHash(NewManifestRenditions(s.Qualities))
+}
+
+func (s Stream) ladderHash(renditions []ManifestRendition) (string, error) {
+	return utils.HashJSON(struct {
+		Renditions   []ManifestRendition
+		Distribution Distribution
+		AutoLadder   AutoLadder
+	}{
+		Renditions:   renditions,
+		Distribution: s.Distribution,
+		AutoLadder:   s.AutoLadder,
+	})
+}
+
+// LadderChange describes how the ladder of a channel changed since an output was encoded
+type LadderChange struct {
+	// Added, Changed and Removed list the qualities by name, sorted
+	Added   []string
+	Changed []string
+	Removed []string
+	// Full is set when every quality must be encoded again: the distribution or auto ladder settings changed,
+	// or the bitrates are picked by the auto ladder, which analyzes all the qualities together
+	Full bool
+}
+
+// Renditions lists the qualities to encode for a partial re-encode, sorted
+func (c LadderChange) Renditions() []string {
+	renditions := append(append([]string{}, c.Added...), c.Changed...)
+	sort.Strings(renditions)
+	return renditions
+}
+
+// LadderChange compares the ladder recorded in the manifest with the current one of a stream
+func (m EncodeManifest) LadderChange(s Stream) (LadderChange, error) {
+	change := LadderChange{}
+
+	recorded := make(map[string]ManifestRendition, len(m.Renditions))
+	for _, rendition := range m.Renditions {
+		recorded[rendition.Quality] = rendition
+	}
+
+	current := NewManifestRenditions(s.Qualities)
+	for _, rendition := range current {
+		previous, found := recorded[rendition.Quality]
+		switch {
+		case !found:
+			change.Added = append(change.Added, rendition.Quality)
+		case previous != rendition:
+			change.Changed = append(change.Changed, rendition.Quality)
+		}
+		delete(recorded, rendition.Quality)
+	}
+	for _, rendition := range m.Renditions {
+		if _, removed := recorded[rendition.Quality]; removed {
+			change.Removed = append(change.Removed, rendition.Quality)
+		}
+	}
+
+	// Hashing the recorded qualities with the current settings tells whether only the qualities changed
+	settingsHash, err := s.ladderHash(m.Renditions)
+	if err != nil {
+		return change, err
+	}
+	change.Full = settingsHash != m.LadderHash || s.AutoLadder.Enabled
+
+	return change, nil
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEncodeManifestLadderChange(t *testing.T) {
+	low := Quality{Width: 640, Height: 360, Framerate: 24, Bitrate: "800k", Codec: "libx264"}
+	medium := Quality{Width: 1280, Height: 720, Framerate: 30, Bitrate: "2500k", Codec: "libx264"}
+	high := Quality{Width: 1920, Height: 1080, Framerate: 30, Bitrate: "5000k", Codec: "libx264"}
+
+	encoded := Stream{
+		Qualities:    map[string]Quality{"low": low, "medium": medium},
+		Distribution: Distribution{Hls: Hls{SegmentDuration: 6}},
+	}
+	ladderHash, err := encoded.LadderHash()
+	if err != nil {
+		t.Fatalf("LadderHash() error = %v", err)
+	}
+	manifest := EncodeManifest{LadderHash: ladderHash, Renditions: NewManifestRenditions(encoded.Qualities)}
+
+	fasterMedium := medium
+	fasterMedium.Bitrate = "3000k"
+
+	tests := []struct {
+		name               string
+		stream             Stream
+		expectedRenditions []string
+		expectedRemoved    []string
+		expectedFull       bool
+	}{
+		{
+			name:               "added quality",
+			stream:             Stream{Qualities: map[string]Quality{"low": low, "medium": medium, "high": high}, Distribution: encoded.Distribution},
+			expectedRenditions: []string{"high"},
+		},
+		{
+			name:               "changed and removed qualities",
+			stream:             Stream{Qualities: map[string]Quality{"medium": fasterMedium}, Distribution: encoded.Distribution},
+			expectedRenditions: []string{"medium"},
+			expectedRemoved:    []string{"low"},
+		},
+		{
+			name:               "changed distribution",
+			stream:             Stream{Qualities: map[string]Quality{"low": low, "medium": medium, "high": high}, Distribution: Distribution{Hls: Hls{SegmentDuration: 4}}},
+			expectedRenditions: []string{"high"},
+			expectedFull:       true,
+		},
+		{
+			name:               "auto ladder",
+			stream:             Stream{Qualities: map[string]Quality{"low": low, "medium": medium, "high": high}, Distribution: encoded.Distribution, AutoLadder: AutoLadder{Enabled: true}},
+			expectedRenditions: []string{"high"},
+			expectedFull:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			change, err := manifest.LadderChange(tt.stream)
+			if err != nil {
+				t.Fatalf("LadderChange() error = %v", err)
+			}
+			if !slices.Equal(change.Renditions(), tt.expectedRenditions) {
+				t.Errorf("Renditions() = %v, expected %v", change.Renditions(), tt.expectedRenditions)
+			}
+			if !slices.Equal(change.Removed, tt.expectedRemoved) {
+				t.Errorf("Removed = %v, expected %v", change.Removed, tt.expectedRemoved)
+			}
+			if change.Full != tt.expectedFull {
+				t.Errorf("Full = %v, expected %v", change.Full, tt.expectedFull)
+			}
+		})
+	}
+}
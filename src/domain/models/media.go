@@ -0,0 +1,37 @@
+package models
+
+// MediaInfo represents the result of probing a source video file
+type MediaInfo struct {
+	// Container format name as reported by the prober (e.g. "mov,mp4,m4a,3gp,3g2,mj2")
+	FormatName string
+	// Duration of the media in seconds
+	Duration float64
+	// Overall bitrate of the media in bits per second
+	Bitrate int64
+	// First video stream of the media (nil if there is none)
+	Video *VideoStreamInfo
+	// First audio stream of the media (nil if there is none)
+	Audio *AudioStreamInfo
+}
+
+// VideoStreamInfo represents the properties of a probed video stream
+type VideoStreamInfo struct {
+	// Codec name of the stream (e.g. "h264")
+	Codec string
+	// Width of the video in pixels
+	Width int
+	// Height of the video in pixels
+	Height int
+	// Framerate of the video in frames per second
+	Framerate float64
+	// Bitrate of the stream in bits per second (0 if unknown)
+	Bitrate int64
+}
+
+// AudioStreamInfo represents the properties of a probed audio stream
+type AudioStreamInfo struct {
+	// Codec name of the stream (e.g. "aac")
+	Codec string
+	// Bitrate of the stream in bits per second (0 if unknown)
+	Bitrate int64
+}
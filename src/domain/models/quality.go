@@ -1,5 +1,26 @@
 package models
 
+import "Theatrum/domain/utils"
+
+// framerateTolerance absorbs rounding of fractional source frame rates (e.g. 29.97 for 30)
+const framerateTolerance = 0.5
+
+// codecNames maps the encoders used in the configuration to the codec names reported by the prober
+var codecNames = map[string]string{
+	"libx264":    "h264",
+	"h264_nvenc": "h264",
+	"h264_qsv":   "h264",
+	"libx265":    "hevc",
+	"hevc_nvenc": "hevc",
+	"libvpx-vp9": "vp9",
+	"libaom-av1": "av1",
+	"libsvtav1":  "av1",
+	"aac":        "aac",
+	"libfdk_aac": "aac",
+	"libopus":    "opus",
+	"libmp3lame": "mp3",
+}
+
 type Audio struct {
 	// Bitrate of the audio in bits per second
 	Bitrate string
@@ -21,4 +42,68 @@ type Quality struct {
 	Codec string
 	// Audio of the video
 	Audio Audio
+	// Passthrough allows remuxing the source instead of re-encoding it when it already matches the quality
+	Passthrough bool
+	// MinBitrate is the lowest bitrate the per-title ladder may choose (default: no lower bound)
+	MinBitrate string
+	// MaxBitrate is the highest bitrate the per-title ladder may choose (default: Bitrate)
+	MaxBitrate string
+}
+
+// ClampBitrate bounds a bitrate in bits per second to the quality minimum and maximum bitrates
+func (q Quality) ClampBitrate(bitrate int64) int64 {
+	maxBitrate, err := utils.ParseBitrate(q.MaxBitrate)
+	if err != nil {
+		maxBitrate, _ = utils.ParseBitrate(q.Bitrate)
+	}
+	if minBitrate, err := utils.ParseBitrate(q.MinBitrate); err == nil && bitrate < minBitrate {
+		bitrate = minBitrate
+	}
+	if maxBitrate > 0 && bitrate > maxBitrate {
+		bitrate = maxBitrate
+	}
+	return bitrate
+}
+
+// AcceptsPassthrough checks that a probed source already complies with the quality codecs and constraints,
+// so it can be remuxed without re-encoding
+func (q Quality) AcceptsPassthrough(media MediaInfo) bool {
+	if !q.Passthrough || media.Video == nil || media.Audio == nil {
+		return false
+	}
+
+	video := media.Video
+	if !sameCodec(q.Codec, video.Codec) || !sameCodec(q.Audio.Codec, media.Audio.Codec) {
+		return false
+	}
+	if video.Width > q.Width || video.Height > q.Height || video.Framerate > float64(q.Framerate)+framerateTolerance {
+		return false
+	}
+
+	// Without a stream bitrate, the overall bitrate is an upper bound of the video bitrate
+	videoBitrate := video.Bitrate
+	if videoBitrate == 0 {
+		videoBitrate = media.Bitrate
+	}
+	maxVideoBitrate, err := utils.ParseBitrate(q.Bitrate)
+	if err != nil || videoBitrate == 0 || videoBitrate > maxVideoBitrate {
+		return false
+	}
+
+	if media.Audio.Bitrate != 0 {
+		maxAudioBitrate, err := utils.ParseBitrate(q.Audio.Bitrate)
+		if err != nil || media.Audio.Bitrate > maxAudioBitrate {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sameCodec checks that an encoder from the configuration produces the probed codec
+func sameCodec(encoder string, probedCodec string) bool {
+	if codec, ok := codecNames[encoder]; ok {
+		return codec == probedCodec
+	}
+	return encoder == probedCodec
 }
\ No newline at end of file
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// QualityReportSettings represents the settings of the objective quality measurement done after each encode
+type QualityReportSettings struct {
+	// Enabled measures PSNR and SSIM of every encoded quality against the scaled source
+	Enabled bool
+	// Vmaf also measures VMAF when the encoder supports it
+	Vmaf bool
+}
+
+// QualityReport holds the objective quality measured for every quality of an encode
+type QualityReport struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	Renditions  []RenditionQuality `json:"renditions"`
+}
+
+// RenditionQuality holds the objective quality of an encoded quality compared to the source scaled to its resolution
+type RenditionQuality struct {
+	Quality string `json:"quality"`
+	// Width and Height are the ones of the encoded variant
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Bitrate string `json:"bitrate"`
+	// Psnr is the average peak signal-to-noise ratio in dB
+	Psnr float64 `json:"psnr"`
+	// Ssim is the average structural similarity index, from 0 to 1
+	Ssim float64 `json:"ssim"`
+	// Vmaf is the average VMAF score, from 0 to 100 (nil when not measured)
+	Vmaf *float64 `json:"vmaf,omitempty"`
+}
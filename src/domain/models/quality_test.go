@@ -0,0 +1,27 @@
+package models
+
+import "testing"
+
+func TestQualityClampBitrate(t *testing.T) {
+	tests := []struct {
+		name     string
+		quality  Quality
+		bitrate  int64
+		expected int64
+	}{
+		{name: "within bounds", quality: Quality{Bitrate: "5000k", MinBitrate: "1000k"}, bitrate: 2400000, expected: 2400000},
+		{name: "below the minimum", quality: Quality{Bitrate: "5000k", MinBitrate: "1000k"}, bitrate: 300000, expected: 1000000},
+		{name: "above the configured bitrate", quality: Quality{Bitrate: "5000k"}, bitrate: 8000000, expected: 5000000},
+		{name: "above the maximum", quality: Quality{Bitrate: "5000k", MaxBitrate: "6M"}, bitrate: 8000000, expected: 6000000},
+		{name: "maximum above the configured bitrate", quality: Quality{Bitrate: "5000k", MaxBitrate: "6M"}, bitrate: 5500000, expected: 5500000},
+		{name: "no lower bound", quality: Quality{Bitrate: "5000k"}, bitrate: 500, expected: 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.quality.ClampBitrate(tt.bitrate); got != tt.expected {
+				t.Errorf("ClampBitrate(%d) = %d, expected %d", tt.bitrate, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// QuarantineReport describes why a source file was rejected, and where it was moved to quarantine
+type QuarantineReport struct {
+	SourcePath     string    `json:"source_path"`
+	QuarantinePath string    `json:"quarantine_path,omitempty"` // Empty when the source was left in place
+	SourceSize     int64     `json:"source_size"`
+	SourceModTime  time.Time `json:"source_mod_time"`
+	Reason         string    `json:"reason"`
+	QuarantinedAt  time.Time `json:"quarantined_at"`
+}
+
+// Matches checks whether the report was written for the current version of its source
+func (r QuarantineReport) Matches(info FileInfo) bool {
+	return info.Unchanged(FileInfo{Size: r.SourceSize, ModTime: r.SourceModTime})
+}
@@ -0,0 +1,37 @@
+package models
+
+// QuotaAction is what happens to a source whose encode would exceed its quota
+type QuotaAction string
+
+const (
+	// QuotaActionHold leaves the source in place, it is queued once enough space is freed
+	QuotaActionHold QuotaAction = "hold"
+	// QuotaActionReject moves the source to the quarantine path, or ignores it until it changes
+	QuotaActionReject QuotaAction = "reject"
+)
+
+// Quota limits the storage used by the sources and outputs of a video unencoded stream
+type Quota struct {
+	// MaxSize is the number of bytes allowed (0 disables the quota)
+	MaxSize int64
+	// Placeholder gives each of its values its own quota (e.g. "username"), the stream shares the quota when empty
+	Placeholder string
+	OnExceed    QuotaAction
+}
+
+// QuotaUsage is the storage used by a channel, or by a placeholder value of a channel
+type QuotaUsage struct {
+	Channel     string
+	Placeholder string
+	Value       string
+	// Used is the size of the sources and outputs in the storage, in bytes
+	Used int64
+	// Pending is the estimated size of the outputs of the queued and running encodes, in bytes
+	Pending int64
+	MaxSize int64
+}
+
+// Exceeded reports whether the quota is used up
+func (u QuotaUsage) Exceeded() bool {
+	return u.Used+u.Pending >= u.MaxSize
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// Retention tells when the encoded outputs of a video unencoded stream are deleted
+// The outputs of each owner are ordered from the newest, the owner being a placeholder value of the stream path
+type Retention struct {
+	// MaxAge deletes the outputs encoded longer ago (0 disables it)
+	MaxAge time.Duration
+	// MaxCount deletes the outputs of an owner beyond its newest ones (0 disables it)
+	MaxCount int
+	// KeepLast protects the newest outputs of an owner from MaxAge
+	KeepLast int
+	// Placeholder gives each of its values its own outputs (e.g. "username"), the stream is the only owner when empty
+	Placeholder string
+}
+
+// Enabled reports whether outputs can expire
+func (r Retention) Enabled() bool {
+	return r.MaxAge > 0 || r.MaxCount > 0
+}
+
+// Expiry returns why the output at the given rank of its owner (0 for the newest), encoded at the given time, expired,
+// or an empty reason when it is kept
+func (r Retention) Expiry(rank int, encodedAt time.Time, now time.Time) string {
+	switch {
+	case rank < r.KeepLast:
+		return ""
+	case r.MaxCount > 0 && rank >= r.MaxCount:
+		return "max_count"
+	case r.MaxAge > 0 && now.Sub(encodedAt) > r.MaxAge:
+		return "max_age"
+	}
+	return ""
+}
+
+// RetentionAuditEntry records an output directory expired by a retention policy
+type RetentionAuditEntry struct {
+	Time      time.Time `json:"time"`
+	Channel   string    `json:"channel"`
+	Owner     string    `json:"owner,omitempty"`
+	Directory string    `json:"directory"`
+	// Reason is the rule which expired the output: max_age or max_count
+	Reason    string    `json:"reason"`
+	EncodedAt time.Time `json:"encoded_at"`
+	Size      int64     `json:"size"`
+	// DryRun is set when the output was left in place
+	DryRun bool   `json:"dry_run,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetentionExpiry(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	recent := now.Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		retention Retention
+		rank      int
+		encodedAt time.Time
+		expected  string
+	}{
+		{name: "recent output", retention: Retention{MaxAge: 24 * time.Hour}, rank: 3, encodedAt: recent},
+		{name: "old output", retention: Retention{MaxAge: 24 * time.Hour}, rank: 0, encodedAt: old, expected: "max_age"},
+		{name: "old output kept as one of the last", retention: Retention{MaxAge: 24 * time.Hour, KeepLast: 2}, rank: 1, encodedAt: old},
+		{name: "old output beyond the last", retention: Retention{MaxAge: 24 * time.Hour, KeepLast: 2}, rank: 2, encodedAt: old, expected: "max_age"},
+		{name: "output within the count", retention: Retention{MaxCount: 3}, rank: 2, encodedAt: old},
+		{name: "output beyond the count", retention: Retention{MaxCount: 3}, rank: 3, encodedAt: recent, expected: "max_count"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reason := tt.retention.Expiry(tt.rank, tt.encodedAt, now); reason != tt.expected {
+				t.Errorf("Expiry(%d) = %q, want %q", tt.rank, reason, tt.expected)
+			}
+		})
+	}
+}
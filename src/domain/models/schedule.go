@@ -0,0 +1,148 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule represents the time windows in which encodes may run
+type Schedule struct {
+	// Windows in which encodes may run, no window means encodes may always run
+	Windows []ScheduleWindow
+	// SuspendRunning suspends the running encodes when a window closes and resumes them when one opens,
+	// otherwise running encodes finish and only new encodes wait for a window
+	SuspendRunning bool
+}
+
+// ScheduleWindow is a daily time window on some days of the week, in local time
+// A window ending before it starts runs past midnight: the part after midnight belongs to the day the window started
+type ScheduleWindow struct {
+	Days  [7]bool // Indexed by time.Weekday
+	Start time.Duration
+	End   time.Duration
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseScheduleWindow parses a window from its days (e.g. "mon-fri", "sat,sun", "*" or empty for every day)
+// and its start and end times of day (e.g. "22:00" and "06:00")
+func ParseScheduleWindow(days string, start string, end string) (ScheduleWindow, error) {
+	var window ScheduleWindow
+	var err error
+
+	if window.Start, err = parseTimeOfDay(start); err != nil {
+		return window, err
+	}
+	if window.End, err = parseTimeOfDay(end); err != nil {
+		return window, err
+	}
+	if window.Start == window.End {
+		return window, fmt.Errorf("window start and end must differ")
+	}
+
+	days = strings.ToLower(strings.TrimSpace(days))
+	if days == "" || days == "*" {
+		for i := range window.Days {
+			window.Days[i] = true
+		}
+		return window, nil
+	}
+
+	for _, part := range strings.Split(days, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		firstDay, ok := weekdayNames[first]
+		if !ok {
+			return window, fmt.Errorf("invalid day %q: must be one of mon, tue, wed, thu, fri, sat, sun", first)
+		}
+		lastDay := firstDay
+		if isRange {
+			if lastDay, ok = weekdayNames[last]; !ok {
+				return window, fmt.Errorf("invalid day %q: must be one of mon, tue, wed, thu, fri, sat, sun", last)
+			}
+		}
+		// Ranges may wrap around the week (e.g. fri-mon)
+		for day := firstDay; ; day = (day + 1) % 7 {
+			window.Days[day] = true
+			if day == lastDay {
+				break
+			}
+		}
+	}
+
+	return window, nil
+}
+
+// parseTimeOfDay parses a "HH:MM" time of day, "24:00" being the end of the day
+func parseTimeOfDay(value string) (time.Duration, error) {
+	hours, minutes, found := strings.Cut(strings.TrimSpace(value), ":")
+	h, hoursErr := strconv.Atoi(hours)
+	m, minutesErr := strconv.Atoi(minutes)
+	if !found || hoursErr != nil || minutesErr != nil || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time of day %q: must be HH:MM", value)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// IsOpen checks whether encodes may run at the given time
+func (s Schedule) IsOpen(t time.Time) bool {
+	if len(s.Windows) == 0 {
+		return true
+	}
+	for _, window := range s.Windows {
+		if window.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextChange returns the first instant after t at which a window opens or closes, zero when there is no window
+func (s Schedule) NextChange(t time.Time) time.Time {
+	var next time.Time
+
+	// Every window boundary happens within a week, starting from the day before covers the windows running past midnight
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	for offset := -1; offset <= 7; offset++ {
+		day := midnight.AddDate(0, 0, offset)
+		for _, window := range s.Windows {
+			if !window.Days[day.Weekday()] {
+				continue
+			}
+			end := window.End
+			if end < window.Start {
+				end += 24 * time.Hour
+			}
+			for _, boundary := range []time.Time{day.Add(window.Start), day.Add(end)} {
+				if boundary.After(t) && (next.IsZero() || boundary.Before(next)) {
+					next = boundary
+				}
+			}
+		}
+	}
+
+	return next
+}
+
+// contains checks whether the window is open at the given time
+func (w ScheduleWindow) contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	timeOfDay := t.Sub(midnight)
+
+	if w.Start < w.End {
+		return w.Days[t.Weekday()] && timeOfDay >= w.Start && timeOfDay < w.End
+	}
+
+	// Past midnight, the window belongs to the previous day
+	previousDay := (t.Weekday() + 6) % 7
+	return (w.Days[t.Weekday()] && timeOfDay >= w.Start) || (w.Days[previousDay] && timeOfDay < w.End)
+}
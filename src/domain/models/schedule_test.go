@@ -0,0 +1,110 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// at returns a time in the week from Monday 2024-01-01 to Sunday 2024-01-07
+func at(weekday time.Weekday, hour int, minute int) time.Time {
+	return time.Date(2024, 1, 1+(int(weekday)+6)%7, hour, minute, 0, 0, time.UTC)
+}
+
+func TestParseScheduleWindow(t *testing.T) {
+	tests := []struct {
+		name         string
+		days         string
+		start        string
+		end          string
+		expectedDays []time.Weekday
+		expectedErr  bool
+	}{
+		{name: "range", days: "mon-fri", start: "22:00", end: "06:00", expectedDays: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}},
+		{name: "list", days: "sat, sun", start: "00:00", end: "24:00", expectedDays: []time.Weekday{time.Saturday, time.Sunday}},
+		{name: "range around the week", days: "fri-mon", start: "08:00", end: "12:00", expectedDays: []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday}},
+		{name: "every day", days: "*", start: "01:00", end: "02:00", expectedDays: []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday}},
+		{name: "invalid day", days: "monday", start: "22:00", end: "06:00", expectedErr: true},
+		{name: "invalid time", days: "mon", start: "25:00", end: "06:00", expectedErr: true},
+		{name: "empty window", days: "mon", start: "06:00", end: "06:00", expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window, err := ParseScheduleWindow(tt.days, tt.start, tt.end)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("ParseScheduleWindow() error = %v, expectedErr %v", err, tt.expectedErr)
+			}
+			if tt.expectedErr {
+				return
+			}
+
+			var expected [7]bool
+			for _, day := range tt.expectedDays {
+				expected[day] = true
+			}
+			if window.Days != expected {
+				t.Errorf("ParseScheduleWindow() days = %v, expected %v", window.Days, expected)
+			}
+		})
+	}
+}
+
+func TestScheduleIsOpen(t *testing.T) {
+	nights, _ := ParseScheduleWindow("mon-fri", "22:00", "06:00")
+	weekend, _ := ParseScheduleWindow("sat-sun", "00:00", "24:00")
+	schedule := Schedule{Windows: []ScheduleWindow{nights, weekend}}
+
+	tests := []struct {
+		name     string
+		time     time.Time
+		expected bool
+	}{
+		{name: "weekday evening", time: at(time.Tuesday, 23, 0), expected: true},
+		{name: "weekday after midnight", time: at(time.Wednesday, 5, 59), expected: true},
+		{name: "weekday morning", time: at(time.Wednesday, 6, 0), expected: false},
+		{name: "weekday afternoon", time: at(time.Thursday, 15, 0), expected: false},
+		{name: "monday after midnight belongs to sunday", time: at(time.Monday, 3, 0), expected: false},
+		{name: "saturday after friday night", time: at(time.Saturday, 12, 0), expected: true},
+		{name: "window start", time: at(time.Monday, 22, 0), expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schedule.IsOpen(tt.time); got != tt.expected {
+				t.Errorf("IsOpen(%s) = %v, expected %v", tt.time.Format("Mon 15:04"), got, tt.expected)
+			}
+		})
+	}
+
+	if !(Schedule{}).IsOpen(at(time.Monday, 12, 0)) {
+		t.Errorf("IsOpen() = false, expected a schedule without windows to be always open")
+	}
+}
+
+func TestScheduleNextChange(t *testing.T) {
+	nights, _ := ParseScheduleWindow("mon-fri", "22:00", "06:00")
+	schedule := Schedule{Windows: []ScheduleWindow{nights}}
+
+	tests := []struct {
+		name     string
+		time     time.Time
+		expected time.Time
+	}{
+		{name: "opens in the evening", time: at(time.Tuesday, 12, 0), expected: at(time.Tuesday, 22, 0)},
+		{name: "closes in the morning", time: at(time.Tuesday, 23, 0), expected: at(time.Wednesday, 6, 0)},
+		{name: "saturday morning after friday night", time: at(time.Saturday, 5, 0), expected: at(time.Saturday, 6, 0)},
+		{name: "opens after the weekend", time: at(time.Saturday, 7, 0), expected: at(time.Monday, 22, 0).AddDate(0, 0, 7)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schedule.NextChange(tt.time); !got.Equal(tt.expected) {
+				t.Errorf("NextChange(%s) = %s, expected %s", tt.time.Format("Mon 15:04"), got.Format("Mon 15:04"), tt.expected.Format("Mon 15:04"))
+			}
+		})
+	}
+
+	if got := (Schedule{}).NextChange(at(time.Monday, 12, 0)); !got.IsZero() {
+		t.Errorf("NextChange() = %s, expected zero without windows", got)
+	}
+}
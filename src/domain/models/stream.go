@@ -2,8 +2,11 @@ package models
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 
 	"Theatrum/constants"
+	"Theatrum/domain/utils"
 )
 
 type StreamType string
@@ -14,6 +17,15 @@ const (
 	// StreamTypeLive StreamType = "live"
 )
 
+// AfterEncoding is what happens to a source once it was successfully encoded
+type AfterEncoding string
+
+const (
+	AfterEncodingKeep   AfterEncoding = "keep"
+	AfterEncodingDelete AfterEncoding = "delete"
+	AfterEncodingMove   AfterEncoding = "move"
+)
+
 type Stream struct {
 	Type         StreamType
 	Path         string
@@ -21,10 +33,85 @@ type Stream struct {
 	Distribution Distribution
 
 	// Specific fields for video unencoded streams
-	VideoInputPath      string
-	DeleteAfterEncoding bool // If enabled, delete the source file after video encoding (default: false)
+	VideoInputPath       string
+	VideoExtensions      []string              // Accepted source file extensions (default: constants.ValidVideoExtensions)
+	AfterEncoding        AfterEncoding         // Keep, delete or move the source file after video encoding (default: keep)
+	ArchivePath          string                // Where sources are moved after their encode when AfterEncoding is move
+	QuarantinePath       string                // Where sources failing the pre-flight checks are moved (default: left in place)
+	DecodeCheckSeconds   int                   // Seconds decoded by the pre-flight check (default: constants.DefaultDecodeCheckSeconds)
+	ChunkedEncoding      ChunkedEncoding       // Split long sources into concurrently encoded chunks (default: disabled)
+	AutoLadder           AutoLadder            // Pick the quality bitrates from a complexity analysis of the source (default: disabled)
+	QualityReport        QualityReportSettings // Measure the objective quality of each encode (default: disabled)
+	MaxConcurrentEncodes int                   // Maximum number of jobs of the channel encoded at the same time (default: 0, no limit)
+	DeadLetterPath       string                // Where sources are moved once their encode failed for good (default: left in place)
+	Priority             int                   // Encode priority of the channel jobs, the highest first (default: 0)
+	Schedule             *Schedule             // Time windows of the channel encodes (default: nil, the application schedule applies)
+	Quota                Quota                 // Storage limit of the sources and outputs (default: none)
+	Retention            Retention             // When the encoded outputs are deleted (default: never)
+}
+
+// ChunkedEncoding represents the settings to encode long sources as concurrently encoded chunks
+type ChunkedEncoding struct {
+	// Number of chunks the source is split into (0 or 1 disables chunked encoding)
+	Chunks int
+	// Minimum source duration in seconds for the source to be split
+	MinDuration int
 }
 
 func (s *Stream) GetMasterPlaylistTemplatePath() string {
-	return fmt.Sprintf("%s/%s", s.Path, constants.MasterPlaylist)
-}
\ No newline at end of file
+	return fmt.Sprintf("%s/%s", s.OutputPath(), constants.MasterPlaylist)
+}
+
+// OutputPath returns the path template of the directory of an encode output. Each source of a video unencoded stream gets
+// its own directory: the stream path when it tells the sources apart (e.g. with {FILENAME_STEM}), else a directory named
+// after the source beneath it.
+func (s *Stream) OutputPath() string {
+	if s.Type != StreamTypeVideoUnEncoded || slices.ContainsFunc(constants.SourcePlaceholders, func(name string) bool {
+		return utils.HasPlaceholder(s.Path, name)
+	}) {
+		return s.Path
+	}
+	return s.Path + "/" + constants.PlaceholderBegin + constants.PlaceholderFilenameStem + constants.PlaceholderEnd
+}
+
+// OutputRoute returns the route template of the outputs of a channel: the channel name, followed for a video unencoded
+// stream by the placeholders of its output path the name lacks, so every output has its own URL
+func (s *Stream) OutputRoute(channelName string) string {
+	if s.Type != StreamTypeVideoUnEncoded {
+		return channelName
+	}
+
+	route := strings.TrimSuffix(channelName, "/")
+	placeholders, err := utils.ParsePlaceholders(s.OutputPath())
+	if err != nil {
+		return channelName
+	}
+	for _, placeholder := range placeholders {
+		// The quality is a segment of the routes of the variants
+		if placeholder.Name == "quality" || utils.HasPlaceholder(channelName, placeholder.Name) {
+			continue
+		}
+		spec := placeholder.Name
+		if placeholder.Constraint != "" {
+			spec += constants.PlaceholderConstraintSeparator + placeholder.Constraint
+		}
+		route += "/" + constants.PlaceholderBegin + spec + constants.PlaceholderEnd
+	}
+	return route
+}
+
+// GetDecodeCheckSeconds returns the number of seconds decoded by the pre-flight check
+func (s *Stream) GetDecodeCheckSeconds() int {
+	if s.DecodeCheckSeconds <= 0 {
+		return constants.DefaultDecodeCheckSeconds
+	}
+	return s.DecodeCheckSeconds
+}
+
+// GetVideoExtensions returns the source file extensions accepted by the stream
+func (s *Stream) GetVideoExtensions() []string {
+	if len(s.VideoExtensions) == 0 {
+		return constants.ValidVideoExtensions
+	}
+	return s.VideoExtensions
+}
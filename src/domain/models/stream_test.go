@@ -0,0 +1,54 @@
+package models
+
+import "testing"
+
+func TestStreamOutputPath(t *testing.T) {
+	tests := []struct {
+		name          string
+		stream        Stream
+		expectedPath  string
+		expectedRoute string
+	}{
+		{
+			name:          "encoded stream",
+			stream:        Stream{Type: StreamTypeVideoEncoded, Path: "live/{username}"},
+			expectedPath:  "live/{username}",
+			expectedRoute: "/live/{username}",
+		},
+		{
+			name:          "sources of an owner get their own directory",
+			stream:        Stream{Type: StreamTypeVideoUnEncoded, Path: "records/{username}"},
+			expectedPath:  "records/{username}/{FILENAME_STEM}",
+			expectedRoute: "/live/{username}/{FILENAME_STEM}",
+		},
+		{
+			name:          "path naming its sources",
+			stream:        Stream{Type: StreamTypeVideoUnEncoded, Path: "records/{username}/{FILENAME_STEM}"},
+			expectedPath:  "records/{username}/{FILENAME_STEM}",
+			expectedRoute: "/live/{username}/{FILENAME_STEM}",
+		},
+		{
+			name:          "path named after the content",
+			stream:        Stream{Type: StreamTypeVideoUnEncoded, Path: "records/{username}/{yyyy}/{hash8:[0-9a-f]+}"},
+			expectedPath:  "records/{username}/{yyyy}/{hash8:[0-9a-f]+}",
+			expectedRoute: "/live/{username}/{yyyy}/{hash8:[0-9a-f]+}",
+		},
+		{
+			name:          "path by date",
+			stream:        Stream{Type: StreamTypeVideoUnEncoded, Path: "records/{username}/{date}"},
+			expectedPath:  "records/{username}/{date}/{FILENAME_STEM}",
+			expectedRoute: "/live/{username}/{date}/{FILENAME_STEM}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.stream.OutputPath(); got != tt.expectedPath {
+				t.Errorf("OutputPath() = %q, expected %q", got, tt.expectedPath)
+			}
+			if got := tt.stream.OutputRoute("/live/{username}"); got != tt.expectedRoute {
+				t.Errorf("OutputRoute() = %q, expected %q", got, tt.expectedRoute)
+			}
+		})
+	}
+}
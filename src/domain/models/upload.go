@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Upload is a resumable upload of a source, written in chunks until its offset reaches its size
+type Upload struct {
+	ID string
+	// Token is the name of the upload token which created the upload, only it can resume the upload
+	Token   string
+	Channel string
+	// Vars are the placeholder values of the channel video_input_path
+	Vars map[string]string
+	// FileName is the name of the source in the input path
+	FileName string
+	Size     int64
+	// Offset is the number of bytes received
+	Offset    int64
+	CreatedAt time.Time
+	// UpdatedAt is when the last chunk was received
+	UpdatedAt time.Time
+}
+
+// Complete reports whether every byte of the upload was received
+func (u Upload) Complete() bool {
+	return u.Offset >= u.Size
+}
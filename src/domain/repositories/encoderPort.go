@@ -1,9 +1,38 @@
 package repositories
 
-import "Theatrum/domain/models"
+import (
+	"Theatrum/domain/models"
+	"context"
+)
 
 // EncoderPort defines the interface for video encoding operations
 type EncoderPort interface {
 	// EncodeVideo encodes a video file to multiple qualities using the specified distribution settings
-	EncodeVideo(inputPath string, outputPath string, qualities map[string]models.Quality, distribution models.Distribution) error
+	// The encode is stopped when the context is canceled
+	EncodeVideo(ctx context.Context, inputPath string, outputPath string, qualities map[string]models.Quality, distribution models.Distribution, options models.EncodeOptions) error
+
+	// ProbeVideo reads the container and stream properties of a video file
+	ProbeVideo(inputPath string) (models.MediaInfo, error)
+
+	// CheckDecode decodes the first seconds of a video file and fails on any decoding error
+	CheckDecode(inputPath string, seconds int) error
+
+	// AnalyzeComplexity encodes excerpts of a video file at a constant rate factor for each quality
+	// and returns the bitrate in bits per second each quality needed
+	AnalyzeComplexity(inputPath string, qualities map[string]models.Quality, crf int, sampleSeconds int) (map[string]int64, error)
+
+	// MeasureQuality compares an encoded variant playlist with the source scaled to the variant resolution,
+	// which is the one of the source for a passthrough quality
+	// VMAF is only measured when requested and supported by the encoder
+	MeasureQuality(sourcePath string, variantPath string, quality models.Quality, vmaf bool) (models.RenditionQuality, error)
+
+	// Version returns the version of the encoder
+	Version() (string, error)
+
+	// Suspend pauses the running encode of a job, identified by the JobID of its options
+	// The processes the job starts afterwards are paused as well, until the job is resumed
+	Suspend(jobID string) error
+
+	// Resume continues the suspended encode of a job, and forgets its suspension
+	Resume(jobID string) error
 } 
\ No newline at end of file
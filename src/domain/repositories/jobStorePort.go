@@ -0,0 +1,28 @@
+package repositories
+
+import (
+	"errors"
+
+	"Theatrum/domain/models"
+)
+
+// ErrJobNotFound is returned when no job has the requested ID
+var ErrJobNotFound = errors.New("job not found")
+
+// JobStorePort defines the interface for the persistence of encode jobs
+type JobStorePort interface {
+	// SaveJob creates or replaces a job
+	SaveJob(job models.EncodeJob) error
+
+	// GetJob returns the job with the given ID, or ErrJobNotFound
+	GetJob(id string) (models.EncodeJob, error)
+
+	// ListJobs returns every stored job, oldest first
+	ListJobs() ([]models.EncodeJob, error)
+
+	// DeleteJob removes a job, it does nothing if the job does not exist
+	DeleteJob(id string) error
+
+	// Close releases the store
+	Close() error
+}
@@ -0,0 +1,9 @@
+package repositories
+
+import "Theatrum/domain/models"
+
+// RetentionAuditPort defines the interface for the audit log of the outputs expired by the retention policies
+type RetentionAuditPort interface {
+	// Record appends an entry to the audit log
+	Record(entry models.RetentionAuditEntry) error
+}
@@ -1,22 +1,51 @@
 package repositories
 
+import (
+	"io"
+
+	"Theatrum/domain/models"
+)
+
 // StoragePort defines the interface for file storage operations
 type StoragePort interface {
 	// ReadFile reads the contents of a file at the given path
 	ReadFile(path string) ([]byte, error)
 
+	// OpenFile opens a file for reading with random access, for the range requests, and returns its size and modification time
+	// The file must be closed. A missing file, or a directory, is reported as fs.ErrNotExist.
+	OpenFile(path string) (io.ReadSeekCloser, models.FileInfo, error)
+
+	// ReadFileHeader reads at most size bytes from the beginning of a file at the given path
+	ReadFileHeader(path string, size int) ([]byte, error)
+
 	// WriteFile writes data to a file at the given path
 	WriteFile(path string, data []byte) error
 
 	// DeleteFile removes a file at the given path
 	DeleteFile(path string) error
 
+	// MoveFile moves a file to the destination path, creating the destination directories if needed
+	// The move is atomic: the file is never partially present at either path
+	MoveFile(sourcePath string, destinationPath string) error
+
 	// ListFiles returns a list of files matching the given glob pattern
 	ListFiles(pattern string) ([]string, error)
 
 	// GetFileSize returns the size of a file in bytes
 	GetFileSize(path string) (int64, error)
 
+	// StatFile returns the size and modification time of a file
+	StatFile(path string) (models.FileInfo, error)
+
+	// DeleteDirectory removes a directory and every file beneath it, it does nothing if the directory does not exist
+	DeleteDirectory(path string) error
+
+	// DirectorySize returns the total size in bytes of the files beneath a directory, 0 if it does not exist
+	DirectorySize(path string) (int64, error)
+
+	// HashFile returns the hex encoded SHA-256 of the contents of a file
+	HashFile(path string) (string, error)
+
 	// SearchFiles searches for files matching a pattern (file name or path), an optional list of extensions and returns both the file paths
 	// and extracted variables from the pattern placeholders
 	// Pattern rules:
@@ -24,4 +53,21 @@ type StoragePort interface {
 	//   * Pattern must start with a forward slash
 	//   * Pattern must not contain empty segments or path traversal attempts
 	SearchFiles(pattern string, extensions []string) ([]string, []map[string]string, error)
+
+	// FetchFile makes a file available on the local file system at its path, for the tools reading local files such as FFmpeg
+	// release removes the local copy of a remote storage, it does nothing for a local storage
+	FetchFile(path string) (release func(), err error)
+
+	// ImportFile moves a file of the local file system into the storage at the given path, creating the destination directories if needed
+	// The file only appears at the destination once fully stored
+	ImportFile(localPath string, path string) error
+
+	// StageDirectory creates an empty local directory of its own, where the files of a directory such as an encode output
+	// are written before being published. release removes the local directory with what is left in it.
+	StageDirectory() (localDir string, release func(), err error)
+
+	// PublishDirectory moves the files written beneath a local directory into the storage directory at the given path,
+	// replacing the files of the same name. The files of the subdirectories are stored first, so a master playlist
+	// only appears once its variants are stored.
+	PublishDirectory(localDir string, path string) error
 }
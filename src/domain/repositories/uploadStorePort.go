@@ -0,0 +1,33 @@
+package repositories
+
+import (
+	"errors"
+	"io"
+
+	"Theatrum/domain/models"
+)
+
+// ErrUploadNotFound is returned when no upload in progress has the requested ID
+var ErrUploadNotFound = errors.New("upload not found")
+
+// UploadStorePort defines the interface for the uploads in progress, kept on the local file system until they are complete
+type UploadStorePort interface {
+	// CreateUpload stores a new upload, with no data received
+	CreateUpload(upload models.Upload) error
+
+	// GetUpload returns the upload with the given ID, its offset being the number of bytes stored, or ErrUploadNotFound
+	GetUpload(id string) (models.Upload, error)
+
+	// ListUploads returns every upload in progress
+	ListUploads() ([]models.Upload, error)
+
+	// WriteUpload appends at most limit bytes of data to an upload, and returns the number of bytes stored
+	// The bytes received before an error are kept, so the upload can resume from them
+	WriteUpload(id string, data io.Reader, limit int64) (int64, error)
+
+	// UploadPath returns the path on the local file system of the data of an upload
+	UploadPath(id string) string
+
+	// DeleteUpload removes an upload and its data
+	DeleteUpload(id string) error
+}
@@ -0,0 +1,15 @@
+package repositories
+
+// WatcherPort defines the interface for notifications of changes in the storage
+type WatcherPort interface {
+	// Watch starts watching the directories matching a pattern, including the ones created afterwards
+	// The pattern follows the rules of StoragePort.SearchFiles
+	Watch(pattern string) error
+
+	// Events returns the paths of the files created, written or moved into the watched directories
+	// Events may be dropped when they are not consumed fast enough, a periodic rescan must not rely on them
+	Events() <-chan string
+
+	// Close stops watching
+	Close() error
+}
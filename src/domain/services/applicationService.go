@@ -3,30 +3,35 @@ package services
 import (
 	"Theatrum/constants"
 	"Theatrum/domain/models"
-	"Theatrum/domain/repositories"
 	"Theatrum/domain/utils"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"log"
-	"path"
+	"maps"
+	"slices"
 	"strings"
 )
 
+// ErrApiUnauthorized is returned when the API token of a request is missing or unknown
+var ErrApiUnauthorized = errors.New("invalid api token")
+
 // ApplicationService handles application-wide operations and configuration
 type ApplicationService struct {
 	application    *models.Application
 	server         *models.Server
 	channels       *map[string]models.Stream
-	storage        repositories.StoragePort
+	inventory      *InventoryService
 	templateService *PathTemplateService
 }
 
 // NewApplicationService creates a new instance of ApplicationService
-func NewApplicationService(application *models.Application, server *models.Server, channels *map[string]models.Stream, storage repositories.StoragePort, templateService *PathTemplateService) *ApplicationService {
+func NewApplicationService(application *models.Application, server *models.Server, channels *map[string]models.Stream, inventory *InventoryService, templateService *PathTemplateService) *ApplicationService {
 	applicationService := &ApplicationService{
 		application:    application,
 		server:        server,
 		channels:      channels,
-		storage:       storage,
+		inventory:     inventory,
 		templateService: templateService,
 	}
 	return applicationService
@@ -57,6 +62,25 @@ func (s *ApplicationService) GetChannel(channelId string) (models.Stream, error)
 	return channel, nil
 }
 
+// AuthenticateApi returns the API token matching the given secret
+func (s *ApplicationService) AuthenticateApi(secret string) (models.ApiToken, error) {
+	if secret == "" {
+		return models.ApiToken{}, ErrApiUnauthorized
+	}
+
+	// Every token is compared in constant time, so the comparisons do not leak the tokens
+	var matched *models.ApiToken
+	for _, token := range s.application.Api.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token.Token), []byte(secret)) == 1 {
+			matched = &token
+		}
+	}
+	if matched == nil {
+		return models.ApiToken{}, ErrApiUnauthorized
+	}
+	return *matched, nil
+}
+
 // GetAllStreamsPlaylist generates an M3U8 playlist containing all available streams
 func (s *ApplicationService) BuildAllStreamsPlaylist() (string, error) {
 	if !s.application.AllStreamsPlaylist.Enabled {
@@ -71,10 +95,10 @@ func (s *ApplicationService) BuildAllStreamsPlaylist() (string, error) {
 	playlist.WriteString("#EXT-X-VERSION:3\n")
 	playlist.WriteString("#EXT-X-STREAM-INF:BANDWIDTH=0\n")
 
-	// Search for the MasterPlaylist file for each streams
-	for index, stream := range *s.channels {
-		patternMasterPlaylist := path.Join(constants.VideoDir, stream.GetMasterPlaylistTemplatePath())
-		masterFiles, vars, err := s.storage.SearchFiles(patternMasterPlaylist, constants.ValidMasterPlaylistExtensions)
+	// List the master playlists of each stream from the inventory, in the order of the channels
+	for _, index := range slices.Sorted(maps.Keys(*s.channels)) {
+		stream := (*s.channels)[index]
+		masterFiles, vars, err := s.inventory.Files(index, InventoryMasterPlaylists)
 		if err != nil {
 			log.Printf("Error searching for videos in %s: %v", stream.Path, err)
 			continue
@@ -83,7 +107,7 @@ func (s *ApplicationService) BuildAllStreamsPlaylist() (string, error) {
 		// Search in the filename that there is a constant.MasterPlaylist
 		for i, _ := range masterFiles {
 			// Get the public path of the master playlist
-			channelPath, err := s.templateService.ReplacePlaceholders(index, vars[i])
+			channelPath, err := s.templateService.ReplacePlaceholders(stream.OutputRoute(index), vars[i])
 			if err != nil {
 				log.Printf("Error replacing placeholders: %v", err)
 				continue
@@ -92,7 +116,6 @@ func (s *ApplicationService) BuildAllStreamsPlaylist() (string, error) {
 			masterFilePublicPath := utils.JoinURL(s.application.PublicPath, channelPath, constants.MasterPlaylist)
 
 			// Add the master playlist to the playlist
-			log.Println("Adding master playlist:", masterFilePublicPath)
 			playlist.WriteString(fmt.Sprintf("%s\n", masterFilePublicPath))
 		}
 	}
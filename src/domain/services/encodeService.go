@@ -4,28 +4,221 @@ import (
 	"Theatrum/constants"
 	"Theatrum/domain/models"
 	"Theatrum/domain/repositories"
+	"Theatrum/domain/utils"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
 )
 
 type EncodeService struct {
 	encoderRepository repositories.EncoderPort
+	storage           repositories.StoragePort
 }
 
-func NewEncodeService(encoder repositories.EncoderPort) *EncodeService {
-	return &EncodeService{encoderRepository: encoder}
+func NewEncodeService(encoder repositories.EncoderPort, storage repositories.StoragePort) *EncodeService {
+	return &EncodeService{
+		encoderRepository: encoder,
+		storage:           storage,
+	}
 }
 
-func (s *EncodeService) EncodeStream(inputStoragePath string, outputStoragePath string, channel models.Stream) error {
+// EncodeStream encodes the source of a job into every quality of its channel, threads limits the FFmpeg threads of the encode (0 lets FFmpeg decide)
+// progress, when set, receives the fraction of the source encoded. The encode stops when the context is canceled.
+func (s *EncodeService) EncodeStream(ctx context.Context, job models.EncodeJob, threads int, progress func(fraction float64)) (models.EncodeResult, error) {
+	result := models.EncodeResult{}
+	inputStoragePath, outputStoragePath, channel := job.InputStoragePath, job.OutputStoragePath, job.Channel
+
 	if len(channel.Qualities) == 0 {
-		return fmt.Errorf("stream has no qualities defined for encoding (path: %s)", channel.Path)
+		return result, fmt.Errorf("stream has no qualities defined for encoding (path: %s)", channel.Path)
 	}
 
-	return s.encoderRepository.EncodeVideo(
+	// A partial encode only encodes some qualities, the others are kept from the previous encode
+	qualities := channel.Qualities
+	var keepRenditions []string
+	if job.Renditions != nil {
+		qualities = make(map[string]models.Quality, len(job.Renditions))
+		keepRenditions = []string{}
+		for name, quality := range channel.Qualities {
+			if slices.Contains(job.Renditions, name) {
+				qualities[name] = quality
+			} else {
+				keepRenditions = append(keepRenditions, name)
+			}
+		}
+	}
+
+	// FFmpeg reads and writes local files: the output is encoded in a directory of its own, published to the storage
+	// once complete. The directory is removed whatever the outcome of the encode.
+	release, err := s.storage.FetchFile(inputStoragePath)
+	if err != nil {
+		return result, fmt.Errorf("failed to fetch source: %w", err)
+	}
+	defer release()
+
+	localDir, releaseDir, err := s.storage.StageDirectory()
+	if err != nil {
+		return result, fmt.Errorf("failed to stage output: %w", err)
+	}
+	defer releaseDir()
+
+	outputDir := path.Dir(outputStoragePath)
+
+	options := s.buildOptions(inputStoragePath, qualities, channel.ChunkedEncoding)
+	options.Threads = threads
+	options.JobID = job.ID
+	options.Progress = progress
+	options.KeepRenditions = keepRenditions
+
+	// The encoder merges the kept qualities from the previous master playlist
+	if keepRenditions != nil {
+		previous, err := s.storage.ReadFile(path.Join(outputDir, constants.MasterPlaylist))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return result, fmt.Errorf("failed to read master playlist: %w", err)
+		}
+		options.PreviousMaster = string(previous)
+	}
+
+	if channel.AutoLadder.Enabled {
+		qualities, result.Ladder = s.buildLadder(inputStoragePath, qualities, channel.AutoLadder, options.Passthrough)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return result, fmt.Errorf("encode canceled: %w", err)
+	}
+
+	err = s.encoderRepository.EncodeVideo(
+		ctx,
 		inputStoragePath,
-		outputStoragePath,
-		channel.Qualities,
+		path.Join(localDir, constants.MasterPlaylist),
+		qualities,
 		channel.Distribution,
+		options,
 	)
+	if err != nil {
+		return result, err
+	}
+
+	// Every quality of the output is measured: the encoded ones before they are published, the kept ones in the output
+	if channel.QualityReport.Enabled {
+		result.QualityReport = s.measureQuality(inputStoragePath, channel.Qualities, channel.QualityReport, func(name string) string {
+			if _, encoded := qualities[name]; encoded {
+				return localDir
+			}
+			return outputDir
+		})
+	}
+
+	// The publish moves the staged files, the files of each variant are listed before
+	published := make(map[string][]string, len(qualities))
+	for name := range qualities {
+		entries, err := os.ReadDir(filepath.Join(filepath.FromSlash(localDir), name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to list variant %s: %w", name, err)
+		}
+		for _, entry := range entries {
+			published[name] = append(published[name], entry.Name())
+		}
+	}
+
+	if err := s.storage.PublishDirectory(localDir, outputDir); err != nil {
+		return result, fmt.Errorf("failed to publish output: %w", err)
+	}
+	s.removeStaleFiles(outputDir, published, job.RemovedRenditions)
+
+	// Store the chosen ladder and the quality report with the encode output
+	if result.Ladder != nil {
+		if err := s.writeJSON(path.Join(outputDir, constants.LadderFile), result.Ladder); err != nil {
+			return result, fmt.Errorf("failed to write ladder: %w", err)
+		}
+	}
+	if result.QualityReport != nil {
+		if err := s.writeJSON(path.Join(outputDir, constants.QualityReportFile), result.QualityReport); err != nil {
+			return result, fmt.Errorf("failed to write quality report: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// removeStaleFiles deletes what a previous encode left in the output directory: the variants of the removed qualities,
+// and the files of the encoded variants which were not published again, such as the segments beyond the new last one.
+// A failed deletion only leaves the file in place.
+func (s *EncodeService) removeStaleFiles(outputDir string, published map[string][]string, removedRenditions []string) {
+	for _, name := range removedRenditions {
+		variantDir := path.Join(outputDir, name)
+		if _, encoded := published[name]; encoded || path.Dir(variantDir) != outputDir {
+			continue
+		}
+		if err := s.storage.DeleteDirectory(variantDir); err != nil {
+			log.Printf("Error removing variant %s of %s: %v", name, outputDir, err)
+		}
+	}
+
+	for name, files := range published {
+		existing, err := s.storage.ListFiles(path.Join(outputDir, name, "*"))
+		if err != nil {
+			log.Printf("Error listing variant %s of %s: %v", name, outputDir, err)
+			continue
+		}
+		for _, file := range existing {
+			if slices.Contains(files, path.Base(file)) {
+				continue
+			}
+			if err := s.storage.DeleteFile(file); err != nil {
+				log.Printf("Error removing stale file %s: %v", file, err)
+			}
+		}
+	}
+}
+
+// SuspendJob pauses the running encode of a job
+func (s *EncodeService) SuspendJob(jobID string) error {
+	return s.encoderRepository.Suspend(jobID)
+}
+
+// ResumeJob continues the suspended encode of a job
+func (s *EncodeService) ResumeJob(jobID string) error {
+	return s.encoderRepository.Resume(jobID)
+}
+
+// measureQuality compares every encoded variant with the source, a failed measurement only leaves its quality out of the report
+// variantDir returns the directory holding the variant of a quality
+func (s *EncodeService) measureQuality(inputStoragePath string, qualities map[string]models.Quality, settings models.QualityReportSettings, variantDir func(name string) string) *models.QualityReport {
+	report := &models.QualityReport{
+		GeneratedAt: time.Now(),
+		Renditions:  []models.RenditionQuality{},
+	}
+
+	names := make([]string, 0, len(qualities))
+	for name := range qualities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		variantPath := path.Join(variantDir(name), name, constants.SubPlaylist)
+		rendition, err := s.encoderRepository.MeasureQuality(inputStoragePath, variantPath, qualities[name], settings.Vmaf)
+		if err != nil {
+			log.Printf("Error measuring quality %s of %s: %v", name, inputStoragePath, err)
+			continue
+		}
+		rendition.Quality = name
+		report.Renditions = append(report.Renditions, rendition)
+	}
+
+	return report
 }
 
 func (s *EncodeService) EncodeQuality(inputStoragePath string, outputStoragePath string, qualityName string, quality models.Quality, distribution models.Distribution) error {
@@ -39,9 +232,103 @@ func (s *EncodeService) EncodeQuality(inputStoragePath string, outputStoragePath
 	}
 
 	return s.encoderRepository.EncodeVideo(
+		context.Background(),
 		inputStoragePath,
 		outputStoragePath,
 		singleQuality,
 		distribution,
+		s.buildOptions(inputStoragePath, singleQuality, models.ChunkedEncoding{}),
 	)
 }
+
+// buildLadder analyzes the source complexity and returns a copy of the qualities with their bitrate picked
+// within their bounds. The configured bitrates are kept if the analysis fails.
+func (s *EncodeService) buildLadder(inputStoragePath string, qualities map[string]models.Quality, autoLadder models.AutoLadder, passthrough map[string]bool) (map[string]models.Quality, *models.Ladder) {
+	// Remuxed qualities are not encoded, so they do not need to be analyzed
+	analyzed := make(map[string]models.Quality)
+	for name, quality := range qualities {
+		if !passthrough[name] {
+			analyzed[name] = quality
+		}
+	}
+	if len(analyzed) == 0 {
+		return qualities, nil
+	}
+
+	measured, err := s.encoderRepository.AnalyzeComplexity(inputStoragePath, analyzed, autoLadder.Crf, autoLadder.SampleSeconds)
+	if err != nil {
+		log.Printf("Error analyzing complexity of %s, using configured bitrates: %v", inputStoragePath, err)
+		return qualities, nil
+	}
+
+	ladder := &models.Ladder{
+		Crf:        autoLadder.Crf,
+		AnalyzedAt: time.Now(),
+	}
+
+	result := make(map[string]models.Quality, len(qualities))
+	for name, quality := range qualities {
+		if bitrate, ok := measured[name]; ok {
+			quality.Bitrate = utils.FormatBitrate(quality.ClampBitrate(bitrate))
+			ladder.Renditions = append(ladder.Renditions, models.LadderRendition{
+				Quality:         name,
+				Width:           quality.Width,
+				Height:          quality.Height,
+				MeasuredBitrate: bitrate,
+				Bitrate:         quality.Bitrate,
+			})
+			log.Printf("Auto ladder picked %s for quality %s of %s (measured %s)", quality.Bitrate, name, inputStoragePath, utils.FormatBitrate(bitrate))
+		}
+		result[name] = quality
+	}
+
+	// Keep the ladder readable, from the smallest to the largest rendition
+	sort.Slice(ladder.Renditions, func(i, j int) bool {
+		return ladder.Renditions[i].Width*ladder.Renditions[i].Height < ladder.Renditions[j].Width*ladder.Renditions[j].Height
+	})
+
+	return result, ladder
+}
+
+// writeJSON stores a value as indented JSON
+func (s *EncodeService) writeJSON(storagePath string, value any) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.storage.WriteFile(storagePath, data)
+}
+
+// buildOptions decides which qualities can be remuxed from the source instead of being re-encoded,
+// and whether the source is long enough to be encoded in chunks
+func (s *EncodeService) buildOptions(inputStoragePath string, qualities map[string]models.Quality, chunked models.ChunkedEncoding) models.EncodeOptions {
+	options := models.EncodeOptions{Passthrough: make(map[string]bool)}
+
+	// Only probe the source when a quality allows passthrough or chunks are enabled
+	needsProbe := chunked.Chunks > 1
+	for _, quality := range qualities {
+		needsProbe = needsProbe || quality.Passthrough
+	}
+	if !needsProbe {
+		return options
+	}
+
+	media, err := s.encoderRepository.ProbeVideo(inputStoragePath)
+	if err != nil {
+		log.Printf("Error probing %s, passthrough and chunked encoding disabled: %v", inputStoragePath, err)
+		return options
+	}
+
+	if chunked.Chunks > 1 && media.Duration >= float64(chunked.MinDuration) {
+		options.Chunks = chunked.Chunks
+	}
+
+	for name, quality := range qualities {
+		if quality.AcceptsPassthrough(media) {
+			log.Printf("Source %s already matches quality %s, remuxing it without re-encoding", inputStoragePath, name)
+			options.Passthrough[name] = true
+		}
+	}
+
+	return options
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"testing"
+
+	"Theatrum/constants"
+	"Theatrum/domain/models"
+)
+
+func TestEncodeServiceBuildLadder(t *testing.T) {
+	qualities := map[string]models.Quality{
+		"360p":  {Width: 640, Height: 360, Bitrate: "800k", MinBitrate: "300k"},
+		"720p":  {Width: 1280, Height: 720, Bitrate: "2500k"},
+		"1080p": {Width: 1920, Height: 1080, Bitrate: "5000k", MaxBitrate: "6M", Passthrough: true},
+	}
+	autoLadder := models.AutoLadder{Enabled: true, Crf: 23, SampleSeconds: 30}
+
+	tests := []struct {
+		name               string
+		encoder            fakeEncoder
+		passthrough        map[string]bool
+		expectedBitrates   map[string]string
+		expectedRenditions []string
+	}{
+		{
+			name:               "measured bitrates clamped to the quality bounds",
+			encoder:            fakeEncoder{complexity: map[string]int64{"360p": 120000, "720p": 1800400, "1080p": 9000000}},
+			expectedBitrates:   map[string]string{"360p": "300k", "720p": "1801k", "1080p": "6000k"},
+			expectedRenditions: []string{"360p", "720p", "1080p"},
+		},
+		{
+			name:               "measured bitrate under a kilobit",
+			encoder:            fakeEncoder{complexity: map[string]int64{"720p": 400}},
+			expectedBitrates:   map[string]string{"360p": "800k", "720p": "1k", "1080p": "5000k"},
+			expectedRenditions: []string{"720p"},
+		},
+		{
+			name:               "passthrough qualities are not analyzed",
+			encoder:            fakeEncoder{complexity: map[string]int64{"360p": 500000, "720p": 1500000, "1080p": 3000000}},
+			passthrough:        map[string]bool{"1080p": true},
+			expectedBitrates:   map[string]string{"360p": "500k", "720p": "1500k", "1080p": "5000k"},
+			expectedRenditions: []string{"360p", "720p"},
+		},
+		{
+			name:             "failed analysis keeps the configured bitrates",
+			encoder:          fakeEncoder{complexityErr: errors.New("ffmpeg failed")},
+			expectedBitrates: map[string]string{"360p": "800k", "720p": "2500k", "1080p": "5000k"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewEncodeService(&tt.encoder, newTestStorage(t, nil))
+
+			result, ladder := service.buildLadder("movie.mp4", qualities, autoLadder, tt.passthrough)
+
+			for name, expected := range tt.expectedBitrates {
+				if got := result[name].Bitrate; got != expected {
+					t.Errorf("bitrate of %s = %s, expected %s", name, got, expected)
+				}
+			}
+			for name := range tt.passthrough {
+				if _, analyzed := tt.encoder.analyzed[name]; analyzed {
+					t.Errorf("passthrough quality %s was analyzed", name)
+				}
+			}
+
+			if tt.expectedRenditions == nil {
+				if ladder != nil {
+					t.Errorf("ladder = %+v, expected none", ladder)
+				}
+				return
+			}
+			if ladder == nil || len(ladder.Renditions) != len(tt.expectedRenditions) {
+				t.Fatalf("ladder = %+v, expected renditions %v", ladder, tt.expectedRenditions)
+			}
+			for i, rendition := range ladder.Renditions {
+				if rendition.Quality != tt.expectedRenditions[i] || rendition.Bitrate != result[rendition.Quality].Bitrate {
+					t.Errorf("rendition %d = %+v, expected %s at %s", i, rendition, tt.expectedRenditions[i], result[tt.expectedRenditions[i]].Bitrate)
+				}
+			}
+			if ladder.Crf != autoLadder.Crf {
+				t.Errorf("ladder CRF = %d, expected %d", ladder.Crf, autoLadder.Crf)
+			}
+		})
+	}
+}
+
+func TestEncodeServiceEncodeStream(t *testing.T) {
+	qualities := map[string]models.Quality{
+		"360p": {Width: 640, Height: 360, Bitrate: "800k"},
+		"720p": {Width: 1280, Height: 720, Bitrate: "2500k"},
+	}
+
+	tests := []struct {
+		name              string
+		renditions        []string
+		removedRenditions []string
+		encodeErr         error
+		expectedFiles     map[string]string
+		// expectedRemoved are the files of the previous encode deleted from the output
+		expectedRemoved  []string
+		expectedPrevious string
+	}{
+		{
+			name:            "encode published to the output directory",
+			expectedFiles:   map[string]string{"master.m3u8": "#EXTM3U", "360p/segment_000.ts": "360p", "720p/segment_000.ts": "720p", "1080p/segment_000.ts": "previous 1080p"},
+			expectedRemoved: []string{"720p/segment_001.ts"},
+		},
+		{
+			name:             "partial encode merged with the previous output",
+			renditions:       []string{"720p"},
+			expectedFiles:    map[string]string{"master.m3u8": "#EXTM3U", "360p/segment_000.ts": "previous 360p", "720p/segment_000.ts": "720p"},
+			expectedRemoved:  []string{"720p/segment_001.ts"},
+			expectedPrevious: "#EXTM3U previous",
+		},
+		{
+			name:              "re-encode without a removed quality",
+			renditions:        []string{"720p"},
+			removedRenditions: []string{"1080p"},
+			expectedFiles:     map[string]string{"master.m3u8": "#EXTM3U", "360p/segment_000.ts": "previous 360p", "720p/segment_000.ts": "720p"},
+			expectedRemoved:   []string{"720p/segment_001.ts", "1080p/segment_000.ts"},
+			expectedPrevious:  "#EXTM3U previous",
+		},
+		{
+			name:              "failed encode",
+			removedRenditions: []string{"1080p"},
+			encodeErr:         errors.New("encode failed"),
+			expectedFiles:     map[string]string{"master.m3u8": "#EXTM3U previous", "360p/segment_000.ts": "previous 360p", "720p/segment_000.ts": "previous 720p", "720p/segment_001.ts": "previous 720p", "1080p/segment_000.ts": "previous 1080p"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The output directory of a source is next to the ones of the other sources of its owner
+			storage := newTestStorage(t, map[string]string{
+				"raw/john/movie.mp4":                     "movie",
+				"records/john/movie/master.m3u8":         "#EXTM3U previous",
+				"records/john/movie/360p/segment_000.ts": "previous 360p",
+				"records/john/movie/720p/segment_000.ts": "previous 720p",
+				// The previous encode of 720p had one more segment, and 1080p was removed from the channel since
+				"records/john/movie/720p/segment_001.ts":  "previous 720p",
+				"records/john/movie/1080p/segment_000.ts": "previous 1080p",
+				"records/john/talk/master.m3u8":           "#EXTM3U talk",
+			})
+			encoder := &fakeEncoder{encodeErr: tt.encodeErr}
+			job := models.EncodeJob{
+				ID:                "job",
+				InputStoragePath:  path.Join(constants.VideoDir, "raw/john/movie.mp4"),
+				OutputStoragePath: path.Join(constants.VideoDir, "records/john/movie/master.m3u8"),
+				Channel:           models.Stream{Path: "records/{username}", Qualities: qualities},
+				Renditions:        tt.renditions,
+				RemovedRenditions: tt.removedRenditions,
+			}
+
+			_, err := NewEncodeService(encoder, storage).EncodeStream(context.Background(), job, 0, nil)
+			if !errors.Is(err, tt.encodeErr) {
+				t.Fatalf("EncodeStream() error = %v, expected %v", err, tt.encodeErr)
+			}
+
+			for file, expected := range tt.expectedFiles {
+				data, err := storage.ReadFile(path.Join(constants.VideoDir, "records/john/movie", file))
+				if err != nil || string(data) != expected {
+					t.Errorf("%s = %q (%v), expected %q", file, data, err, expected)
+				}
+			}
+			for _, file := range tt.expectedRemoved {
+				if _, err := storage.StatFile(path.Join(constants.VideoDir, "records/john/movie", file)); !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("%s error = %v, expected it removed", file, err)
+				}
+			}
+			if data, err := storage.ReadFile(path.Join(constants.VideoDir, "records/john/talk/master.m3u8")); err != nil || string(data) != "#EXTM3U talk" {
+				t.Errorf("output of another source = %q (%v), expected it unchanged", data, err)
+			}
+			if encoder.encodeOptions.PreviousMaster != tt.expectedPrevious {
+				t.Errorf("PreviousMaster = %q, expected %q", encoder.encodeOptions.PreviousMaster, tt.expectedPrevious)
+			}
+
+			// The staging directory of the encode is removed whatever its outcome
+			if entries, err := os.ReadDir(constants.EncodesDir); err != nil || len(entries) != 0 {
+				t.Errorf("encodes directory = %v (%v), expected it empty", entries, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"Theatrum/constants"
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+	"Theatrum/domain/utils"
+	"context"
+	"log"
+	"maps"
+	"path"
+	"slices"
+	"sync"
+	"time"
+)
+
+// InventoryKind is a kind of file kept in the inventory
+type InventoryKind string
+
+const (
+	// InventoryMasterPlaylists are the published master playlists of every channel
+	InventoryMasterPlaylists InventoryKind = "master_playlists"
+	// InventoryManifests are the encode manifests of the video unencoded channels
+	InventoryManifests InventoryKind = "manifests"
+	// InventorySources are the sources waiting in the input path of the video unencoded channels
+	InventorySources InventoryKind = "sources"
+)
+
+// InventoryService keeps in memory the files of every channel, so the playlists and the detection do not search the storage on every call.
+// A kind of files of a channel is searched in the storage on its first use, then kept up to date by the changes it is told about
+// and reconciled with the storage at every refresh.
+type InventoryService struct {
+	storage     repositories.StoragePort
+	mu          sync.RWMutex
+	collections map[inventoryKey]*inventoryCollection
+}
+
+type inventoryKey struct {
+	channel string
+	kind    InventoryKind
+}
+
+// inventoryCollection holds the files matching the search pattern of a kind of files of a channel
+type inventoryCollection struct {
+	search     string
+	extensions []string
+	pattern    *utils.PathPattern
+	built      bool
+	files      map[string]map[string]string // Placeholder values by path
+}
+
+func NewInventoryService(channels *map[string]models.Stream, storage repositories.StoragePort) *InventoryService {
+	s := &InventoryService{
+		storage:     storage,
+		collections: make(map[inventoryKey]*inventoryCollection),
+	}
+
+	for channelName, stream := range *channels {
+		s.addCollection(channelName, InventoryMasterPlaylists, path.Join(constants.VideoDir, stream.GetMasterPlaylistTemplatePath()), constants.ValidMasterPlaylistExtensions)
+		if stream.Type != models.StreamTypeVideoUnEncoded {
+			continue
+		}
+		s.addCollection(channelName, InventoryManifests, path.Join(constants.VideoDir, stream.OutputPath(), constants.ManifestFile), nil)
+		if stream.VideoInputPath != "" {
+			s.addCollection(channelName, InventorySources, path.Join(constants.VideoDir, stream.VideoInputPath), stream.GetVideoExtensions())
+		}
+	}
+
+	return s
+}
+
+func (s *InventoryService) addCollection(channelName string, kind InventoryKind, search string, extensions []string) {
+	pattern, err := utils.CompilePathPattern(search)
+	if err != nil {
+		log.Printf("Error compiling %s pattern of %s, they will not be listed: %v", kind, channelName, err)
+		return
+	}
+	s.collections[inventoryKey{channelName, kind}] = &inventoryCollection{
+		search:     search,
+		extensions: extensions,
+		pattern:    pattern,
+	}
+}
+
+// Files returns the files of a kind of a channel sorted by path, with the placeholder values extracted from their path
+func (s *InventoryService) Files(channelName string, kind InventoryKind) ([]string, []map[string]string, error) {
+	collection, err := s.collection(channelName, kind)
+	if collection == nil {
+		return nil, nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	files := slices.Sorted(maps.Keys(collection.files))
+	vars := make([]map[string]string, len(files))
+	for i, file := range files {
+		vars[i] = maps.Clone(collection.files[file])
+	}
+	return files, vars, nil
+}
+
+// Lookup returns the placeholder values of a file of a kind of a channel, and whether the file is in the inventory
+func (s *InventoryService) Lookup(channelName string, kind InventoryKind, file string) (map[string]string, bool, error) {
+	collection, err := s.collection(channelName, kind)
+	if collection == nil {
+		return nil, false, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	vars, found := collection.files[file]
+	return maps.Clone(vars), found, nil
+}
+
+// collection returns the collection of a kind of files of a channel, searched in the storage on its first use
+// nil is returned when the channel has no such files, or when the search failed
+func (s *InventoryService) collection(channelName string, kind InventoryKind) (*inventoryCollection, error) {
+	key := inventoryKey{channelName, kind}
+
+	s.mu.RLock()
+	collection, found := s.collections[key]
+	built := found && collection.built
+	s.mu.RUnlock()
+
+	if !found {
+		return nil, nil
+	}
+	if !built {
+		if err := s.refresh(key); err != nil {
+			return nil, err
+		}
+	}
+	return collection, nil
+}
+
+// Update checks the given files in the storage, and adds them to or removes them from the inventory
+// It is called with the files created, changed, moved or deleted, a nil inventory ignores them
+func (s *InventoryService) Update(files ...string) {
+	if s == nil {
+		return
+	}
+
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		_, err := s.storage.StatFile(file)
+		exists := err == nil
+
+		s.mu.Lock()
+		for _, collection := range s.collections {
+			// The collections not searched yet will find the file on their first use
+			if !collection.built {
+				continue
+			}
+			vars, matched := collection.pattern.Match(file, collection.extensions)
+			if matched && exists {
+				collection.files[file] = vars
+			} else {
+				delete(collection.files, file)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Refresh searches the storage again for the given kinds of files (every kind if none), to reconcile the inventory with the changes
+// it was not told about
+func (s *InventoryService) Refresh(kinds ...InventoryKind) {
+	s.mu.RLock()
+	keys := make([]inventoryKey, 0, len(s.collections))
+	for key := range s.collections {
+		if len(kinds) == 0 || slices.Contains(kinds, key.kind) {
+			keys = append(keys, key)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, key := range keys {
+		if err := s.refresh(key); err != nil {
+			log.Printf("Error refreshing %s of %s: %v", key.kind, key.channel, err)
+		}
+	}
+}
+
+// Reconcile refreshes the whole inventory at every interval until the context is canceled
+func (s *InventoryService) Reconcile(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Refresh()
+		}
+	}
+}
+
+// refresh searches the storage for the files of a collection and replaces its files
+func (s *InventoryService) refresh(key inventoryKey) error {
+	s.mu.RLock()
+	collection := s.collections[key]
+	s.mu.RUnlock()
+
+	found, vars, err := s.storage.SearchFiles(collection.search, collection.extensions)
+	if err != nil {
+		return err
+	}
+
+	files := make(map[string]map[string]string, len(found))
+	for i, file := range found {
+		files[file] = vars[i]
+	}
+
+	s.mu.Lock()
+	collection.files = files
+	collection.built = true
+	s.mu.Unlock()
+
+	log.Printf("Found %d %s for %s", len(files), key.kind, key.channel)
+	return nil
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"Theatrum/constants"
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+)
+
+// ManifestService records in a manifest what each encode output was produced from, so detection is idempotent
+type ManifestService struct {
+	storage repositories.StoragePort
+	encoder repositories.EncoderPort
+}
+
+func NewManifestService(storage repositories.StoragePort, encoder repositories.EncoderPort) *ManifestService {
+	return &ManifestService{
+		storage: storage,
+		encoder: encoder,
+	}
+}
+
+// manifestPath returns the path of the manifest stored next to an encode output
+func manifestPath(outputStoragePath string) string {
+	return path.Join(path.Dir(outputStoragePath), constants.ManifestFile)
+}
+
+// ReadManifest reads the manifest of an encode output
+func (s *ManifestService) ReadManifest(outputStoragePath string) (models.EncodeManifest, error) {
+	var manifest models.EncodeManifest
+
+	data, err := s.storage.ReadFile(manifestPath(outputStoragePath))
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// NewManifest records the source and the channel ladder of a successful encode, to be saved once the source is
+// deleted or archived. A re-encode keeps the source and placeholder values recorded by the previous manifest.
+func (s *ManifestService) NewManifest(job models.EncodeJob) (models.EncodeManifest, error) {
+	ladderHash, err := job.Channel.LadderHash()
+	if err != nil {
+		return models.EncodeManifest{}, fmt.Errorf("failed to hash ladder: %w", err)
+	}
+
+	// The version is informative, a missing version does not prevent recording the encode
+	encoderVersion, err := s.encoder.Version()
+	if err != nil {
+		log.Printf("Error reading encoder version: %v", err)
+	}
+
+	manifest := models.EncodeManifest{
+		LadderHash:     ladderHash,
+		Renditions:     models.NewManifestRenditions(job.Channel.Qualities),
+		EncoderVersion: encoderVersion,
+		EncodedAt:      time.Now(),
+		Vars:           job.Vars,
+	}
+
+	if job.Reencode {
+		previous, err := s.ReadManifest(job.OutputStoragePath)
+		if err != nil {
+			return manifest, fmt.Errorf("failed to read previous manifest: %w", err)
+		}
+		manifest.Source = previous.Source
+		if previous.Vars != nil {
+			manifest.Vars = previous.Vars
+		}
+		return manifest, nil
+	}
+
+	info, err := s.storage.StatFile(job.InputStoragePath)
+	if err != nil {
+		return manifest, fmt.Errorf("failed to read source: %w", err)
+	}
+	manifest.Source = models.ManifestSource{
+		Name:    path.Base(job.InputStoragePath),
+		Slug:    job.Vars[constants.PlaceholderFilename],
+		Hash:    job.ContentHash,
+		Size:    info.Size,
+		ModTime: info.ModTime,
+	}
+	return manifest, nil
+}
+
+// SaveManifest writes the manifest next to the output of a job, recording where its source is kept (empty if it was deleted)
+func (s *ManifestService) SaveManifest(job models.EncodeJob, manifest models.EncodeManifest, sourceStoragePath string) error {
+	manifest.Source.Path = relativeStoragePath(sourceStoragePath)
+	return s.write(job.OutputStoragePath, manifest)
+}
+
+// SourcePath returns the storage path of the source kept after the encode recorded by a manifest, empty if it was deleted
+func (s *ManifestService) SourcePath(manifest models.EncodeManifest) string {
+	if manifest.Source.Path == "" {
+		return ""
+	}
+	return path.Join(constants.VideoDir, manifest.Source.Path)
+}
+
+// relativeStoragePath returns a storage path relative to the data directory, so the manifests stay valid if it moves
+func relativeStoragePath(storagePath string) string {
+	return strings.TrimPrefix(storagePath, constants.VideoDir+"/")
+}
+
+// IsUpToDate checks whether the output of a source was encoded from the same content with the current channel ladder
+// A source only touched keeps matching: its content hash is checked and its manifest refreshed, so it is not hashed again
+func (s *ManifestService) IsUpToDate(inputStoragePath string, outputStoragePath string, channel models.Stream) bool {
+	manifest, err := s.ReadManifest(outputStoragePath)
+	if err != nil {
+		return false
+	}
+
+	if manifest.Source.Name != path.Base(inputStoragePath) {
+		return false
+	}
+
+	ladderHash, err := channel.LadderHash()
+	if err != nil || manifest.LadderHash != ladderHash {
+		log.Printf("Ladder of %s changed since its last encode", inputStoragePath)
+		return false
+	}
+
+	info, err := s.storage.StatFile(inputStoragePath)
+	if err != nil || info.Size != manifest.Source.Size {
+		return false
+	}
+	if info.ModTime.Equal(manifest.Source.ModTime) {
+		return true
+	}
+
+	contentHash, err := s.storage.HashFile(inputStoragePath)
+	if err != nil || contentHash != manifest.Source.Hash {
+		return false
+	}
+
+	manifest.Source.ModTime = info.ModTime
+	if err := s.write(outputStoragePath, manifest); err != nil {
+		log.Printf("Error refreshing manifest of %s: %v", inputStoragePath, err)
+	}
+	return true
+}
+
+func (s *ManifestService) write(outputStoragePath string, manifest models.EncodeManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.storage.WriteFile(manifestPath(outputStoragePath), data)
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"Theatrum/constants"
+	"Theatrum/domain/models"
+)
+
+func TestManifestServiceSourcesOfOneOwner(t *testing.T) {
+	storage := newTestStorage(t, map[string]string{
+		"raw/john/first.mp4":  "first source",
+		"raw/john/second.mp4": "second source",
+	})
+	templateService := NewPathTemplateService()
+	manifestService := NewManifestService(storage, &fakeEncoder{})
+	stream := models.Stream{
+		Type:           models.StreamTypeVideoUnEncoded,
+		VideoInputPath: "raw/{username}",
+		Path:           "records/{username}",
+		Qualities:      map[string]models.Quality{"720p": {Width: 1280, Height: 720, Bitrate: "2500k"}},
+	}
+
+	// Both sources of the owner are encoded, each output records its own source
+	jobs := []models.EncodeJob{}
+	for _, name := range []string{"first.mp4", "second.mp4"} {
+		vars, err := templateService.SourceVars(map[string]string{"username": "john"}, name)
+		if err != nil {
+			t.Fatalf("SourceVars(%s) error = %v", name, err)
+		}
+		outputPath, err := templateService.OutputStoragePath(stream, vars)
+		if err != nil {
+			t.Fatalf("OutputStoragePath(%s) error = %v", name, err)
+		}
+		job := models.EncodeJob{
+			InputStoragePath:  path.Join(constants.VideoDir, "raw/john", name),
+			OutputStoragePath: outputPath,
+			Channel:           stream,
+			Vars:              vars,
+		}
+		if job.ContentHash, err = storage.HashFile(job.InputStoragePath); err != nil {
+			t.Fatal(err)
+		}
+		// The output directory is written by the encode
+		if err := os.MkdirAll(filepath.FromSlash(path.Dir(outputPath)), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		manifest, err := manifestService.NewManifest(job)
+		if err != nil {
+			t.Fatalf("NewManifest(%s) error = %v", name, err)
+		}
+		if err := manifestService.SaveManifest(job, manifest, job.InputStoragePath); err != nil {
+			t.Fatalf("SaveManifest(%s) error = %v", name, err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	if jobs[0].OutputStoragePath == jobs[1].OutputStoragePath {
+		t.Fatalf("both sources are encoded to %s", jobs[0].OutputStoragePath)
+	}
+	expected := path.Join(constants.VideoDir, "records/john/first", constants.MasterPlaylist)
+	if jobs[0].OutputStoragePath != expected {
+		t.Errorf("OutputStoragePath = %s, expected %s", jobs[0].OutputStoragePath, expected)
+	}
+
+	for _, job := range jobs {
+		manifest, err := manifestService.ReadManifest(job.OutputStoragePath)
+		if err != nil {
+			t.Fatalf("ReadManifest(%s) error = %v", job.OutputStoragePath, err)
+		}
+		if manifest.Source.Name != path.Base(job.InputStoragePath) {
+			t.Errorf("manifest of %s records source %s", job.InputStoragePath, manifest.Source.Name)
+		}
+		if !manifestService.IsUpToDate(job.InputStoragePath, job.OutputStoragePath, stream) {
+			t.Errorf("IsUpToDate(%s) = false, expected true", job.InputStoragePath)
+		}
+	}
+}
@@ -2,26 +2,21 @@ package services
 
 import (
 	"Theatrum/constants"
-	"errors"
+	"Theatrum/domain/models"
+	"Theatrum/domain/utils"
 	"fmt"
+	"maps"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
 )
 
-type PathTemplateService struct {
-	allowedChars *regexp.Regexp
-	noConsecutiveDots *regexp.Regexp
-}
+// PathTemplateService templates the paths, its values follow the path policy of utils.CheckPathValue
+type PathTemplateService struct{}
 
 func NewPathTemplateService() *PathTemplateService {
-	// Only allow alphanumeric characters, underscores, hyphens, and single dots (no consecutive dots)
-	allowedChars := regexp.MustCompile(`^[a-zA-Z0-9_\-\.]+$`)
-	noConsecutiveDots := regexp.MustCompile(`\.\.`) // TODO : improve + security test
-	return &PathTemplateService{
-		allowedChars: allowedChars,
-		noConsecutiveDots: noConsecutiveDots,
-	}
+	return &PathTemplateService{}
 }
 
 func (s *PathTemplateService) ExtractValues(template string, input string) (map[string]string, error) {
@@ -31,17 +26,23 @@ func (s *PathTemplateService) ExtractValues(template string, input string) (map[
 
 	// Find all {var} placeholders
 	varRegex := regexp.MustCompile(constants.PlaceholderRegex)
-	varNames := varRegex.FindAllStringSubmatch(template, -1)
+	varNames, err := utils.ParsePlaceholders(template)
+	if err != nil {
+		return nil, err
+	}
 
-	// Build regex pattern from template
-	pattern := regexp.QuoteMeta(template)
-	for _, match := range varNames {
-		placeholder := regexp.QuoteMeta(constants.PlaceholderBegin + match[1] + constants.PlaceholderEnd)
-		pattern = strings.Replace(pattern, placeholder, `([^/]+)`, 1)
+	// Build regex pattern from template, the values match the constraints of their placeholders
+	var pattern strings.Builder
+	last := 0
+	for i, index := range varRegex.FindAllStringIndex(template, -1) {
+		pattern.WriteString(regexp.QuoteMeta(template[last:index[0]]))
+		pattern.WriteString("(" + varNames[i].Pattern() + ")")
+		last = index[1]
 	}
+	pattern.WriteString(regexp.QuoteMeta(template[last:]))
 
 	// Compile regex
-	re, err := regexp.Compile("^" + pattern)
+	re, err := regexp.Compile("^" + pattern.String())
 	if err != nil {
 		return nil, fmt.Errorf("failed to compile regex: %w", err)
 	}
@@ -54,8 +55,11 @@ func (s *PathTemplateService) ExtractValues(template string, input string) (map[
 
 	// Map variable names to matched values
 	result := make(map[string]string)
-	for i, match := range varNames {
-		result[match[1]] = matches[i+1]
+	for i, placeholder := range varNames {
+		if !placeholder.Accepts(matches[i+1]) {
+			return nil, fmt.Errorf("input does not match template")
+		}
+		result[placeholder.Name] = matches[i+1]
 	}
 
 	// Extract filename from input path if it exists
@@ -75,14 +79,22 @@ func (s *PathTemplateService) ReplacePlaceholders(text string, vars map[string]s
 
 	var err error
 	result := re.ReplaceAllStringFunc(text, func(match string) string {
-		key := strings.Trim(match, constants.PlaceholderBegin+constants.PlaceholderEnd)
-		if val, ok := vars[key]; ok {
-			sanitized, sanitizeErr := s.sanitizeValue(val)
-			if sanitizeErr != nil {
-				err = sanitizeErr
+		placeholder, parseErr := utils.ParsePlaceholder(strings.Trim(match, constants.PlaceholderBegin+constants.PlaceholderEnd))
+		if parseErr != nil {
+			err = parseErr
+			return match
+		}
+		if val, ok := vars[placeholder.Name]; ok {
+			if checkErr := utils.CheckPathValue(val); checkErr != nil {
+				err = checkErr
 				return match // Leave placeholder as-is if error
 			}
-			return sanitized
+			// The value must satisfy the constraint of the placeholder, as in {id:int}
+			if !placeholder.Accepts(val) {
+				err = fmt.Errorf("value %q of placeholder %s does not match its constraint %s", val, placeholder.Name, placeholder.Constraint)
+				return match
+			}
+			return val
 		}
 		return match // Leave placeholder if no matching variable
 	})
@@ -95,12 +107,45 @@ func (s *PathTemplateService) ReplacePlaceholders(text string, vars map[string]s
 	return filepath.ToSlash(filepath.Clean(result)), nil
 }
 
-func (s *PathTemplateService) sanitizeValue(value string) (string, error) {
-	if !s.allowedChars.MatchString(value) {
-		return "", errors.New("invalid characters in value: only a-z, A-Z, 0-9, _, - and . are allowed")
+// SourceVars returns the placeholder values of a source with the ones of its file name: {FILENAME}, {FILENAME_STEM} and {EXT}.
+// The parts of the name with characters not accepted in the paths are slugified (e.g. "My Talk (2024).mp4" gives "My-Talk-2024.mp4"),
+// the accepted names are kept unchanged.
+func (s *PathTemplateService) SourceVars(vars map[string]string, fileName string) (map[string]string, error) {
+	extension := strings.TrimPrefix(path.Ext(fileName), ".")
+	stem := s.slugifyValue(strings.TrimSuffix(fileName, path.Ext(fileName)))
+	if stem == "" {
+		return nil, fmt.Errorf("file name %q has no character accepted in the paths", fileName)
 	}
-	if s.noConsecutiveDots.MatchString(value) {
-		return "", errors.New("consecutive dots are not allowed")
+
+	name := s.slugifyValue(fileName)
+	if name != fileName && extension != "" {
+		name = stem + "." + utils.Slugify(extension)
+	}
+
+	result := maps.Clone(vars)
+	if result == nil {
+		result = make(map[string]string)
+	}
+	result[constants.PlaceholderFilename] = name
+	result[constants.PlaceholderFilenameStem] = stem
+	result[constants.PlaceholderExt] = strings.ToLower(utils.Slugify(extension))
+	return result, nil
+}
+
+// OutputStoragePath returns the storage path of the master playlist of the output of a source, in the output directory of
+// the source templated with its placeholder values
+func (s *PathTemplateService) OutputStoragePath(stream models.Stream, vars map[string]string) (string, error) {
+	outputDir, err := s.ReplacePlaceholders(path.Join(constants.VideoDir, stream.OutputPath()), vars)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(outputDir, constants.MasterPlaylist), nil
+}
+
+// slugifyValue returns a value unchanged if it is accepted in the paths, else its slug
+func (s *PathTemplateService) slugifyValue(value string) string {
+	if err := utils.CheckPathValue(value); err == nil {
+		return value
 	}
-	return value, nil
+	return utils.Slugify(value)
 }
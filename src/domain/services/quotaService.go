@@ -0,0 +1,176 @@
+package services
+
+import (
+	"Theatrum/constants"
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+	"Theatrum/domain/utils"
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+)
+
+// ErrQuotaExceeded is returned (wrapped) when encoding a source would exceed the quota of its channel
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// QuotaService measures the storage used by the channels with a quota, and checks the encodes against it
+// The usage is the size of the sources, outputs and archived sources of the channel, or of a placeholder value
+type QuotaService struct {
+	appService *ApplicationService
+	storage    repositories.StoragePort
+	inventory  *InventoryService
+}
+
+func NewQuotaService(appService *ApplicationService, storage repositories.StoragePort, inventory *InventoryService) *QuotaService {
+	return &QuotaService{
+		appService: appService,
+		storage:    storage,
+		inventory:  inventory,
+	}
+}
+
+// EstimateSize returns the expected size in bytes of the encode output of a source lasting the given seconds,
+// from the video and audio bitrates of the stream qualities
+func (s *QuotaService) EstimateSize(stream models.Stream, duration float64) int64 {
+	var bitsPerSecond int64
+	for _, quality := range stream.Qualities {
+		for _, bitrate := range []string{quality.Bitrate, quality.Audio.Bitrate} {
+			if value, err := utils.ParseBitrate(bitrate); err == nil {
+				bitsPerSecond += value
+			}
+		}
+	}
+	return int64(float64(bitsPerSecond) * duration / 8)
+}
+
+// Usage returns the bytes used in the storage by the owner of the placeholder values, or by the whole channel
+// when its quota has no placeholder: its sources, the output directories of its encodes and its archived sources
+func (s *QuotaService) Usage(channelName string, stream models.Stream, vars map[string]string) (int64, error) {
+	owned := func(fileVars map[string]string) bool {
+		return stream.Quota.Placeholder == "" || fileVars[stream.Quota.Placeholder] == vars[stream.Quota.Placeholder]
+	}
+
+	sources, sourcesVars, err := s.inventory.Files(channelName, InventorySources)
+	if err != nil {
+		return 0, fmt.Errorf("error listing the sources of %s: %w", channelName, err)
+	}
+	if stream.AfterEncoding == models.AfterEncodingMove {
+		archived, archivedVars, err := s.storage.SearchFiles(path.Join(constants.VideoDir, stream.ArchivePath), stream.GetVideoExtensions())
+		if err != nil {
+			return 0, fmt.Errorf("error listing the archived sources of %s: %w", channelName, err)
+		}
+		sources, sourcesVars = append(sources, archived...), append(sourcesVars, archivedVars...)
+	}
+
+	var used int64
+	for i, source := range sources {
+		if !owned(sourcesVars[i]) {
+			continue
+		}
+		// A source removed since it was listed no longer counts
+		if info, err := s.storage.StatFile(source); err == nil {
+			used += info.Size
+		}
+	}
+
+	// Every encode has its own output directory, holding its manifest
+	manifests, manifestsVars, err := s.inventory.Files(channelName, InventoryManifests)
+	if err != nil {
+		return 0, fmt.Errorf("error listing the outputs of %s: %w", channelName, err)
+	}
+	for i, manifest := range manifests {
+		if !owned(manifestsVars[i]) {
+			continue
+		}
+		size, err := s.storage.DirectorySize(path.Dir(manifest))
+		if err != nil {
+			return 0, fmt.Errorf("error measuring %s: %w", path.Dir(manifest), err)
+		}
+		used += size
+	}
+
+	return used, nil
+}
+
+// Check returns an error wrapping ErrQuotaExceeded when adding the given bytes to the usage of the owner of the
+// placeholder values would exceed the quota of the stream. Streams without a quota always pass.
+func (s *QuotaService) Check(channelName string, stream models.Stream, vars map[string]string, additional int64) error {
+	if stream.Quota.MaxSize <= 0 {
+		return nil
+	}
+
+	used, err := s.Usage(channelName, stream, vars)
+	if err != nil {
+		return err
+	}
+	if used+additional <= stream.Quota.MaxSize {
+		return nil
+	}
+
+	owner := "the channel"
+	if stream.Quota.Placeholder != "" {
+		owner = stream.Quota.Placeholder + "=" + vars[stream.Quota.Placeholder]
+	}
+	return fmt.Errorf("%w: %s uses %s of %s, %s more needed", ErrQuotaExceeded,
+		owner, utils.FormatSize(used), utils.FormatSize(stream.Quota.MaxSize), utils.FormatSize(additional))
+}
+
+// Report returns the usage of every channel with a quota, by placeholder value when the quota has one
+// pending returns the estimated size of the queued and running encodes of a placeholder value of a channel
+func (s *QuotaService) Report(pending func(channelName string, placeholder string, value string) int64) ([]models.QuotaUsage, error) {
+	channels := *s.appService.GetChannels()
+
+	report := []models.QuotaUsage{}
+	for _, channelName := range slices.Sorted(maps.Keys(channels)) {
+		stream := channels[channelName]
+		if stream.Quota.MaxSize <= 0 {
+			continue
+		}
+
+		values, err := s.placeholderValues(channelName, stream.Quota.Placeholder)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, value := range values {
+			used, err := s.Usage(channelName, stream, map[string]string{stream.Quota.Placeholder: value})
+			if err != nil {
+				return nil, err
+			}
+			report = append(report, models.QuotaUsage{
+				Channel:     channelName,
+				Placeholder: stream.Quota.Placeholder,
+				Value:       value,
+				Used:        used,
+				Pending:     pending(channelName, stream.Quota.Placeholder, value),
+				MaxSize:     stream.Quota.MaxSize,
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// placeholderValues returns the values of a placeholder found in the sources and outputs of a channel, sorted
+// A single empty value stands for the whole channel when there is no placeholder
+func (s *QuotaService) placeholderValues(channelName string, placeholder string) ([]string, error) {
+	if placeholder == "" {
+		return []string{""}, nil
+	}
+
+	values := make(map[string]bool)
+	for _, kind := range []InventoryKind{InventorySources, InventoryMasterPlaylists, InventoryManifests} {
+		_, vars, err := s.inventory.Files(channelName, kind)
+		if err != nil {
+			return nil, err
+		}
+		for _, fileVars := range vars {
+			if value := fileVars[placeholder]; value != "" {
+				values[value] = true
+			}
+		}
+	}
+	return slices.Sorted(maps.Keys(values)), nil
+}
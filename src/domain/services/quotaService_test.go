@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"Theatrum/domain/models"
+)
+
+// newTestQuotaService returns the quota service of a channel with a quota by username, which archives its sources,
+// and of a channel sharing one quota whose input path starts with a placeholder. Other files lie next to theirs.
+func newTestQuotaService(t *testing.T, maxSize int64) (*QuotaService, map[string]models.Stream) {
+	t.Helper()
+
+	storage := newTestStorage(t, map[string]string{
+		"raw_videos/john/movie.mp4":            "12345",
+		"raw_videos/jane/talk.mp4":             "1234567",
+		"raw_videos/notes.mp4":                 "not a source",
+		"records/john/movie/manifest.json":     "{}",
+		"records/john/movie/720p/segment_0.ts": "0123456789",
+		"records/john/unfinished/master.m3u8":  "#EXTM3U",
+		"archive/john/old.mp4":                 "123",
+		"fr/keynote/intro.mp4":                 "1234",
+		"en/keynote/outro.mp4":                 "12",
+		"de/keynote/intro.mp4":                 "not a source",
+		"talks/fr/keynote/intro/manifest.json": "{}",
+	})
+	channels := map[string]models.Stream{
+		"/records/{username}": {
+			Type:           models.StreamTypeVideoUnEncoded,
+			VideoInputPath: "raw_videos/{username}",
+			Path:           "records/{username}",
+			AfterEncoding:  models.AfterEncodingMove,
+			ArchivePath:    "archive/{username}",
+			Quota:          models.Quota{MaxSize: maxSize, Placeholder: "username"},
+		},
+		"/talks/{lang}/{event}": {
+			Type:           models.StreamTypeVideoUnEncoded,
+			VideoInputPath: "{lang:en|fr}/{event}",
+			Path:           "talks/{lang:en|fr}/{event}",
+			Quota:          models.Quota{MaxSize: maxSize},
+		},
+		"/shows/{username}": {
+			Type:           models.StreamTypeVideoUnEncoded,
+			VideoInputPath: "raw_videos/{username}",
+			Path:           "shows/{username}",
+		},
+	}
+	templateService := NewPathTemplateService()
+	appService := NewApplicationService(&models.Application{}, &models.Server{}, &channels, nil, templateService)
+	return NewQuotaService(appService, storage, NewInventoryService(&channels, storage)), channels
+}
+
+func TestQuotaServiceUsage(t *testing.T) {
+	tests := []struct {
+		name     string
+		channel  string
+		vars     map[string]string
+		expected int64
+	}{
+		{name: "sources, outputs and archives of an owner", channel: "/records/{username}", vars: map[string]string{"username": "john"}, expected: 20},
+		{name: "sources of another owner", channel: "/records/{username}", vars: map[string]string{"username": "jane"}, expected: 7},
+		{name: "owner without files", channel: "/records/{username}", vars: map[string]string{"username": "mallory"}, expected: 0},
+		{name: "whole channel", channel: "/talks/{lang}/{event}", vars: map[string]string{"lang": "en"}, expected: 8},
+	}
+
+	quotaService, channels := newTestQuotaService(t, 100)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := quotaService.Usage(tt.channel, channels[tt.channel], tt.vars)
+			if err != nil {
+				t.Fatalf("Usage() error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Usage() = %d, expected %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestQuotaServiceCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		channel    string
+		maxSize    int64
+		additional int64
+		expected   error
+	}{
+		{name: "within the quota", channel: "/records/{username}", maxSize: 30, additional: 10},
+		{name: "over the quota", channel: "/records/{username}", maxSize: 30, additional: 11, expected: ErrQuotaExceeded},
+		{name: "over the quota of the channel", channel: "/talks/{lang}/{event}", maxSize: 10, additional: 3, expected: ErrQuotaExceeded},
+		{name: "without quota", channel: "/shows/{username}", maxSize: 30, additional: 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quotaService, channels := newTestQuotaService(t, tt.maxSize)
+			err := quotaService.Check(tt.channel, channels[tt.channel], map[string]string{"username": "john", "lang": "fr"}, tt.additional)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("Check() = %v, expected %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestQuotaServiceReport(t *testing.T) {
+	quotaService, _ := newTestQuotaService(t, 100)
+
+	report, err := quotaService.Report(func(channelName string, placeholder string, value string) int64 {
+		if value == "john" {
+			return 80
+		}
+		return 0
+	})
+	if err != nil {
+		t.Fatalf("Report() error: %v", err)
+	}
+
+	expected := []models.QuotaUsage{
+		{Channel: "/records/{username}", Placeholder: "username", Value: "jane", Used: 7, MaxSize: 100},
+		{Channel: "/records/{username}", Placeholder: "username", Value: "john", Used: 20, Pending: 80, MaxSize: 100},
+		{Channel: "/talks/{lang}/{event}", Used: 8, MaxSize: 100},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("Report() = %+v, expected %+v", report, expected)
+	}
+	if !report[1].Exceeded() || report[0].Exceeded() {
+		t.Errorf("Exceeded() = %v and %v, expected true for john only", report[1].Exceeded(), report[0].Exceeded())
+	}
+}
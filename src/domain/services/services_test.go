@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	fileAccessRepository "Theatrum/adapters/driven/fileAccess/repositories"
+	"Theatrum/constants"
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+)
+
+// newTestStorage returns the local storage of a temporary data directory, with the given files, and sets the data directory constant
+func newTestStorage(t testing.TB, files map[string]string) repositories.StoragePort {
+	t.Helper()
+
+	videoDir, encodesDir := constants.VideoDir, constants.EncodesDir
+	workDir := t.TempDir()
+	constants.VideoDir = filepath.ToSlash(filepath.Join(workDir, "data"))
+	constants.EncodesDir = filepath.ToSlash(filepath.Join(workDir, "encodes"))
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() {
+		constants.VideoDir, constants.EncodesDir = videoDir, encodesDir
+		log.SetOutput(os.Stderr)
+	})
+
+	storage, err := fileAccessRepository.NewFileAccess()
+	if err != nil {
+		t.Fatalf("NewFileAccess error: %v", err)
+	}
+	for file, content := range files {
+		localPath := filepath.Join(constants.VideoDir, file)
+		if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(localPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return storage
+}
+
+// fakeEncoder answers the probes, decode checks and analyses of the services tests, counting them
+// Its encodes write a master playlist and a segment of every quality, then fail with encodeErr when set
+type fakeEncoder struct {
+	encodeErr     error
+	encodeOptions models.EncodeOptions
+	media         models.MediaInfo
+	probeErr      error
+	decodeErr     error
+	complexity    map[string]int64 // Bitrates measured by the analysis by quality
+	complexityErr error
+	analyzed      map[string]models.Quality
+	probes        int
+	decodes       int
+}
+
+var _ repositories.EncoderPort = (*fakeEncoder)(nil)
+
+func (e *fakeEncoder) EncodeVideo(ctx context.Context, inputPath string, outputPath string, qualities map[string]models.Quality, distribution models.Distribution, options models.EncodeOptions) error {
+	e.encodeOptions = options
+	for name := range qualities {
+		variantDir := filepath.Join(filepath.Dir(outputPath), name)
+		if err := os.MkdirAll(variantDir, 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(variantDir, "segment_000.ts"), []byte(name), 0644); err != nil {
+			return err
+		}
+	}
+	if e.encodeErr != nil {
+		return e.encodeErr
+	}
+	return os.WriteFile(outputPath, []byte("#EXTM3U"), 0644)
+}
+
+func (e *fakeEncoder) ProbeVideo(inputPath string) (models.MediaInfo, error) {
+	e.probes++
+	return e.media, e.probeErr
+}
+
+func (e *fakeEncoder) CheckDecode(inputPath string, seconds int) error {
+	e.decodes++
+	return e.decodeErr
+}
+
+func (e *fakeEncoder) AnalyzeComplexity(inputPath string, qualities map[string]models.Quality, crf int, sampleSeconds int) (map[string]int64, error) {
+	e.analyzed = qualities
+	if e.complexityErr != nil {
+		return nil, e.complexityErr
+	}
+	measured := make(map[string]int64)
+	for name := range qualities {
+		if bitrate, ok := e.complexity[name]; ok {
+			measured[name] = bitrate
+		}
+	}
+	return measured, nil
+}
+
+func (e *fakeEncoder) MeasureQuality(sourcePath string, variantPath string, quality models.Quality, vmaf bool) (models.RenditionQuality, error) {
+	return models.RenditionQuality{}, nil
+}
+
+func (e *fakeEncoder) Version() (string, error) {
+	return "test", nil
+}
+
+func (e *fakeEncoder) Suspend(jobID string) error {
+	return nil
+}
+
+func (e *fakeEncoder) Resume(jobID string) error {
+	return nil
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"Theatrum/constants"
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+	"Theatrum/domain/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSource is returned (wrapped) when a source file must not be handed to the encoder
+var ErrInvalidSource = errors.New("invalid source")
+
+// SourceValidationService checks that source files really are videos before they are encoded
+type SourceValidationService struct {
+	storage repositories.StoragePort
+	encoder repositories.EncoderPort
+}
+
+func NewSourceValidationService(storage repositories.StoragePort, encoder repositories.EncoderPort) *SourceValidationService {
+	return &SourceValidationService{
+		storage: storage,
+		encoder: encoder,
+	}
+}
+
+// Validate runs the pre-flight checks on a source file: its magic bytes must match its extension, it must be
+// readable by the prober with a video stream and a positive duration, and its first seconds must decode cleanly
+// It returns the probed media information, or an error wrapping ErrInvalidSource with the rejection reason
+func (s *SourceValidationService) Validate(inputStoragePath string, decodeCheckSeconds int) (models.MediaInfo, error) {
+	header, err := s.storage.ReadFileHeader(inputStoragePath, utils.ContainerHeaderSize)
+	if err != nil {
+		return models.MediaInfo{}, fmt.Errorf("failed to read source header: %w", err)
+	}
+
+	// Only known extensions can be checked against their magic bytes, others rely on probing
+	extension := filepath.Ext(inputStoragePath)
+	if expected := utils.ContainerForExtension(extension); expected != "" {
+		detected := utils.SniffContainer(header)
+		if detected == "" {
+			return models.MediaInfo{}, fmt.Errorf("%w: content of %s file is not a recognized video container (corrupt file?)", ErrInvalidSource, extension)
+		}
+		if detected != expected {
+			return models.MediaInfo{}, fmt.Errorf("%w: %s file contains a %s container (renamed file?)", ErrInvalidSource, extension, detected)
+		}
+	}
+
+	// The prober reads local files
+	release, err := s.storage.FetchFile(inputStoragePath)
+	if err != nil {
+		return models.MediaInfo{}, fmt.Errorf("failed to fetch source: %w", err)
+	}
+	defer release()
+
+	media, err := s.encoder.ProbeVideo(inputStoragePath)
+	if err != nil {
+		return models.MediaInfo{}, fmt.Errorf("%w: probe failed: %v", ErrInvalidSource, err)
+	}
+
+	if media.Video == nil {
+		return models.MediaInfo{}, fmt.Errorf("%w: no video stream found", ErrInvalidSource)
+	}
+
+	if media.Duration <= 0 {
+		return models.MediaInfo{}, fmt.Errorf("%w: duration is not positive", ErrInvalidSource)
+	}
+
+	if err := s.encoder.CheckDecode(inputStoragePath, decodeCheckSeconds); err != nil {
+		return models.MediaInfo{}, fmt.Errorf("%w: %v", ErrInvalidSource, err)
+	}
+
+	return media, nil
+}
+
+// Quarantine moves a rejected source file into the quarantine directory and writes a JSON error report next to it
+// A quarantined file never replaces another one, a number is added before its extension instead
+// Without quarantine directory, the source is left in place with the report next to it, so it is not checked again until it changes
+// It returns where the source is
+func (s *SourceValidationService) Quarantine(inputStoragePath string, quarantineDir string, reason error) (string, error) {
+	info, err := s.storage.StatFile(inputStoragePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read source: %w", err)
+	}
+
+	report := models.QuarantineReport{
+		SourcePath:    inputStoragePath,
+		SourceSize:    info.Size,
+		SourceModTime: info.ModTime,
+		Reason:        reason.Error(),
+		QuarantinedAt: time.Now(),
+	}
+
+	quarantinedPath := inputStoragePath
+	if quarantineDir != "" {
+		quarantinedPath = s.freeQuarantinePath(path.Join(quarantineDir, path.Base(inputStoragePath)))
+		if err := s.storage.MoveFile(inputStoragePath, quarantinedPath); err != nil {
+			return "", fmt.Errorf("failed to move source to quarantine: %w", err)
+		}
+		report.QuarantinePath = quarantinedPath
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode quarantine report: %w", err)
+	}
+
+	if err := s.storage.WriteFile(quarantinedPath+constants.QuarantineReportSuffix, data); err != nil {
+		return "", fmt.Errorf("failed to write quarantine report: %w", err)
+	}
+
+	return quarantinedPath, nil
+}
+
+// freeQuarantinePath returns the quarantine path of a source, numbered if another quarantined file has its name
+func (s *SourceValidationService) freeQuarantinePath(quarantinedPath string) string {
+	extension := path.Ext(quarantinedPath)
+	candidate := quarantinedPath
+	for i := 1; ; i++ {
+		if _, err := s.storage.StatFile(candidate); err != nil {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s.%d%s", strings.TrimSuffix(quarantinedPath, extension), i, extension)
+	}
+}
+
+// IsRejected checks whether a source left in place was rejected in its current version, given by its size and modification time
+// The report of a previous version of the source is removed
+func (s *SourceValidationService) IsRejected(inputStoragePath string, info models.FileInfo) bool {
+	reportPath := inputStoragePath + constants.QuarantineReportSuffix
+	data, err := s.storage.ReadFile(reportPath)
+	if err != nil {
+		return false
+	}
+
+	var report models.QuarantineReport
+	if err := json.Unmarshal(data, &report); err == nil && report.Matches(info) {
+		return true
+	}
+
+	if err := s.storage.DeleteFile(reportPath); err != nil {
+		log.Printf("Error removing outdated quarantine report %s: %v", reportPath, err)
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"path"
+	"testing"
+
+	"Theatrum/constants"
+	"Theatrum/domain/models"
+)
+
+const (
+	mp4Header      = "\x00\x00\x00\x20ftypisom"
+	matroskaHeader = "\x1A\x45\xDF\xA3\x9F\x42\x86\x81"
+)
+
+func TestSourceValidationServiceValidate(t *testing.T) {
+	video := models.MediaInfo{Duration: 60, Video: &models.VideoStreamInfo{Codec: "h264", Width: 1920, Height: 1080}}
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		encoder fakeEncoder
+		invalid bool
+		probed  bool
+	}{
+		{name: "valid source", file: "movie.mp4", content: mp4Header, encoder: fakeEncoder{media: video}, probed: true},
+		{name: "unknown extension relies on probing", file: "movie.flv", content: "FLV", encoder: fakeEncoder{media: video}, probed: true},
+		{name: "renamed text file", file: "movie.mp4", content: "not a video", invalid: true},
+		{name: "renamed matroska", file: "movie.mp4", content: matroskaHeader, invalid: true},
+		{name: "probe failure", file: "movie.mkv", content: matroskaHeader, encoder: fakeEncoder{probeErr: errors.New("moov atom not found")}, invalid: true, probed: true},
+		{name: "no video stream", file: "movie.mp4", content: mp4Header, encoder: fakeEncoder{media: models.MediaInfo{Duration: 60}}, invalid: true, probed: true},
+		{name: "no duration", file: "movie.mp4", content: mp4Header, encoder: fakeEncoder{media: models.MediaInfo{Video: video.Video}}, invalid: true, probed: true},
+		{name: "decoding error", file: "movie.mp4", content: mp4Header, encoder: fakeEncoder{media: video, decodeErr: errors.New("invalid NAL unit size")}, invalid: true, probed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newTestStorage(t, map[string]string{tt.file: tt.content})
+			service := NewSourceValidationService(storage, &tt.encoder)
+
+			media, err := service.Validate(path.Join(constants.VideoDir, tt.file), 10)
+			if tt.invalid {
+				if !errors.Is(err, ErrInvalidSource) {
+					t.Errorf("Validate() error = %v, expected ErrInvalidSource", err)
+				}
+			} else if err != nil || media.Video == nil {
+				t.Errorf("Validate() = %v, %v, expected the probed media", media, err)
+			}
+			if probed := tt.encoder.probes > 0; probed != tt.probed {
+				t.Errorf("probed = %v, expected %v", probed, tt.probed)
+			}
+		})
+	}
+}
+
+func TestSourceValidationServiceQuarantine(t *testing.T) {
+	storage := newTestStorage(t, map[string]string{
+		"raw/john/movie.mp4":     "corrupt",
+		"quarantine/movie.mp4":   "quarantined before",
+		"quarantine/movie.1.mp4": "quarantined before too",
+	})
+	service := NewSourceValidationService(storage, &fakeEncoder{})
+	quarantineDir := path.Join(constants.VideoDir, "quarantine")
+	reason := errors.New("decoding failed")
+
+	// A quarantined file never replaces another one
+	source := path.Join(constants.VideoDir, "raw/john/movie.mp4")
+	quarantinedPath, err := service.Quarantine(source, quarantineDir, reason)
+	if err != nil {
+		t.Fatalf("Quarantine() error: %v", err)
+	}
+	if expected := path.Join(quarantineDir, "movie.2.mp4"); quarantinedPath != expected {
+		t.Errorf("Quarantine() = %s, expected %s", quarantinedPath, expected)
+	}
+	if content, err := storage.ReadFile(quarantinedPath); err != nil || string(content) != "corrupt" {
+		t.Errorf("quarantined file = %q, %v, expected the source", content, err)
+	}
+	for file, expected := range map[string]string{"movie.mp4": "quarantined before", "movie.1.mp4": "quarantined before too"} {
+		if content, err := storage.ReadFile(path.Join(quarantineDir, file)); err != nil || string(content) != expected {
+			t.Errorf("%s = %q, %v, expected it to be kept", file, content, err)
+		}
+	}
+	if _, err := storage.StatFile(source); err == nil {
+		t.Errorf("source %s was not moved", source)
+	}
+
+	data, err := storage.ReadFile(quarantinedPath + constants.QuarantineReportSuffix)
+	if err != nil {
+		t.Fatalf("quarantine report error: %v", err)
+	}
+	var report models.QuarantineReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("quarantine report error: %v", err)
+	}
+	if report.SourcePath != source || report.QuarantinePath != quarantinedPath || report.Reason != reason.Error() || report.SourceSize != int64(len("corrupt")) {
+		t.Errorf("quarantine report = %+v", report)
+	}
+}
+
+func TestSourceValidationServiceRejectInPlace(t *testing.T) {
+	storage := newTestStorage(t, map[string]string{"raw/john/movie.mp4": "corrupt"})
+	service := NewSourceValidationService(storage, &fakeEncoder{})
+	source := path.Join(constants.VideoDir, "raw/john/movie.mp4")
+
+	info, err := storage.StatFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service.IsRejected(source, info) {
+		t.Fatalf("IsRejected() = true before the source was rejected")
+	}
+
+	// Without quarantine directory, the source stays with its report next to it
+	quarantinedPath, err := service.Quarantine(source, "", errors.New("decoding failed"))
+	if err != nil || quarantinedPath != source {
+		t.Fatalf("Quarantine() = %s, %v, expected the source to stay in place", quarantinedPath, err)
+	}
+	if !service.IsRejected(source, info) {
+		t.Errorf("IsRejected() = false for the rejected source")
+	}
+
+	// A new version of the source is checked again, and the outdated report removed
+	if err := storage.WriteFile(source, []byte("fixed video")); err != nil {
+		t.Fatal(err)
+	}
+	if info, err = storage.StatFile(source); err != nil {
+		t.Fatal(err)
+	}
+	if service.IsRejected(source, info) {
+		t.Errorf("IsRejected() = true for a new version of the source")
+	}
+	if _, err := storage.StatFile(source + constants.QuarantineReportSuffix); err == nil {
+		t.Errorf("outdated quarantine report was not removed")
+	}
+}
@@ -3,20 +3,29 @@ package services
 import (
 	"Theatrum/constants"
 	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+	"Theatrum/domain/utils"
+	"io"
 	"path"
-	"strings"
 )
 
 type StreamService struct {
 	pathTemplateService *PathTemplateService
+	storage             repositories.StoragePort
 }
 
-func NewStreamService(pathTemplateService *PathTemplateService) *StreamService {
+func NewStreamService(pathTemplateService *PathTemplateService, storage repositories.StoragePort) *StreamService {
 	return &StreamService{
 		pathTemplateService: pathTemplateService,
+		storage:             storage,
 	}
 }
 
+// OpenResource opens a resource of a stream from the storage, the returned file must be closed
+func (s *StreamService) OpenResource(resourceStoragePath string) (io.ReadSeekCloser, models.FileInfo, error) {
+	return s.storage.OpenFile(resourceStoragePath)
+}
+
 func (s *StreamService) GetStreamStoragePath(stream *models.Stream, templatingVars map[string]string) (string, error) {
 	// If quality is not provided, use the default quality
 	if _, ok := templatingVars["quality"]; !ok {
@@ -24,8 +33,8 @@ func (s *StreamService) GetStreamStoragePath(stream *models.Stream, templatingVa
 	}
 
 	// If the path does not contain the quality placeholder, add it (except for master.m3u8)
-	streamStorageTemplate := stream.Path
-	if !strings.Contains(stream.Path, constants.PlaceholderBegin+"quality"+constants.PlaceholderEnd) && templatingVars["resource"] != constants.MasterPlaylist {
+	streamStorageTemplate := stream.OutputPath()
+	if !utils.HasPlaceholder(stream.Path, "quality") && templatingVars["resource"] != constants.MasterPlaylist {
 		streamStorageTemplate += "/" + templatingVars["quality"]
 	}
 
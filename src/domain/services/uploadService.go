@@ -0,0 +1,329 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"Theatrum/constants"
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+	"Theatrum/domain/utils"
+)
+
+var (
+	// ErrUploadUnauthorized is returned when the upload token is missing or unknown
+	ErrUploadUnauthorized = errors.New("invalid upload token")
+	// ErrUploadForbidden is returned when the upload token cannot upload to the channel
+	ErrUploadForbidden = errors.New("upload token not allowed for this channel")
+	// ErrInvalidUpload is returned when the upload does not tell its channel, file name or placeholder values
+	ErrInvalidUpload = errors.New("invalid upload")
+	// ErrUploadTooLarge is returned when the upload is larger than the maximum size, or than its announced size
+	ErrUploadTooLarge = errors.New("upload too large")
+	// ErrUploadOffsetMismatch is returned when a chunk does not start where the upload stopped
+	ErrUploadOffsetMismatch = errors.New("upload offset does not match the received bytes")
+	// ErrUploadLocked is returned when a chunk is sent while another chunk of the upload is being written
+	ErrUploadLocked = errors.New("upload is being written")
+)
+
+// UploadService receives the sources uploaded in chunks, and moves them to the input path of their channel once complete.
+// The uploads follow the tus resumable upload protocol, each is bound to the token which created it.
+type UploadService struct {
+	appService      *ApplicationService
+	templateService *PathTemplateService
+	storage         repositories.StoragePort
+	uploadStore     repositories.UploadStorePort
+	inventory       *InventoryService
+	quotaService    *QuotaService
+	mu              sync.Mutex
+	writing         map[string]bool // Uploads receiving a chunk by ID
+}
+
+func NewUploadService(
+	appService *ApplicationService,
+	templateService *PathTemplateService,
+	storage repositories.StoragePort,
+	uploadStore repositories.UploadStorePort,
+	inventory *InventoryService,
+	quotaService *QuotaService,
+) *UploadService {
+	return &UploadService{
+		appService:      appService,
+		templateService: templateService,
+		storage:         storage,
+		uploadStore:     uploadStore,
+		inventory:       inventory,
+		quotaService:    quotaService,
+		writing:         make(map[string]bool),
+	}
+}
+
+// Authenticate returns the upload token matching the given secret
+func (s *UploadService) Authenticate(secret string) (models.UploadToken, error) {
+	if secret == "" {
+		return models.UploadToken{}, ErrUploadUnauthorized
+	}
+
+	// Every token is compared in constant time, so the comparisons do not leak the tokens
+	var matched *models.UploadToken
+	for _, token := range s.appService.GetApplication().Uploads.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token.Token), []byte(secret)) == 1 {
+			matched = &token
+		}
+	}
+	if matched == nil {
+		return models.UploadToken{}, ErrUploadUnauthorized
+	}
+	return *matched, nil
+}
+
+// Create starts the upload of a source of the given size, described by its metadata: the channel, the file name,
+// and the placeholder values of the channel input path which the token does not fix
+func (s *UploadService) Create(token models.UploadToken, size int64, metadata map[string]string) (models.Upload, error) {
+	channelName := metadata["channel"]
+	stream, found := (*s.appService.GetChannels())[channelName]
+	if !found || stream.Type != models.StreamTypeVideoUnEncoded {
+		return models.Upload{}, fmt.Errorf("%w: no video unencoded channel '%s'", ErrInvalidUpload, channelName)
+	}
+	if !token.AllowsChannel(channelName) {
+		return models.Upload{}, fmt.Errorf("%w: %s", ErrUploadForbidden, channelName)
+	}
+
+	if maxSize := s.MaxSize(); maxSize > 0 && size > maxSize {
+		return models.Upload{}, fmt.Errorf("%w: %s is over the %s limit", ErrUploadTooLarge, utils.FormatSize(size), utils.FormatSize(maxSize))
+	}
+
+	fileName, err := uploadFileName(metadata, stream)
+	if err != nil {
+		return models.Upload{}, err
+	}
+
+	// The token values take precedence, so an owner cannot upload as another one
+	placeholders, err := utils.ParsePlaceholders(stream.VideoInputPath)
+	if err != nil {
+		return models.Upload{}, err
+	}
+	vars := make(map[string]string)
+	for _, placeholder := range placeholders {
+		value, fixed := token.Vars[placeholder.Name]
+		if !fixed {
+			value = metadata[placeholder.Name]
+		}
+		if value == "" {
+			return models.Upload{}, fmt.Errorf("%w: missing value of placeholder '%s'", ErrInvalidUpload, placeholder.Name)
+		}
+		vars[placeholder.Name] = value
+	}
+	if _, err := s.inputDir(stream, vars); err != nil {
+		return models.Upload{}, err
+	}
+
+	if err := s.quotaService.Check(channelName, stream, vars, size); err != nil {
+		return models.Upload{}, err
+	}
+
+	now := time.Now()
+	upload := models.Upload{
+		ID:        utils.NewID(),
+		Token:     token.Name,
+		Channel:   channelName,
+		Vars:      vars,
+		FileName:  fileName,
+		Size:      size,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.uploadStore.CreateUpload(upload); err != nil {
+		return models.Upload{}, fmt.Errorf("error creating upload: %w", err)
+	}
+
+	log.Printf("Upload %s of %s (%s) created by %s for %s", upload.ID, fileName, utils.FormatSize(size), token.Name, channelName)
+	return upload, nil
+}
+
+// Get returns an upload of the token, or repositories.ErrUploadNotFound
+func (s *UploadService) Get(token models.UploadToken, id string) (models.Upload, error) {
+	upload, err := s.uploadStore.GetUpload(id)
+	if err != nil {
+		return models.Upload{}, err
+	}
+	if upload.Token != token.Name {
+		return models.Upload{}, fmt.Errorf("%w: %s", repositories.ErrUploadNotFound, id)
+	}
+	return upload, nil
+}
+
+// Write appends a chunk starting at the given offset to an upload of the token
+// Once complete, the upload is moved to the input path of its channel and the path of the source is returned
+func (s *UploadService) Write(token models.UploadToken, id string, offset int64, data io.Reader) (models.Upload, string, error) {
+	if !s.lock(id) {
+		return models.Upload{}, "", fmt.Errorf("%w: %s", ErrUploadLocked, id)
+	}
+	defer s.unlock(id)
+
+	upload, err := s.Get(token, id)
+	if err != nil {
+		return upload, "", err
+	}
+	if offset != upload.Offset {
+		return upload, "", fmt.Errorf("%w: %d bytes received, chunk starts at %d", ErrUploadOffsetMismatch, upload.Offset, offset)
+	}
+
+	// The bytes received before a broken connection are kept, the client resumes after them
+	written, err := s.uploadStore.WriteUpload(id, data, upload.Size-upload.Offset)
+	upload.Offset += written
+	upload.UpdatedAt = time.Now()
+	if err != nil {
+		return upload, "", fmt.Errorf("error writing upload %s: %w", id, err)
+	}
+	if !upload.Complete() {
+		return upload, "", nil
+	}
+	if n, _ := data.Read(make([]byte, 1)); n > 0 {
+		return upload, "", fmt.Errorf("%w: more than the %d announced bytes", ErrUploadTooLarge, upload.Size)
+	}
+
+	source, err := s.finish(upload)
+	return upload, source, err
+}
+
+// Terminate cancels an upload of the token and removes its data
+func (s *UploadService) Terminate(token models.UploadToken, id string) error {
+	if !s.lock(id) {
+		return fmt.Errorf("%w: %s", ErrUploadLocked, id)
+	}
+	defer s.unlock(id)
+
+	if _, err := s.Get(token, id); err != nil {
+		return err
+	}
+
+	log.Printf("Upload %s terminated by %s", id, token.Name)
+	return s.uploadStore.DeleteUpload(id)
+}
+
+// MaxSize returns the largest source accepted in bytes, 0 for no limit
+func (s *UploadService) MaxSize() int64 {
+	return s.appService.GetApplication().Uploads.MaxSize
+}
+
+// ExpiresAt returns when an unfinished upload is removed if it does not progress
+func (s *UploadService) ExpiresAt(upload models.Upload) time.Time {
+	return upload.UpdatedAt.Add(s.appService.GetApplication().Uploads.ExpireAfter)
+}
+
+// Expire removes the unfinished uploads which did not progress for the expire after duration, at every such duration
+// until the context is canceled
+func (s *UploadService) Expire(ctx context.Context) {
+	ticker := time.NewTicker(s.appService.GetApplication().Uploads.ExpireAfter)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		uploads, err := s.uploadStore.ListUploads()
+		if err != nil {
+			log.Printf("Error listing uploads: %v", err)
+			continue
+		}
+		for _, upload := range uploads {
+			if time.Now().Before(s.ExpiresAt(upload)) || !s.lock(upload.ID) {
+				continue
+			}
+			if err := s.uploadStore.DeleteUpload(upload.ID); err != nil {
+				log.Printf("Error removing expired upload %s: %v", upload.ID, err)
+			} else {
+				log.Printf("Removed expired upload %s of %s (%d of %d bytes received)", upload.ID, upload.FileName, upload.Offset, upload.Size)
+			}
+			s.unlock(upload.ID)
+		}
+	}
+}
+
+// finish moves a complete upload to the input path of its channel, without replacing an existing source
+func (s *UploadService) finish(upload models.Upload) (string, error) {
+	stream, found := (*s.appService.GetChannels())[upload.Channel]
+	if !found {
+		return "", fmt.Errorf("%w: channel '%s' no longer exists", ErrInvalidUpload, upload.Channel)
+	}
+	inputDir, err := s.inputDir(stream, upload.Vars)
+	if err != nil {
+		return "", err
+	}
+
+	source := path.Join(inputDir, upload.FileName)
+	if _, err := s.storage.StatFile(source); err == nil {
+		extension := path.Ext(upload.FileName)
+		source = path.Join(inputDir, strings.TrimSuffix(upload.FileName, extension)+"-"+upload.ID+extension)
+	}
+
+	if err := s.storage.ImportFile(s.uploadStore.UploadPath(upload.ID), source); err != nil {
+		return "", fmt.Errorf("error moving upload %s to %s: %w", upload.ID, source, err)
+	}
+	if err := s.uploadStore.DeleteUpload(upload.ID); err != nil {
+		log.Printf("Error removing upload %s: %v", upload.ID, err)
+	}
+	s.inventory.Update(source)
+
+	log.Printf("Upload %s complete: %s", upload.ID, source)
+	return source, nil
+}
+
+// inputDir returns the input directory of a channel for the given placeholder values
+func (s *UploadService) inputDir(stream models.Stream, vars map[string]string) (string, error) {
+	inputDir, err := s.templateService.ReplacePlaceholders(path.Join(constants.VideoDir, stream.VideoInputPath), vars)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidUpload, err)
+	}
+	if strings.Contains(inputDir, constants.PlaceholderBegin) {
+		return "", fmt.Errorf("%w: missing placeholder values for %s", ErrInvalidUpload, stream.VideoInputPath)
+	}
+	return inputDir, nil
+}
+
+func (s *UploadService) lock(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writing[id] {
+		return false
+	}
+	s.writing[id] = true
+	return true
+}
+
+func (s *UploadService) unlock(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.writing, id)
+}
+
+// uploadFileName returns the file name given in the upload metadata, which must have an extension accepted by the channel
+func uploadFileName(metadata map[string]string, stream models.Stream) (string, error) {
+	fileName := metadata["filename"]
+	if fileName == "" {
+		fileName = metadata["name"]
+	}
+
+	if fileName == "" || strings.HasPrefix(fileName, ".") || strings.ContainsAny(fileName, `/\`) ||
+		strings.ContainsFunc(fileName, func(r rune) bool { return r < ' ' || r == 0x7f }) {
+		return "", fmt.Errorf("%w: invalid file name '%s'", ErrInvalidUpload, fileName)
+	}
+	if !slices.ContainsFunc(stream.GetVideoExtensions(), func(extension string) bool { return strings.EqualFold(extension, path.Ext(fileName)) }) {
+		return "", fmt.Errorf("%w: %s files are not accepted by the channel", ErrInvalidUpload, path.Ext(fileName))
+	}
+	return fileName, nil
+}
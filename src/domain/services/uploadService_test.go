@@ -0,0 +1,148 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	fileUploadStoreRepository "Theatrum/adapters/driven/fileUploadStore/repositories"
+	"Theatrum/constants"
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+)
+
+func TestUploadServiceWrite(t *testing.T) {
+	type chunk struct {
+		offset int64
+		data   string
+	}
+
+	tests := []struct {
+		name   string
+		file   string
+		chunks []chunk
+		// writer is the token sending the chunks, the one which created the upload when empty
+		writer         string
+		expectedErr    error
+		expectedOffset int64
+		// expectedSource is where the complete upload is moved, {id} standing for its ID
+		expectedSource string
+	}{
+		{
+			name:           "chunks in order",
+			file:           "movie.mp4",
+			chunks:         []chunk{{0, "01234"}, {5, "56789"}},
+			expectedOffset: 10,
+			expectedSource: "raw/john/movie.mp4",
+		},
+		{
+			name:           "source of the same name",
+			file:           "talk.mp4",
+			chunks:         []chunk{{0, "0123456789"}},
+			expectedOffset: 10,
+			expectedSource: "raw/john/talk-{id}.mp4",
+		},
+		{
+			name:           "chunk not starting at the offset",
+			file:           "movie.mp4",
+			chunks:         []chunk{{0, "01234"}, {4, "456789"}},
+			expectedErr:    ErrUploadOffsetMismatch,
+			expectedOffset: 5,
+		},
+		{
+			name:        "upload of another token",
+			file:        "movie.mp4",
+			chunks:      []chunk{{0, "0123456789"}},
+			writer:      "jane",
+			expectedErr: repositories.ErrUploadNotFound,
+		},
+		{
+			name:           "more than the announced bytes",
+			file:           "movie.mp4",
+			chunks:         []chunk{{0, "0123456789-and-more"}},
+			expectedErr:    ErrUploadTooLarge,
+			expectedOffset: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uploadService, uploadStore := newTestUploadService(t)
+			tokens := map[string]models.UploadToken{}
+			for _, token := range uploadService.appService.GetApplication().Uploads.Tokens {
+				tokens[token.Name] = token
+			}
+
+			upload, err := uploadService.Create(tokens["john"], 10, map[string]string{"channel": "/records/{username}", "filename": tt.file})
+			if err != nil {
+				t.Fatalf("Create() error: %v", err)
+			}
+
+			writer := tokens["john"]
+			if tt.writer != "" {
+				writer = tokens[tt.writer]
+			}
+			var source string
+			for _, chunk := range tt.chunks {
+				upload, source, err = uploadService.Write(writer, upload.ID, chunk.offset, strings.NewReader(chunk.data))
+				if err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Write() error = %v, expected %v", err, tt.expectedErr)
+			}
+			if upload.Offset != tt.expectedOffset {
+				t.Errorf("Offset = %d, expected %d", upload.Offset, tt.expectedOffset)
+			}
+
+			if tt.expectedSource == "" {
+				if source != "" {
+					t.Errorf("Write() source = %s, expected the upload not to be moved", source)
+				}
+				return
+			}
+			expectedSource := path.Join(constants.VideoDir, strings.ReplaceAll(tt.expectedSource, "{id}", upload.ID))
+			if source != expectedSource {
+				t.Errorf("Write() source = %s, expected %s", source, expectedSource)
+			}
+			if data, err := os.ReadFile(filepath.FromSlash(expectedSource)); err != nil || string(data) != "0123456789" {
+				t.Errorf("source = %q, %v, expected the uploaded bytes", data, err)
+			}
+			if _, err := uploadStore.GetUpload(upload.ID); !errors.Is(err, repositories.ErrUploadNotFound) {
+				t.Errorf("GetUpload() error = %v, expected the complete upload to be removed", err)
+			}
+		})
+	}
+}
+
+// newTestUploadService returns the upload service of a channel whose sources are kept by username, with the tokens
+// of john and jane. john already has a source named talk.mp4.
+func newTestUploadService(t *testing.T) (*UploadService, repositories.UploadStorePort) {
+	t.Helper()
+
+	storage := newTestStorage(t, map[string]string{"raw/john/talk.mp4": "talk"})
+	uploadStore := fileUploadStoreRepository.NewFileUploadStore(filepath.Join(t.TempDir(), "uploads"))
+
+	channels := map[string]models.Stream{
+		"/records/{username}": {
+			Type:           models.StreamTypeVideoUnEncoded,
+			VideoInputPath: "raw/{username}",
+			Path:           "records/{username}",
+		},
+	}
+	application := &models.Application{Uploads: models.Uploads{
+		Enabled: true,
+		Tokens: []models.UploadToken{
+			{Name: "john", Token: "john-0123456789", Vars: map[string]string{"username": "john"}},
+			{Name: "jane", Token: "jane-0123456789", Vars: map[string]string{"username": "jane"}},
+		},
+	}}
+	templateService := NewPathTemplateService()
+	appService := NewApplicationService(application, &models.Server{}, &channels, nil, templateService)
+	inventory := NewInventoryService(&channels, storage)
+	return NewUploadService(appService, templateService, storage, uploadStore, inventory, NewQuotaService(appService, storage, inventory)), uploadStore
+}
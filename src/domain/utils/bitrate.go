@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseBitrate converts a bitrate such as "800k", "2.5M" or "96000" to bits per second
+func ParseBitrate(bitrate string) (int64, error) {
+	value := strings.TrimSpace(bitrate)
+	multiplier := 1.0
+
+	switch {
+	case strings.HasSuffix(value, "k") || strings.HasSuffix(value, "K"):
+		multiplier = 1000
+	case strings.HasSuffix(value, "M") || strings.HasSuffix(value, "m"):
+		multiplier = 1000 * 1000
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid bitrate %q", bitrate)
+	}
+
+	return int64(number * multiplier), nil
+}
+
+// FormatBitrate converts bits per second to the kilobits notation used in the configuration (e.g. "800k")
+// The bitrate is rounded up, so it is never formatted lower than it is, and is at least "1k"
+func FormatBitrate(bitsPerSecond int64) string {
+	kilobits := (bitsPerSecond + 999) / 1000
+	if kilobits < 1 {
+		kilobits = 1
+	}
+	return fmt.Sprintf("%dk", kilobits)
+}
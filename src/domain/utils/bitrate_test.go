@@ -0,0 +1,54 @@
+package utils
+
+import "testing"
+
+func TestParseBitrate(t *testing.T) {
+	tests := []struct {
+		bitrate  string
+		expected int64
+		wantErr  bool
+	}{
+		{bitrate: "800k", expected: 800000},
+		{bitrate: "800K", expected: 800000},
+		{bitrate: "2.5M", expected: 2500000},
+		{bitrate: "96000", expected: 96000},
+		{bitrate: " 128k ", expected: 128000},
+		{bitrate: "", wantErr: true},
+		{bitrate: "k", wantErr: true},
+		{bitrate: "0k", wantErr: true},
+		{bitrate: "-800k", wantErr: true},
+		{bitrate: "fast", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.bitrate, func(t *testing.T) {
+			got, err := ParseBitrate(tt.bitrate)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBitrate(%q) error = %v, wantErr %v", tt.bitrate, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseBitrate(%q) = %d, expected %d", tt.bitrate, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFormatBitrate(t *testing.T) {
+	tests := []struct {
+		bitsPerSecond int64
+		expected      string
+	}{
+		{bitsPerSecond: 800000, expected: "800k"},
+		{bitsPerSecond: 2500000, expected: "2500k"},
+		{bitsPerSecond: 533334, expected: "534k"},
+		{bitsPerSecond: 999, expected: "1k"},
+		{bitsPerSecond: 1, expected: "1k"},
+		{bitsPerSecond: 0, expected: "1k"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatBitrate(tt.bitsPerSecond); got != tt.expected {
+			t.Errorf("FormatBitrate(%d) = %q, expected %q", tt.bitsPerSecond, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Container families recognized by their magic bytes
+const (
+	ContainerMp4      = "mp4" // ISO base media file format and QuickTime
+	ContainerMatroska = "matroska"
+	ContainerAvi      = "avi"
+	ContainerMpegTs   = "mpegts"
+)
+
+// ContainerHeaderSize is the number of leading bytes needed by SniffContainer
+const ContainerHeaderSize = 512
+
+// Packet sizes of MPEG transport streams, M2TS packets being prefixed with a 4 bytes timecode
+const (
+	mpegTsPacketSize = 188
+	m2tsPacketSize   = 192
+)
+
+// containerExtensions maps known video file extensions to their container family
+var containerExtensions = map[string]string{
+	".mp4":  ContainerMp4,
+	".m4v":  ContainerMp4,
+	".mov":  ContainerMp4,
+	".mkv":  ContainerMatroska,
+	".webm": ContainerMatroska,
+	".avi":  ContainerAvi,
+	".ts":   ContainerMpegTs,
+	".m2ts": ContainerMpegTs,
+	".mts":  ContainerMpegTs,
+}
+
+// quickTimeAtoms lists the top level atoms a QuickTime file may start with (older files have no "ftyp")
+var quickTimeAtoms = [][]byte{[]byte("ftyp"), []byte("moov"), []byte("mdat"), []byte("free"), []byte("wide"), []byte("skip"), []byte("pnot")}
+
+// ContainerForExtension returns the container family expected for a file extension, or "" if it is unknown
+func ContainerForExtension(extension string) string {
+	return containerExtensions[strings.ToLower(extension)]
+}
+
+// SniffContainer detects the container family of a file from its first bytes, or returns "" if it is not recognized
+func SniffContainer(header []byte) string {
+	switch {
+	case len(header) >= 8 && isQuickTimeAtom(header[4:8]):
+		return ContainerMp4
+	case bytes.HasPrefix(header, []byte{0x1A, 0x45, 0xDF, 0xA3}): // EBML header
+		return ContainerMatroska
+	case len(header) >= 12 && bytes.Equal(header[0:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("AVI ")):
+		return ContainerAvi
+	case isMpegTs(header):
+		return ContainerMpegTs
+	}
+	return ""
+}
+
+func isQuickTimeAtom(atom []byte) bool {
+	for _, candidate := range quickTimeAtoms {
+		if bytes.Equal(atom, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMpegTs checks the sync byte of the first packets, also accepting the 192 bytes packets of M2TS files and their 4 bytes timecode prefix
+func isMpegTs(header []byte) bool {
+	for _, layout := range []struct{ offset, stride int }{{0, mpegTsPacketSize}, {4, m2tsPacketSize}} {
+		packets := 0
+		for i := layout.offset; i < len(header) && header[i] == 0x47; i += layout.stride {
+			packets++
+		}
+		if packets >= 2 {
+			return true
+		}
+	}
+	return false
+}
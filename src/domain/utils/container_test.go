@@ -0,0 +1,103 @@
+package utils
+
+import "testing"
+
+func TestSniffContainer(t *testing.T) {
+	tsPackets := make([]byte, 2*mpegTsPacketSize)
+	tsPackets[0] = 0x47
+	tsPackets[mpegTsPacketSize] = 0x47
+
+	// M2TS packets have a 4 bytes timecode before the sync byte: sync bytes at 4, 196 and 388
+	m2tsPackets := make([]byte, ContainerHeaderSize)
+	for i := 4; i < len(m2tsPackets); i += m2tsPacketSize {
+		m2tsPackets[i] = 0x47
+	}
+
+	tests := []struct {
+		name     string
+		header   []byte
+		expected string
+	}{
+		{
+			name:     "mp4 with ftyp",
+			header:   append([]byte{0x00, 0x00, 0x00, 0x20}, []byte("ftypisom")...),
+			expected: ContainerMp4,
+		},
+		{
+			name:     "quicktime starting with moov",
+			header:   append([]byte{0x00, 0x00, 0x01, 0x00}, []byte("moov")...),
+			expected: ContainerMp4,
+		},
+		{
+			name:     "matroska",
+			header:   []byte{0x1A, 0x45, 0xDF, 0xA3, 0x9F, 0x42, 0x86, 0x81},
+			expected: ContainerMatroska,
+		},
+		{
+			name:     "avi",
+			header:   []byte("RIFF\x10\x00\x00\x00AVI LIST"),
+			expected: ContainerAvi,
+		},
+		{
+			name:     "mpeg transport stream",
+			header:   tsPackets,
+			expected: ContainerMpegTs,
+		},
+		{
+			name:     "m2ts",
+			header:   m2tsPackets,
+			expected: ContainerMpegTs,
+		},
+		{
+			name:     "wav is not a video",
+			header:   []byte("RIFF\x10\x00\x00\x00WAVEfmt "),
+			expected: "",
+		},
+		{
+			name:     "text file renamed to mp4",
+			header:   []byte("this is not a video at all"),
+			expected: "",
+		},
+		{
+			name:     "empty file",
+			header:   []byte{},
+			expected: "",
+		},
+		{
+			name:     "single sync byte",
+			header:   []byte{0x47},
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SniffContainer(tt.header); got != tt.expected {
+				t.Errorf("SniffContainer() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestContainerForExtension(t *testing.T) {
+	tests := []struct {
+		extension string
+		expected  string
+	}{
+		{".mp4", ContainerMp4},
+		{".MOV", ContainerMp4},
+		{".webm", ContainerMatroska},
+		{".avi", ContainerAvi},
+		{".ts", ContainerMpegTs},
+		{".MTS", ContainerMpegTs},
+		{".flv", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.extension, func(t *testing.T) {
+			if got := ContainerForExtension(tt.extension); got != tt.expected {
+				t.Errorf("ContainerForExtension(%q) = %q, expected %q", tt.extension, got, tt.expected)
+			}
+		})
+	}
+}
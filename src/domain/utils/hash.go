@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// HashJSON returns the hex encoded SHA-256 of the JSON encoding of a value
+// Map keys are sorted by the JSON encoding, so equal values always give the same hash
+func HashJSON(value any) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"Theatrum/constants"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// PathPattern matches file paths against a search pattern such as /data/{username}/{stream_name},
+// it is shared by the storages so they extract the same placeholders from their paths or keys
+type PathPattern struct {
+	re       *regexp.Regexp
+	varNames []string
+	root     string
+	maxDepth int
+	filename string // Last segment of the pattern when it names a file
+}
+
+// CompilePathPattern validates a search pattern and builds its matcher, see StoragePort.SearchFiles for the pattern rules
+func CompilePathPattern(pattern string) (*PathPattern, error) {
+	// Validate pattern to prevent path traversal
+	if err := CheckPathTemplate(pattern); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	p := &PathPattern{
+		// The max depth of the pattern is its number of segments
+		maxDepth: strings.Count(pattern, "/"),
+	}
+
+	var reBuilder strings.Builder
+	reBuilder.WriteString("^") // anchor at the start
+
+	// We'll also work out the longest literal prefix so we know where to
+	// start the search (huge speed-up on big trees).
+	var root strings.Builder
+
+	varAlreadyFound := false // This makes us able to manage a static dir name like "default" after a placeholder.
+	hasFilename := false     // Track if pattern ends with a filename
+
+	for i := 0; i < len(pattern); i++ {
+		ch := pattern[i]
+		switch {
+		case ch == constants.PlaceholderBegin[0]:
+			varAlreadyFound = true
+			// collect the var name and its constraint
+			j := strings.IndexByte(pattern[i+1:], constants.PlaceholderEnd[0])
+			if j == -1 {
+				return nil, fmt.Errorf("unclosed placeholder in pattern %q", pattern)
+			}
+			spec := pattern[i+1 : i+1+j]
+			if spec == "" {
+				return nil, fmt.Errorf("empty placeholder in pattern %q", pattern)
+			}
+			placeholder, err := ParsePlaceholder(spec)
+			if err != nil {
+				return nil, fmt.Errorf("invalid placeholder in pattern %q: %w", pattern, err)
+			}
+			reBuilder.WriteString("(" + placeholder.Pattern() + ")")
+			p.varNames = append(p.varNames, placeholder.Name)
+			i += j // skip over the variable text; the loop's i++ will land on the closing brace
+		case ch == constants.PlaceholderEnd[0]:
+			// Nothing extra; the regex group has already been written, we just need to skip over the closing brace
+		default:
+			reBuilder.WriteString(regexp.QuoteMeta(string(ch)))
+
+			if !varAlreadyFound {
+				root.WriteByte(ch) // only literals belong in the root
+			}
+
+			// Check if this is the last character and it's not a slash
+			if i == len(pattern)-1 && ch != '/' {
+				hasFilename = true
+			}
+		}
+	}
+
+	// Files sit beneath the matched directories, unless the pattern ends with a filename
+	if hasFilename {
+		reBuilder.WriteString("$")
+		p.filename = path.Base(pattern)
+	} else {
+		reBuilder.WriteString("/.+$")
+	}
+
+	re, err := regexp.Compile(reBuilder.String())
+	if err != nil {
+		return nil, fmt.Errorf("building regexp from pattern: %w", err)
+	}
+	p.re = re
+
+	p.root = path.Clean(root.String())
+	if p.root == "" || p.root == "." {
+		p.root = "/"
+	}
+
+	return p, nil
+}
+
+// Root returns the longest literal prefix of the pattern, where the search starts
+func (p *PathPattern) Root() string {
+	return p.root
+}
+
+// MaxDepth returns the number of segments of the pattern, deeper directories cannot hold a matching file
+func (p *PathPattern) MaxDepth() int {
+	return p.maxDepth
+}
+
+// Match reports whether a file path matches the pattern and one of the extensions (any extension when empty),
+// and returns the placeholders values extracted from the path, with the file name as FILENAME
+func (p *PathPattern) Match(filePath string, extensions []string) (map[string]string, bool) {
+	matches := p.re.FindStringSubmatch(filePath)
+	if len(matches) != len(p.varNames)+1 {
+		return nil, false
+	}
+
+	if p.filename != "" && path.Base(filePath) != p.filename {
+		return nil, false
+	}
+
+	// Extensions are compared case-insensitively
+	if len(extensions) > 0 {
+		pathExt := strings.ToLower(path.Ext(filePath))
+		validExt := false
+		for _, ext := range extensions {
+			if strings.ToLower(ext) == pathExt {
+				validExt = true
+				break
+			}
+		}
+		if !validExt {
+			return nil, false
+		}
+	}
+
+	vars := make(map[string]string, len(p.varNames)+1)
+	for i, name := range p.varNames {
+		// A regular expression constraint could match across the segments
+		if strings.Contains(matches[i+1], "/") {
+			return nil, false
+		}
+		vars[name] = matches[i+1]
+	}
+
+	if strings.Contains(filePath, "/") {
+		filename := path.Base(filePath)
+		if filename != "" && filename != "." && filename != "/" {
+			vars["FILENAME"] = filename
+		}
+	}
+
+	return vars, true
+}
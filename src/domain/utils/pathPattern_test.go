@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestPathPatternMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		pattern    string
+		path       string
+		extensions []string
+		expected   map[string]string
+	}{
+		{
+			name:     "file beneath a templated directory",
+			pattern:  "/data/{username}/{stream_name}",
+			path:     "/data/john/stream1/movie.mp4",
+			expected: map[string]string{"username": "john", "stream_name": "stream1", "FILENAME": "movie.mp4"},
+		},
+		{
+			name:       "extension compared case-insensitively",
+			pattern:    "/data/{username}",
+			path:       "/data/john/MOVIE.MKV",
+			extensions: []string{".mp4", ".mkv"},
+			expected:   map[string]string{"username": "john", "FILENAME": "MOVIE.MKV"},
+		},
+		{
+			name:       "other extension",
+			pattern:    "/data/{username}",
+			path:       "/data/john/notes.txt",
+			extensions: []string{".mp4"},
+		},
+		{
+			name:     "pattern naming a file",
+			pattern:  "/data/{username}/master.m3u8",
+			path:     "/data/john/master.m3u8",
+			expected: map[string]string{"username": "john", "FILENAME": "master.m3u8"},
+		},
+		{
+			name:    "other file than the named one",
+			pattern: "/data/{username}/master.m3u8",
+			path:    "/data/john/720p.m3u8",
+		},
+		{
+			name:     "constrained placeholders",
+			pattern:  "/data/{id:int}/{lang:en|fr|de}/{slug:[a-z0-9-]+}",
+			path:     "/data/42/fr/my-talk/movie.mp4",
+			expected: map[string]string{"id": "42", "lang": "fr", "slug": "my-talk", "FILENAME": "movie.mp4"},
+		},
+		{
+			name:    "value rejected by an int constraint",
+			pattern: "/data/{id:int}",
+			path:    "/data/john/movie.mp4",
+		},
+		{
+			name:    "value missing from a list constraint",
+			pattern: "/data/{lang:en|fr|de}",
+			path:    "/data/es/movie.mp4",
+		},
+		{
+			name:    "regular expression constraint matched across segments",
+			pattern: "/data/{slug:.+}/master.m3u8",
+			path:    "/data/john/720p/master.m3u8",
+		},
+		{
+			name:    "file outside the templated directories",
+			pattern: "/data/raw/{username}",
+			path:    "/data/encoded/john/movie.mp4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, err := CompilePathPattern(tt.pattern)
+			if err != nil {
+				t.Fatalf("CompilePathPattern(%q) error: %v", tt.pattern, err)
+			}
+
+			vars, matched := pattern.Match(tt.path, tt.extensions)
+			if matched != (tt.expected != nil) {
+				t.Fatalf("Match(%q) matched = %v, want %v", tt.path, matched, tt.expected != nil)
+			}
+			if matched && !maps.Equal(vars, tt.expected) {
+				t.Errorf("Match(%q) = %v, want %v", tt.path, vars, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCompilePathPatternRoot(t *testing.T) {
+	pattern, err := CompilePathPattern("/data/raw/{username}/{stream_name}")
+	if err != nil {
+		t.Fatalf("CompilePathPattern error: %v", err)
+	}
+	if pattern.Root() != "/data/raw" {
+		t.Errorf("Root() = %q, want %q", pattern.Root(), "/data/raw")
+	}
+
+	for _, invalid := range []string{"/data/../etc", "/data/*/videos", "/data/{}/videos", "/data/{user", "/data/{id:}", "/data/{slug:([a-z]+)}", "/data/{slug:[a-z}"} {
+		if _, err := CompilePathPattern(invalid); err == nil {
+			t.Errorf("CompilePathPattern(%q) expected an error", invalid)
+		}
+	}
+}
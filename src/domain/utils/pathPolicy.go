@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"Theatrum/constants"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// The path policy is shared by the configuration, the templating and the storages:
+//   - the path templates are segments separated by slashes, without "..", backslashes nor empty segments,
+//     and only their placeholders can hold regular expressions
+//   - the placeholder values are single segments of a-z, A-Z, 0-9, _, - and ., without ".."
+//   - the storage paths resolve inside their root directory
+
+// ErrUnsafePath is returned (wrapped) for the templates, values and paths rejected by the path policy
+var ErrUnsafePath = errors.New("unsafe path")
+
+var pathValueRegex = regexp.MustCompile(`^[a-zA-Z0-9_\-\.]+$`)
+
+// dangerousPathParts are rejected outside of the placeholders: encoded characters, home directories, pipes, redirections and globs
+var dangerousPathParts = []string{"%00", "%2e", "%2f", "%5c", "~", "|", ">", "<", "*", "?"}
+
+// CheckPathTemplate checks a path template, such as a search pattern of the storages, to prevent path traversal attacks
+func CheckPathTemplate(template string) error {
+	// Check for path traversal attempts
+	if strings.Contains(template, "..") {
+		return fmt.Errorf("%w: cannot contain '..' (path traversal attempt)", ErrUnsafePath)
+	}
+
+	// Check for backslash path traversal (Windows-style)
+	if strings.Contains(template, "\\") {
+		return fmt.Errorf("%w: cannot contain backslashes (use forward slashes)", ErrUnsafePath)
+	}
+
+	// Check for empty segments
+	segments := strings.Split(template, "/")
+	for i, segment := range segments {
+		if segment == "" && i > 0 { // Allow empty first segment for leading slash
+			return fmt.Errorf("%w: cannot contain empty segments", ErrUnsafePath)
+		}
+	}
+
+	// Check that all placeholders are properly formed, their constraints are regular expressions
+	if _, err := ParsePlaceholders(template); err != nil {
+		return fmt.Errorf("%w: %w", ErrUnsafePath, err)
+	}
+
+	// Check for nested placeholders
+	if strings.Contains(template, constants.PlaceholderBegin+constants.PlaceholderBegin) || strings.Contains(template, constants.PlaceholderEnd+constants.PlaceholderEnd) {
+		return fmt.Errorf("%w: nested placeholders are not allowed", ErrUnsafePath)
+	}
+
+	// Check for any other potentially dangerous characters, outside of the placeholders
+	literal := placeholderRegex.ReplaceAllString(template, constants.PlaceholderBegin+constants.PlaceholderEnd)
+	for _, part := range dangerousPathParts {
+		if strings.Contains(literal, part) {
+			return fmt.Errorf("%w: contains potentially dangerous character: %s", ErrUnsafePath, part)
+		}
+	}
+
+	return nil
+}
+
+// CheckRelativePathTemplate checks a path template relative to the data directory, as the paths of the streams
+func CheckRelativePathTemplate(template string) error {
+	if template == "" {
+		return fmt.Errorf("%w: cannot be empty", ErrUnsafePath)
+	}
+
+	// Check for absolute paths and Windows drive paths
+	if strings.HasPrefix(template, "/") || len(template) >= 2 && template[1] == ':' {
+		return fmt.Errorf("%w: should be a relative path, not absolute", ErrUnsafePath)
+	}
+
+	return CheckPathTemplate(template)
+}
+
+// CheckPathValue checks a value replacing a placeholder, which must stay a single segment of the templated path
+func CheckPathValue(value string) error {
+	if !pathValueRegex.MatchString(value) {
+		return fmt.Errorf("%w: invalid characters in value: only a-z, A-Z, 0-9, _, - and . are allowed", ErrUnsafePath)
+	}
+	if strings.Contains(value, "..") {
+		return fmt.Errorf("%w: consecutive dots are not allowed", ErrUnsafePath)
+	}
+	// The value would disappear from the cleaned path
+	if value == "." {
+		return fmt.Errorf("%w: a value cannot be a single dot", ErrUnsafePath)
+	}
+	return nil
+}
+
+// RelativeToRoot returns the path relative to a root directory of a path inside it, "." for the root itself
+func RelativeToRoot(root string, storagePath string) (string, error) {
+	cleanRoot := path.Clean(filepath.ToSlash(root))
+	cleanPath := path.Clean(filepath.ToSlash(storagePath))
+	if cleanPath == cleanRoot {
+		return ".", nil
+	}
+
+	prefix := strings.TrimSuffix(cleanRoot, "/") + "/"
+	if !strings.HasPrefix(cleanPath, prefix) {
+		return "", fmt.Errorf("%w: %s is outside of %s", ErrUnsafePath, storagePath, root)
+	}
+	return strings.TrimPrefix(cleanPath, prefix), nil
+}
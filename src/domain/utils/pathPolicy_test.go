@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckRelativePathTemplate(t *testing.T) {
+	tests := map[string]bool{
+		"encoded/{username}/{FILENAME_STEM}": true,
+		"talks/{lang:en|fr}/{slug:[a-z-]+}":  true,
+		"":                                   false,
+		"/encoded/{username}":                false,
+		"C:/videos":                          false,
+		"encoded/../etc":                     false,
+		"encoded\\{username}":                false,
+		"encoded//{username}":                false,
+		"encoded/{username}/":                false,
+		"encoded/~/videos":                   false,
+		"encoded/*/videos":                   false,
+		"encoded/a|b":                        false,
+		"encoded/%2e%2e":                     false,
+		"encoded/{{username}}":               false,
+		"encoded/{id:(x)}":                   false,
+		"encoded/{code:[a-z]{2,4}}":          false,
+	}
+
+	for template, valid := range tests {
+		err := CheckRelativePathTemplate(template)
+		if valid && err != nil {
+			t.Errorf("CheckRelativePathTemplate(%q) error: %v", template, err)
+		}
+		if !valid && !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("CheckRelativePathTemplate(%q) = %v, want ErrUnsafePath", template, err)
+		}
+	}
+}
+
+func TestCheckPathValue(t *testing.T) {
+	tests := map[string]bool{
+		"john":          true,
+		"movie.mp4":     true,
+		"My-Talk_2":     true,
+		"":              false,
+		".":             false,
+		"..":            false,
+		"a..b":          false,
+		"a/b":           false,
+		"a\\b":          false,
+		"My Talk":       false,
+		"{username}":    false,
+		"caf\u00e9":     false,
+		"movie.mp4\x00": false,
+	}
+
+	for value, valid := range tests {
+		if err := CheckPathValue(value); (err == nil) != valid {
+			t.Errorf("CheckPathValue(%q) = %v, want valid %v", value, err, valid)
+		}
+	}
+}
+
+func TestRelativeToRoot(t *testing.T) {
+	tests := []struct {
+		root     string
+		path     string
+		expected string
+		invalid  bool
+	}{
+		{root: "/srv/data", path: "/srv/data/raw/john/movie.mp4", expected: "raw/john/movie.mp4"},
+		{root: "/srv/data/", path: "/srv/data", expected: "."},
+		{root: "/srv/data", path: "/srv/data/raw/../encoded", expected: "encoded"},
+		{root: "/", path: "/srv/data", expected: "srv/data"},
+		{root: "/srv/data", path: "/srv/data/../etc/passwd", invalid: true},
+		{root: "/srv/data", path: "/srv/database/file", invalid: true},
+		{root: "/srv/data", path: "raw/john", invalid: true},
+	}
+
+	for _, tt := range tests {
+		relativePath, err := RelativeToRoot(tt.root, tt.path)
+		if tt.invalid {
+			if !errors.Is(err, ErrUnsafePath) {
+				t.Errorf("RelativeToRoot(%q, %q) = %q, %v, want ErrUnsafePath", tt.root, tt.path, relativePath, err)
+			}
+			continue
+		}
+		if err != nil || relativePath != tt.expected {
+			t.Errorf("RelativeToRoot(%q, %q) = %q, %v, want %q", tt.root, tt.path, relativePath, err, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"Theatrum/constants"
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	placeholderRegex       = regexp.MustCompile(constants.PlaceholderRegex)
+	placeholderNameRegex   = regexp.MustCompile(`^[a-zA-Z0-9_\-]+$`)
+	placeholderValuesRegex = regexp.MustCompile(`^[a-zA-Z0-9_\-\.]+(\|[a-zA-Z0-9_\-\.]+)+$`)
+)
+
+// Placeholder is a {name} of a path template, optionally constrained: {id:int} accepts digits, {lang:en|fr|de} one of
+// the listed values, and {slug:[a-z0-9-]+} the values matching a regular expression
+type Placeholder struct {
+	Name       string
+	Constraint string
+	pattern    string
+	re         *regexp.Regexp
+}
+
+// ParsePlaceholder parses the text between the braces of a placeholder
+func ParsePlaceholder(spec string) (Placeholder, error) {
+	name, constraint, constrained := strings.Cut(spec, constants.PlaceholderConstraintSeparator)
+	if !placeholderNameRegex.MatchString(name) {
+		return Placeholder{}, fmt.Errorf("invalid placeholder name %q: only a-z, A-Z, 0-9, _ and - are allowed", name)
+	}
+
+	p := Placeholder{Name: name, Constraint: constraint, pattern: `[^/]+`}
+	switch {
+	case !constrained:
+	case constraint == "":
+		return Placeholder{}, fmt.Errorf("placeholder %s has an empty constraint", name)
+	case constraint == constants.PlaceholderConstraintInt:
+		p.pattern = `[0-9]+`
+	case placeholderValuesRegex.MatchString(constraint):
+		values := strings.Split(constraint, "|")
+		for i, value := range values {
+			values[i] = regexp.QuoteMeta(value)
+		}
+		p.pattern = `(?:` + strings.Join(values, "|") + `)`
+	default:
+		// The values are single segments, and the groups of the constraint would shift the ones of the templates
+		if strings.Contains(constraint, "/") {
+			return Placeholder{}, fmt.Errorf("constraint of placeholder %s cannot contain '/'", name)
+		}
+		if strings.ContainsAny(constraint, constants.PlaceholderBegin+constants.PlaceholderEnd) {
+			return Placeholder{}, fmt.Errorf("constraint of placeholder %s cannot contain braces, repeat the pattern instead of a {n,m} quantifier", name)
+		}
+		re, err := regexp.Compile(constraint)
+		if err != nil {
+			return Placeholder{}, fmt.Errorf("invalid constraint of placeholder %s: %w", name, err)
+		}
+		if re.NumSubexp() > 0 {
+			return Placeholder{}, fmt.Errorf("constraint of placeholder %s cannot have capturing groups, use (?:...)", name)
+		}
+		p.pattern = `(?:` + constraint + `)`
+	}
+
+	p.re = regexp.MustCompile(`^` + p.pattern + `$`)
+	return p, nil
+}
+
+// Pattern returns the regular expression matching the values of the placeholder, without anchors nor capturing groups
+func (p Placeholder) Pattern() string {
+	return p.pattern
+}
+
+// Accepts reports whether a value is a single segment satisfying the constraint of the placeholder
+func (p Placeholder) Accepts(value string) bool {
+	return !strings.Contains(value, "/") && p.re.MatchString(value)
+}
+
+// Route returns the placeholder as a gorilla/mux route variable, with its constraint as a regular expression
+func (p Placeholder) Route() string {
+	if p.Constraint == "" {
+		return constants.PlaceholderBegin + p.Name + constants.PlaceholderEnd
+	}
+	return constants.PlaceholderBegin + p.Name + constants.PlaceholderConstraintSeparator + p.pattern + constants.PlaceholderEnd
+}
+
+// ParsePlaceholders returns the placeholders of a template, in their order
+func ParsePlaceholders(template string) ([]Placeholder, error) {
+	// A placeholder ends at its first closing brace: a constraint with braces, such as [a-z]{2,4}, would be split
+	// into a placeholder of another name and braces left outside of any placeholder
+	literal := placeholderRegex.ReplaceAllString(template, "")
+	if strings.ContainsAny(literal, constants.PlaceholderBegin+constants.PlaceholderEnd) {
+		return nil, fmt.Errorf("unbalanced braces in %q: placeholders cannot be nested, and their constraints cannot contain braces such as a {n,m} quantifier", template)
+	}
+
+	placeholders := []Placeholder{}
+	for _, match := range placeholderRegex.FindAllString(template, -1) {
+		placeholder, err := ParsePlaceholder(match[1 : len(match)-1])
+		if err != nil {
+			return nil, err
+		}
+		placeholders = append(placeholders, placeholder)
+	}
+	return placeholders, nil
+}
+
+// SegmentPlaceholder returns the placeholder making up a whole path segment, such as {username} or {id:int}
+func SegmentPlaceholder(segment string) (Placeholder, bool) {
+	if segment == "" || placeholderRegex.FindString(segment) != segment {
+		return Placeholder{}, false
+	}
+	placeholder, err := ParsePlaceholder(segment[1 : len(segment)-1])
+	return placeholder, err == nil
+}
+
+// HasPlaceholder reports whether a template has a placeholder of the given name, whatever its constraint
+func HasPlaceholder(template string, name string) bool {
+	for _, match := range placeholderRegex.FindAllString(template, -1) {
+		if placeholder, err := ParsePlaceholder(match[1 : len(match)-1]); err == nil && placeholder.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RouteTemplate returns a template as a gorilla/mux route template, so the routes only match the values accepted by the constraints
+func RouteTemplate(template string) (string, error) {
+	var err error
+	route := placeholderRegex.ReplaceAllStringFunc(template, func(match string) string {
+		placeholder, parseErr := ParsePlaceholder(match[1 : len(match)-1])
+		if parseErr != nil {
+			err = parseErr
+			return match
+		}
+		return placeholder.Route()
+	})
+	if err != nil {
+		return "", err
+	}
+	return route, nil
+}
+
+// ComputePlaceholders returns the placeholder values with the ones of the computed placeholders of a template they miss:
+// {date}, {yyyy} and {mm} from the given time, {uuid} drawn at random, and {hash8} from the content hash of the source,
+// which is only called when the template needs it
+func ComputePlaceholders(template string, vars map[string]string, now time.Time, contentHash func() (string, error)) (map[string]string, error) {
+	result := maps.Clone(vars)
+	if result == nil {
+		result = make(map[string]string)
+	}
+
+	placeholders, err := ParsePlaceholders(template)
+	if err != nil {
+		return nil, err
+	}
+	for _, placeholder := range placeholders {
+		if _, found := result[placeholder.Name]; found {
+			continue
+		}
+		switch placeholder.Name {
+		case constants.PlaceholderDate:
+			result[placeholder.Name] = now.Format(constants.DateLayout)
+		case constants.PlaceholderYear:
+			result[placeholder.Name] = now.Format("2006")
+		case constants.PlaceholderMonth:
+			result[placeholder.Name] = now.Format("01")
+		case constants.PlaceholderUUID:
+			result[placeholder.Name] = NewUUID()
+		case constants.PlaceholderHash8:
+			hash, err := contentHash()
+			if err != nil {
+				return nil, fmt.Errorf("error hashing source: %w", err)
+			}
+			if len(hash) < 8 {
+				return nil, fmt.Errorf("invalid source hash %q", hash)
+			}
+			result[placeholder.Name] = hash[:8]
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"errors"
+	"maps"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestParsePlaceholder(t *testing.T) {
+	tests := []struct {
+		spec     string
+		name     string
+		route    string
+		accepted []string
+		rejected []string
+		invalid  bool
+	}{
+		{spec: "username", name: "username", route: "{username}", accepted: []string{"john", "42"}, rejected: []string{"a/b"}},
+		{spec: "id:int", name: "id", route: "{id:[0-9]+}", accepted: []string{"42"}, rejected: []string{"john", "4a", ""}},
+		{spec: "lang:en|fr|de", name: "lang", route: "{lang:(?:en|fr|de)}", accepted: []string{"en", "de"}, rejected: []string{"es", "english"}},
+		{spec: "v:1.0|2.0", name: "v", route: "{v:(?:1\\.0|2\\.0)}", accepted: []string{"1.0"}, rejected: []string{"1x0"}},
+		{spec: "slug:[a-z0-9-]+", name: "slug", route: "{slug:(?:[a-z0-9-]+)}", accepted: []string{"my-talk"}, rejected: []string{"My-Talk"}},
+		{spec: "slug:.+", name: "slug", route: "{slug:(?:.+)}", accepted: []string{"a.b"}, rejected: []string{"a/b"}},
+		{spec: "", invalid: true},
+		{spec: "user name", invalid: true},
+		{spec: "id:", invalid: true},
+		{spec: "slug:[a-z", invalid: true},
+		{spec: "slug:([a-z]+)", invalid: true},
+		{spec: "path:[^/]+", invalid: true},
+		{spec: "code:[a-z]{2,4}", invalid: true},
+	}
+
+	for _, tt := range tests {
+		placeholder, err := ParsePlaceholder(tt.spec)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("ParsePlaceholder(%q) expected an error, got %+v", tt.spec, placeholder)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePlaceholder(%q) error: %v", tt.spec, err)
+			continue
+		}
+		if placeholder.Name != tt.name || placeholder.Route() != tt.route {
+			t.Errorf("ParsePlaceholder(%q) = %s, %s, want %s, %s", tt.spec, placeholder.Name, placeholder.Route(), tt.name, tt.route)
+		}
+		for _, value := range tt.accepted {
+			if !placeholder.Accepts(value) {
+				t.Errorf("%s does not accept %q", tt.spec, value)
+			}
+		}
+		for _, value := range tt.rejected {
+			if placeholder.Accepts(value) {
+				t.Errorf("%s accepts %q", tt.spec, value)
+			}
+		}
+	}
+}
+
+func TestRouteTemplate(t *testing.T) {
+	route, err := RouteTemplate("/video/{username}/{id:int}/{lang:en|fr}")
+	if err != nil {
+		t.Fatalf("RouteTemplate error: %v", err)
+	}
+	if expected := "/video/{username}/{id:[0-9]+}/{lang:(?:en|fr)}"; route != expected {
+		t.Errorf("RouteTemplate = %q, want %q", route, expected)
+	}
+
+	if _, err := RouteTemplate("/video/{id:(x)}"); err == nil {
+		t.Errorf("RouteTemplate of a capturing group expected an error")
+	}
+}
+
+func TestParsePlaceholdersBraces(t *testing.T) {
+	tests := map[string]bool{
+		"talks/{lang:en|fr}/{slug:[a-z-]+}": true,
+		"talks/{code:[a-z]{2,4}}":           false,
+		"talks/{code:[a-z]{2}}/{slug}":      false,
+		"talks/{code:x{2}y}":                false,
+		"talks/{{username}}":                false,
+		"talks/username}":                   false,
+	}
+
+	for template, valid := range tests {
+		_, err := ParsePlaceholders(template)
+		if valid && err != nil {
+			t.Errorf("ParsePlaceholders(%q) error: %v", template, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("ParsePlaceholders(%q) expected an error", template)
+		}
+	}
+}
+
+func TestHasPlaceholder(t *testing.T) {
+	if !HasPlaceholder("encoded/{quality:720p|1080p}/{FILENAME}", "quality") {
+		t.Errorf("HasPlaceholder did not find a constrained placeholder")
+	}
+	if HasPlaceholder("encoded/{quality_name}", "quality") {
+		t.Errorf("HasPlaceholder found a placeholder by its prefix")
+	}
+}
+
+func TestComputePlaceholders(t *testing.T) {
+	now := time.Date(2024, time.March, 9, 12, 0, 0, 0, time.UTC)
+	hashed := 0
+	contentHash := func() (string, error) {
+		hashed++
+		return "0123456789abcdef", nil
+	}
+
+	vars, err := ComputePlaceholders("encoded/{username}/{yyyy}/{mm}/{date}/{hash8}/{uuid}", map[string]string{"username": "john"}, now, contentHash)
+	if err != nil {
+		t.Fatalf("ComputePlaceholders error: %v", err)
+	}
+	expected := map[string]string{"username": "john", "yyyy": "2024", "mm": "03", "date": "2024-03-09", "hash8": "01234567", "uuid": vars["uuid"]}
+	if !maps.Equal(vars, expected) {
+		t.Errorf("ComputePlaceholders = %v, want %v", vars, expected)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(vars["uuid"]) {
+		t.Errorf("uuid = %q, want a version 4 UUID", vars["uuid"])
+	}
+
+	// The values already known are kept, and the source is only hashed when needed
+	vars, err = ComputePlaceholders("encoded/{yyyy}", map[string]string{"yyyy": "2023"}, now, contentHash)
+	if err != nil || vars["yyyy"] != "2023" || hashed != 1 {
+		t.Errorf("ComputePlaceholders = %v, %v, hashed %d times, want the known year and a single hash", vars, err, hashed)
+	}
+
+	failure := errors.New("unreadable")
+	if _, err := ComputePlaceholders("encoded/{hash8}", nil, now, func() (string, error) { return "", failure }); !errors.Is(err, failure) {
+		t.Errorf("ComputePlaceholders error = %v, want %v", err, failure)
+	}
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the binary multiples accepted by ParseSize
+var sizeUnits = map[string]float64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// ParseSize converts a size such as "500M", "50G", "1.5TB" or "1024" to bytes, the units are binary (1K = 1024 bytes)
+func ParseSize(size string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(size))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "IB"), "B")
+
+	unit := ""
+	if n := len(value); n > 0 {
+		if _, found := sizeUnits[value[n-1:]]; found {
+			unit = value[n-1:]
+			value = value[:n-1]
+		}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+
+	return int64(number * sizeUnits[unit]), nil
+}
+
+// FormatSize converts bytes to a readable size (e.g. "1.5G")
+func FormatSize(bytes int64) string {
+	for _, unit := range []string{"T", "G", "M", "K"} {
+		if multiple := sizeUnits[unit]; float64(bytes) >= multiple {
+			return strconv.FormatFloat(float64(bytes)/multiple, 'f', 1, 64) + unit
+		}
+	}
+	return strconv.FormatInt(bytes, 10)
+}
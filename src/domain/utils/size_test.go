@@ -0,0 +1,48 @@
+package utils
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size     string
+		expected int64
+		invalid  bool
+	}{
+		{size: "1024", expected: 1024},
+		{size: "500M", expected: 500 << 20},
+		{size: "50GB", expected: 50 << 30},
+		{size: "2GiB", expected: 2 << 30},
+		{size: "1.5t", expected: 3 << 39},
+		{size: "", invalid: true},
+		{size: "-1G", invalid: true},
+		{size: "10X", invalid: true},
+	}
+
+	for _, tt := range tests {
+		size, err := ParseSize(tt.size)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("ParseSize(%q) expected an error, got %d", tt.size, size)
+			}
+			continue
+		}
+		if err != nil || size != tt.expected {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", tt.size, size, err, tt.expected)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{
+		512:      "512",
+		1536:     "1.5K",
+		50 << 30: "50.0G",
+		3 << 39:  "1.5T",
+	}
+
+	for bytes, expected := range tests {
+		if formatted := FormatSize(bytes); formatted != expected {
+			t.Errorf("FormatSize(%d) = %q, want %q", bytes, formatted, expected)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"strings"
+)
+
+// transliterations replaces the accented latin letters with their plain letters before slugifying
+var transliterations = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a", "æ", "ae",
+	"À", "A", "Á", "A", "Â", "A", "Ã", "A", "Ä", "A", "Å", "A", "Æ", "AE",
+	"ç", "c", "Ç", "C", "ñ", "n", "Ñ", "N", "ß", "ss",
+	"è", "e", "é", "e", "ê", "e", "ë", "e", "È", "E", "É", "E", "Ê", "E", "Ë", "E",
+	"ì", "i", "í", "i", "î", "i", "ï", "i", "Ì", "I", "Í", "I", "Î", "I", "Ï", "I",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ø", "o", "œ", "oe",
+	"Ò", "O", "Ó", "O", "Ô", "O", "Õ", "O", "Ö", "O", "Ø", "O", "Œ", "OE",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u", "Ù", "U", "Ú", "U", "Û", "U", "Ü", "U",
+	"ý", "y", "ÿ", "y", "Ý", "Y",
+)
+
+// Slugify returns a value made of the characters accepted in the templated paths (a-z, A-Z, 0-9, _ and -):
+// the accented letters lose their accents, and every run of other characters, hyphens and dots included, becomes a single hyphen.
+// For example "My Talk (2024)" becomes "My-Talk-2024". An empty value is returned when no character is kept.
+func Slugify(value string) string {
+	var slug strings.Builder
+	separated := false
+	for _, r := range transliterations.Replace(value) {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			slug.WriteRune(r)
+			separated = false
+		} else if !separated {
+			slug.WriteRune('-')
+			separated = true
+		}
+	}
+	return strings.Trim(slug.String(), "-")
+}
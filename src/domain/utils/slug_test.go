@@ -0,0 +1,22 @@
+package utils
+
+import "testing"
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"movie":            "movie",
+		"My Talk (2024)":   "My-Talk-2024",
+		"Café Olé":         "Cafe-Ole",
+		"a -- b":           "a-b",
+		"v1.2...final":     "v1-2-final",
+		"  _draft_  ":      "_draft_",
+		"../../etc/passwd": "etc-passwd",
+		"日本語":              "",
+	}
+
+	for value, expected := range tests {
+		if slug := Slugify(value); slug != expected {
+			t.Errorf("Slugify(%q) = %q, want %q", value, slug, expected)
+		}
+	}
+}
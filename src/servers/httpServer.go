@@ -11,23 +11,35 @@ import (
 	"Theatrum/adapters/driver/http/handlers"
 	"Theatrum/adapters/driver/ports"
 	"Theatrum/constants"
+	"Theatrum/domain/jobs"
 	"Theatrum/domain/services"
+	"Theatrum/domain/utils"
 )
 
 // HttpServer implements the HttpPort interface
 type HttpServer struct {
 	applicationService *services.ApplicationService
 	streamService     *services.StreamService
+	encodeQueue       *jobs.EncodeJobQueue
+	videoDetector     *jobs.VideoUnencodedDetector
+	ladderDetector    *jobs.LadderChangeDetector
+	quotaService      *services.QuotaService
+	uploadService     *services.UploadService
 	server            *http.Server
 }
 
 // Verify interface implementation
 var _ ports.HttpPort = (*HttpServer)(nil)
 
-func NewHttpServer(applicationService *services.ApplicationService, streamService *services.StreamService) ports.HttpPort {
+func NewHttpServer(applicationService *services.ApplicationService, streamService *services.StreamService, encodeQueue *jobs.EncodeJobQueue, videoDetector *jobs.VideoUnencodedDetector, ladderDetector *jobs.LadderChangeDetector, quotaService *services.QuotaService, uploadService *services.UploadService) ports.HttpPort {
 	return &HttpServer{
 		applicationService: applicationService,
 		streamService:     streamService,
+		encodeQueue:       encodeQueue,
+		videoDetector:     videoDetector,
+		ladderDetector:    ladderDetector,
+		quotaService:      quotaService,
+		uploadService:     uploadService,
 	}
 }
 
@@ -42,14 +54,44 @@ func (s *HttpServer) BuildRouter() *mux.Router {
 		r.Handle("/"+playlistPath, handlers.NewAllStreamsPlaylistHandler(s.applicationService, s.streamService)).Methods("GET")
 	}
 
+	// Handle the API, the jobs are managed with an API token
+	apiRouter := r.PathPrefix(constants.ApiPathPrefix).Subrouter()
+	adminRouter := apiRouter.NewRoute().Subrouter()
+	adminRouter.Use(handlers.NewApiAuthMiddleware(s.applicationService))
+	jobsHandler := handlers.NewJobsHandler(s.encodeQueue, s.videoDetector, s.ladderDetector)
+	adminRouter.HandleFunc("/jobs", jobsHandler.List).Methods("GET")
+	adminRouter.HandleFunc("/jobs", jobsHandler.Create).Methods("POST")
+	adminRouter.HandleFunc("/jobs/failed", jobsHandler.ListFailed).Methods("GET")
+	adminRouter.HandleFunc("/jobs/reencode", jobsHandler.Reencode).Methods("POST")
+	adminRouter.HandleFunc("/jobs/{id}", jobsHandler.Get).Methods("GET")
+	adminRouter.HandleFunc("/jobs/{id}/cancel", jobsHandler.Cancel).Methods("POST")
+	adminRouter.HandleFunc("/jobs/{id}/retry", jobsHandler.Retry).Methods("POST")
+	adminRouter.HandleFunc("/jobs/{id}/priority", jobsHandler.SetPriority).Methods("PUT")
+	adminRouter.Handle("/usage", handlers.NewUsageHandler(s.quotaService, s.encodeQueue)).Methods("GET")
+
+	// Handle the resumable uploads
+	if s.applicationService.GetApplication().Uploads.Enabled {
+		uploadHandler := handlers.NewUploadHandler(s.uploadService, s.videoDetector)
+		apiRouter.HandleFunc("/uploads", uploadHandler.Options).Methods("OPTIONS")
+		apiRouter.HandleFunc("/uploads", uploadHandler.Create).Methods("POST")
+		apiRouter.HandleFunc("/uploads/{id}", uploadHandler.Head).Methods("HEAD")
+		apiRouter.HandleFunc("/uploads/{id}", uploadHandler.Patch).Methods("PATCH")
+		apiRouter.HandleFunc("/uploads/{id}", uploadHandler.Delete).Methods("DELETE")
+	}
+
 	channels := *s.applicationService.GetChannels()
 
 	// Handle all channels
 	for path, channel := range channels {
 		log.Printf("Registering channel: %s -> %s", path, channel.Path)
 		
-		// Create a subrouter for this channel
-		channelRouter := r.PathPrefix(path).Subrouter()
+		// Create a subrouter for this channel, its placeholders only match the values accepted by their constraints
+		route, err := utils.RouteTemplate(channel.OutputRoute(path))
+		if err != nil {
+			log.Printf("Error registering channel %s: %v", path, err)
+			continue
+		}
+		channelRouter := r.PathPrefix(route).Subrouter()
 		// Create the stream handler
 		handler := handlers.NewStreamHandler(&channel, s.streamService, s.applicationService)
 		
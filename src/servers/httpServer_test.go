@@ -0,0 +1,445 @@
+package servers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	boltJobStoreRepository "Theatrum/adapters/driven/boltJobStore/repositories"
+	fileAccessRepository "Theatrum/adapters/driven/fileAccess/repositories"
+	fileUploadStoreRepository "Theatrum/adapters/driven/fileUploadStore/repositories"
+	s3StorageRepository "Theatrum/adapters/driven/s3Storage/repositories"
+	"Theatrum/constants"
+	"Theatrum/domain/jobs"
+	"Theatrum/domain/models"
+	"Theatrum/domain/repositories"
+	"Theatrum/domain/services"
+)
+
+// testApiToken is the token of the API of the test router
+const testApiToken = "0123456789abcdef"
+
+// newTestRouter builds the router of two channels over a temporary data directory, whose links lead to a secret
+// master playlist outside of it
+func newTestRouter(t testing.TB) http.Handler {
+	t.Helper()
+	return newTestRouterOver(t, func() (repositories.StoragePort, error) {
+		return fileAccessRepository.NewFileAccess()
+	})
+}
+
+// newTestRouterOver builds the router of newTestRouter over the storage returned by newStorage, called once the
+// files are written
+func newTestRouterOver(t testing.TB, newStorage func() (repositories.StoragePort, error)) http.Handler {
+	t.Helper()
+
+	dir := t.TempDir()
+	videoDir, frontendDir := constants.VideoDir, constants.FrontendDir
+	constants.VideoDir = filepath.ToSlash(filepath.Join(dir, "data"))
+	constants.FrontendDir = filepath.ToSlash(filepath.Join(dir, "frontend"))
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() {
+		constants.VideoDir, constants.FrontendDir = videoDir, frontendDir
+		log.SetOutput(os.Stderr)
+	})
+
+	files := map[string]string{
+		"master.m3u8":                             "secret",
+		"data/encoded/john/master.m3u8":           "#EXTM3U master",
+		"data/encoded/john/720p/index.m3u8":       "#EXTM3U 720p",
+		"data/talks/42/fr/default/index.m3u8":     "#EXTM3U talk",
+		"data/records/john/movie/master.m3u8":     "#EXTM3U movie",
+		"data/records/john/movie/720p/index.m3u8": "#EXTM3U movie 720p",
+	}
+	for file, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"data/encoded/john/720p/escape.m3u8": filepath.Join(dir, "master.m3u8"),
+		"data/encoded/mallory":               dir,
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Skipf("symbolic links are not supported: %v", err)
+		}
+	}
+
+	storage, err := newStorage()
+	if err != nil {
+		t.Fatalf("storage error: %v", err)
+	}
+	channels := map[string]models.Stream{
+		"/video/{username}": {
+			Type:      models.StreamTypeVideoEncoded,
+			Path:      "encoded/{username}",
+			Qualities: map[string]models.Quality{"720p": {}},
+		},
+		"/records/{username}": {
+			Type:           models.StreamTypeVideoUnEncoded,
+			VideoInputPath: "raw/{username}",
+			Path:           "records/{username}",
+			Qualities:      map[string]models.Quality{"720p": {}},
+		},
+		"/talks/{id:int}/{lang:en|fr}": {
+			Type: models.StreamTypeVideoEncoded,
+			Path: "talks/{id:int}/{lang:en|fr}",
+		},
+	}
+	jobStore, err := boltJobStoreRepository.NewBoltJobStore(filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewBoltJobStore error: %v", err)
+	}
+	t.Cleanup(func() { jobStore.Close() })
+
+	templateService := services.NewPathTemplateService()
+	application := &models.Application{
+		Api: models.Api{Tokens: []models.ApiToken{{Name: "admin", Token: testApiToken}}},
+		Uploads: models.Uploads{Enabled: true, ExpireAfter: time.Hour, Tokens: []models.UploadToken{
+			{Name: "john", Token: testUploadTokens["john"], Vars: map[string]string{"username": "john"}},
+			{Name: "jane", Token: testUploadTokens["jane"], Vars: map[string]string{"username": "jane"}},
+		}},
+	}
+	appService := services.NewApplicationService(application, &models.Server{}, &channels, nil, templateService)
+	inventory := services.NewInventoryService(&channels, storage)
+	quotaService := services.NewQuotaService(appService, storage, inventory)
+	encodeQueue := jobs.NewEncodeJobQueue(appService, nil, nil, nil, storage, jobStore, models.Encoding{})
+	uploadStore := fileUploadStoreRepository.NewFileUploadStore(filepath.Join(dir, "uploads"))
+	server := &HttpServer{
+		applicationService: appService,
+		streamService:      services.NewStreamService(templateService, storage),
+		encodeQueue:        encodeQueue,
+		videoDetector: jobs.NewVideoUnencodedDetector(appService, encodeQueue, storage, nil, templateService,
+			services.NewSourceValidationService(storage, probeEncoder{}), services.NewManifestService(storage, nil), inventory, quotaService),
+		quotaService:  quotaService,
+		uploadService: services.NewUploadService(appService, templateService, storage, uploadStore, inventory, quotaService),
+	}
+	return server.BuildRouter()
+}
+
+// testUploadTokens are the upload tokens of the test router by owner
+var testUploadTokens = map[string]string{"john": "john-0123456789", "jane": "jane-0123456789"}
+
+// probeEncoder finds a video in every source, it is only used to validate the uploaded sources
+type probeEncoder struct{}
+
+var _ repositories.EncoderPort = probeEncoder{}
+
+func (probeEncoder) EncodeVideo(ctx context.Context, inputPath string, outputPath string, qualities map[string]models.Quality, distribution models.Distribution, options models.EncodeOptions) error {
+	return errors.New("not an encoder")
+}
+
+func (probeEncoder) ProbeVideo(inputPath string) (models.MediaInfo, error) {
+	return models.MediaInfo{Duration: 60, Video: &models.VideoStreamInfo{}}, nil
+}
+
+func (probeEncoder) CheckDecode(inputPath string, seconds int) error {
+	return nil
+}
+
+func (probeEncoder) AnalyzeComplexity(inputPath string, qualities map[string]models.Quality, crf int, sampleSeconds int) (map[string]int64, error) {
+	return nil, errors.New("not an encoder")
+}
+
+func (probeEncoder) MeasureQuality(sourcePath string, variantPath string, quality models.Quality, vmaf bool) (models.RenditionQuality, error) {
+	return models.RenditionQuality{}, errors.New("not an encoder")
+}
+
+func (probeEncoder) Version() (string, error) {
+	return "probe", nil
+}
+
+func (probeEncoder) Suspend(jobID string) error {
+	return nil
+}
+
+func (probeEncoder) Resume(jobID string) error {
+	return nil
+}
+
+func serve(router http.Handler, target string) (*httptest.ResponseRecorder, bool) {
+	request, err := http.NewRequest(http.MethodGet, "http://localhost"+target, nil)
+	if err != nil {
+		return nil, false
+	}
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	return response, true
+}
+
+func TestRouterChannels(t *testing.T) {
+	router := newTestRouter(t)
+
+	tests := map[string]int{
+		"/video/john/master.m3u8":             http.StatusOK,
+		"/records/john/movie/master.m3u8":     http.StatusOK,
+		"/records/john/movie/720p/index.m3u8": http.StatusOK,
+		"/records/john/master.m3u8":           http.StatusNotFound,
+		"/video/john/720p/index.m3u8":         http.StatusOK,
+		"/talks/42/fr/index.m3u8":             http.StatusOK,
+		"/talks/abc/fr/index.m3u8":            http.StatusNotFound,
+		"/talks/42/es/index.m3u8":             http.StatusNotFound,
+		"/video/john/720p/escape.m3u8":        http.StatusNotFound,
+		"/video/mallory/master.m3u8":          http.StatusNotFound,
+		"/video/john/720p/missing.m3u8":       http.StatusNotFound,
+		"/video/john/../../master.m3u8":       http.StatusMovedPermanently,
+	}
+	for target, expected := range tests {
+		response, _ := serve(router, target)
+		if response.Code != expected {
+			t.Errorf("GET %s = %d, want %d", target, response.Code, expected)
+		}
+	}
+}
+
+func TestRouterApiAuth(t *testing.T) {
+	router := newTestRouter(t)
+
+	tests := []struct {
+		name          string
+		method        string
+		target        string
+		authorization string
+		expected      int
+	}{
+		{name: "jobs without token", method: http.MethodGet, target: "/api/jobs", expected: http.StatusUnauthorized},
+		{name: "jobs with an unknown token", method: http.MethodGet, target: "/api/jobs", authorization: "Bearer fedcba9876543210", expected: http.StatusUnauthorized},
+		{name: "jobs with the token in another scheme", method: http.MethodGet, target: "/api/jobs", authorization: "Basic " + testApiToken, expected: http.StatusUnauthorized},
+		{name: "job cancel without token", method: http.MethodPost, target: "/api/jobs/42/cancel", expected: http.StatusUnauthorized},
+		{name: "jobs with the token", method: http.MethodGet, target: "/api/jobs", authorization: "Bearer " + testApiToken, expected: http.StatusOK},
+		{name: "unknown job with the token", method: http.MethodGet, target: "/api/jobs/42", authorization: "Bearer " + testApiToken, expected: http.StatusNotFound},
+		{name: "usage without token", method: http.MethodGet, target: "/api/usage", expected: http.StatusUnauthorized},
+		{name: "usage with the token", method: http.MethodGet, target: "/api/usage", authorization: "Bearer " + testApiToken, expected: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, "http://localhost"+tt.target, nil)
+			if tt.authorization != "" {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+
+			if response.Code != tt.expected {
+				t.Errorf("%s %s = %d, expected %d", tt.method, tt.target, response.Code, tt.expected)
+			}
+			if tt.expected == http.StatusUnauthorized && response.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, expected Bearer", response.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+// newFakeS3Storage returns the S3 storage of a fake server, which serves the files of the data directory as the
+// objects of its bucket. It only answers the requests reading the objects.
+func newFakeS3Storage(t testing.TB) (repositories.StoragePort, error) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/theatrum"), "/")
+		if key == "" {
+			return // The bucket exists
+		}
+
+		file, err := os.Open(filepath.Join(constants.VideoDir, filepath.FromSlash(key)))
+		var info os.FileInfo
+		if err == nil {
+			defer file.Close()
+			info, err = file.Stat()
+		}
+		if err != nil || info.IsDir() {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>")
+			return
+		}
+		w.Header().Set("ETag", `"`+strconv.FormatInt(info.ModTime().UnixNano(), 16)+`"`)
+		http.ServeContent(w, r, key, info.ModTime(), file)
+	}))
+	t.Cleanup(server.Close)
+
+	return s3StorageRepository.NewS3Storage(models.S3Storage{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Bucket:    "theatrum",
+		Region:    "us-east-1",
+		AccessKey: "theatrum",
+		SecretKey: "theatrum-secret",
+	})
+}
+
+func TestRouterRangeAndConditionalRequests(t *testing.T) {
+	storages := map[string]func(t testing.TB) (repositories.StoragePort, error){
+		"local": func(t testing.TB) (repositories.StoragePort, error) { return fileAccessRepository.NewFileAccess() },
+		"s3":    newFakeS3Storage,
+	}
+	modTime := time.Date(2026, time.January, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name                 string
+		headers              map[string]string
+		expected             int
+		expectedBody         string
+		expectedContentRange string
+	}{
+		{name: "whole file", expected: http.StatusOK, expectedBody: "#EXTM3U 720p"},
+		{name: "range", headers: map[string]string{"Range": "bytes=0-6"}, expected: http.StatusPartialContent, expectedBody: "#EXTM3U", expectedContentRange: "bytes 0-6/12"},
+		{name: "range to the end", headers: map[string]string{"Range": "bytes=8-"}, expected: http.StatusPartialContent, expectedBody: "720p", expectedContentRange: "bytes 8-11/12"},
+		{name: "range after the end", headers: map[string]string{"Range": "bytes=20-"}, expected: http.StatusRequestedRangeNotSatisfiable, expectedContentRange: "bytes */12"},
+		{name: "not modified", headers: map[string]string{"If-Modified-Since": modTime.Format(http.TimeFormat)}, expected: http.StatusNotModified},
+		{name: "modified", headers: map[string]string{"If-Modified-Since": modTime.Add(-time.Hour).Format(http.TimeFormat)}, expected: http.StatusOK, expectedBody: "#EXTM3U 720p"},
+	}
+
+	for storageName, newStorage := range storages {
+		t.Run(storageName, func(t *testing.T) {
+			router := newTestRouterOver(t, func() (repositories.StoragePort, error) {
+				if err := os.Chtimes(filepath.Join(constants.VideoDir, "encoded/john/720p/index.m3u8"), modTime, modTime); err != nil {
+					return nil, err
+				}
+				return newStorage(t)
+			})
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					request := httptest.NewRequest(http.MethodGet, "http://localhost/video/john/720p/index.m3u8", nil)
+					for name, value := range tt.headers {
+						request.Header.Set(name, value)
+					}
+					response := httptest.NewRecorder()
+					router.ServeHTTP(response, request)
+
+					if response.Code != tt.expected {
+						t.Fatalf("GET = %d, expected %d", response.Code, tt.expected)
+					}
+					if tt.expectedBody != "" && response.Body.String() != tt.expectedBody {
+						t.Errorf("body = %q, expected %q", response.Body.String(), tt.expectedBody)
+					}
+					if contentRange := response.Header().Get("Content-Range"); contentRange != tt.expectedContentRange {
+						t.Errorf("Content-Range = %q, expected %q", contentRange, tt.expectedContentRange)
+					}
+					// The errors are not cached
+					if lastModified := response.Header().Get("Last-Modified"); tt.expected < http.StatusBadRequest && lastModified != modTime.Format(http.TimeFormat) {
+						t.Errorf("Last-Modified = %q, expected %q", lastModified, modTime.Format(http.TimeFormat))
+					}
+				})
+			}
+		})
+	}
+}
+
+// tusRequest sends a request of the upload protocol with the upload token of an owner
+func tusRequest(router http.Handler, method string, target string, owner string, headers map[string]string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, "http://localhost"+target, strings.NewReader(body))
+	request.Header.Set("Tus-Resumable", "1.0.0")
+	request.Header.Set("Authorization", "Bearer "+testUploadTokens[owner])
+	if method == http.MethodPatch {
+		request.Header.Set("Content-Type", "application/offset+octet-stream")
+	}
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	return response
+}
+
+func TestRouterUploads(t *testing.T) {
+	router := newTestRouter(t)
+	source := "\x00\x00\x00\x18ftypisom-movie-data"
+	metadata := "channel " + base64.StdEncoding.EncodeToString([]byte("/records/{username}")) +
+		",filename " + base64.StdEncoding.EncodeToString([]byte("movie.mp4"))
+	create := func() string {
+		t.Helper()
+		response := tusRequest(router, http.MethodPost, "/api/uploads", "john",
+			map[string]string{"Upload-Length": strconv.Itoa(len(source)), "Upload-Metadata": metadata}, "")
+		if response.Code != http.StatusCreated {
+			t.Fatalf("POST /api/uploads = %d, expected %d: %s", response.Code, http.StatusCreated, response.Body)
+		}
+		return response.Header().Get("Location")
+	}
+	patch := func(upload string, owner string, offset int, body string) *httptest.ResponseRecorder {
+		return tusRequest(router, http.MethodPatch, upload, owner, map[string]string{"Upload-Offset": strconv.Itoa(offset)}, body)
+	}
+
+	upload := create()
+	steps := []struct {
+		name           string
+		response       *httptest.ResponseRecorder
+		expected       int
+		expectedOffset string
+	}{
+		{name: "first chunk", response: patch(upload, "john", 0, source[:8]), expected: http.StatusNoContent, expectedOffset: "8"},
+		{name: "chunk not starting at the offset", response: patch(upload, "john", 4, source[4:]), expected: http.StatusConflict},
+		{name: "offset of the upload of another token", response: tusRequest(router, http.MethodHead, upload, "jane", nil, ""), expected: http.StatusNotFound},
+		{name: "chunk of the upload of another token", response: patch(upload, "jane", 8, source[8:]), expected: http.StatusNotFound},
+		{name: "offset to resume from", response: tusRequest(router, http.MethodHead, upload, "john", nil, ""), expected: http.StatusOK, expectedOffset: "8"},
+		{name: "last chunk", response: patch(upload, "john", 8, source[8:]), expected: http.StatusNoContent, expectedOffset: strconv.Itoa(len(source))},
+		{name: "complete upload", response: tusRequest(router, http.MethodHead, upload, "john", nil, ""), expected: http.StatusNotFound},
+		{name: "more than the announced bytes", response: patch(create(), "john", 0, source+"-and-more"), expected: http.StatusRequestEntityTooLarge},
+	}
+	for _, step := range steps {
+		if step.response.Code != step.expected {
+			t.Errorf("%s = %d, expected %d: %s", step.name, step.response.Code, step.expected, step.response.Body)
+		}
+		if offset := step.response.Header().Get("Upload-Offset"); step.expectedOffset != "" && offset != step.expectedOffset {
+			t.Errorf("%s Upload-Offset = %s, expected %s", step.name, offset, step.expectedOffset)
+		}
+	}
+
+	// The complete upload is moved to the input path of its owner and queued for encoding
+	if data, err := os.ReadFile(filepath.Join(constants.VideoDir, "raw/john/movie.mp4")); err != nil || string(data) != source {
+		t.Errorf("uploaded source = %q, %v, expected the uploaded bytes", data, err)
+	}
+	jobID := steps[5].response.Header().Get("Theatrum-Job-Id")
+	if jobID == "" {
+		t.Fatal("Theatrum-Job-Id is empty, expected the job of the upload")
+	}
+	request := httptest.NewRequest(http.MethodGet, "http://localhost/api/jobs/"+jobID, nil)
+	request.Header.Set("Authorization", "Bearer "+testApiToken)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), "raw/john/movie.mp4") {
+		t.Errorf("GET /api/jobs/%s = %d %s, expected the job of the uploaded source", jobID, response.Code, response.Body)
+	}
+}
+
+// FuzzRouter checks that no URL of a channel reads a file outside of the data directory
+func FuzzRouter(f *testing.F) {
+	for _, seed := range []string{
+		"/video/john/master.m3u8", "/video/john/720p/escape.m3u8", "/video/mallory/master.m3u8", "/video/john/../../master.m3u8",
+		"/video/%2e%2e/master.m3u8", "/video/john/720p/..%2f..%2f..%2fmaster.m3u8", "/talks/42/fr/index.m3u8", "/talks/1/en/../../../master.m3u8",
+	} {
+		f.Add(seed)
+	}
+
+	router := newTestRouter(f)
+	f.Fuzz(func(t *testing.T, target string) {
+		// The API needs the other services, only the channels are fuzzed
+		if !strings.HasPrefix(target, "/video/") && !strings.HasPrefix(target, "/talks/") {
+			return
+		}
+
+		response, ok := serve(router, target)
+		if !ok {
+			return
+		}
+		if strings.Contains(response.Body.String(), "secret") {
+			t.Fatalf("GET %s served a file outside of the data directory", target)
+		}
+		if response.Code == http.StatusOK && !strings.HasPrefix(response.Body.String(), "#EXTM3U") {
+			t.Errorf("GET %s = %q, want a playlist", target, response.Body.String())
+		}
+	})
+}